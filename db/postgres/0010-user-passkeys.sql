@@ -0,0 +1,20 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add user passkeys (WebAuthn credentials) table
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_user_passkeys (
+    id            uuid primary key,                  -- Unique record ID
+    user_id       uuid                     not null, -- Reference to the user who owns the passkey
+    credential_id varchar(1366)            not null, -- Base64url-encoded credential ID, as issued by the authenticator
+    public_key    bytea                    not null, -- COSE-encoded credential public key
+    sign_count    bigint        default 0  not null, -- Last seen signature counter value
+    name          varchar(63)   default '' not null, -- User-given passkey name
+    ts_created    timestamp                not null, -- When the passkey was registered
+    ts_last_used  timestamp,                         -- When the passkey was last used to log in
+    -- Constraints
+    constraint uk_user_passkeys_credential_id unique (credential_id),
+    constraint fk_user_passkeys_user_id       foreign key (user_id) references cm_users(id) on delete cascade
+);
+
+-- Indices
+create index idx_user_passkeys_user_id on cm_user_passkeys(user_id);
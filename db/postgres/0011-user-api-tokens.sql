@@ -0,0 +1,20 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add personal API tokens table
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_user_api_tokens (
+    id           uuid primary key,                  -- Unique record ID
+    user_id      uuid                     not null, -- Reference to the user who owns the token
+    name         varchar(63)   default '' not null, -- User-given token name
+    value_hash   varchar(64)              not null, -- SHA-256 hash of the token value, as a hex string
+    scopes       varchar(255)  default '' not null, -- Comma-separated list of scopes granted to the token
+    ts_created   timestamp                not null, -- When the token was created
+    ts_expires   timestamp,                         -- When the token expires, null if never
+    ts_last_used timestamp,                         -- When the token was last used
+    -- Constraints
+    constraint uk_user_api_tokens_value_hash unique (value_hash),
+    constraint fk_user_api_tokens_user_id    foreign key (user_id) references cm_users(id) on delete cascade
+);
+
+-- Indices
+create index idx_user_api_tokens_user_id on cm_user_api_tokens(user_id);
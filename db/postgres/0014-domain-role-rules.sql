@@ -0,0 +1,14 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add domain role mapping rules table
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_domain_role_rules (
+    domain_id uuid          not null, -- Reference to the domain the rule belongs to
+    seq       integer       not null, -- Rule's position in the domain's rule list; the first matching rule wins
+    claim     varchar(63)   not null, -- Name of the identity claim to match, or the special "email_domain"
+    value     varchar(255)  not null, -- Value the claim must have, or "*" to match any value
+    role      varchar(20)   not null, -- Role to assign to a matching user: 'moderator', 'commenter', 'readonly'
+    -- Constraints
+    constraint pk_domain_role_rules           primary key (domain_id, seq),
+    constraint fk_domain_role_rules_domain_id foreign key (domain_id) references cm_domains(id) on delete cascade
+);
@@ -0,0 +1,22 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add domain invitations table
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_domain_invitations (
+    id           uuid primary key,          -- Unique record ID
+    domain_id    uuid             not null, -- Reference to the domain the user is invited to
+    email        varchar(254)     not null, -- Email of the invited user
+    role         varchar(20)      not null, -- Role to grant the user on the domain: 'owner', 'moderator', 'commenter', 'readonly'
+    token_value  char(64)         not null, -- Reference to the token sent to the invited user
+    ts_created   timestamp        not null, -- When the record was created
+    user_created uuid,                      -- Reference to the user who sent the invitation
+    ts_expires   timestamp        not null, -- When the invitation expires
+    -- Constraints
+    constraint fk_domain_invitations_domain_id    foreign key (domain_id)    references cm_domains(id)   on delete cascade,
+    constraint fk_domain_invitations_token_value  foreign key (token_value)  references cm_tokens(value) on delete cascade,
+    constraint fk_domain_invitations_user_created foreign key (user_created) references cm_users(id)    on delete set null
+);
+
+-- Indices
+create index idx_domain_invitations_domain_id   on cm_domain_invitations(domain_id);
+create index idx_domain_invitations_token_value on cm_domain_invitations(token_value);
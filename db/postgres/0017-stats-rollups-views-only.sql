@@ -0,0 +1,6 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Remove comment counts from daily statistics rollups: comments are counted directly, since older comments can be
+-- imported, deleted, or moderated at any time
+------------------------------------------------------------------------------------------------------------------------
+
+alter table cm_stats_daily_pages drop column count_comments;
@@ -0,0 +1,5 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add the expected issuer and audience of SSO JWTs to domains
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_domains add column sso_jwt_issuer   varchar(2083) default '' not null; -- Expected "iss" claim of SSO JWTs
+alter table cm_domains add column sso_jwt_audience varchar(2083) default '' not null; -- Expected "aud" claim of SSO JWTs
@@ -0,0 +1,30 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add daily statistics rollup tables
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_stats_daily_pages (
+    page_id        uuid,                         -- Reference to the page and a part of the primary key
+    ts_day         timestamp,                    -- Start of the day (UTC) and a part of the primary key
+    count_views    integer   default 0 not null, -- Number of page views on the day
+    count_comments integer   default 0 not null, -- Number of (non-deleted) comments created on the day
+    -- Constraints
+    primary key (page_id, ts_day),
+    constraint fk_stats_daily_pages_page_id foreign key (page_id) references cm_domain_pages(id) on delete cascade
+);
+
+-- Indices
+create index idx_stats_daily_pages_ts_day on cm_stats_daily_pages(ts_day);
+
+create table cm_stats_daily_views (
+    page_id     uuid,                           -- Reference to the page and a part of the primary key
+    ts_day      timestamp,                      -- Start of the day (UTC) and a part of the primary key
+    dimension   varchar(32),                    -- Dimension (page view column name) and a part of the primary key
+    element     varchar(63),                    -- Dimension element and a part of the primary key
+    count_views integer     default 0 not null, -- Number of page views on the day with this element
+    -- Constraints
+    primary key (page_id, ts_day, dimension, element),
+    constraint fk_stats_daily_views_page_id foreign key (page_id) references cm_domain_pages(id) on delete cascade
+);
+
+-- Indices
+create index idx_stats_daily_views_ts_day on cm_stats_daily_views(ts_day);
@@ -0,0 +1,10 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add page view source columns
+------------------------------------------------------------------------------------------------------------------------
+
+alter table cm_domain_page_views add column ref_host     varchar(255) default '' not null; -- Host of the (external) page the visitor came from
+alter table cm_domain_page_views add column utm_source   varchar(255) default '' not null; -- Value of the utm_source landing page URL parameter
+alter table cm_domain_page_views add column utm_medium   varchar(255) default '' not null; -- Value of the utm_medium landing page URL parameter
+alter table cm_domain_page_views add column utm_campaign varchar(255) default '' not null; -- Value of the utm_campaign landing page URL parameter
+
+-- NB: SQLite doesn't enforce varchar lengths, so the element column in cm_stats_daily_views needs no enlarging
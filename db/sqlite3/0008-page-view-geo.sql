@@ -0,0 +1,6 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add page view geolocation columns
+------------------------------------------------------------------------------------------------------------------------
+
+alter table cm_domain_page_views add column region varchar(255) default '' not null; -- Region (first-level subdivision) of the visitor, as resolved by GeoIP
+alter table cm_domain_page_views add column city   varchar(255) default '' not null; -- City of the visitor, as resolved by GeoIP
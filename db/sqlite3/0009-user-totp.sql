@@ -0,0 +1,8 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add user TOTP (two-factor authentication) columns
+------------------------------------------------------------------------------------------------------------------------
+
+alter table cm_users add column totp_secret    varchar(64) default ''    not null; -- Base32-encoded TOTP secret, empty if not enrolled
+alter table cm_users add column totp_enabled   boolean     default false not null; -- Whether TOTP is enabled (enrolment has been confirmed with a valid code)
+alter table cm_users add column totp_last_step bigint      default 0     not null; -- Last accepted TOTP time step, to prevent code reuse
+alter table cm_users add column totp_recovery  text        default ''    not null; -- Space-separated SHA-256 hashes of unused recovery codes
@@ -0,0 +1,25 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add domain OIDC providers table
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_domain_oidc_providers (
+    id            uuid primary key,                    -- Unique record ID
+    domain_id     uuid                       not null, -- Reference to the domain the provider is registered for
+    name          varchar(63)                not null, -- Provider display name
+    url           varchar(2083)              not null, -- OIDC server URL
+    client_id     varchar(255)               not null, -- OIDC client ID
+    client_secret blob                       not null, -- OIDC client secret, encrypted with the server's encryption key
+    scopes        varchar(1024) default ''   not null, -- Space-separated list of additional scopes to request
+    is_enabled    boolean       default true not null, -- Whether the provider is available for login
+    ts_created    timestamp                  not null, -- When the record was created
+    user_created  uuid,                                -- Reference to the user who created the record
+    ts_updated    timestamp                  not null, -- When the record was last updated
+    -- Constraints
+    constraint fk_domain_oidc_providers_domain_id    foreign key (domain_id)    references cm_domains(id) on delete cascade,
+    constraint fk_domain_oidc_providers_user_created foreign key (user_created) references cm_users(id)   on delete set null
+);
+
+-- Indices
+create index idx_domain_oidc_providers_domain_id on cm_domain_oidc_providers(domain_id);
+
+-- NB: cm_users.federated_idp doesn't need to be enlarged as SQLite doesn't enforce varchar length
@@ -0,0 +1,4 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add JWT-based SSO verification keys to domains
+------------------------------------------------------------------------------------------------------------------------
+alter table cm_domains add column sso_jwt_keys text default '' not null; -- PEM-encoded public keys or JWKS document to verify SSO JWTs with. Empty means HMAC-based SSO
@@ -0,0 +1,26 @@
+------------------------------------------------------------------------------------------------------------------------
+-- Add user merge audit table
+------------------------------------------------------------------------------------------------------------------------
+
+create table cm_user_merges (
+    id                   uuid primary key,                  -- Unique record ID
+    ts_created           timestamp                not null, -- When the merge was performed
+    user_created         uuid,                              -- Reference to the user who performed the merge
+    target_user_id       uuid,                              -- Reference to the user the source account was merged into
+    source_user_id       uuid                     not null, -- ID of the merged (and deleted) source user
+    source_email         varchar(254)             not null, -- Email of the source user
+    source_name          varchar(63)              not null, -- Name of the source user
+    source_federated_idp varchar(64)  default ''  not null, -- Federated IdP ID of the source user, if any
+    source_federated_id  varchar(255) default ''  not null, -- Federated user ID of the source user, if any
+    count_comments       integer                  not null, -- Number of reassigned comment references
+    count_votes          integer                  not null, -- Number of reassigned votes
+    count_domain_users   integer                  not null, -- Number of reassigned or merged domain user records
+    count_sessions       integer                  not null, -- Number of reassigned sessions
+    count_attrs          integer                  not null, -- Number of reassigned attributes
+    -- Constraints
+    constraint fk_user_merges_user_created   foreign key (user_created)   references cm_users(id) on delete set null,
+    constraint fk_user_merges_target_user_id foreign key (target_user_id) references cm_users(id) on delete set null
+);
+
+-- Indices
+create index idx_user_merges_target_user_id on cm_user_merges(target_user_id);
@@ -181,9 +181,10 @@ export class ApiService {
      * @param email Commenter's email.
      * @param password Commenter's password.
      * @param host Host the commenter is signing in on.
+     * @param totpCode Optional two-factor authentication code.
      */
-    async authLogin(email: string, password: string, host: string): Promise<void> {
-        const r = await this.httpClient.post<ApiAuthLoginResponse>('embed/auth/login', {email, password, host});
+    async authLogin(email: string, password: string, host: string, totpCode?: string): Promise<void> {
+        const r = await this.httpClient.post<ApiAuthLoginResponse>('embed/auth/login', {email, password, host, totpCode});
         this.storeAuth(r.principal, r.sessionToken);
     }
 
@@ -276,9 +277,11 @@ export class ApiService {
      * Get a list of comments and commenters for the given host/path combination.
      * @param host Host the comments reside on.
      * @param path Path of the page the comments reside on.
+     * @param referrer Optional URL of the page the visitor came from.
+     * @param query Optional query string of the page URL.
      */
-    async commentList(host: string, path: string): Promise<ApiCommentListResponse> {
-        return this.httpClient.post<ApiCommentListResponse>('embed/comments', {host, path}, this.addAuth());
+    async commentList(host: string, path: string, referrer?: string, query?: string): Promise<ApiCommentListResponse> {
+        return this.httpClient.post<ApiCommentListResponse>('embed/comments', {host, path, referrer, query}, this.addAuth());
     }
 
     /**
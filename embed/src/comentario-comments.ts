@@ -13,6 +13,8 @@ import { WebSocketClient, WebSocketMessage } from './ws-client';
 import { I18nService } from './i18n';
 import { PopupBlockedDialog } from './popup-blocked-dialog';
 import { RssDialog } from './rss-dialog';
+import { TotpDialog } from './totp-dialog';
+import { HttpClientError } from './http-client';
 
 /**
  * Web component implementing the <comentario-comments> element.
@@ -611,6 +613,10 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
             case LoginChoice.federatedAuth:
                 return this.oAuthLogin(data.idp!);
 
+            // Passkey auth
+            case LoginChoice.passkey:
+                return this.passkeyLogin();
+
             // Commenting without registration
             case LoginChoice.unregistered:
                 this.localConfig.setUnregisteredCommenting(true, data.userName);
@@ -625,8 +631,33 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
      * @param password User's password.
      */
     private async authenticateLocally(email: string, password: string): Promise<void> {
-        // Log the user in
-        await this.apiService.authLogin(email, password, this.location.host);
+        // Log the user in, handling errors ourselves
+        let totpCode: string | undefined;
+        this.ignoreApiErrors = true;
+        try {
+            await this.apiService.authLogin(email, password, this.location.host);
+
+        } catch (e) {
+            // Report any error other than a request for a two-factor authentication code
+            if (!(e instanceof HttpClientError) || e.errorId !== 'totp-code-required') {
+                this.handleApiError(e);
+                throw e;
+            }
+
+            // Ask the user for the code, and give up if they cancel
+            totpCode = await TotpDialog.run(this.i18n.t, this.root, {ref: this.profileBar!.btnLogin!, placement: 'bottom-end'});
+            if (!totpCode) {
+                return;
+            }
+
+        } finally {
+            this.ignoreApiErrors = false;
+        }
+
+        // Retry with the code, if requested
+        if (totpCode) {
+            await this.apiService.authLogin(email, password, this.location.host, totpCode);
+        }
 
         // Refresh the auth status
         await this.updateAuthStatus();
@@ -669,6 +700,30 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
         }
     }
 
+    /**
+     * Initiate a passkey login by opening a new browser popup window on the Comentario origin, which is required for
+     * the passkey to be usable. Return a promise that resolves as soon as the user is authenticated, or rejects when
+     * the authentication has been unsuccessful.
+     */
+    private async passkeyLogin(): Promise<void> {
+        // Request a new, anonymous login token
+        const token = await this.apiService.authNewLoginToken(true);
+
+        // Open a popup window that runs the passkey ceremony
+        await this.loginOAuthPopup(`${this.origin}/en/auth/passkey?${new URLSearchParams({token}).toString()}`);
+
+        // If the authentication was successful, the token is supposed to be bound to the user now. Use it for login
+        await this.apiService.authLoginToken(token, this.location.host);
+
+        // Refresh the auth status
+        await this.updateAuthStatus();
+
+        // If authenticated, reload all comments and page data
+        if (this.principal) {
+            await this.reload();
+        }
+    }
+
     /**
      * Try to authenticate the user with non-interactive SSO.
      */
@@ -763,7 +818,7 @@ export class ComentarioComments extends ComentarioBase implements WebComponent {
         // Retrieve page settings and a comment list from the backend
         let r: ApiCommentListResponse;
         try {
-            r = await this.apiService.commentList(this.location.host, this.pagePath);
+            r = await this.apiService.commentList(this.location.host, this.pagePath, document.referrer, this.location.search);
 
             // Store page- and backend-related properties
             this.pageInfo = new PageInfo(r.pageInfo);
@@ -6,6 +6,17 @@ export class HttpClientError {
         readonly message: string,
         readonly response: any,
     ) {}
+
+    /**
+     * ID of the error returned by the server, if any.
+     */
+    get errorId(): string | undefined {
+        try {
+            return typeof this.response === 'string' ? JSON.parse(this.response)?.id : undefined;
+        } catch {
+            return undefined;
+        }
+    }
 }
 
 export type HttpHeaders = Record<string, string>;
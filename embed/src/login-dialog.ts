@@ -81,7 +81,7 @@ export class LoginDialog extends Dialog {
                                     UIToolkit.button(
                                         idp.name,
                                         () => this.dismissWith(LoginChoice.federatedAuth, idp.id),
-                                        `btn-${idp.id.startsWith('oidc:') ? 'dark' : idp.id}`)) ??
+                                        `btn-${idp.id === 'ldap' || idp.id.startsWith('oidc:') || idp.id.startsWith('doidc:') || idp.id.startsWith('saml:') ? 'dark' : idp.id}`)) ??
                                 [])));
         }
 
@@ -102,6 +102,10 @@ export class LoginDialog extends Dialog {
                         UIToolkit.div('input-group').append(this._email),
                         // Password
                         UIToolkit.div('input-group').append(this._pwd, UIToolkit.submit(this.t('actionLogIn'), true)),
+                        // Passkey button, if the browser supports passkeys
+                        !!window.PublicKeyCredential &&
+                            UIToolkit.div('dialog-centered')
+                                .append(UIToolkit.button(this.t('actionLogInPasskey'), () => this.dismissWith(LoginChoice.passkey), 'btn-secondary')),
                         // Forgot password link
                         UIToolkit.div('dialog-centered')
                             .append(
@@ -189,6 +189,8 @@ export enum LoginChoice {
     federatedAuth,
     /** Unregistered commenting, with an optional name. */
     unregistered,
+    /** Authentication with a passkey (WebAuthn). */
+    passkey,
 }
 
 /** The result of running the Login dialog. */
@@ -0,0 +1,42 @@
+import { Wrap } from './element-wrap';
+import { Dialog, DialogPositioning } from './dialog';
+import { UIToolkit } from './ui-toolkit';
+import { TranslateFunc } from './models';
+
+export class TotpDialog extends Dialog {
+
+    private _code?: Wrap<HTMLInputElement>;
+
+    private constructor(t: TranslateFunc, parent: Wrap<any>, pos: DialogPositioning) {
+        super(t, parent, t('dlgTitleTwoFactorAuth'), pos);
+    }
+
+    /**
+     * Instantiate and show the dialog. Return a promise that resolves with the entered code as soon as the dialog is
+     * closed, or with undefined if the dialog was cancelled.
+     * @param t Function for obtaining translated messages.
+     * @param parent Parent element for the dialog.
+     * @param pos Positioning options.
+     */
+    static async run(t: TranslateFunc, parent: Wrap<any>, pos: DialogPositioning): Promise<string | undefined> {
+        const dlg = new TotpDialog(t, parent, pos);
+        await dlg.run(null);
+        return dlg.confirmed ? dlg._code?.val.trim() || undefined : undefined;
+    }
+
+    override renderContent(): Wrap<any> {
+        this._code = UIToolkit.input('totpCode', 'text', this.t('fieldTotpCode'), 'one-time-code', true)
+            .attr({maxlength: '32', inputmode: 'numeric'});
+        return UIToolkit.form(() => this.dismiss(true), () => this.dismiss())
+            .id('totp-form')
+            .append(
+                // Dialog text
+                UIToolkit.div('dialog-centered').inner(this.t('totpCodeRequested')),
+                // Code
+                UIToolkit.div('input-group').append(this._code, UIToolkit.submit(this.t('actionLogIn'), true)));
+    }
+
+    override onShow() {
+        this._code?.focus();
+    }
+}
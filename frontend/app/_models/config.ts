@@ -30,8 +30,13 @@ export enum InstanceConfigItemKey {
     authSignupConfirmCommenter             = 'auth.signup.confirm.commenter',
     authSignupConfirmUser                  = 'auth.signup.confirm.user',
     authSignupEnabled                      = 'auth.signup.enabled',
+    authTotpRequiredOwner                  = 'auth.totp.required.owner',
+    authTotpRequiredSuperuser              = 'auth.totp.required.superuser',
     integrationsUseGravatar                = 'integrations.useGravatar',
     operationNewOwnerEnabled               = 'operation.newOwner.enabled',
+    retentionCommentsAuthorIpDays          = 'retention.comments.authorIp.days',
+    retentionCommentsDeletedDays           = 'retention.comments.deleted.days',
+    retentionUserSessionsDays              = 'retention.userSessions.days',
     // Domain defaults
     domainDefaultsCommentDeletionAuthor    = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.commentDeletionAuthor,
     domainDefaultsCommentDeletionModerator = ConfigKeyDomainDefaultsPrefix + DomainConfigItemKey.commentDeletionModerator,
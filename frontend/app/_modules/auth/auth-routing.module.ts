@@ -4,6 +4,10 @@ import { LoginComponent } from './login/login.component';
 import { SignupComponent } from './signup/signup.component';
 import { ForgotPasswordComponent } from './forgot-password/forgot-password.component';
 import { ResetPasswordComponent } from './reset-password/reset-password.component';
+import { InvitationComponent } from './invitation/invitation.component';
+import { PasskeyLoginComponent } from './passkey-login/passkey-login.component';
+import { LdapLoginComponent } from './ldap-login/ldap-login.component';
+import { LoginRevokeComponent } from './login-revoke/login-revoke.component';
 import { AuthGuard } from '../../_guards/auth.guard';
 
 const routes: Routes = [
@@ -16,7 +20,15 @@ const routes: Routes = [
             {path: 'signup',         component: SignupComponent,         canActivate: [AuthGuard.isUnauthenticated]},
 
             // Authenticated by token
+            {path: 'invitation',     component: InvitationComponent,     canActivate: [AuthGuard.hasTokenInNavigation]},
+            {path: 'loginRevoke',    component: LoginRevokeComponent,    canActivate: [AuthGuard.hasTokenInNavigation]},
             {path: 'resetPassword',  component: ResetPasswordComponent,  canActivate: [AuthGuard.hasTokenInNavigation]},
+
+            // Passkey login popup for the embedded comments
+            {path: 'passkey',        component: PasskeyLoginComponent},
+
+            // LDAP login page, opened in the federated login popup
+            {path: 'ldap',           component: LdapLoginComponent},
         ],
     },
 ];
@@ -8,6 +8,8 @@ import { SignupComponent } from './signup/signup.component';
 import { ForgotPasswordComponent } from './forgot-password/forgot-password.component';
 import { ResetPasswordComponent } from './reset-password/reset-password.component';
 import { FederatedLoginComponent } from './federated-login/federated-login.component';
+import { InvitationComponent } from './invitation/invitation.component';
+import { LoginRevokeComponent } from './login-revoke/login-revoke.component';
 
 @NgModule({
     imports: [
@@ -17,7 +19,9 @@ import { FederatedLoginComponent } from './federated-login/federated-login.compo
         FontAwesomeModule,
         ForgotPasswordComponent,
         FormsModule,
+        InvitationComponent,
         LoginComponent,
+        LoginRevokeComponent,
         ReactiveFormsModule,
         ResetPasswordComponent,
         SignupComponent,
@@ -0,0 +1,41 @@
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { RouterModule } from '@angular/router';
+import { signal } from '@angular/core';
+import { of } from 'rxjs';
+import { MockComponents, MockProvider } from 'ng-mocks';
+import { InvitationComponent } from './invitation.component';
+import { ApiGeneralService } from '../../../../generated-api';
+import { ToastService } from '../../../_services/toast.service';
+import { PrincipalService } from '../../../_services/principal.service';
+import { PasswordInputComponent } from '../../tools/password-input/password-input.component';
+import { DomainUserRoleBadgeComponent } from '../../manage/badges/domain-user-role-badge/domain-user-role-badge.component';
+
+describe('InvitationComponent', () => {
+
+    let component: InvitationComponent;
+    let fixture: ComponentFixture<InvitationComponent>;
+
+    beforeEach(async () => {
+        await TestBed.configureTestingModule({
+                imports: [
+                    RouterModule.forRoot([]),
+                    InvitationComponent,
+                    MockComponents(PasswordInputComponent, DomainUserRoleBadgeComponent),
+                ],
+                providers: [
+                    MockProvider(ApiGeneralService, {authInvitationGet: () => of({}) as any}),
+                    MockProvider(ToastService),
+                    MockProvider(PrincipalService, {principal: signal(undefined)}),
+                ],
+            })
+            .compileComponents();
+
+        fixture = TestBed.createComponent(InvitationComponent);
+        component = fixture.componentInstance;
+        fixture.detectChanges();
+    });
+
+    it('is created', () => {
+        expect(component).toBeTruthy();
+    });
+});
@@ -0,0 +1,81 @@
+import { Component } from '@angular/core';
+import { Router } from '@angular/router';
+import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
+import { ProcessingStatus } from '../../../_utils/processing-status';
+import { ApiGeneralService, AuthInvitationGet200Response } from '../../../../generated-api';
+import { Paths } from '../../../_utils/consts';
+import { ToastService } from '../../../_services/toast.service';
+import { PrincipalService } from '../../../_services/principal.service';
+import { PasswordInputComponent } from '../../tools/password-input/password-input.component';
+import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
+import { ValidatableDirective } from '../../tools/_directives/validatable.directive';
+import { LoaderDirective } from '../../tools/_directives/loader.directive';
+import { DomainUserRoleBadgeComponent } from '../../manage/badges/domain-user-role-badge/domain-user-role-badge.component';
+
+@Component({
+    selector: 'app-invitation',
+    templateUrl: './invitation.component.html',
+    imports: [
+        ReactiveFormsModule,
+        PasswordInputComponent,
+        SpinnerDirective,
+        ValidatableDirective,
+        LoaderDirective,
+        DomainUserRoleBadgeComponent,
+    ],
+})
+export class InvitationComponent {
+
+    /** Invitation details. */
+    invitation?: AuthInvitationGet200Response;
+
+    readonly loading    = new ProcessingStatus();
+    readonly submitting = new ProcessingStatus();
+    readonly form = this.fb.nonNullable.group({
+        name:     ['', [Validators.required, Validators.minLength(2), Validators.maxLength(63)]],
+        password: '',
+    });
+
+    /** Invitation token passed in the navigation state. */
+    private readonly token: string = this.router.getCurrentNavigation()?.extras?.state?.token;
+
+    constructor(
+        private readonly router: Router,
+        private readonly fb: FormBuilder,
+        private readonly api: ApiGeneralService,
+        private readonly toastSvc: ToastService,
+        private readonly principalSvc: PrincipalService,
+    ) {
+        // Load the invitation details
+        this.api.authInvitationGet(this.token)
+            .pipe(this.loading.processing())
+            .subscribe(inv => this.invitation = inv);
+    }
+
+    submit() {
+        // The name and password are only needed when creating a new account
+        const newUser = !this.invitation?.userExists;
+        if (newUser) {
+            // Mark all controls touched to display validation results
+            this.form.markAllAsTouched();
+            if (!this.form.valid) {
+                return;
+            }
+        }
+
+        // Accept the invitation
+        const vals = this.form.value;
+        this.api.authInvitationAccept({
+                token:    this.token,
+                name:     newUser ? vals.name     : undefined,
+                password: newUser ? vals.password : undefined,
+            })
+            .pipe(this.submitting.processing())
+            .subscribe(() => {
+                // Add a success toast
+                this.toastSvc.success({messageId: 'invitation-accepted', keepOnRouteChange: true});
+                // Proceed to the dashboard if the user is already logged in, otherwise to the login page
+                return this.router.navigate([this.principalSvc.principal() ? Paths.manage.dashboard : Paths.auth.login]);
+            });
+    }
+}
@@ -0,0 +1,42 @@
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { RouterModule } from '@angular/router';
+import { ReactiveFormsModule } from '@angular/forms';
+import { MockComponents, MockDirective, MockProviders } from 'ng-mocks';
+import { ApiGeneralService, Configuration } from '../../../../generated-api';
+import { ToastService } from '../../../_services/toast.service';
+import { PasswordInputComponent } from '../../tools/password-input/password-input.component';
+import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
+import { LdapLoginComponent } from './ldap-login.component';
+import { mockConfigService } from '../../../_utils/_mocks.spec';
+
+describe('LdapLoginComponent', () => {
+
+    let component: LdapLoginComponent;
+    let fixture: ComponentFixture<LdapLoginComponent>;
+
+    beforeEach(async () => {
+        await TestBed.configureTestingModule({
+                imports: [
+                    RouterModule.forRoot([]),
+                    ReactiveFormsModule,
+                    LdapLoginComponent,
+                    MockComponents(PasswordInputComponent),
+                    MockDirective(SpinnerDirective),
+                ],
+                providers: [
+                    {provide: Configuration, useValue: new Configuration()},
+                    MockProviders(ApiGeneralService, ToastService),
+                    mockConfigService(),
+                ],
+            })
+            .compileComponents();
+
+        fixture = TestBed.createComponent(LdapLoginComponent);
+        component = fixture.componentInstance;
+        fixture.detectChanges();
+    });
+
+    it('is created', () => {
+        expect(component).toBeTruthy();
+    });
+});
@@ -0,0 +1,62 @@
+import { Component } from '@angular/core';
+import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
+import { ActivatedRoute } from '@angular/router';
+import { ApiGeneralService, Configuration } from '../../../../generated-api';
+import { ProcessingStatus } from '../../../_utils/processing-status';
+import { ConfigService } from '../../../_services/config.service';
+import { ToastService } from '../../../_services/toast.service';
+import { PasswordInputComponent } from '../../tools/password-input/password-input.component';
+import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
+import { ValidatableDirective } from '../../tools/_directives/validatable.directive';
+
+@Component({
+    selector: 'app-ldap-login',
+    templateUrl: './ldap-login.component.html',
+    imports: [
+        ReactiveFormsModule,
+        PasswordInputComponent,
+        SpinnerDirective,
+        ValidatableDirective,
+    ],
+})
+export class LdapLoginComponent {
+
+    readonly submitting = new ProcessingStatus();
+    readonly state = this.route.snapshot.queryParamMap.get('state');
+
+    /** Display name of the LDAP provider. */
+    readonly idpName = this.cfgSvc.staticConfig.federatedIdps?.find(idp => idp.id === 'ldap')?.name || 'LDAP';
+
+    readonly form = this.fb.nonNullable.group({
+        username: ['', [Validators.required, Validators.maxLength(255)]],
+        password: '',
+    });
+
+    constructor(
+        private readonly fb: FormBuilder,
+        private readonly route: ActivatedRoute,
+        private readonly apiConfig: Configuration,
+        private readonly api: ApiGeneralService,
+        private readonly cfgSvc: ConfigService,
+        private readonly toastSvc: ToastService,
+    ) {}
+
+    submit(): void {
+        // Mark all controls touched to display validation results
+        this.form.markAllAsTouched();
+
+        // Submit the form if it's valid
+        if (this.form.valid) {
+            // Remove any toasts
+            this.toastSvc.clear();
+
+            // Verify the credentials within the current auth session
+            const vals = this.form.value;
+            this.api.authLdapLogin({username: vals.username!, password: vals.password!})
+                .pipe(this.submitting.processing())
+                // Proceed to the callback, which completes the authentication and closes the popup
+                .subscribe(() =>
+                    window.location.href = `${this.apiConfig.basePath}/oauth/ldap/callback?${new URLSearchParams({state: this.state!})}`);
+        }
+    }
+}
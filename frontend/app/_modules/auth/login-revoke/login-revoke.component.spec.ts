@@ -0,0 +1,36 @@
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { RouterModule } from '@angular/router';
+import { MockDirective, MockProviders } from 'ng-mocks';
+import { LoginRevokeComponent } from './login-revoke.component';
+import { ApiGeneralService, Configuration } from '../../../../generated-api';
+import { ToastService } from '../../../_services/toast.service';
+import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
+
+describe('LoginRevokeComponent', () => {
+
+    let component: LoginRevokeComponent;
+    let fixture: ComponentFixture<LoginRevokeComponent>;
+
+    beforeEach(async () => {
+        await TestBed.configureTestingModule({
+                imports: [
+                    RouterModule.forRoot([]),
+                    LoginRevokeComponent,
+                    MockDirective(SpinnerDirective),
+                ],
+                providers: [
+                    {provide: Configuration, useValue: new Configuration()},
+                    ...MockProviders(ToastService, ApiGeneralService),
+                ],
+            })
+            .compileComponents();
+
+        fixture = TestBed.createComponent(LoginRevokeComponent);
+        component = fixture.componentInstance;
+        fixture.detectChanges();
+    });
+
+    it('is created', () => {
+        expect(component).toBeTruthy();
+    });
+});
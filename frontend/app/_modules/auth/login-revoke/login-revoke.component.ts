@@ -0,0 +1,51 @@
+import { Component, OnDestroy } from '@angular/core';
+import { Router } from '@angular/router';
+import { ProcessingStatus } from '../../../_utils/processing-status';
+import { ApiGeneralService, Configuration } from '../../../../generated-api';
+import { Paths } from '../../../_utils/consts';
+import { ToastService } from '../../../_services/toast.service';
+import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
+
+@Component({
+    selector: 'app-login-revoke',
+    templateUrl: './login-revoke.component.html',
+    imports: [
+        SpinnerDirective,
+    ],
+})
+export class LoginRevokeComponent implements OnDestroy {
+
+    readonly submitting = new ProcessingStatus();
+
+    /** ID of the session to revoke, passed in the navigation state. */
+    private readonly sessionId: string = this.router.getCurrentNavigation()?.extras?.state?.session;
+
+    constructor(
+        private readonly router: Router,
+        private readonly toastSvc: ToastService,
+        private readonly api: ApiGeneralService,
+        private readonly apiConfig: Configuration,
+    ) {
+        // Set the auth token in the API config to be used for the revocation
+        this.apiConfig.credentials.token = router.getCurrentNavigation()?.extras?.state?.token;
+    }
+
+    ngOnDestroy(): void {
+        // Remove any revoke token on exit
+        delete this.apiConfig.credentials.token;
+    }
+
+    submit() {
+        this.api.authLoginRevoke({session: this.sessionId})
+            .pipe(this.submitting.processing())
+            .subscribe(r => {
+                // Add a success toast
+                this.toastSvc.success({messageId: 'login-revoked', keepOnRouteChange: true});
+
+                // Proceed to the password reset page if there's a token, otherwise to the login page
+                return r.passwordResetToken ?
+                    this.router.navigate([Paths.auth.resetPassword], {state: {token: r.passwordResetToken}}) :
+                    this.router.navigate([Paths.auth.login]);
+            });
+    }
+}
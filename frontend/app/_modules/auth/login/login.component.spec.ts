@@ -3,6 +3,8 @@ import { RouterModule } from '@angular/router';
 import { ReactiveFormsModule } from '@angular/forms';
 import { MockComponents, MockDirective, MockProviders } from 'ng-mocks';
 import { AuthService } from '../../../_services/auth.service';
+import { PasskeyService } from '../../../_services/passkey.service';
+import { ApiGeneralService } from '../../../../generated-api';
 import { PasswordInputComponent } from '../../tools/password-input/password-input.component';
 import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
 import { LoginComponent } from './login.component';
@@ -21,7 +23,7 @@ describe('LoginComponent', () => {
                     MockComponents(PasswordInputComponent, FederatedLoginComponent),
                     MockDirective(SpinnerDirective),
                 ],
-                providers: [MockProviders(AuthService)],
+                providers: [MockProviders(ApiGeneralService, AuthService, PasskeyService)],
             })
             .compileComponents();
 
@@ -1,6 +1,9 @@
 import { Component, OnInit } from '@angular/core';
+import { HttpErrorResponse } from '@angular/common/http';
 import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
 import { ActivatedRoute, Router, RouterLink } from '@angular/router';
+import { switchMap } from 'rxjs';
+import { map } from 'rxjs/operators';
 import { AuthService } from '../../../_services/auth.service';
 import { Paths } from '../../../_utils/consts';
 import { ProcessingStatus } from '../../../_utils/processing-status';
@@ -9,6 +12,8 @@ import { PasswordInputComponent } from '../../tools/password-input/password-inpu
 import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
 import { FederatedLoginComponent } from '../federated-login/federated-login.component';
 import { ValidatableDirective } from '../../tools/_directives/validatable.directive';
+import { PasskeyService } from '../../../_services/passkey.service';
+import { ApiGeneralService } from '../../../../generated-api';
 
 @Component({
     selector: 'app-login',
@@ -25,11 +30,16 @@ import { ValidatableDirective } from '../../tools/_directives/validatable.direct
 export class LoginComponent implements OnInit {
 
     submitting = new ProcessingStatus();
+    passkeyLoggingIn = new ProcessingStatus();
+
+    /** Whether the server requested a two-factor authentication code. */
+    totpRequired = false;
 
     readonly Paths = Paths;
     readonly form = this.fb.nonNullable.group({
         email:    ['', [Validators.required, Validators.email, Validators.minLength(6), Validators.maxLength(254)]],
         password: '',
+        totpCode: ['', [Validators.maxLength(32)]],
     });
 
     constructor(
@@ -38,6 +48,8 @@ export class LoginComponent implements OnInit {
         private readonly router: Router,
         private readonly authSvc: AuthService,
         private readonly toastSvc: ToastService,
+        private readonly api: ApiGeneralService,
+        readonly passkeySvc: PasskeyService,
     ) {}
 
     ngOnInit(): void {
@@ -58,10 +70,42 @@ export class LoginComponent implements OnInit {
 
             // Submit the form
             const vals = this.form.value;
-            this.authSvc.login(vals.email!, vals.password!)
+            this.authSvc.login(vals.email!, vals.password!, this.totpRequired ? vals.totpCode : undefined)
                 .pipe(this.submitting.processing())
-                // Redirect to saved URL or the dashboard on success
-                .subscribe(() => this.router.navigateByUrl(this.authSvc.afterLoginRedirectUrl || Paths.manage.dashboard));
+                .subscribe({
+                    // Redirect to saved URL or the dashboard on success
+                    next: () => this.router.navigateByUrl(this.authSvc.afterLoginRedirectUrl || Paths.manage.dashboard),
+                    // Ask for a code if the user has two-factor authentication enabled
+                    error: (err: HttpErrorResponse) => {
+                        if (err.error?.id === 'totp-code-required') {
+                            this.totpRequired = true;
+                        }
+                    },
+                });
         }
     }
+
+    loginWithPasskey(): void {
+        // Remove any toasts
+        this.toastSvc.clear();
+
+        // Request a new, anonymous login token
+        this.api.authLoginTokenNew()
+            .pipe(
+                // Bind the token to the user with a passkey
+                switchMap(r => this.passkeySvc.authenticate(r.token!).pipe(map(() => r.token!))),
+                // Log in using the token
+                switchMap(token => this.authSvc.loginViaToken(token, false)),
+                this.passkeyLoggingIn.processing())
+            .subscribe({
+                // Redirect to saved URL or the dashboard on success
+                next: () => this.router.navigateByUrl(this.authSvc.afterLoginRedirectUrl || Paths.manage.dashboard),
+                // HTTP errors are handled by the interceptor; anything else comes from the browser's passkey prompt
+                error: err => {
+                    if (!(err instanceof HttpErrorResponse)) {
+                        this.toastSvc.error({messageId: 'passkey-failed', error: err});
+                    }
+                },
+            });
+    }
 }
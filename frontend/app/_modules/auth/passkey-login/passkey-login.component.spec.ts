@@ -0,0 +1,29 @@
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { RouterModule } from '@angular/router';
+import { MockDirective, MockProviders } from 'ng-mocks';
+import { PasskeyLoginComponent } from './passkey-login.component';
+import { ToastService } from '../../../_services/toast.service';
+import { PasskeyService } from '../../../_services/passkey.service';
+import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
+
+describe('PasskeyLoginComponent', () => {
+
+    let component: PasskeyLoginComponent;
+    let fixture: ComponentFixture<PasskeyLoginComponent>;
+
+    beforeEach(async () => {
+        await TestBed.configureTestingModule({
+                imports: [RouterModule.forRoot([]), PasskeyLoginComponent, MockDirective(SpinnerDirective)],
+                providers: MockProviders(ToastService, PasskeyService),
+            })
+            .compileComponents();
+
+        fixture = TestBed.createComponent(PasskeyLoginComponent);
+        component = fixture.componentInstance;
+        fixture.detectChanges();
+    });
+
+    it('is created', () => {
+        expect(component).toBeTruthy();
+    });
+});
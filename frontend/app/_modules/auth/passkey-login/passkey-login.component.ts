@@ -0,0 +1,51 @@
+import { Component } from '@angular/core';
+import { HttpErrorResponse } from '@angular/common/http';
+import { ActivatedRoute } from '@angular/router';
+import { ProcessingStatus } from '../../../_utils/processing-status';
+import { ToastService } from '../../../_services/toast.service';
+import { PasskeyService } from '../../../_services/passkey.service';
+import { SpinnerDirective } from '../../tools/_directives/spinner.directive';
+
+@Component({
+    selector: 'app-passkey-login',
+    templateUrl: './passkey-login.component.html',
+    imports: [
+        SpinnerDirective,
+    ],
+})
+export class PasskeyLoginComponent {
+
+    /** Whether the authentication has completed successfully. */
+    done = false;
+
+    readonly authenticating = new ProcessingStatus();
+    readonly token = this.route.snapshot.queryParamMap.get('token');
+
+    constructor(
+        private readonly route: ActivatedRoute,
+        private readonly toastSvc: ToastService,
+        readonly passkeySvc: PasskeyService,
+    ) {}
+
+    authenticate(): void {
+        // Remove any toasts
+        this.toastSvc.clear();
+
+        // Run the ceremony, which binds the token to the user
+        this.passkeySvc.authenticate(this.token!)
+            .pipe(this.authenticating.processing())
+            .subscribe({
+                // Close the popup on success
+                next: () => {
+                    this.done = true;
+                    window.close();
+                },
+                // HTTP errors are handled by the interceptor; anything else comes from the browser's passkey prompt
+                error: err => {
+                    if (!(err instanceof HttpErrorResponse)) {
+                        this.toastSvc.error({messageId: 'passkey-failed', error: err});
+                    }
+                },
+            });
+    }
+}
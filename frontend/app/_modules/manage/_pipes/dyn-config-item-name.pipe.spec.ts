@@ -21,8 +21,13 @@ describe('DynConfigItemNamePipe', () => {
         {in: 'auth.signup.confirm.commenter',               want: 'New commenters must confirm their email'},
         {in: 'auth.signup.confirm.user',                    want: 'New users must confirm their email'},
         {in: 'auth.signup.enabled',                         want: 'Enable registration of new users'},
+        {in: 'auth.totp.required.owner',                    want: 'Require two-factor authentication for domain owners'},
+        {in: 'auth.totp.required.superuser',                want: 'Require two-factor authentication for superusers'},
         {in: 'integrations.useGravatar',                    want: 'Use Gravatar for user avatars'},
         {in: 'operation.newOwner.enabled',                  want: 'Non-owner users can add domains'},
+        {in: 'retention.comments.authorIp.days',            want: 'Anonymise comment author IPs after (days)'},
+        {in: 'retention.comments.deleted.days',             want: 'Purge deleted comments after (days)'},
+        {in: 'retention.userSessions.days',                 want: 'Purge user sessions after (days)'},
         // Domain defaults
         {in: 'domain.defaults.comments.deletion.author',    want: 'Allow comment authors to delete comments'},
         {in: 'domain.defaults.comments.deletion.moderator', want: 'Allow moderators to delete comments'},
@@ -12,8 +12,13 @@ export class DynConfigItemNamePipe implements PipeTransform {
         [InstanceConfigItemKey.authSignupConfirmCommenter]:             $localize`New commenters must confirm their email`,
         [InstanceConfigItemKey.authSignupConfirmUser]:                  $localize`New users must confirm their email`,
         [InstanceConfigItemKey.authSignupEnabled]:                      $localize`Enable registration of new users`,
+        [InstanceConfigItemKey.authTotpRequiredOwner]:                  $localize`Require two-factor authentication for domain owners`,
+        [InstanceConfigItemKey.authTotpRequiredSuperuser]:              $localize`Require two-factor authentication for superusers`,
         [InstanceConfigItemKey.integrationsUseGravatar]:                $localize`Use Gravatar for user avatars`,
         [InstanceConfigItemKey.operationNewOwnerEnabled]:               $localize`Non-owner users can add domains`,
+        [InstanceConfigItemKey.retentionCommentsAuthorIpDays]:          $localize`Anonymise comment author IPs after (days)`,
+        [InstanceConfigItemKey.retentionCommentsDeletedDays]:           $localize`Purge deleted comments after (days)`,
+        [InstanceConfigItemKey.retentionUserSessionsDays]:              $localize`Purge user sessions after (days)`,
         // Domain defaults
         [InstanceConfigItemKey.domainDefaultsCommentDeletionAuthor]:    $localize`Allow comment authors to delete comments`,
         [InstanceConfigItemKey.domainDefaultsCommentDeletionModerator]: $localize`Allow moderators to delete comments`,
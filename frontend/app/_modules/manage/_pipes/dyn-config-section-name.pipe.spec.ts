@@ -20,6 +20,7 @@ describe('DynConfigSectionNamePipe', () => {
         {in: 'integrations', want: 'Integrations'},
         {in: 'markdown',     want: 'Markdown'},
         {in: 'misc',         want: 'Miscellaneous'},
+        {in: 'retention',    want: 'Data retention'},
     ]
         .forEach(test =>
             it(`transforms '${test.in}' into '${test.want}'`, () =>
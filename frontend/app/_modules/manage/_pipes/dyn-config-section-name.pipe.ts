@@ -11,6 +11,7 @@ export class DynConfigSectionNamePipe implements PipeTransform {
         'integrations': $localize`Integrations`,
         'markdown':     $localize`Markdown`,
         'misc':         $localize`Miscellaneous`,
+        'retention':    $localize`Data retention`,
     };
 
     transform(key: string | null | undefined): string {
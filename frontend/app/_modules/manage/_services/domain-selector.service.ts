@@ -3,7 +3,7 @@ import { HttpContext } from '@angular/common/http';
 import { BehaviorSubject, combineLatestWith, Observable, tap } from 'rxjs';
 import { filter } from 'rxjs/operators';
 import { UntilDestroy, untilDestroyed } from '@ngneat/until-destroy';
-import { ApiGeneralService, Domain, DomainExtension, DomainGet200Response, DomainUser, DomainUserRole, Principal } from '../../../../generated-api';
+import { ApiGeneralService, Domain, DomainExtension, DomainGet200Response, DomainRoleRule, DomainUser, DomainUserRole, Principal } from '../../../../generated-api';
 import { LocalSettingService } from '../../../_services/local-setting.service';
 import { HTTP_ERROR_HANDLING } from '../../../_services/http-error-handler.interceptor';
 import { ProcessingStatus } from '../../../_utils/processing-status';
@@ -41,6 +41,8 @@ export class DomainMeta {
         readonly federatedIdpIds?: string[],
         /** List of extensions enabled for the domain. */
         readonly extensions?: DomainExtension[],
+        /** Role mapping rules of the domain (domain owner only). */
+        readonly roleRules?: DomainRoleRule[],
         /** Domain attributes (superuser only). */
         readonly attributes?: Record<string, string>,
         /** Authenticated principal, if any. */
@@ -164,6 +166,7 @@ export class DomainSelectorService {
             v?.configuration ? new DynamicConfig(v.configuration) : undefined,
             v?.federatedIdpIds,
             v?.extensions,
+            v?.roleRules,
             Utils.sortByKey(v?.attributes) as Record<string, string> | undefined,
             this.principal,
             this.principalSvc.updatedTime()));
@@ -0,0 +1,32 @@
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { RouterModule } from '@angular/router';
+import { of } from 'rxjs';
+import { MockProvider } from 'ng-mocks';
+import { ApiTokensComponent } from './api-tokens.component';
+import { ApiGeneralService } from '../../../../../generated-api';
+import { ToastService } from '../../../../_services/toast.service';
+
+describe('ApiTokensComponent', () => {
+
+    let component: ApiTokensComponent;
+    let fixture: ComponentFixture<ApiTokensComponent>;
+
+    beforeEach(async () => {
+        await TestBed.configureTestingModule({
+                imports: [RouterModule.forRoot([]), ApiTokensComponent],
+                providers: [
+                    MockProvider(ApiGeneralService, {curUserApiTokenList: () => of([]) as any}),
+                    MockProvider(ToastService),
+                ],
+            })
+            .compileComponents();
+
+        fixture = TestBed.createComponent(ApiTokensComponent);
+        component = fixture.componentInstance;
+        fixture.detectChanges();
+    });
+
+    it('is created', () => {
+        expect(component).toBeTruthy();
+    });
+});
@@ -0,0 +1,131 @@
+import { Component, OnInit } from '@angular/core';
+import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
+import { RouterLink } from '@angular/router';
+import { FaIconComponent } from '@fortawesome/angular-fontawesome';
+import { faCopy, faTrashAlt } from '@fortawesome/free-solid-svg-icons';
+import { NgbTooltipModule } from '@ng-bootstrap/ng-bootstrap';
+import { ApiGeneralService, ApiToken, ApiTokenScope } from '../../../../../generated-api';
+import { ProcessingStatus } from '../../../../_utils/processing-status';
+import { Paths } from '../../../../_utils/consts';
+import { Animations } from '../../../../_utils/animations';
+import { ToastService } from '../../../../_services/toast.service';
+import { SpinnerDirective } from '../../../tools/_directives/spinner.directive';
+import { ConfirmDirective } from '../../../tools/_directives/confirm.directive';
+import { CopyTextDirective } from '../../../tools/_directives/copy-text.directive';
+import { ValidatableDirective } from '../../../tools/_directives/validatable.directive';
+import { DatetimePipe } from '../../_pipes/datetime.pipe';
+
+@Component({
+    selector: 'app-api-tokens',
+    templateUrl: './api-tokens.component.html',
+    animations: [Animations.fadeIn('slow')],
+    imports: [
+        ConfirmDirective,
+        CopyTextDirective,
+        DatetimePipe,
+        FaIconComponent,
+        NgbTooltipModule,
+        ReactiveFormsModule,
+        RouterLink,
+        SpinnerDirective,
+        ValidatableDirective,
+    ],
+})
+export class ApiTokensComponent implements OnInit {
+
+    /** Tokens of the current user. */
+    tokens?: ApiToken[];
+
+    /** Value of the token just created, which is only available once. */
+    newTokenValue?: string;
+
+    /** Available token scopes. */
+    readonly scopes: ApiTokenScope[] = [ApiTokenScope.DomainRead, ApiTokenScope.Moderation, ApiTokenScope.Export, ApiTokenScope.UserSync];
+
+    /** Available token lifetimes, in days; 0 means the token never expires. */
+    readonly lifetimes = [30, 90, 365, 0];
+
+    readonly loading  = new ProcessingStatus();
+    readonly creating = new ProcessingStatus();
+    readonly revoking = new ProcessingStatus();
+
+    readonly form = this.fb.nonNullable.group({
+        name:     ['', [Validators.required, Validators.maxLength(63)]],
+        scopes:   this.fb.nonNullable.group(Object.fromEntries(this.scopes.map(s => [s, false]))),
+        lifetime: 90,
+    });
+
+    readonly Paths = Paths;
+    readonly ApiTokenScope = ApiTokenScope;
+
+    // Icons
+    readonly faCopy     = faCopy;
+    readonly faTrashAlt = faTrashAlt;
+
+    constructor(
+        private readonly fb: FormBuilder,
+        private readonly api: ApiGeneralService,
+        private readonly toastSvc: ToastService,
+    ) {}
+
+    /**
+     * Scopes currently selected in the form.
+     */
+    get selectedScopes(): ApiTokenScope[] {
+        const v = this.form.controls.scopes.value;
+        return this.scopes.filter(s => v[s]);
+    }
+
+    ngOnInit(): void {
+        this.load();
+    }
+
+    /**
+     * Create a new token using the form values.
+     */
+    create() {
+        // Mark all controls touched to display validation results
+        this.form.markAllAsTouched();
+
+        // Submit the form if it's valid
+        if (this.form.valid && this.selectedScopes.length) {
+            const vals = this.form.value;
+            this.api.curUserApiTokenNew({
+                    name:        vals.name!,
+                    scopes:      this.selectedScopes,
+                    expiresTime: vals.lifetime ? new Date(Date.now() + vals.lifetime * 24 * 3600 * 1000).toISOString() : undefined,
+                })
+                .pipe(this.creating.processing())
+                .subscribe(r => {
+                    this.newTokenValue = r.value;
+                    this.tokens = [...this.tokens ?? [], r.token];
+                    this.form.reset();
+                });
+        }
+    }
+
+    /**
+     * Whether the given token has expired.
+     */
+    isExpired(t: ApiToken): boolean {
+        return !!t.expiresTime && new Date(t.expiresTime).getTime() < Date.now();
+    }
+
+    /**
+     * Revoke the given token.
+     */
+    revoke(t: ApiToken) {
+        this.api.curUserApiTokenDelete(t.id)
+            .pipe(this.revoking.processing())
+            .subscribe(() => {
+                this.tokens = this.tokens?.filter(x => x.id !== t.id);
+                this.toastSvc.success('api-token-revoked');
+            });
+    }
+
+    private load() {
+        this.api.curUserApiTokenList()
+            .pipe(this.loading.processing())
+            .subscribe(ts => this.tokens = ts);
+    }
+}
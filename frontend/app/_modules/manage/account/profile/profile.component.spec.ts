@@ -7,6 +7,7 @@ import { mockConfigService } from '../../../../_utils/_mocks.spec';
 import { PluginService } from '../../../plugin/_services/plugin.service';
 import { AuthService } from '../../../../_services/auth.service';
 import { PrincipalService } from '../../../../_services/principal.service';
+import { PasskeyService } from '../../../../_services/passkey.service';
 
 describe('ProfileComponent', () => {
 
@@ -20,6 +21,7 @@ describe('ProfileComponent', () => {
                     MockProvider(ApiGeneralService),
                     MockProvider(PluginService),
                     MockProvider(AuthService),
+                    MockProvider(PasskeyService),
                     MockProvider(PrincipalService, {principal: signal(undefined), updatedTime: signal(0)}),
                     mockConfigService(),
                 ],
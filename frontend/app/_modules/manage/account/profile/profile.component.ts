@@ -1,14 +1,15 @@
 import { Component, effect, ElementRef, ViewChild } from '@angular/core';
-import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
+import { HttpErrorResponse } from '@angular/common/http';
+import { FormBuilder, FormControl, ReactiveFormsModule, Validators } from '@angular/forms';
 import { Router, RouterLink } from '@angular/router';
 import { concat, EMPTY, first, Observable } from 'rxjs';
 import { UntilDestroy, untilDestroyed } from '@ngneat/until-destroy';
 import { FaIconComponent } from '@fortawesome/angular-fontawesome';
-import { faAngleDown, faCopy, faPencil, faSkullCrossbones, faTrashAlt } from '@fortawesome/free-solid-svg-icons';
+import { faAngleDown, faCopy, faPencil, faSkullCrossbones, faTrashAlt, faUndo } from '@fortawesome/free-solid-svg-icons';
 import { NgbCollapseModule, NgbTooltipModule } from '@ng-bootstrap/ng-bootstrap';
 import { ProcessingStatus } from '../../../../_utils/processing-status';
 import { AuthService } from '../../../../_services/auth.service';
-import { ApiGeneralService, CurUserUpdateRequest, Principal } from '../../../../../generated-api';
+import { ApiGeneralService, CurUserUpdateRequest, Principal, UserPasskey } from '../../../../../generated-api';
 import { ToastService } from '../../../../_services/toast.service';
 import { XtraValidators } from '../../../../_utils/xtra-validators';
 import { Utils } from '../../../../_utils/utils';
@@ -24,6 +25,8 @@ import { PluginPlugComponent } from '../../../plugin/plugin-plug/plugin-plug.com
 import { ConfirmDirective } from '../../../tools/_directives/confirm.directive';
 import { ValidatableDirective } from '../../../tools/_directives/validatable.directive';
 import { PrincipalService } from '../../../../_services/principal.service';
+import { PasskeyService } from '../../../../_services/passkey.service';
+import { DatetimePipe } from '../../_pipes/datetime.pipe';
 
 @UntilDestroy()
 @Component({
@@ -31,6 +34,7 @@ import { PrincipalService } from '../../../../_services/principal.service';
     imports: [
         ConfirmDirective,
         CopyTextDirective,
+        DatetimePipe,
         FaIconComponent,
         NgbCollapseModule,
         NgbTooltipModule,
@@ -67,6 +71,18 @@ export class ProfileComponent {
     /** Whether editing email is enabled. */
     canEditEmail = false;
 
+    /** Pending (not yet confirmed) two-factor authentication enrolment. */
+    totpEnrolment?: {secret: string; uri: string};
+
+    /** Recovery codes received upon enabling two-factor authentication. */
+    totpRecoveryCodes?: string[];
+
+    /** Passkeys registered by the user. */
+    passkeys?: UserPasskey[];
+
+    /** IDs of passkeys marked for removal on save. */
+    readonly passkeysToRemove = new Set<string>();
+
     /** UI plugs destined for the profile page. */
     readonly plugs = this.pluginSvc.uiPlugsForLocation('profile');
 
@@ -76,7 +92,10 @@ export class ProfileComponent {
     /** Processing statuses. */
     readonly saving          = new ProcessingStatus();
     readonly deleting        = new ProcessingStatus();
+    readonly exporting       = new ProcessingStatus();
     readonly settingGravatar = new ProcessingStatus();
+    readonly updatingTotp    = new ProcessingStatus();
+    readonly addingPasskey   = new ProcessingStatus();
 
     readonly userForm = this.fb.nonNullable.group({
         email:       {value: '', disabled: true},
@@ -87,6 +106,16 @@ export class ProfileComponent {
         langId:      [this.cfgSvc.staticConfig.defaultLangId, [Validators.required]],
     });
 
+    readonly totpEnableForm = this.fb.nonNullable.group({
+        code: ['', [Validators.required, Validators.pattern(/^\d{6}$/)]],
+    });
+
+    readonly totpDisableForm = this.fb.nonNullable.group({
+        password: '',
+    });
+
+    readonly passkeyName = new FormControl('', {nonNullable: true, validators: [Validators.required, Validators.maxLength(63)]});
+
     readonly deleteConfirmationForm = this.fb.nonNullable.group({
         deleteComments: false,
         purgeComments:  [{value: false, disabled: true}],
@@ -101,6 +130,7 @@ export class ProfileComponent {
     readonly faPencil          = faPencil;
     readonly faSkullCrossbones = faSkullCrossbones;
     readonly faTrashAlt        = faTrashAlt;
+    readonly faUndo            = faUndo;
 
     constructor(
         private readonly fb: FormBuilder,
@@ -111,6 +141,7 @@ export class ProfileComponent {
         private readonly api: ApiGeneralService,
         private readonly pluginSvc: PluginService,
         private readonly cfgSvc: ConfigService,
+        readonly passkeySvc: PasskeyService,
     ) {
         cfgSvc.dynamicConfig
             .pipe(first())
@@ -139,6 +170,7 @@ export class ProfileComponent {
 
                 // Local user: the old password is required and enabled if there's a new one
                 if (p.isLocal) {
+                    this.loadPasskeys();
                     this.userForm.controls.newPassword.valueChanges
                         .pipe(untilDestroyed(this))
                         .subscribe(s => {
@@ -195,6 +227,12 @@ export class ProfileComponent {
             });
     }
 
+    requestDataExport() {
+        this.api.curUserDataExportRequest()
+            .pipe(this.exporting.processing())
+            .subscribe(() => this.toastSvc.success('data-export-requested'));
+    }
+
     submit() {
         // Mark all controls touched to display validation results
         this.userForm.markAllAsTouched();
@@ -224,6 +262,81 @@ export class ProfileComponent {
             });
     }
 
+    totpInit() {
+        this.totpRecoveryCodes = undefined;
+        this.api.curUserTotpInit()
+            .pipe(this.updatingTotp.processing())
+            .subscribe(r => {
+                this.totpEnrolment = r;
+                this.totpEnableForm.reset();
+            });
+    }
+
+    totpEnable() {
+        // Mark all controls touched to display validation results
+        this.totpEnableForm.markAllAsTouched();
+
+        // Submit the form if it's valid
+        if (this.totpEnableForm.valid) {
+            this.api.curUserTotpEnable({code: this.totpEnableForm.value.code!})
+                .pipe(this.updatingTotp.processing())
+                .subscribe(r => {
+                    this.totpEnrolment = undefined;
+                    this.totpRecoveryCodes = r.recoveryCodes;
+
+                    // Update the logged-in principal
+                    this.authSvc.update();
+                });
+        }
+    }
+
+    totpDisable() {
+        // Mark all controls touched to display validation results
+        this.totpDisableForm.markAllAsTouched();
+
+        // Submit the form if it's valid
+        if (this.totpDisableForm.valid) {
+            this.api.curUserTotpDisable({password: this.totpDisableForm.value.password!})
+                .pipe(this.updatingTotp.processing())
+                .subscribe(() => {
+                    this.totpDisableForm.reset();
+                    this.totpRecoveryCodes = undefined;
+
+                    // Update the logged-in principal
+                    this.authSvc.update();
+
+                    // Add a success toast
+                    this.toastSvc.success('data-saved');
+                });
+        }
+    }
+
+    addPasskey() {
+        this.passkeySvc.register(this.passkeyName.value.trim(), this.principal!.email!, this.principal!.name!)
+            .pipe(this.addingPasskey.processing())
+            .subscribe({
+                next: pk => {
+                    this.passkeys = [...this.passkeys ?? [], pk];
+                    this.passkeyName.reset();
+
+                    // Add a success toast
+                    this.toastSvc.success('data-saved');
+                },
+                // HTTP errors are handled by the interceptor; anything else comes from the browser's passkey prompt
+                error: err => {
+                    if (!(err instanceof HttpErrorResponse)) {
+                        this.toastSvc.error({messageId: 'passkey-failed', error: err});
+                    }
+                },
+            });
+    }
+
+    togglePasskeyRemoval(id: string) {
+        if (!this.passkeysToRemove.delete(id)) {
+            this.passkeysToRemove.add(id);
+        }
+    }
+
     uploadAvatar() {
         this.avatarFileInput?.nativeElement.click();
     }
@@ -270,6 +383,16 @@ export class ProfileComponent {
         this.avatarChanged = changed;
     }
 
+    /**
+     * (Re)load the user's passkeys from the backend.
+     */
+    private loadPasskeys() {
+        this.api.curUserPasskeyList().subscribe(pks => {
+            this.passkeys = pks;
+            this.passkeysToRemove.clear();
+        });
+    }
+
     /**
      * Submit the user's avatar change, if any, to the backend.
      */
@@ -282,6 +405,9 @@ export class ProfileComponent {
      * Submit the user's profile to the backend.
      */
     private saveProfile(): Observable<void> {
-        return this.api.curUserUpdate(this.userForm.value as CurUserUpdateRequest);
+        return this.api.curUserUpdate({
+            ...this.userForm.value,
+            removePasskeys: this.passkeysToRemove.size ? [...this.passkeysToRemove] : undefined,
+        } as CurUserUpdateRequest);
     }
 }
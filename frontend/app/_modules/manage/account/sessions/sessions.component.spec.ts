@@ -0,0 +1,32 @@
+import { ComponentFixture, TestBed } from '@angular/core/testing';
+import { RouterModule } from '@angular/router';
+import { of } from 'rxjs';
+import { MockProvider } from 'ng-mocks';
+import { SessionsComponent } from './sessions.component';
+import { ApiGeneralService } from '../../../../../generated-api';
+import { ToastService } from '../../../../_services/toast.service';
+
+describe('SessionsComponent', () => {
+
+    let component: SessionsComponent;
+    let fixture: ComponentFixture<SessionsComponent>;
+
+    beforeEach(async () => {
+        await TestBed.configureTestingModule({
+                imports: [RouterModule.forRoot([]), SessionsComponent],
+                providers: [
+                    MockProvider(ApiGeneralService, {curUserSessionList: () => of([]) as any}),
+                    MockProvider(ToastService),
+                ],
+            })
+            .compileComponents();
+
+        fixture = TestBed.createComponent(SessionsComponent);
+        component = fixture.componentInstance;
+        fixture.detectChanges();
+    });
+
+    it('is created', () => {
+        expect(component).toBeTruthy();
+    });
+});
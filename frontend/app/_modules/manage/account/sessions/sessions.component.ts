@@ -0,0 +1,85 @@
+import { Component, OnInit } from '@angular/core';
+import { RouterLink } from '@angular/router';
+import { FaIconComponent } from '@fortawesome/angular-fontawesome';
+import { faCalendarXmark, faSignOutAlt } from '@fortawesome/free-solid-svg-icons';
+import { ApiGeneralService, UserSession } from '../../../../../generated-api';
+import { ProcessingStatus } from '../../../../_utils/processing-status';
+import { Paths } from '../../../../_utils/consts';
+import { Animations } from '../../../../_utils/animations';
+import { ToastService } from '../../../../_services/toast.service';
+import { SpinnerDirective } from '../../../tools/_directives/spinner.directive';
+import { ConfirmDirective } from '../../../tools/_directives/confirm.directive';
+import { DatetimePipe } from '../../_pipes/datetime.pipe';
+
+@Component({
+    selector: 'app-sessions',
+    templateUrl: './sessions.component.html',
+    animations: [Animations.fadeIn('slow')],
+    imports: [
+        ConfirmDirective,
+        DatetimePipe,
+        FaIconComponent,
+        RouterLink,
+        SpinnerDirective,
+    ],
+})
+export class SessionsComponent implements OnInit {
+
+    /** Active sessions of the current user. */
+    sessions?: UserSession[];
+
+    readonly loading  = new ProcessingStatus();
+    readonly expiring = new ProcessingStatus();
+
+    readonly Paths = Paths;
+
+    // Icons
+    readonly faCalendarXmark = faCalendarXmark;
+    readonly faSignOutAlt    = faSignOutAlt;
+
+    constructor(
+        private readonly api: ApiGeneralService,
+        private readonly toastSvc: ToastService,
+    ) {}
+
+    /**
+     * Whether there are sessions other than the current one.
+     */
+    get hasOtherSessions(): boolean {
+        return !!this.sessions?.some(us => !us.current);
+    }
+
+    ngOnInit(): void {
+        this.load();
+    }
+
+    /**
+     * Sign out the given session.
+     */
+    expire(us: UserSession) {
+        this.api.curUserSessionExpire(us.id)
+            .pipe(this.expiring.processing())
+            .subscribe(() => {
+                this.sessions = this.sessions?.filter(x => x.id !== us.id);
+                this.toastSvc.success('session-expired');
+            });
+    }
+
+    /**
+     * Sign out all sessions except the current one.
+     */
+    expireOthers() {
+        this.api.curUserSessionsExpire()
+            .pipe(this.expiring.processing())
+            .subscribe(() => {
+                this.sessions = this.sessions?.filter(x => x.current);
+                this.toastSvc.success('sessions-expired');
+            });
+    }
+
+    private load() {
+        this.api.curUserSessionList()
+            .pipe(this.loading.processing())
+            .subscribe(ss => this.sessions = ss);
+    }
+}
@@ -1,7 +1,8 @@
 import { Component, input } from '@angular/core';
-import { faExclamationTriangle } from '@fortawesome/free-solid-svg-icons';
-import { FormGroup, ReactiveFormsModule } from '@angular/forms';
-import { FederatedIdentityProvider } from '../../../../../../generated-api';
+import { faExclamationTriangle, faPlus, faTrashAlt } from '@fortawesome/free-solid-svg-icons';
+import { FaIconComponent } from '@fortawesome/angular-fontawesome';
+import { FormArray, FormControl, FormGroup, ReactiveFormsModule, Validators } from '@angular/forms';
+import { DomainRoleRule, DomainUserRole, FederatedIdentityProvider } from '../../../../../../generated-api';
 import { DynamicConfig } from '../../../../../_models/config';
 import { InfoBlockComponent } from '../../../../tools/info-block/info-block.component';
 import { InfoIconComponent } from '../../../../tools/info-icon/info-icon.component';
@@ -19,6 +20,7 @@ import { ValidatableDirective } from '../../../../tools/_directives/validatable.
         ReactiveFormsModule,
         IdentityProviderIconComponent,
         ValidatableDirective,
+        FaIconComponent,
     ],
 })
 export class DomainEditAuthComponent {
@@ -35,6 +37,45 @@ export class DomainEditAuthComponent {
     /** Federated IdPs configured on the current instance. */
     readonly federatedIdps = input<FederatedIdentityProvider[]>();
 
+    /** Roles a role rule can assign (the owner role can't be assigned automatically). */
+    readonly ruleRoles = [DomainUserRole.Moderator, DomainUserRole.Commenter, DomainUserRole.Readonly];
+
     // Icons
     readonly faExclamationTriangle = faExclamationTriangle;
+    readonly faPlus                = faPlus;
+    readonly faTrashAlt            = faTrashAlt;
+
+    /**
+     * Create a new form group for editing the given role rule.
+     */
+    static roleRuleGroup(rule?: DomainRoleRule): FormGroup {
+        return new FormGroup({
+            claim: new FormControl(rule?.claim ?? '', {nonNullable: true, validators: [Validators.required, Validators.maxLength(63)]}),
+            value: new FormControl(rule?.value ?? '', {nonNullable: true, validators: [Validators.required, Validators.maxLength(255)]}),
+            role:  new FormControl(rule?.role ?? DomainUserRole.Moderator, {nonNullable: true}),
+        });
+    }
+
+    /**
+     * Role rules form array.
+     */
+    get roleRules(): FormArray<FormGroup> {
+        return this.methodsFormGroup()!.controls.roleRules as FormArray<FormGroup>;
+    }
+
+    /**
+     * Append a new, empty role rule.
+     */
+    addRoleRule() {
+        this.roleRules.push(DomainEditAuthComponent.roleRuleGroup());
+        this.roleRules.markAsDirty();
+    }
+
+    /**
+     * Remove the role rule with the given index.
+     */
+    removeRoleRule(index: number) {
+        this.roleRules.removeAt(index);
+        this.roleRules.markAsDirty();
+    }
 }
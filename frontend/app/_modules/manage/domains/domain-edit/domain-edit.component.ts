@@ -1,5 +1,5 @@
 import { Component, OnInit } from '@angular/core';
-import { AbstractControl, FormBuilder, FormGroup, ReactiveFormsModule, Validators } from '@angular/forms';
+import { AbstractControl, FormArray, FormBuilder, FormGroup, ReactiveFormsModule, Validators } from '@angular/forms';
 import { ActivatedRoute, Router, RouterLink } from '@angular/router';
 import { first, Observable, of, switchMap } from 'rxjs';
 import { map } from 'rxjs/operators';
@@ -157,12 +157,15 @@ export class DomainEditComponent implements OnInit {
                                 defaultSort: d.defaultSort,
                             },
                             auth: {
-                                anonymous: d.authAnonymous,
-                                local:     d.authLocal,
-                                sso:       d.authSso,
-                                ssoUrl:    d.ssoUrl,
-                                ssoNonInt: d.ssoNonInteractive,
-                                fedIdps:   this.fedIdps?.map(idp => !!this.domainMeta!.federatedIdpIds?.includes(idp.id)),
+                                anonymous:  d.authAnonymous,
+                                local:      d.authLocal,
+                                sso:        d.authSso,
+                                ssoUrl:     d.ssoUrl,
+                                ssoNonInt:  d.ssoNonInteractive,
+                                ssoJwtKeys: d.ssoJwtKeys ?? '',
+                                ssoJwtIss:  d.ssoJwtIssuer ?? '',
+                                ssoJwtAud:  d.ssoJwtAudience ?? '',
+                                fedIdps:    this.fedIdps?.map(idp => !!this.domainMeta!.federatedIdpIds?.includes(idp.id)),
                             },
                             mod: {
                                 anonymous:     d.modAnonymous,
@@ -190,6 +193,10 @@ export class DomainEditComponent implements OnInit {
                                 group.controls.config.setValue(el.ex!.config ?? '');
                                 group.controls.config.enable();
                             });
+
+                        // Populate role rules
+                        const rules = this.ctlGroupAuth.controls.roleRules as FormArray;
+                        this.domainMeta!.roleRules?.forEach(r => rules.push(DomainEditAuthComponent.roleRuleGroup(r)));
                     }
 
                     // Return either a cloned domain config if there's a domain, or the vanilla domain defaults as config
@@ -228,6 +235,9 @@ export class DomainEditComponent implements OnInit {
                 authSso:           !!vals.auth.sso,
                 ssoUrl:            vals.auth.ssoUrl ?? '',
                 ssoNonInteractive: !!vals.auth.ssoNonInt,
+                ssoJwtKeys:        vals.auth.ssoJwtKeys?.trim() ?? '',
+                ssoJwtIssuer:      vals.auth.ssoJwtIss?.trim() ?? '',
+                ssoJwtAudience:    vals.auth.ssoJwtAud?.trim() ?? '',
                 // Moderation
                 modAnonymous:      !!vals.mod.anonymous,
                 modAuthenticated:  !!vals.mod.authenticated,
@@ -256,10 +266,13 @@ export class DomainEditComponent implements OnInit {
                     .map(e => ({id: e.id, config: e.config})) :
                 undefined;
 
+            // Collect role rules
+            const roleRules = vals.auth.roleRules;
+
             // Run creation/updating with the API
             (this.isNew ?
-                    this.api.domainNew({domain, configuration, federatedIdpIds, extensions}) :
-                    this.api.domainUpdate(this.domainMeta!.domain!.id!, {domain, configuration, federatedIdpIds, extensions}))
+                    this.api.domainNew({domain, configuration, federatedIdpIds, extensions, roleRules}) :
+                    this.api.domainUpdate(this.domainMeta!.domain!.id!, {domain, configuration, federatedIdpIds, extensions, roleRules}))
                 .pipe(this.saving.processing())
                 .subscribe(newDomain => {
                     // Add a success toast
@@ -295,16 +308,20 @@ export class DomainEditComponent implements OnInit {
                             defaultSort: CommentSort.Td,
                         }),
                         auth: this.fb.nonNullable.group({
-                            anonymous: false,
-                            local:     true,
-                            sso:       false,
-                            ssoUrl:    [
+                            anonymous:  false,
+                            local:      true,
+                            sso:        false,
+                            ssoUrl:     [
                                 {value: '', disabled: true},
                                 // Only allow insecure URL if the app itself runs on an HTTP host
                                 [Validators.required, XtraValidators.url(window.location.protocol === 'https:')],
                             ],
-                            ssoNonInt: false,
-                            fedIdps:   this.fb.array(Array(this.fedIdps?.length).fill(true)), // Enable all by default
+                            ssoNonInt:  false,
+                            ssoJwtKeys: [{value: '', disabled: true}, [Validators.maxLength(65536)]],
+                            ssoJwtIss:  [{value: '', disabled: true}, [Validators.maxLength(2083)]],
+                            ssoJwtAud:  [{value: '', disabled: true}, [Validators.maxLength(2083)]],
+                            fedIdps:    this.fb.array(Array(this.fedIdps?.length).fill(true)), // Enable all by default
+                            roleRules:  this.fb.array<FormGroup>([]),
                         }),
                         mod: this.fb.nonNullable.group({
                             anonymous:     true,
@@ -324,7 +341,7 @@ export class DomainEditComponent implements OnInit {
                     // SSO URL is only relevant when SSO auth is enabled
                     f.controls.auth.controls.sso.valueChanges
                         .pipe(untilDestroyed(this))
-                        .subscribe(b => Utils.enableControls(b, f.controls.auth.controls.ssoUrl, f.controls.auth.controls.ssoNonInt));
+                        .subscribe(b => Utils.enableControls(b, f.controls.auth.controls.ssoUrl, f.controls.auth.controls.ssoNonInt, f.controls.auth.controls.ssoJwtKeys, f.controls.auth.controls.ssoJwtIss, f.controls.auth.controls.ssoJwtAud));
 
                     // Disable numeric controls when the corresponding checkbox is off
                     f.controls.mod.controls.numCommentsOn.valueChanges
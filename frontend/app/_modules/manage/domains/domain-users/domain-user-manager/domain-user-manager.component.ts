@@ -1,13 +1,13 @@
 import { Component, OnInit } from '@angular/core';
 import { RouterLink } from '@angular/router';
-import { FormBuilder, ReactiveFormsModule } from '@angular/forms';
+import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
 import { debounceTime, distinctUntilChanged, merge, mergeWith, Subject, switchMap, tap } from 'rxjs';
 import { filter, map } from 'rxjs/operators';
 import { UntilDestroy, untilDestroyed } from '@ngneat/until-destroy';
 import { FaIconComponent } from '@fortawesome/angular-fontawesome';
-import { faBan, faUserLock } from '@fortawesome/free-solid-svg-icons';
+import { faBan, faEnvelope, faTrashAlt, faUserLock } from '@fortawesome/free-solid-svg-icons';
 import { Sort } from '../../../_models/sort';
-import { ApiGeneralService, DomainUser, User } from '../../../../../../generated-api';
+import { ApiGeneralService, DomainInvitation, DomainUser, DomainUserRole, User } from '../../../../../../generated-api';
 import { DomainMeta, DomainSelectorService } from '../../../_services/domain-selector.service';
 import { ProcessingStatus } from '../../../../../_utils/processing-status';
 import { ConfigService } from '../../../../../_services/config.service';
@@ -26,6 +26,11 @@ import { LoaderDirective } from '../../../../tools/_directives/loader.directive'
 import { DecimalPipe } from '@angular/common';
 import { LocalSettingService } from '../../../../../_services/local-setting.service';
 import { SortableViewSettings } from '../../../_models/view';
+import { ToastService } from '../../../../../_services/toast.service';
+import { SpinnerDirective } from '../../../../tools/_directives/spinner.directive';
+import { ConfirmDirective } from '../../../../tools/_directives/confirm.directive';
+import { ValidatableDirective } from '../../../../tools/_directives/validatable.directive';
+import { DatetimePipe } from '../../../_pipes/datetime.pipe';
 
 @UntilDestroy()
 @Component({
@@ -47,6 +52,10 @@ import { SortableViewSettings } from '../../../_models/view';
         ListFooterComponent,
         LoaderDirective,
         DecimalPipe,
+        SpinnerDirective,
+        ConfirmDirective,
+        ValidatableDirective,
+        DatetimePipe,
     ],
     animations: [Animations.fadeIn('slow')],
 })
@@ -61,6 +70,9 @@ export class DomainUserManagerComponent implements OnInit {
     /** Whether there are more results to load. */
     canLoadMore = true;
 
+    /** Pending invitations to the domain. */
+    invitations?: DomainInvitation[];
+
     /** Map of users for the loaded domain users. */
     readonly userMap = new Map<string, User>();
 
@@ -69,15 +81,27 @@ export class DomainUserManagerComponent implements OnInit {
 
     readonly sort = new Sort(['email', 'name', 'created'], 'email', false);
     readonly loading = new ProcessingStatus();
+    readonly loadingInvitations = new ProcessingStatus();
+    readonly inviting = new ProcessingStatus();
+    readonly revoking = new ProcessingStatus();
 
     readonly filterForm = this.fb.nonNullable.group({
         filter: '',
     });
 
+    readonly inviteForm = this.fb.nonNullable.group({
+        email: ['', [Validators.required, Validators.email, Validators.maxLength(254)]],
+        role:  [DomainUserRole.Commenter as DomainUserRole, [Validators.required]],
+    });
+
+    readonly DomainUserRole = DomainUserRole;
+
     private loadedPageNum = 0;
 
     // Icons
     readonly faBan      = faBan;
+    readonly faEnvelope = faEnvelope;
+    readonly faTrashAlt = faTrashAlt;
     readonly faUserLock = faUserLock;
 
     constructor(
@@ -86,6 +110,7 @@ export class DomainUserManagerComponent implements OnInit {
         private readonly domainSelectorSvc: DomainSelectorService,
         private readonly configSvc: ConfigService,
         private readonly localSettingSvc: LocalSettingService,
+        private readonly toastSvc: ToastService,
     ) {
         // Restore the view settings
         localSettingSvc.load<SortableViewSettings>('domainUserManager').subscribe(s => s?.sort && (this.sort.asString = s.sort));
@@ -97,7 +122,8 @@ export class DomainUserManagerComponent implements OnInit {
             this.domainSelectorSvc.domainMeta(true)
                 .pipe(
                     untilDestroyed(this),
-                    tap(meta => this.domainMeta = meta)),
+                    tap(meta => this.domainMeta = meta),
+                    tap(() => this.loadInvitations())),
             // Subscribe to sort changes
             this.sort.changes,
             // Subscribe to filter changes
@@ -137,4 +163,42 @@ export class DomainUserManagerComponent implements OnInit {
                 this.localSettingSvc.storeValue<SortableViewSettings>('domainUserManager', {sort: this.sort.asString});
             });
     }
+
+    invite() {
+        // Mark all controls touched to display validation results
+        this.inviteForm.markAllAsTouched();
+
+        // Submit the form if it's valid
+        if (this.inviteForm.valid && this.domainMeta?.domain) {
+            const vals = this.inviteForm.value as Required<typeof this.inviteForm.value>;
+            this.api.domainInvitationNew(this.domainMeta.domain.id!, {email: vals.email, role: vals.role})
+                .pipe(this.inviting.processing())
+                .subscribe(() => {
+                    this.toastSvc.success('invitation-sent');
+                    this.inviteForm.reset();
+                    this.loadInvitations();
+                });
+        }
+    }
+
+    revoke(inv: DomainInvitation) {
+        this.api.domainInvitationDelete(inv.domainId!, inv.id!)
+            .pipe(this.revoking.processing())
+            .subscribe(() => {
+                this.toastSvc.success('invitation-revoked');
+                this.loadInvitations();
+            });
+    }
+
+    /**
+     * (Re)load pending invitations to the current domain.
+     */
+    private loadInvitations() {
+        this.invitations = undefined;
+        if (this.domainMeta?.domain) {
+            this.api.domainInvitationList(this.domainMeta.domain.id!)
+                .pipe(this.loadingInvitations.processing())
+                .subscribe(r => this.invitations = r);
+        }
+    }
 }
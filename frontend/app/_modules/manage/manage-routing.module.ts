@@ -28,6 +28,8 @@ import { StaticConfigComponent } from './config/static-config/static-config.comp
 import { DynamicConfigComponent } from './config/dynamic-config/dynamic-config.component';
 import { ConfigEditComponent } from './config/config-edit/config-edit.component';
 import { EmailUpdateComponent } from './account/email-update/email-update.component';
+import { ApiTokensComponent } from './account/api-tokens/api-tokens.component';
+import { SessionsComponent } from './account/sessions/sessions.component';
 import { DomainPageEditComponent } from './domains/domain-pages/domain-page-edit/domain-page-edit.component';
 import { DomainPageMoveDataComponent } from './domains/domain-pages/domain-page-move-data/domain-page-move-data.component';
 
@@ -98,6 +100,8 @@ const children: Routes = [
     // Account
     {path: 'account/profile',      component: ProfileComponent},
     {path: 'account/email',        component: EmailUpdateComponent, canActivate: [ManageGuard.isLocal]},
+    {path: 'account/api-tokens',   component: ApiTokensComponent},
+    {path: 'account/sessions',     component: SessionsComponent},
 ];
 
 // Make a parent route object, protected by the AuthGuard
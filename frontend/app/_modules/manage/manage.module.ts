@@ -64,11 +64,14 @@ import { PieStatsChartComponent } from './stats/pie-stats-chart/pie-stats-chart.
 import { TopPagesStatsComponent } from './stats/top-pages-stats/top-pages-stats.component';
 import { StatsComponent } from './stats/stats/stats.component';
 import { EmailUpdateComponent } from './account/email-update/email-update.component';
+import { ApiTokensComponent } from './account/api-tokens/api-tokens.component';
+import { SessionsComponent } from './account/sessions/sessions.component';
 import { DomainPageEditComponent } from './domains/domain-pages/domain-page-edit/domain-page-edit.component';
 import { SuperuserBadgeComponent } from './badges/superuser-badge/superuser-badge.component';
 
 @NgModule({
     imports: [
+        ApiTokensComponent,
         AttributeTableComponent,
         CommentListComponent,
         CommentManagerComponent,
@@ -126,6 +129,7 @@ import { SuperuserBadgeComponent } from './badges/superuser-badge/superuser-badg
         ProfileComponent,
         ReactiveFormsModule,
         RouterModule,
+        SessionsComponent,
         SortPropertyComponent,
         SortSelectorComponent,
         StaticConfigComponent,
@@ -12,7 +12,7 @@ import { LoaderDirective } from '../../../tools/_directives/loader.directive';
 import { ConfigService } from '../../../../_services/config.service';
 
 type DailyMetric = 'views' | 'comments';
-type PageViewDimension = 'country' | 'device' | 'browser' | 'os';
+type PageViewDimension = 'country' | 'region' | 'city' | 'device' | 'browser' | 'os' | 'referrer' | 'utmSource' | 'utmMedium' | 'utmCampaign';
 
 @Component({
     selector: 'app-stats',
@@ -43,10 +43,16 @@ export class StatsComponent {
     // Page views data
     pageViewsStats?: Partial<Record<PageViewDimension, StatsDimensionItem[]>>;
     readonly loadingPageViews: Record<PageViewDimension, ProcessingStatus> = {
-        country: new ProcessingStatus(true),
-        device:  new ProcessingStatus(true),
-        browser: new ProcessingStatus(true),
-        os:      new ProcessingStatus(true),
+        country:     new ProcessingStatus(true),
+        region:      new ProcessingStatus(true),
+        city:        new ProcessingStatus(true),
+        device:      new ProcessingStatus(true),
+        browser:     new ProcessingStatus(true),
+        os:          new ProcessingStatus(true),
+        referrer:    new ProcessingStatus(true),
+        utmSource:   new ProcessingStatus(true),
+        utmMedium:   new ProcessingStatus(true),
+        utmCampaign: new ProcessingStatus(true),
     };
 
     // Top pages data
@@ -130,7 +136,7 @@ export class StatsComponent {
 
         // Iterate dimensions and load stats for each of them sequentially, to unburden the backend
         this.pageViewsStats = {};
-        of<PageViewDimension[]>('country', 'device', 'browser', 'os')
+        of<PageViewDimension[]>('country', 'region', 'city', 'device', 'browser', 'os', 'referrer', 'utmSource', 'utmMedium', 'utmCampaign')
             .pipe(
                 concatMap(dim =>
                     this.api.dashboardPageViewStats(dim, this.numberOfDays(), domainId)
@@ -1,11 +1,11 @@
 import { Component, computed, effect, input } from '@angular/core';
 import { toObservable, toSignal } from '@angular/core/rxjs-interop';
 import { Router, RouterLink } from '@angular/router';
-import { FormBuilder, ReactiveFormsModule } from '@angular/forms';
+import { FormBuilder, ReactiveFormsModule, Validators } from '@angular/forms';
 import { BehaviorSubject, combineLatestWith, EMPTY, switchMap, tap } from 'rxjs';
 import { UntilDestroy, untilDestroyed } from '@ngneat/until-destroy';
 import { FaIconComponent } from '@fortawesome/angular-fontawesome';
-import { faBan, faCalendarXmark, faEdit, faLockOpen, faTrashAlt } from '@fortawesome/free-solid-svg-icons';
+import { faBan, faCalendarXmark, faCodeMerge, faEdit, faLockOpen, faTrashAlt } from '@fortawesome/free-solid-svg-icons';
 import { ApiGeneralService, Domain, UserGet200Response, UserSession } from '../../../../../generated-api';
 import { ProcessingStatus } from '../../../../_utils/processing-status';
 import { Paths } from '../../../../_utils/consts';
@@ -86,6 +86,7 @@ export class UserPropertiesComponent {
     readonly unlocking        = new ProcessingStatus();
     readonly banning          = new ProcessingStatus();
     readonly deleting         = new ProcessingStatus();
+    readonly merging          = new ProcessingStatus();
     readonly expiringSessions = new ProcessingStatus();
 
     readonly banConfirmationForm = this.fb.nonNullable.group({
@@ -98,9 +99,14 @@ export class UserPropertiesComponent {
         purgeComments:  [{value: false, disabled: true}],
     });
 
+    readonly mergeConfirmationForm = this.fb.nonNullable.group({
+        sourceUserId: ['', [Validators.required, Validators.pattern(/^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/i)]],
+    });
+
     // Icons
     readonly faBan           = faBan;
     readonly faCalendarXmark = faCalendarXmark;
+    readonly faCodeMerge     = faCodeMerge;
     readonly faEdit          = faEdit;
     readonly faLockOpen      = faLockOpen;
     readonly faTrashAlt      = faTrashAlt;
@@ -160,6 +166,24 @@ export class UserPropertiesComponent {
         }
     }
 
+    merge() {
+        const u = this.user();
+        if (u) {
+            this.api.userMerge(u.id!, {sourceUserId: this.mergeConfirmationForm.value.sourceUserId!.trim().toLowerCase()})
+                .pipe(this.merging.processing(), tap(this.reload$))
+                .subscribe(r => {
+                    this.mergeConfirmationForm.reset();
+                    this.loadSessions(true);
+
+                    // Add a success toast
+                    this.toastSvc.success({
+                        messageId: 'users-merged',
+                        details:   $localize`Reassigned ${r.countComments} comment references, ${r.countVotes} votes, ${r.countDomainUsers} domain roles, ${r.countSessions} sessions, and ${r.countAttrs} attributes`,
+                    });
+                });
+        }
+    }
+
     /**
      * Load or reload sessions of the current user.
      * @param reset Whether to reset the list prior to load.
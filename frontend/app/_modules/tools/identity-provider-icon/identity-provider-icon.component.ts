@@ -1,6 +1,6 @@
 import { Component, computed, input } from '@angular/core';
 import { FaIconComponent } from '@fortawesome/angular-fontawesome';
-import { faIdCard, faQuestionCircle, IconDefinition } from '@fortawesome/free-solid-svg-icons';
+import { faAddressBook, faIdBadge, faIdCard, faQuestionCircle, IconDefinition } from '@fortawesome/free-solid-svg-icons';
 import { faFacebook, faGithub, faGitlab, faGoogle, faOpenid, faTwitter } from '@fortawesome/free-brands-svg-icons';
 
 @Component({
@@ -33,6 +33,9 @@ export class IdentityProviderIconComponent {
             case 'google':
                 return faGoogle;
 
+            case 'ldap':
+                return faAddressBook;
+
             case 'twitter':
                 return faTwitter;
 
@@ -41,7 +44,8 @@ export class IdentityProviderIconComponent {
             case '':
                 return this.sso() ? faIdCard : undefined;
         }
-        return this.idpId()?.startsWith('oidc:') ? faOpenid : faQuestionCircle;
+        const id = this.idpId();
+        return id?.startsWith('oidc:') || id?.startsWith('doidc:') ? faOpenid : id?.startsWith('saml:') ? faIdBadge : faQuestionCircle;
     });
 
     /** Icon title. */
@@ -60,9 +64,12 @@ export class IdentityProviderIconComponent {
             case 'google':
                 return 'Google';
 
+            case 'ldap':
+                return 'LDAP';
+
             case 'twitter':
                 return 'Twitter/X';
         }
-        return id?.startsWith('oidc:') ? id?.substring(5) : '';
+        return id?.startsWith('oidc:') || id?.startsWith('saml:') ? id?.substring(5) : '';
     });
 }
@@ -107,7 +107,7 @@ describe('AuthService', () => {
                 // Verify
                 .subscribe({
                     next: p => {
-                        expect(api.authLogin).toHaveBeenCalledOnceWith({email: 'whatever', password: 'secret'});
+                        expect(api.authLogin).toHaveBeenCalledOnceWith({email: 'whatever', password: 'secret', totpCode: undefined});
                         expect(p.id).toBe('two');
                     },
                     error: fail,
@@ -27,9 +27,10 @@ export class AuthService {
      * Log into the server and return the principal.
      * @param email User's email.
      * @param password User's password.
+     * @param totpCode Optional two-factor authentication code.
      */
-    login(email: string, password: string): Observable<Principal> {
-        return this.api.authLogin({email, password})
+    login(email: string, password: string, totpCode?: string): Observable<Principal> {
+        return this.api.authLogin({email, password, totpCode})
             .pipe(map(p => {
                 // Store the returned principal
                 this.principalSvc.setPrincipal(p);
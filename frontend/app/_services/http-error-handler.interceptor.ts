@@ -8,6 +8,9 @@ import { PrincipalService } from './principal.service';
 /** HTTP context token that, when set to false, inhibits the standard error handling (error toasts and such). */
 export const HTTP_ERROR_HANDLING = new HttpContextToken<boolean>(() => true);
 
+/** IDs of 401 errors that are returned by login attempts, and hence don't mean the user's session is gone. */
+const LOGIN_ERROR_IDS = ['invalid-credentials', 'invalid-totp-code', 'totp-code-required'];
+
 /** HTTP interceptor function that catches errors from HTTP requests and displays a corresponding error toasts. */
 export const httpErrorHandlerInterceptor: HttpInterceptorFn = (req, next) => {
     // Inject the dependencies
@@ -27,7 +30,7 @@ export const httpErrorHandlerInterceptor: HttpInterceptorFn = (req, next) => {
                     toastSvc.error({messageId: errorId, errorCode: -1, details, error: error.error});
 
                 // 401 Unauthorized from the backend, but not a login-related error
-                } else if (error.status === 401 && errorId !== 'invalid-credentials') {
+                } else if (error.status === 401 && !LOGIN_ERROR_IDS.includes(errorId)) {
                     // Remove the current principal if it's a 401 error, which means the user isn't logged in (anymore)
                     principalSvc.setPrincipal(undefined);
 
@@ -0,0 +1,34 @@
+import { TestBed } from '@angular/core/testing';
+import { MockProvider } from 'ng-mocks';
+import { PasskeyService } from './passkey.service';
+import { ApiGeneralService } from '../../generated-api';
+
+describe('PasskeyService', () => {
+
+    let service: PasskeyService;
+
+    beforeEach(() => {
+        TestBed.configureTestingModule({
+            providers: [MockProvider(ApiGeneralService)],
+        });
+        service = TestBed.inject(PasskeyService);
+    });
+
+    it('is created', () => {
+        expect(service).toBeTruthy();
+    });
+
+    [
+        {in: '',         want: ''},
+        {in: 'f',        want: 'Zg'},
+        {in: 'fo',       want: 'Zm8'},
+        {in: 'foo',      want: 'Zm9v'},
+        {in: '\xfb\xff', want: '-_8'},
+    ]
+        .forEach(test =>
+            it(`encodes and decodes '${test.in}'`, () => {
+                const buf = Uint8Array.from(test.in, c => c.charCodeAt(0));
+                expect(PasskeyService.encode(buf.buffer)).toBe(test.want);
+                expect(PasskeyService.decode(test.want)).toEqual(buf);
+            }));
+});
@@ -0,0 +1,102 @@
+import { Injectable } from '@angular/core';
+import { from, Observable, switchMap } from 'rxjs';
+import { ApiGeneralService, UserPasskey } from '../../generated-api';
+
+@Injectable({
+    providedIn: 'root',
+})
+export class PasskeyService {
+
+    constructor(
+        private readonly api: ApiGeneralService,
+    ) {}
+
+    /**
+     * Whether the browser supports passkeys (WebAuthn).
+     */
+    get isSupported(): boolean {
+        return !!window.PublicKeyCredential && !!navigator.credentials;
+    }
+
+    /**
+     * Run a passkey login ceremony, which, if successful, binds the provided anonymous token to the passkey owner. The
+     * token can then be redeemed to log in.
+     * @param token Anonymous token with the 'login' scope.
+     */
+    authenticate(token: string): Observable<void> {
+        return this.api.authPasskeyBegin({token})
+            .pipe(
+                // Ask the authenticator to sign the challenge
+                switchMap(ch => from(navigator.credentials.get({
+                        publicKey: {
+                            challenge:        PasskeyService.decode(ch.challenge),
+                            rpId:             ch.rpId,
+                            timeout:          ch.timeout,
+                            userVerification: 'preferred',
+                        },
+                    }))
+                    .pipe(switchMap(cred => {
+                        const c = cred as PublicKeyCredential;
+                        const resp = c.response as AuthenticatorAssertionResponse;
+                        // Submit the assertion
+                        return this.api.authPasskeyFinish({
+                            sessionId:         ch.sessionId,
+                            credentialId:      PasskeyService.encode(c.rawId),
+                            clientDataJson:    PasskeyService.encode(resp.clientDataJSON),
+                            authenticatorData: PasskeyService.encode(resp.authenticatorData),
+                            signature:         PasskeyService.encode(resp.signature),
+                        });
+                    }))));
+    }
+
+    /**
+     * Run a passkey registration ceremony for the current user and return the new passkey.
+     * @param name Name of the passkey.
+     * @param email Email of the current user, to tell the account apart in the authenticator.
+     * @param displayName Name of the current user.
+     */
+    register(name: string, email: string, displayName: string): Observable<UserPasskey> {
+        return this.api.curUserPasskeyBegin()
+            .pipe(
+                // Ask the authenticator to create a new credential
+                switchMap(r => from(navigator.credentials.create({
+                        publicKey: {
+                            challenge:              PasskeyService.decode(r.challenge.challenge),
+                            rp:                     {id: r.challenge.rpId, name: r.rpName},
+                            user:                   {id: PasskeyService.decode(r.userHandle), name: email, displayName},
+                            pubKeyCredParams:       r.algorithms.map(alg => ({type: 'public-key', alg})),
+                            excludeCredentials:     r.excludeCredentials.map(id => ({type: 'public-key', id: PasskeyService.decode(id)})),
+                            timeout:                r.challenge.timeout,
+                            attestation:            'none',
+                            authenticatorSelection: {residentKey: 'preferred', userVerification: 'preferred'},
+                        },
+                    }))
+                    .pipe(switchMap(cred => {
+                        const resp = (cred as PublicKeyCredential).response as AuthenticatorAttestationResponse;
+                        // Submit the new credential
+                        return this.api.curUserPasskeyAdd({
+                            sessionId:         r.challenge.sessionId,
+                            name,
+                            clientDataJson:    PasskeyService.encode(resp.clientDataJSON),
+                            attestationObject: PasskeyService.encode(resp.attestationObject),
+                        });
+                    }))));
+    }
+
+    /**
+     * Encode the given binary value into a base64url string.
+     */
+    static encode(buf: ArrayBuffer): string {
+        return btoa(String.fromCharCode(...new Uint8Array(buf)))
+            .replace(/\+/g, '-')
+            .replace(/\//g, '_')
+            .replace(/=+$/, '');
+    }
+
+    /**
+     * Decode the given base64url string into a binary value.
+     */
+    static decode(s: string): Uint8Array {
+        return Uint8Array.from(atob(s.replace(/-/g, '+').replace(/_/g, '/')), c => c.charCodeAt(0));
+    }
+}
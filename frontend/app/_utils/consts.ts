@@ -7,7 +7,11 @@ export const Paths = {
     // Auth
     auth: {
         forgotPassword: '/auth/forgotPassword',
+        invitation:     '/auth/invitation',
+        ldap:           '/auth/ldap',
         login:          '/auth/login',
+        loginRevoke:    '/auth/loginRevoke',
+        passkey:        '/auth/passkey',
         resetPassword:  '/auth/resetPassword',
         signup:         '/auth/signup',
     },
@@ -28,6 +32,8 @@ export const Paths = {
         account: {
             profile:    '/manage/account/profile',
             email:      '/manage/account/email',
+            apiTokens:  '/manage/account/api-tokens',
+            sessions:   '/manage/account/sessions',
         },
     },
 
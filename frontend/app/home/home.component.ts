@@ -26,6 +26,8 @@ export class HomeComponent {
     /** Handlers to execute when a specific parameter is present */
     private readonly paramHandlers: Record<string, (value: string, allParams: ParamMap) => any> = {
         authToken:          (token, allParams) => this.handleAuth(token, allParams),
+        invitationToken:    token => this.handleInvitation(token),
+        loginRevokeToken:   (token, allParams) => this.handleLoginRevoke(token, allParams),
         passwordResetToken: token => this.handlePasswordReset(token),
         unsubscribed:       () => this.toastSvc.success('unsubscribed-ok'),
     };
@@ -77,6 +79,22 @@ export class HomeComponent {
             .subscribe(() => allParams.has('path') && this.router.navigateByUrl(allParams.get('path')!));
     }
 
+    /**
+     * Handles accepting a domain invitation, when provided a token with the 'domain-invite' scope.
+     */
+    private handleInvitation(token: string) {
+        this.canRedirect = false;
+        this.router.navigate([Paths.auth.invitation], {state: {token}});
+    }
+
+    /**
+     * Handles revoking an unrecognised login session, when provided a token with the 'login-revoke' scope.
+     */
+    private handleLoginRevoke(token: string, allParams: ParamMap) {
+        this.canRedirect = false;
+        this.router.navigate([Paths.auth.loginRevoke], {state: {token, session: allParams.get('session')}});
+    }
+
     /**
      * Handles password reset, when provided a token with the 'pwd-reset' scope.
      */
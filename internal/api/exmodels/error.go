@@ -54,7 +54,9 @@ var (
 	ErrorImmutableProperty     = &Error{ID: "immutable-property", Message: "Property cannot be updated"}
 	ErrorInvalidCredentials    = &Error{ID: "invalid-credentials", Message: "Wrong password or user doesn't exist"}
 	ErrorInvalidInputData      = &Error{ID: "invalid-input-data", Message: "Invalid input data provided"}
+	ErrorInvalidPasskey        = &Error{ID: "invalid-passkey", Message: "Passkey verification failed"}
 	ErrorInvalidPropertyValue  = &Error{ID: "invalid-prop-value", Message: "Value of the property is invalid"}
+	ErrorInvalidTOTPCode       = &Error{ID: "invalid-totp-code", Message: "Wrong two-factor authentication code"}
 	ErrorInvalidUUID           = &Error{ID: "invalid-uuid", Message: "Invalid UUID value"}
 	ErrorLoginLocally          = &Error{ID: "login-locally", Message: "There's already a registered account with this email. Please login with your email and password instead"}
 	ErrorLoginUsingIdP         = &Error{ID: "login-using-idp", Message: "There's already a registered account with this email. Please login via the correct federated identity provider instead"}
@@ -68,11 +70,14 @@ var (
 	ErrorNotModerator          = &Error{ID: "not-moderator", Message: "User is not a moderator"}
 	ErrorPagePathAlreadyExists = &Error{ID: "page-path-already-exists", Message: "This page path is already used by another page"}
 	ErrorPageReadonly          = &Error{ID: "page-readonly", Message: "This page is read-only"}
+	ErrorPasswordCompromised   = &Error{ID: "password-compromised", Message: "This password is known to be compromised. Please choose another one"}
 	ErrorResourceFetchFailed   = &Error{ID: "resource-fetch-failed", Message: "Failed to fetch external resource"}
 	ErrorSelfOperation         = &Error{ID: "self-operation", Message: "You cannot do this to yourself"}
 	ErrorSelfVote              = &Error{ID: "self-vote", Message: "You cannot vote for your own comment"}
 	ErrorSignupsForbidden      = &Error{ID: "signups-forbidden", Message: "New signups are forbidden"}
 	ErrorSSOMisconfigured      = &Error{ID: "sso-misconfigured", Message: "Domain's SSO configuration is invalid"}
+	ErrorTOTPCodeRequired      = &Error{ID: "totp-code-required", Message: "Two-factor authentication code is required"}
+	ErrorTOTPRequired          = &Error{ID: "totp-required", Message: "You must enable two-factor authentication to perform this operation"}
 	ErrorUnauthenticated       = &Error{ID: "unauthenticated", Message: "User isn't authenticated"}
 	ErrorUnauthorized          = &Error{ID: "unauthorized", Message: "You are not allowed to perform this operation"}
 	ErrorUnknownHost           = &Error{ID: "unknown-host", Message: "Unknown host"}
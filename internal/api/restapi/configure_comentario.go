@@ -42,6 +42,7 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.Logger = logger.Infof
 	api.JSONConsumer = runtime.JSONConsumer()
 	api.JSONProducer = runtime.JSONProducer()
+	api.CsvProducer = runtime.ByteStreamProducer()
 	api.GzipProducer = runtime.ByteStreamProducer()
 	api.HTMLProducer = runtime.TextProducer()
 	api.XMLProducer = XMLAndRSSProducer()
@@ -66,6 +67,7 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 
 	// Set up auth handlers
 	authSvc := svc.Services.AuthService(nil)
+	api.APITokenAuth = authSvc.AuthenticateAPIToken
 	api.TokenAuth = authSvc.AuthenticateBearerToken
 	api.UserSessionHeaderAuth = authSvc.AuthenticateUserBySessionHeader
 	api.UserCookieAuth = authSvc.AuthenticateUserByCookieHeader
@@ -77,7 +79,10 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	// Auth
 	api.APIGeneralAuthConfirmHandler = api_general.AuthConfirmHandlerFunc(handlers.AuthConfirm)
 	api.APIGeneralAuthDeleteProfileHandler = api_general.AuthDeleteProfileHandlerFunc(handlers.AuthDeleteProfile)
+	api.APIGeneralAuthInvitationAcceptHandler = api_general.AuthInvitationAcceptHandlerFunc(handlers.AuthInvitationAccept)
+	api.APIGeneralAuthInvitationGetHandler = api_general.AuthInvitationGetHandlerFunc(handlers.AuthInvitationGet)
 	api.APIGeneralAuthLoginHandler = api_general.AuthLoginHandlerFunc(handlers.AuthLogin)
+	api.APIGeneralAuthLoginRevokeHandler = api_general.AuthLoginRevokeHandlerFunc(handlers.AuthLoginRevoke)
 	api.APIGeneralAuthLoginTokenNewHandler = api_general.AuthLoginTokenNewHandlerFunc(handlers.AuthLoginTokenNew)
 	api.APIGeneralAuthLoginTokenRedeemHandler = api_general.AuthLoginTokenRedeemHandlerFunc(handlers.AuthLoginTokenRedeem)
 	api.APIGeneralAuthLogoutHandler = api_general.AuthLogoutHandlerFunc(handlers.AuthLogout)
@@ -87,6 +92,14 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	// OAuth
 	api.APIGeneralAuthOauthCallbackHandler = api_general.AuthOauthCallbackHandlerFunc(handlers.AuthOauthCallback)
 	api.APIGeneralAuthOauthInitHandler = api_general.AuthOauthInitHandlerFunc(handlers.AuthOauthInit)
+	// LDAP
+	api.APIGeneralAuthLdapLoginHandler = api_general.AuthLdapLoginHandlerFunc(handlers.AuthLdapLogin)
+	// SAML
+	api.APIGeneralAuthSamlAcsHandler = api_general.AuthSamlAcsHandlerFunc(handlers.AuthSamlAcs)
+	api.APIGeneralAuthSamlMetadataHandler = api_general.AuthSamlMetadataHandlerFunc(handlers.AuthSamlMetadata)
+	// Passkeys
+	api.APIGeneralAuthPasskeyBeginHandler = api_general.AuthPasskeyBeginHandlerFunc(handlers.AuthPasskeyBegin)
+	api.APIGeneralAuthPasskeyFinishHandler = api_general.AuthPasskeyFinishHandlerFunc(handlers.AuthPasskeyFinish)
 	// Config
 	api.APIGeneralConfigDynamicResetHandler = api_general.ConfigDynamicResetHandlerFunc(handlers.ConfigDynamicReset)
 	api.APIGeneralConfigDynamicUpdateHandler = api_general.ConfigDynamicUpdateHandlerFunc(handlers.ConfigDynamicUpdate)
@@ -94,18 +107,37 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralConfigGetHandler = api_general.ConfigGetHandlerFunc(handlers.ConfigGet)
 	api.APIGeneralConfigVersionsGetHandler = api_general.ConfigVersionsGetHandlerFunc(handlers.ConfigVersionsGet)
 	// Mail
+	api.APIGeneralDomainInvitationDeleteHandler = api_general.DomainInvitationDeleteHandlerFunc(handlers.DomainInvitationDelete)
+	api.APIGeneralDomainInvitationListHandler = api_general.DomainInvitationListHandlerFunc(handlers.DomainInvitationList)
+	api.APIGeneralDomainInvitationNewHandler = api_general.DomainInvitationNewHandlerFunc(handlers.DomainInvitationNew)
 	api.APIGeneralMailUnsubscribeHandler = api_general.MailUnsubscribeHandlerFunc(handlers.MailUnsubscribe)
 	// CurUser
+	api.APIGeneralCurUserAPITokenDeleteHandler = api_general.CurUserAPITokenDeleteHandlerFunc(handlers.CurUserAPITokenDelete)
+	api.APIGeneralCurUserAPITokenListHandler = api_general.CurUserAPITokenListHandlerFunc(handlers.CurUserAPITokenList)
+	api.APIGeneralCurUserAPITokenNewHandler = api_general.CurUserAPITokenNewHandlerFunc(handlers.CurUserAPITokenNew)
+	api.APIGeneralCurUserDataExportHandler = api_general.CurUserDataExportHandlerFunc(handlers.CurUserDataExport)
+	api.APIGeneralCurUserDataExportRequestHandler = api_general.CurUserDataExportRequestHandlerFunc(handlers.CurUserDataExportRequest)
 	api.APIGeneralCurUserEmailUpdateConfirmHandler = api_general.CurUserEmailUpdateConfirmHandlerFunc(handlers.CurUserEmailUpdateConfirm)
 	api.APIGeneralCurUserEmailUpdateRequestHandler = api_general.CurUserEmailUpdateRequestHandlerFunc(handlers.CurUserEmailUpdateRequest)
 	api.APIGeneralCurUserGetHandler = api_general.CurUserGetHandlerFunc(handlers.CurUserGet)
+	api.APIGeneralCurUserPasskeyAddHandler = api_general.CurUserPasskeyAddHandlerFunc(handlers.CurUserPasskeyAdd)
+	api.APIGeneralCurUserPasskeyBeginHandler = api_general.CurUserPasskeyBeginHandlerFunc(handlers.CurUserPasskeyBegin)
+	api.APIGeneralCurUserPasskeyListHandler = api_general.CurUserPasskeyListHandlerFunc(handlers.CurUserPasskeyList)
 	api.APIGeneralCurUserSetAvatarFromGravatarHandler = api_general.CurUserSetAvatarFromGravatarHandlerFunc(handlers.CurUserSetAvatarFromGravatar)
 	api.APIGeneralCurUserSetAvatarHandler = api_general.CurUserSetAvatarHandlerFunc(handlers.CurUserSetAvatar)
+	api.APIGeneralCurUserSessionExpireHandler = api_general.CurUserSessionExpireHandlerFunc(handlers.CurUserSessionExpire)
+	api.APIGeneralCurUserSessionListHandler = api_general.CurUserSessionListHandlerFunc(handlers.CurUserSessionList)
+	api.APIGeneralCurUserSessionsExpireHandler = api_general.CurUserSessionsExpireHandlerFunc(handlers.CurUserSessionsExpire)
+	api.APIGeneralCurUserTotpDisableHandler = api_general.CurUserTotpDisableHandlerFunc(handlers.CurUserTotpDisable)
+	api.APIGeneralCurUserTotpEnableHandler = api_general.CurUserTotpEnableHandlerFunc(handlers.CurUserTotpEnable)
+	api.APIGeneralCurUserTotpInitHandler = api_general.CurUserTotpInitHandlerFunc(handlers.CurUserTotpInit)
 	api.APIGeneralCurUserUpdateHandler = api_general.CurUserUpdateHandlerFunc(handlers.CurUserUpdate)
 	// Dashboard
 	api.APIGeneralDashboardDailyStatsHandler = api_general.DashboardDailyStatsHandlerFunc(handlers.DashboardDailyStats)
+	api.APIGeneralDashboardEngagementStatsHandler = api_general.DashboardEngagementStatsHandlerFunc(handlers.DashboardEngagementStats)
 	api.APIGeneralDashboardPageStatsHandler = api_general.DashboardPageStatsHandlerFunc(handlers.DashboardPageStats)
 	api.APIGeneralDashboardPageViewStatsHandler = api_general.DashboardPageViewStatsHandlerFunc(handlers.DashboardPageViewStats)
+	api.APIGeneralDashboardSeriesStatsHandler = api_general.DashboardSeriesStatsHandlerFunc(handlers.DashboardSeriesStats)
 	api.APIGeneralDashboardTotalsHandler = api_general.DashboardTotalsHandlerFunc(handlers.DashboardTotals)
 	// Domains
 	api.APIGeneralDomainClearHandler = api_general.DomainClearHandlerFunc(handlers.DomainClear)
@@ -116,8 +148,14 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralDomainImportHandler = api_general.DomainImportHandlerFunc(handlers.DomainImport)
 	api.APIGeneralDomainListHandler = api_general.DomainListHandlerFunc(handlers.DomainList)
 	api.APIGeneralDomainNewHandler = api_general.DomainNewHandlerFunc(handlers.DomainNew)
+	api.APIGeneralDomainOidcProviderDeleteHandler = api_general.DomainOidcProviderDeleteHandlerFunc(handlers.DomainOidcProviderDelete)
+	api.APIGeneralDomainOidcProviderListHandler = api_general.DomainOidcProviderListHandlerFunc(handlers.DomainOidcProviderList)
+	api.APIGeneralDomainOidcProviderNewHandler = api_general.DomainOidcProviderNewHandlerFunc(handlers.DomainOidcProviderNew)
+	api.APIGeneralDomainOidcProviderUpdateHandler = api_general.DomainOidcProviderUpdateHandlerFunc(handlers.DomainOidcProviderUpdate)
 	api.APIGeneralDomainPurgeHandler = api_general.DomainPurgeHandlerFunc(handlers.DomainPurge)
+	api.APIGeneralDomainStatsExportHandler = api_general.DomainStatsExportHandlerFunc(handlers.DomainStatsExport)
 	api.APIGeneralDomainSsoSecretNewHandler = api_general.DomainSsoSecretNewHandlerFunc(handlers.DomainSsoSecretNew)
+	api.APIGeneralDomainSsoUserSyncHandler = api_general.DomainSsoUserSyncHandlerFunc(handlers.DomainSsoUserSync)
 	api.APIGeneralDomainReadonlyHandler = api_general.DomainReadonlyHandlerFunc(handlers.DomainReadonly)
 	api.APIGeneralDomainUpdateHandler = api_general.DomainUpdateHandlerFunc(handlers.DomainUpdate)
 	// Domain pages
@@ -143,6 +181,7 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	api.APIGeneralUserDeleteHandler = api_general.UserDeleteHandlerFunc(handlers.UserDelete)
 	api.APIGeneralUserGetHandler = api_general.UserGetHandlerFunc(handlers.UserGet)
 	api.APIGeneralUserListHandler = api_general.UserListHandlerFunc(handlers.UserList)
+	api.APIGeneralUserMergeHandler = api_general.UserMergeHandlerFunc(handlers.UserMerge)
 	api.APIGeneralUserSessionListHandler = api_general.UserSessionListHandlerFunc(handlers.UserSessionList)
 	api.APIGeneralUserSessionsExpireHandler = api_general.UserSessionsExpireHandlerFunc(handlers.UserSessionsExpire)
 	api.APIGeneralUserUnlockHandler = api_general.UserUnlockHandlerFunc(handlers.UserUnlock)
@@ -196,6 +235,7 @@ func configureAPI(api *operations.ComentarioAPI) http.Handler {
 	// Set up the middleware
 	chain := alice.New(
 		webSocketsHandler,
+		metricsHandler,
 		redirectToLangRootHandler,
 		corsHandler,
 	)
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/swag"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"time"
+)
+
+func CurUserAPITokenDelete(params api_general.CurUserAPITokenDeleteParams, user *data.User) middleware.Responder {
+	// Parse the token ID
+	id, r := parseUUID(params.UUID)
+	if r != nil {
+		return r
+	}
+
+	// Delete the token, making sure it belongs to the user
+	if err := svc.Services.APITokenService(nil).DeleteByUserID(&user.ID, id); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserAPITokenDeleteNoContent()
+}
+
+func CurUserAPITokenList(_ api_general.CurUserAPITokenListParams, user *data.User) middleware.Responder {
+	ts, err := svc.Services.APITokenService(nil).ListByUserID(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserAPITokenListOK().WithPayload(data.SliceToDTOs[*data.UserAPIToken, *models.APIToken](ts))
+}
+
+func CurUserAPITokenNew(params api_general.CurUserAPITokenNewParams, user *data.User) middleware.Responder {
+	// Validate the expiration time, if any
+	var expires sql.NullTime
+	if t := time.Time(params.Body.ExpiresTime); !t.IsZero() {
+		if !t.After(time.Now()) {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("expiresTime"))
+		}
+		expires = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+
+	// Convert the scopes
+	scopes := make([]data.APITokenScope, len(params.Body.Scopes))
+	for i, sc := range params.Body.Scopes {
+		scopes[i] = data.APITokenScope(sc)
+	}
+
+	// Create a new token
+	t, value, err := data.NewUserAPIToken(&user.ID, swag.StringValue(params.Body.Name), scopes, expires)
+	if err != nil {
+		return respInternalError(nil)
+	}
+
+	// Persist the token
+	if err := svc.Services.APITokenService(nil).Create(t); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserAPITokenNewOK().WithPayload(&api_general.CurUserAPITokenNewOKBody{
+		Token: t.ToDTO(),
+		Value: swag.String(value),
+	})
+}
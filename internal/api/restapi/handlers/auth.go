@@ -10,6 +10,7 @@ import (
 	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
 	"gitlab.com/comentario/comentario/internal/svc"
 	"gitlab.com/comentario/comentario/internal/util"
 	"net/http"
@@ -114,6 +115,7 @@ func AuthLogin(params api_general.AuthLoginParams) middleware.Responder {
 	user, us, r := loginLocalUser(
 		data.EmailPtrToString(params.Body.Email),
 		swag.StringValue(params.Body.Password),
+		params.Body.TotpCode,
 		"",
 		params.HTTPRequest)
 	if r != nil {
@@ -124,6 +126,51 @@ func AuthLogin(params api_general.AuthLoginParams) middleware.Responder {
 	return authAddUserSessionToResponse(api_general.NewAuthLoginOK(), user, us)
 }
 
+func AuthLoginRevoke(params api_general.AuthLoginRevokeParams, user *data.User) middleware.Responder {
+	// Parse the session ID
+	sessionID, r := parseUUIDPtr(params.Body.Session)
+	if r != nil {
+		return r
+	}
+
+	// Revoke the session. The password of a local user may be known to someone else, so also remove it, sign the user
+	// out everywhere, and issue a password reset token
+	var token *data.Token
+	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		// The session may have expired in the meantime, which is fine
+		us := svc.Services.UserService(tx)
+		if err := us.ExpireUserSession(&user.ID, sessionID); err != nil && !errors.Is(err, svc.ErrNotFound) {
+			return err
+		}
+
+		// Nothing else to do for a federated user
+		if !user.IsLocal() {
+			return nil
+		}
+		if err := us.Update(user.WithPassword("")); err != nil {
+			return err
+		}
+		if err := us.ExpireUserSessions(&user.ID, nil); err != nil {
+			return err
+		}
+		var err error
+		if token, err = data.NewToken(&user.ID, data.TokenScopeResetPassword, util.UserPwdResetDuration, false); err != nil {
+			return err
+		}
+		return svc.Services.TokenService(tx).Create(token)
+	})
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded. Return the password reset token, if any
+	resp := &api_general.AuthLoginRevokeOKBody{}
+	if token != nil {
+		resp.PasswordResetToken = token.Value
+	}
+	return api_general.NewAuthLoginRevokeOK().WithPayload(resp)
+}
+
 func AuthLoginTokenNew(_ api_general.AuthLoginTokenNewParams) middleware.Responder {
 	// Create an anonymous login token
 	t, err := authCreateLoginToken(nil)
@@ -161,13 +208,22 @@ func AuthLogout(params api_general.AuthLogoutParams, _ *data.User) middleware.Re
 }
 
 func AuthPwdResetChange(params api_general.AuthPwdResetChangeParams, user *data.User) middleware.Responder {
-	// Verify it's a local user
+	// Verify it's a local user and the new password isn't compromised
 	if r := Verifier.UserIsLocal(user); r != nil {
 		return r
+	} else if r := Verifier.PasswordNotCompromised(data.PasswordPtrToString(params.Body.Password)); r != nil {
+		return r
 	}
 
-	// Update the user's password
-	if err := svc.Services.UserService(nil /* TODO */).Update(user.WithPassword(data.PasswordPtrToString(params.Body.Password))); err != nil {
+	// Update the user's password and sign them out everywhere, since the old password may have been compromised
+	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		us := svc.Services.UserService(tx)
+		if err := us.Update(user.WithPassword(data.PasswordPtrToString(params.Body.Password))); err != nil {
+			return err
+		}
+		return us.ExpireUserSessions(&user.ID, nil)
+	})
+	if err != nil {
 		return respServiceError(err)
 	}
 
@@ -219,6 +275,11 @@ func AuthSignup(params api_general.AuthSignupParams) middleware.Responder {
 		return r
 	}
 
+	// Verify the password isn't compromised
+	if r := Verifier.PasswordNotCompromised(data.PasswordPtrToString(params.Body.Password)); r != nil {
+		return r
+	}
+
 	// Create a new user
 	user := data.NewUser(email, data.TrimmedString(params.Body.Name)).
 		WithLangFromReq(params.HTTPRequest).
@@ -293,9 +354,10 @@ func authAddUserSessionToResponse(resp PrincipalResponder, user *data.User, us *
 			http.SameSiteLaxMode)
 }
 
-// loginLocalUser tries to log a local user in using their email and password, returning the user and a new user
-// session. In case of error an error responder is returned
-func loginLocalUser(email, password, host string, req *http.Request) (*data.User, *data.UserSession, middleware.Responder) {
+// loginLocalUser tries to log a local user in using their email, password, and (for users with two-factor
+// authentication enabled) TOTP or recovery code, returning the user and a new user session. In case of error an error
+// responder is returned
+func loginLocalUser(email, password, totpCode, host string, req *http.Request) (*data.User, *data.UserSession, middleware.Responder) {
 	// Find the user
 	user, err := svc.Services.UserService(nil /* TODO */).FindUserByEmail(email)
 	if errors.Is(err, svc.ErrNotFound) || err == nil && !user.IsLocal() {
@@ -307,20 +369,30 @@ func loginLocalUser(email, password, host string, req *http.Request) (*data.User
 
 	// Verify the provided password
 	if !user.VerifyPassword(password) {
-		// Wrong password. Register the failed login attempt
-		user.WithLastLogin(false)
+		return nil, nil, loginFailed(user, exmodels.ErrorInvalidCredentials)
+	}
 
-		// Lock the user out if they exhausted the allowed attempts (and maxAttempts > 0)
-		if i := svc.Services.DynConfigService().GetInt(data.ConfigKeyAuthLoginLocalMaxAttempts); i > 0 && user.FailedLoginAttempts > i {
-			user.WithLocked(true)
+	// If the user has two-factor authentication enabled, verify the provided code
+	if user.TOTPEnabled {
+		prevStep, prevRecovery := user.TOTPLastStep, user.TOTPRecovery
+		if totpCode == "" {
+			// No code provided: the client is supposed to ask the user for one and retry
+			return nil, nil, respUnauthorized(exmodels.ErrorTOTPCodeRequired)
+		} else if !user.VerifyTOTP(totpCode) {
+			return nil, nil, loginFailed(user, exmodels.ErrorInvalidTOTPCode)
+
+			// Persist the used code right away, so that it can't be reused even if the login fails further on. If it's
+			// already been consumed by a concurrent login, reject it
+		} else if err := svc.Services.UserService(nil /* TODO */).UpdateTOTPUsage(user, prevStep, prevRecovery); errors.Is(err, svc.ErrNotFound) {
+			return nil, nil, loginFailed(user, exmodels.ErrorInvalidTOTPCode)
+		} else if err != nil {
+			return nil, nil, respServiceError(err)
 		}
+	}
 
-		// Persist ignoring possible errors
-		_ = svc.Services.UserService(nil /* TODO */).UpdateLoginLocked(user)
-
-		// Pause for a random while
-		util.RandomSleep(util.WrongAuthDelayMin, util.WrongAuthDelayMax)
-		return nil, nil, respUnauthorized(exmodels.ErrorInvalidCredentials)
+	// Upgrade the password hash if it's outdated. The user gets persisted along with their last login time
+	if user.PasswordNeedsRehash() {
+		user.WithPassword(password)
 	}
 
 	// Verify the user can log in and create a new session
@@ -332,6 +404,24 @@ func loginLocalUser(email, password, host string, req *http.Request) (*data.User
 	}
 }
 
+// loginFailed registers a failed login attempt for the given user, locking them out if they've exhausted the allowed
+// attempts, and returns an "Unauthorized" responder with the given error
+func loginFailed(user *data.User, err *exmodels.Error) middleware.Responder {
+	user.WithLastLogin(false)
+
+	// Lock the user out if they exhausted the allowed attempts (and maxAttempts > 0)
+	if i := svc.Services.DynConfigService().GetInt(data.ConfigKeyAuthLoginLocalMaxAttempts); i > 0 && user.FailedLoginAttempts > i {
+		user.WithLocked(true)
+	}
+
+	// Persist ignoring possible errors
+	_ = svc.Services.UserService(nil /* TODO */).UpdateLoginLocked(user)
+
+	// Pause for a random while
+	util.RandomSleep(util.WrongAuthDelayMin, util.WrongAuthDelayMax)
+	return respUnauthorized(err)
+}
+
 // loginUser verifies the user is allowed to authenticate, logs the given user in, and returns a new user session. In
 // case of error an error responder is returned
 func loginUser(user *data.User, host string, req *http.Request) (*data.UserSession, middleware.Responder) {
@@ -357,10 +447,44 @@ func loginUser(user *data.User, host string, req *http.Request) (*data.UserSessi
 		svc.Services.AvatarService(nil).SetFromGravatarAsync(&user.ID, user.Email, false)
 	}
 
+	// Notify the user if the login looks unusual, in the background
+	go func() {
+		if err := loginNotifyIfUnusual(user, us); err != nil {
+			logger.Warningf("Failed to check for unusual login of user %s: %v", &user.ID, err)
+		}
+	}()
+
 	// Succeeded
 	return us, nil
 }
 
+// loginNotifyIfUnusual compares the given new session with the user's recent sessions, and if it looks unusual, emails
+// the user a link for revoking it
+func loginNotifyIfUnusual(user *data.User, us *data.UserSession) error {
+	// Don't bother if there's no way to notify the user
+	if user.Email == "" || !util.TheMailer.Operational() {
+		return nil
+	}
+
+	// Fetch the user's recent sessions and compare them with the new one
+	if recent, err := svc.Services.UserService(nil).ListUserSessions(&user.ID, 0); err != nil {
+		return err
+	} else if !us.IsUnusual(recent) {
+		return nil
+	}
+
+	// Issue a token for revoking the session
+	token, err := data.NewToken(&user.ID, data.TokenScopeLoginRevoke, util.UserLoginRevokeDuration, false)
+	if err != nil {
+		return err
+	} else if err := svc.Services.TokenService(nil).Create(token); err != nil {
+		return err
+	}
+
+	// Send out a notification
+	return svc.Services.MailService().SendUnusualLogin(user, us, token)
+}
+
 // signupUser saves the given user and runs post-signup tasks
 func signupUser(user *data.User) middleware.Responder {
 	// Save the new user
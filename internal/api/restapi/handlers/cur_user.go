@@ -1,20 +1,78 @@
 package handlers
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/swag"
+	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
 	"gitlab.com/comentario/comentario/internal/svc"
 	"gitlab.com/comentario/comentario/internal/util"
+	"io"
+	"net/http"
 	"strings"
+	"time"
 )
 
+func CurUserDataExport(_ api_general.CurUserDataExportParams, user *data.User) middleware.Responder {
+	// Export the user's data
+	var b []byte
+	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		var err error
+		b, err = svc.Services.ImportExportService(tx).ExportUser(user)
+		return err
+	})
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded. Send the data as a file
+	return api_general.NewCurUserDataExportOK().
+		WithContentDisposition(
+			fmt.Sprintf(`attachment; filename="comentario-user-data-%s.json.gz"`, time.Now().UTC().Format("2006-01-02-15-04-05"))).
+		WithPayload(io.NopCloser(bytes.NewReader(b)))
+}
+
+func CurUserDataExportRequest(_ api_general.CurUserDataExportRequestParams, user *data.User) middleware.Responder {
+	// The export can only be delivered by email
+	if !util.TheMailer.Operational() {
+		return respForbidden(exmodels.ErrorFeatureDisabled.WithDetails("mailer isn't configured"))
+	}
+
+	// Only send personal data to a confirmed address
+	if !user.Confirmed {
+		return respForbidden(exmodels.ErrorEmailNotConfirmed)
+	}
+
+	// Create a new download token. It's multi-use so that an interrupted download can be retried until it expires
+	token, err := data.NewToken(&user.ID, data.TokenScopeDataExport, util.UserDataExportDuration, true)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Persist the token
+	if err := svc.Services.TokenService(nil).Create(token); err != nil {
+		return respServiceError(err)
+	}
+
+	// Send out an email with the download link
+	if err := svc.Services.MailService().SendDataExport(user, token); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserDataExportRequestNoContent()
+}
+
 func CurUserEmailUpdateConfirm(params api_general.CurUserEmailUpdateConfirmParams, user *data.User) middleware.Responder {
 	// Verify email change is (still) possible
 	newEmail := data.EmailToString(params.Email)
@@ -130,15 +188,153 @@ func CurUserSetAvatarFromGravatar(_ api_general.CurUserSetAvatarFromGravatarPara
 	return api_general.NewCurUserSetAvatarFromGravatarNoContent()
 }
 
+func CurUserSessionExpire(params api_general.CurUserSessionExpireParams, user *data.User) middleware.Responder {
+	// Parse the session ID
+	id, r := parseUUID(params.UUID)
+	if r != nil {
+		return r
+	}
+
+	// Expire the session, making sure it belongs to the user
+	if err := svc.Services.UserService(nil).ExpireUserSession(&user.ID, id); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserSessionExpireNoContent()
+}
+
+func CurUserSessionList(params api_general.CurUserSessionListParams, user *data.User) middleware.Responder {
+	// Fetch the user's active sessions
+	uss, err := svc.Services.UserService(nil).ListActiveUserSessions(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Convert the sessions into DTOs, marking the one the request is made in
+	curID := curUserSessionID(params.HTTPRequest)
+	dtos := data.SliceToDTOs[*data.UserSession, *models.UserSession](uss)
+	for i, us := range uss {
+		dtos[i].Current = curID != nil && us.ID == *curID
+	}
+
+	// Succeeded
+	return api_general.NewCurUserSessionListOK().WithPayload(dtos)
+}
+
+func CurUserSessionsExpire(params api_general.CurUserSessionsExpireParams, user *data.User) middleware.Responder {
+	// Find out the session the request is made in, which must stay intact
+	curID := curUserSessionID(params.HTTPRequest)
+	if curID == nil {
+		return respUnauthorized(nil)
+	}
+
+	// Expire all other sessions
+	if err := svc.Services.UserService(nil).ExpireUserSessions(&user.ID, curID); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserSessionsExpireNoContent()
+}
+
+func CurUserTotpDisable(params api_general.CurUserTotpDisableParams, user *data.User) middleware.Responder {
+	// Verify it's a local user
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Verify the provided password
+	if r := Verifier.UserCurrentPassword(user, swag.StringValue(params.Body.Password)); r != nil {
+		return r
+	}
+
+	// Remove the TOTP secret and recovery codes
+	if err := svc.Services.UserService(nil).Update(user.WithTOTP("")); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTotpDisableNoContent()
+}
+
+func CurUserTotpEnable(params api_general.CurUserTotpEnableParams, user *data.User) middleware.Responder {
+	// Verify it's a local user
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Verify enrolment has been started, but not completed yet
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		return respBadRequest(exmodels.ErrorNotAllowed.WithDetails("no pending two-factor authentication enrolment"))
+	}
+
+	// Verify the code produced with the pending secret
+	step := util.TOTPVerify(user.TOTPSecret, swag.StringValue(params.Body.Code), time.Now(), 0)
+	if step == 0 {
+		return respBadRequest(exmodels.ErrorInvalidTOTPCode)
+	}
+
+	// Generate recovery codes
+	codes, err := util.TOTPGenerateRecoveryCodes()
+	if err != nil {
+		return respInternalError(nil)
+	}
+
+	// Enable TOTP for the user
+	if err := svc.Services.UserService(nil).Update(user.WithTOTPEnabled(step, codes)); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserTotpEnableOK().
+		WithPayload(&api_general.CurUserTotpEnableOKBody{RecoveryCodes: codes})
+}
+
+func CurUserTotpInit(_ api_general.CurUserTotpInitParams, user *data.User) middleware.Responder {
+	// Verify it's a local user
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Don't allow replacing an active secret: 2FA must be explicitly disabled first
+	if user.TOTPEnabled {
+		return respBadRequest(exmodels.ErrorNotAllowed.WithDetails("two-factor authentication is already enabled"))
+	}
+
+	// Generate a new secret
+	secret, err := util.TOTPGenerateSecret()
+	if err != nil {
+		return respInternalError(nil)
+	}
+
+	// Store the (pending) secret
+	if err := svc.Services.UserService(nil).Update(user.WithTOTP(secret)); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	issuer := util.ApplicationName + " " + config.ServerConfig.ParsedBaseURL().Hostname()
+	return api_general.NewCurUserTotpInitOK().
+		WithPayload(&api_general.CurUserTotpInitOKBody{
+			Secret: swag.String(secret),
+			URI:    swag.String(util.TOTPProvisioningURI(issuer, user.Email, secret)),
+		})
+}
+
 func CurUserUpdate(params api_general.CurUserUpdateParams, user *data.User) middleware.Responder {
 	// If it's a local user
+	pwdChanged := false
 	if user.IsLocal() {
 		// If the password is getting changed, verify the current password
 		if params.Body.NewPassword != "" {
 			if r := Verifier.UserCurrentPassword(user, params.Body.CurPassword); r != nil {
 				return r
+			} else if r := Verifier.PasswordNotCompromised(string(params.Body.NewPassword)); r != nil {
+				return r
 			}
 			user.WithPassword(string(params.Body.NewPassword))
+			pwdChanged = true
 		}
 
 		// Update properties relevant to a local user
@@ -155,9 +351,31 @@ func CurUserUpdate(params api_general.CurUserUpdateParams, user *data.User) midd
 		return respBadRequest(exmodels.ErrorImmutableProperty.WithDetails("newPassword"))
 	}
 
-	// Update the user
+	// Parse IDs of passkeys to remove, if any
+	var removePasskeys []uuid.UUID
+	for _, sid := range params.Body.RemovePasskeys {
+		id, r := parseUUID(sid)
+		if r != nil {
+			return r
+		}
+		removePasskeys = append(removePasskeys, *id)
+	}
+
+	// Update the user and remove the passkeys. A password change also signs the user out everywhere else
 	user.WithLangID(swag.StringValue(params.Body.LangID))
-	if err := svc.Services.UserService(nil).Update(user); err != nil {
+	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		us := svc.Services.UserService(tx)
+		if err := us.Update(user); err != nil {
+			return err
+		}
+		if pwdChanged {
+			if err := us.ExpireUserSessions(&user.ID, curUserSessionID(params.HTTPRequest)); err != nil {
+				return err
+			}
+		}
+		return svc.Services.PasskeyService(tx).DeleteByUserID(&user.ID, removePasskeys)
+	})
+	if err != nil {
 		return respServiceError(err)
 	}
 
@@ -165,6 +383,20 @@ func CurUserUpdate(params api_general.CurUserUpdateParams, user *data.User) midd
 	return api_general.NewCurUserUpdateNoContent()
 }
 
+// curUserSessionID returns the ID of the user session the given request is made in, or nil if there's none. Just like
+// the authentication middleware, it looks at the X-User-Session header first, and at the session cookie then
+func curUserSessionID(r *http.Request) *uuid.UUID {
+	as := svc.Services.AuthService(nil)
+	if s := r.Header.Get(util.HeaderUserSession); s != "" {
+		if _, id, err := as.ExtractUserSessionIDs(s); err == nil {
+			return id
+		}
+	} else if _, id, err := as.FetchUserSessionIDFromCookie(r); err == nil {
+		return id
+	}
+	return nil
+}
+
 // signUserEmailUpdate signs the given user's email update using HMAC with SHA256
 func signUserEmailUpdate(u *data.User, newEmail string) []byte {
 	// Sign the new email with the client secret combined with the server's XSRF key
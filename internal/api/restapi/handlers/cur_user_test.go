@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/util"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_curUserSessionID(t *testing.T) {
+	userID := uuid.MustParse("6f0b3e4c-6fa4-4d4c-a1f5-9c6b0f3b4c7e")
+	cookieID := uuid.MustParse("0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d")
+	headerID := uuid.MustParse("f1e2d3c4-b5a6-4978-8a9b-0c1d2e3f4a5b")
+	encode := func(sessionID uuid.UUID) string {
+		return base64.RawURLEncoding.EncodeToString(append(userID[:], sessionID[:]...))
+	}
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   *uuid.UUID
+	}{
+		{"none            ", "", "", nil},
+		{"cookie          ", "", encode(cookieID), &cookieID},
+		{"header          ", encode(headerID), "", &headerID},
+		{"header & cookie ", encode(headerID), encode(cookieID), &headerID},
+		{"invalid cookie  ", "", "foo", nil},
+		{"invalid header  ", "foo", encode(cookieID), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/user/sessions", nil)
+			if tt.header != "" {
+				r.Header.Set(util.HeaderUserSession, tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: util.CookieNameUserSession, Value: tt.cookie})
+			}
+			if got := curUserSessionID(r); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("curUserSessionID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"fmt"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/swag"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/svc"
+	"gitlab.com/comentario/comentario/internal/util"
+	"time"
 )
 
 func DashboardDailyStats(params api_general.DashboardDailyStatsParams, user *data.User) middleware.Responder {
@@ -47,6 +51,23 @@ func DashboardDailyStats(params api_general.DashboardDailyStatsParams, user *dat
 	return api_general.NewDashboardDailyStatsOK().WithPayload(counts)
 }
 
+func DashboardEngagementStats(params api_general.DashboardEngagementStatsParams, user *data.User) middleware.Responder {
+	// Extract and parse the parameters
+	domainID, r := parseUUIDPtr(params.Domain)
+	if r != nil {
+		return r
+	}
+
+	// Collect stats
+	stats, err := svc.Services.StatsService(nil).GetEngagement(user.IsSuperuser, &user.ID, domainID, swag.Uint64Value(params.Days))
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDashboardEngagementStatsOK().WithPayload(stats.ToDTO())
+}
+
 func DashboardPageStats(params api_general.DashboardPageStatsParams, user *data.User) middleware.Responder {
 	// Extract and parse the parameters
 	numDays := swag.Uint64Value(params.Days)
@@ -91,12 +112,24 @@ func DashboardPageViewStats(params api_general.DashboardPageViewStatsParams, use
 		dim = "proto"
 	case "country":
 		dim = "country"
+	case "region":
+		dim = "region"
+	case "city":
+		dim = "city"
 	case "browser":
 		dim = "ua_browser_name"
 	case "os":
 		dim = "ua_os_name"
 	case "device":
 		dim = "ua_device"
+	case "referrer":
+		dim = "ref_host"
+	case "utmSource":
+		dim = "utm_source"
+	case "utmMedium":
+		dim = "utm_medium"
+	case "utmCampaign":
+		dim = "utm_campaign"
 	default:
 		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("dimension"))
 	}
@@ -111,6 +144,53 @@ func DashboardPageViewStats(params api_general.DashboardPageViewStatsParams, use
 	return api_general.NewDashboardPageViewStatsOK().WithPayload(stats)
 }
 
+func DashboardSeriesStats(params api_general.DashboardSeriesStatsParams, user *data.User) middleware.Responder {
+	// Extract and parse the parameters
+	domainID, r := parseUUIDPtr(params.Domain)
+	if r != nil {
+		return r
+	}
+	pageID, r := parseUUIDPtr(params.Page)
+	if r != nil {
+		return r
+	}
+
+	// Validate the granularity
+	g := data.StatsGranularity(swag.StringValue(params.Granularity))
+	if !g.IsValid() {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("granularity"))
+	}
+
+	// Validate the time range
+	from, to := time.Time(params.From), time.Time(params.To)
+	if !from.Before(to) {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("from/to"))
+	} else if n := g.BucketCount(from, to); n > util.StatsMaxBuckets {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails(fmt.Sprintf("too many buckets: %d (max %d)", n, util.StatsMaxBuckets)))
+	}
+
+	// Validate the metric, and that it can be filtered by page, if required
+	switch params.Metric {
+	case "comments", "domainPages", "views":
+		// OK
+	case "domainUsers":
+		if pageID != nil {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("page"))
+		}
+	default:
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails(params.Metric))
+	}
+
+	// Collect stats
+	buckets, err := svc.Services.StatsService(nil).GetSeries(user.IsSuperuser, params.Metric, &user.ID, domainID, pageID, from, to, g)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDashboardSeriesStatsOK().WithPayload(data.SliceToDTOs[*svc.StatsBucket, *models.StatsBucket](buckets))
+}
+
 func DashboardTotals(_ api_general.DashboardTotalsParams, user *data.User) middleware.Responder {
 	// Query the data
 	totals, err := svc.Services.StatsService(nil).GetTotals(user)
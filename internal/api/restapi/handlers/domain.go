@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
@@ -17,6 +19,7 @@ import (
 	"gitlab.com/comentario/comentario/internal/util"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -77,11 +80,18 @@ func DomainExport(params api_general.DomainExportParams, user *data.User) middle
 		return r
 	}
 
+	// Check if it's an incremental export
+	var since *time.Time
+	if params.Since != nil {
+		t := time.Time(*params.Since)
+		since = &t
+	}
+
 	// Export the data
 	var b []byte
 	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
 		var err error
-		b, err = svc.Services.ImportExportService(tx).Export(&d.ID)
+		b, err = svc.Services.ImportExportService(tx).Export(&d.ID, since)
 		return err
 	})
 	if err != nil {
@@ -124,6 +134,14 @@ func DomainGet(params api_general.DomainGetParams, user *data.User) middleware.R
 		return respServiceError(err)
 	}
 
+	// Role rules are only visible to those who can manage the domain
+	var rules []*data.DomainRoleRule
+	if user.IsSuperuser || du.IsAnOwner() {
+		if rules, err = svc.Services.DomainService(nil).ListDomainRoleRules(&d.ID); err != nil {
+			return respServiceError(err)
+		}
+	}
+
 	// If the user is a superuser, fetch domain attributes
 	var attr intf.AttrValues
 	if user.IsSuperuser {
@@ -140,6 +158,7 @@ func DomainGet(params api_general.DomainGetParams, user *data.User) middleware.R
 		DomainUser:      du.ToDTO(),
 		Extensions:      data.SliceToDTOs[*data.DomainExtension, *models.DomainExtension](exts),
 		FederatedIdpIds: idps,
+		RoleRules:       data.SliceToDTOs[*data.DomainRoleRule, *models.DomainRoleRule](rules),
 	})
 }
 
@@ -243,6 +262,11 @@ func DomainNew(params api_general.DomainNewParams, user *data.User) middleware.R
 		return r
 	}
 
+	// Validate SSO JWT settings
+	if r := Verifier.DomainSSOJWT(d); r != nil {
+		return r
+	}
+
 	// Validate domain configuration
 	if r := Verifier.DomainConfigItems(params.Body.Configuration); r != nil {
 		return r
@@ -259,6 +283,12 @@ func DomainNew(params api_general.DomainNewParams, user *data.User) middleware.R
 		return r
 	}
 
+	// Convert role rules
+	rules, r := domainConvertRoleRules(params.Body.RoleRules)
+	if r != nil {
+		return r
+	}
+
 	// Run in a transaction
 	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
 		ds := svc.Services.DomainService(tx)
@@ -273,6 +303,8 @@ func DomainNew(params api_general.DomainNewParams, user *data.User) middleware.R
 			func() error { return ds.SaveIdPs(&d.ID, params.Body.FederatedIdpIds) },
 			// Store the domain's extensions
 			func() error { return ds.SaveExtensions(&d.ID, exts) },
+			// Store the domain's role rules
+			func() error { return ds.SaveRoleRules(&d.ID, rules) },
 		})
 	})
 	if err != nil {
@@ -328,6 +360,210 @@ func DomainSsoSecretNew(params api_general.DomainSsoSecretNewParams, user *data.
 	return api_general.NewDomainSsoSecretNewOK().WithPayload(&api_general.DomainSsoSecretNewOKBody{SsoSecret: ss})
 }
 
+func DomainSsoUserSync(params api_general.DomainSsoUserSyncParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Make sure no user is mentioned twice in the batch, either by their ID or by their new email
+	seen := make(map[string]bool, len(params.Body.Users))
+	for _, upd := range params.Body.Users {
+		id, email := strings.ToLower(swag.StringValue(upd.ID)), strings.ToLower(string(upd.Email))
+		if seen[id] {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("duplicate email: " + id))
+		}
+		seen[id] = true
+		if email != "" && email != id {
+			if seen[email] {
+				return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("duplicate email: " + email))
+			}
+			seen[email] = true
+		}
+	}
+
+	// Resolve and validate every update before applying anything
+	type userUpdate struct {
+		user   *data.User
+		du     *data.DomainUser
+		update *models.SsoUserUpdate
+	}
+	var updates []userUpdate
+	notFound := []string{}
+	for _, upd := range params.Body.Users {
+		id := swag.StringValue(upd.ID)
+
+		// Owner role can't be granted by a sync
+		if upd.Role == models.DomainUserRoleOwner {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("role: owner role can't be assigned by a sync"))
+		}
+
+		// Find the SSO user, which must have signed up via this domain and still be its domain user. Everyone else is
+		// off-limits to the owner
+		u, du, err := domainSsoUserGet(d, id)
+		if errors.Is(err, svc.ErrNotFound) {
+			notFound = append(notFound, id)
+			continue
+		} else if err != nil {
+			return respServiceError(err)
+		}
+
+		// Validate the new email, which also serves as the user's SSO ID, if it's changing
+		if email := string(upd.Email); email != "" && email != u.Email {
+			if !util.IsValidEmail(email) {
+				return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("email"))
+			} else if _, err := svc.Services.UserService(nil).FindUserByEmail(email); err == nil {
+				return respBadRequest(exmodels.ErrorEmailAlreadyExists.WithDetails(email))
+			} else if !errors.Is(err, svc.ErrNotFound) {
+				return respServiceError(err)
+			}
+		}
+
+		// Validate the URLs
+		if upd.WebsiteURL != "" && !util.IsValidURL(upd.WebsiteURL, true) {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("websiteUrl"))
+		}
+		if upd.AvatarURL != "" && !util.IsValidURL(upd.AvatarURL, true) {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("avatarUrl"))
+		}
+		updates = append(updates, userUpdate{user: u, du: du, update: upd})
+	}
+
+	// Apply the updates in a transaction
+	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		us := svc.Services.UserService(tx)
+		for _, uu := range updates {
+			u, upd := uu.user, uu.update
+
+			// Update the profile
+			if email := string(upd.Email); email != "" && email != u.Email {
+				u.WithEmail(email).WithFederated(email, "")
+			}
+			if upd.Name != "" {
+				u.WithName(upd.Name)
+			}
+			if upd.WebsiteURL != "" {
+				u.WithWebsiteURL(upd.WebsiteURL)
+			}
+			if err := us.Update(u); err != nil {
+				return err
+			}
+
+			// Lock or unlock the user, if the status is changing. A deactivated user is also logged out everywhere
+			if upd.Active != nil && *upd.Active == u.IsLocked {
+				if err := us.UpdateLoginLocked(u.WithLocked(!*upd.Active)); err != nil {
+					return err
+				}
+				if u.IsLocked {
+					if err := us.ExpireUserSessions(&u.ID, nil); err != nil {
+						return err
+					}
+				}
+			}
+
+			// Update the role on the domain, if it's changing
+			if upd.Role != "" && upd.Role != uu.du.Role() {
+				if err := svc.Services.DomainService(tx).UserModify(uu.du.WithRole(upd.Role)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Download new avatars in the background
+	for _, uu := range updates {
+		if uu.update.AvatarURL != "" {
+			go func(userID uuid.UUID, url string) {
+				_ = svc.Services.AvatarService(nil).DownloadAndUpdateByUserID(&userID, url, false)
+			}(uu.user.ID, uu.update.AvatarURL)
+		}
+	}
+
+	// Succeeded
+	return api_general.NewDomainSsoUserSyncOK().
+		WithPayload(&api_general.DomainSsoUserSyncOKBody{CountUpdated: int64(len(updates)), NotFound: notFound})
+}
+
+func DomainStatsExport(params api_general.DomainStatsExportParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Prepare the CSV records
+	stSvc := svc.Services.StatsService(nil)
+	numDays := swag.Uint64Value(params.Days)
+	var recs [][]string
+	switch params.Kind {
+	case "daily":
+		// Collect daily view and comment counts
+		views, err := stSvc.GetDailyViewCounts(user.IsSuperuser, &user.ID, &d.ID, numDays)
+		if err != nil {
+			return respServiceError(err)
+		}
+		comments, err := stSvc.GetDailyCommentCounts(user.IsSuperuser, &user.ID, &d.ID, numDays)
+		if err != nil {
+			return respServiceError(err)
+		}
+
+		// The counts end today; views are missing when stats gathering is disabled
+		recs = append(recs, []string{"date", "views", "comments"})
+		start := time.Now().UTC().Truncate(util.OneDay).AddDate(0, 0, -len(comments)+1)
+		for i, cnt := range comments {
+			var v uint64
+			if i < len(views) {
+				v = views[i]
+			}
+			recs = append(recs, []string{
+				start.AddDate(0, 0, i).Format(time.DateOnly),
+				strconv.FormatUint(v, 10),
+				strconv.FormatUint(cnt, 10),
+			})
+		}
+
+	case "pages":
+		// Collect per-page totals
+		pages, err := stSvc.GetDomainPageTotals(&d.ID, numDays)
+		if err != nil {
+			return respServiceError(err)
+		}
+		recs = append(recs, []string{"path", "title", "views", "comments"})
+		for _, p := range pages {
+			recs = append(recs, []string{
+				p.Path,
+				p.Title,
+				strconv.FormatInt(p.CountViews, 10),
+				strconv.FormatInt(p.CountComments, 10),
+			})
+		}
+
+	default:
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails(params.Kind))
+	}
+
+	// Render the CSV
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(recs); err != nil {
+		return respInternalError(nil)
+	}
+
+	// Succeeded. Send the data as a file
+	return api_general.NewDomainStatsExportOK().
+		WithContentDisposition(
+			fmt.Sprintf(
+				`attachment; filename="%s-stats-%s-%s.csv"`,
+				strings.ReplaceAll(d.Host, ":", "-"),
+				params.Kind,
+				time.Now().UTC().Format("2006-01-02"))).
+		WithPayload(io.NopCloser(&buf))
+}
+
 // DomainReadonly sets the domain's readonly state
 func DomainReadonly(params api_general.DomainReadonlyParams, user *data.User) middleware.Responder {
 	// Find the domain and verify the user's privileges
@@ -376,9 +612,20 @@ func DomainUpdate(params api_general.DomainUpdateParams, user *data.User) middle
 		return r
 	}
 
+	// Convert role rules
+	rules, r := domainConvertRoleRules(params.Body.RoleRules)
+	if r != nil {
+		return r
+	}
+
 	// Update domain properties
 	domain.FromDTO(params.Body.Domain)
 
+	// Validate SSO JWT settings
+	if r := Verifier.DomainSSOJWT(domain); r != nil {
+		return r
+	}
+
 	// Persist the updated properties
 	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
 		ds := svc.Services.DomainService(tx)
@@ -393,6 +640,8 @@ func DomainUpdate(params api_general.DomainUpdateParams, user *data.User) middle
 			func() error { return ds.SaveIdPs(&domain.ID, params.Body.FederatedIdpIds) },
 			// Store the domain's extensions
 			func() error { return ds.SaveExtensions(&domain.ID, exts) },
+			// Store the domain's role rules
+			func() error { return ds.SaveRoleRules(&domain.ID, rules) },
 		})
 	})
 	if err != nil {
@@ -428,6 +677,29 @@ func domainConvertExtensions(exIn []*models.DomainExtension) ([]*data.DomainExte
 	return exOut, nil
 }
 
+// domainConvertRoleRules converts domain role rules from DTOs into data models, validating them
+func domainConvertRoleRules(rulesIn []*models.DomainRoleRule) ([]*data.DomainRoleRule, middleware.Responder) {
+	var rulesOut []*data.DomainRoleRule
+	for _, r := range rulesIn {
+		rule := &data.DomainRoleRule{
+			Claim: strings.TrimSpace(r.Claim),
+			Value: strings.TrimSpace(r.Value),
+			Role:  r.Role,
+		}
+
+		// Check the claim and the value aren't blank
+		if rule.Claim == "" || rule.Value == "" {
+			return nil, respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("roleRules: claim and value are required"))
+
+			// Owner role can't be granted automatically
+		} else if rule.Role == models.DomainUserRoleOwner {
+			return nil, respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("roleRules: owner role can't be assigned by a rule"))
+		}
+		rulesOut = append(rulesOut, rule)
+	}
+	return rulesOut, nil
+}
+
 // domainGet parses a string UUID and fetches the corresponding domain
 func domainGet(domainUUID strfmt.UUID) (*data.Domain, middleware.Responder) {
 	// Parse domain ID
@@ -474,3 +746,27 @@ func domainGetWithUser(domainUUID strfmt.UUID, user *data.User, checkCanManage b
 		return domain, domainUser, nil
 	}
 }
+
+// domainSsoUserGet finds an SSO user by their SSO ID, who signed up on the given domain and is still its domain user,
+// and returns the user along with the domain user. Returns svc.ErrNotFound if there's no such user
+func domainSsoUserGet(domain *data.Domain, id string) (*data.User, *data.DomainUser, error) {
+	// Find the user by their SSO ID
+	u, err := svc.Services.UserService(nil).FindUserByFederatedID("", id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Make sure the user originates from the domain
+	if u.SignupHost != domain.Host {
+		return nil, nil, svc.ErrNotFound
+	}
+
+	// Find the corresponding domain user
+	if _, du, err := svc.Services.UserService(nil).FindDomainUserByID(&u.ID, &domain.ID); err != nil {
+		return nil, nil, err
+	} else if du == nil {
+		return nil, nil, svc.ErrNotFound
+	} else {
+		return u, du, nil
+	}
+}
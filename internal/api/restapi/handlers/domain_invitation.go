@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"gitlab.com/comentario/comentario/internal/util"
+	"strings"
+)
+
+func AuthInvitationAccept(params api_general.AuthInvitationAcceptParams) middleware.Responder {
+	// Find the invitation
+	inv, r := domainInvitationGet(swag.StringValue(params.Body.Token))
+	if r != nil {
+		return r
+	}
+
+	// Find the invited user, if they're already registered
+	user, err := svc.Services.UserService(nil).FindUserByEmail(inv.Email)
+	isNew := errors.Is(err, svc.ErrNotFound)
+	if err != nil && !isNew {
+		return respServiceError(err)
+	}
+
+	// If there's no such user yet, prepare a new, local one. The email is known to be valid, since the token was sent
+	// to it
+	if isNew {
+		name := strings.TrimSpace(params.Body.Name)
+		pwd := string(params.Body.Password)
+		if name == "" {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("name"))
+		} else if pwd == "" {
+			return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("password"))
+		} else if r := Verifier.PasswordNotCompromised(pwd); r != nil {
+			return r
+		}
+		user = data.NewUser(inv.Email, name).
+			WithLangFromReq(params.HTTPRequest).
+			WithPassword(pwd).
+			WithSignup(params.HTTPRequest, "", !config.ServerConfig.LogFullIPs).
+			WithConfirmed(true)
+
+		// Invitations can't be used to (re)activate system accounts
+	} else if user.SystemAccount {
+		return respBadRequest(exmodels.ErrorImmutableAccount)
+	}
+
+	err = svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		// Save the new user, if needed
+		if isNew {
+			if err := svc.Services.UserService(tx).Create(user); err != nil {
+				return err
+			}
+		}
+
+		// Find the domain user
+		ds := svc.Services.DomainService(tx)
+		_, du, err := ds.FindDomainUserByID(&inv.DomainID, &user.ID, false)
+		if err != nil {
+			return err
+		}
+
+		// If the user isn't on the domain yet, add them with the invited role
+		invited := data.NewDomainUser(&inv.DomainID, &user.ID, false, false, false).WithRole(inv.Role)
+		if du == nil {
+			if err := ds.UserAdd(invited); err != nil {
+				return err
+			}
+
+			// Otherwise, only upgrade the user's role: an invitation never takes any privileges away
+		} else if invited.IsOwner && !du.IsOwner || invited.IsModerator && !du.IsModerator || invited.IsCommenter && !du.IsCommenter {
+			if err := ds.UserModify(du.WithRole(inv.Role)); err != nil {
+				return err
+			}
+		}
+
+		// Revoke the token, which also deletes the invitation
+		return svc.Services.TokenService(tx).DeleteByValue(inv.TokenValue)
+	})
+	if errors.Is(err, svc.ErrBadToken) {
+		// The invitation has been accepted or revoked in the meantime
+		return respUnauthorized(exmodels.ErrorBadToken)
+	} else if err != nil {
+		return respServiceError(err)
+	}
+
+	// If Gravatar is enabled, try to fetch the new user's avatar, ignoring any error
+	if isNew && svc.Services.DynConfigService().GetBool(data.ConfigKeyIntegrationsUseGravatar) {
+		svc.Services.AvatarService(nil).SetFromGravatarAsync(&user.ID, user.Email, false)
+	}
+
+	// Succeeded
+	return api_general.NewAuthInvitationAcceptNoContent()
+}
+
+func AuthInvitationGet(params api_general.AuthInvitationGetParams) middleware.Responder {
+	// Find the invitation
+	inv, r := domainInvitationGet(params.Token)
+	if r != nil {
+		return r
+	}
+
+	// Find the domain
+	domain, err := svc.Services.DomainService(nil).FindByID(&inv.DomainID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Check whether the invited user is already registered
+	_, err = svc.Services.UserService(nil).FindUserByEmail(inv.Email)
+	if err != nil && !errors.Is(err, svc.ErrNotFound) {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewAuthInvitationGetOK().
+		WithPayload(&api_general.AuthInvitationGetOKBody{
+			DomainHost: models.Host(domain.Host),
+			Email:      strfmt.Email(inv.Email),
+			Role:       inv.Role,
+			UserExists: err == nil,
+		})
+}
+
+func DomainInvitationDelete(params api_general.DomainInvitationDeleteParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Parse the invitation ID
+	id, r := parseUUID(params.InvitationUUID)
+	if r != nil {
+		return r
+	}
+
+	// Revoke the invitation, making sure it belongs to the domain
+	if err := svc.Services.DomainInvitationService(nil).DeleteByDomainID(&d.ID, id); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainInvitationDeleteNoContent()
+}
+
+func DomainInvitationList(params api_general.DomainInvitationListParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the domain's pending invitations
+	invs, err := svc.Services.DomainInvitationService(nil).ListByDomainID(&d.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainInvitationListOK().
+		WithPayload(data.SliceToDTOs[*data.DomainInvitation, *models.DomainInvitation](invs))
+}
+
+func DomainInvitationNew(params api_general.DomainInvitationNewParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Invitations can only be delivered by email
+	if !util.TheMailer.Operational() {
+		return respForbidden(exmodels.ErrorFeatureDisabled.WithDetails("mailer isn't configured"))
+	}
+
+	// Address the email in the invited user's language and name if they're already registered, otherwise use the
+	// inviting user's language
+	email := data.EmailPtrToString(params.Body.Email)
+	lang, name := user.LangID, email
+	if u, err := svc.Services.UserService(nil).FindUserByEmail(email); errors.Is(err, svc.ErrNotFound) {
+		// Not registered yet
+	} else if err != nil {
+		return respServiceError(err)
+	} else if u.SystemAccount {
+		return respBadRequest(exmodels.ErrorImmutableAccount)
+	} else {
+		lang, name = u.LangID, u.Name
+	}
+
+	// Create a new anonymous token: the invited user may not exist yet
+	token, err := data.NewToken(nil, data.TokenScopeDomainInvite, util.DomainInvitationDuration, false)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Persist the invitation and send it out. Should sending fail, the invitation gets discarded
+	inv := data.NewDomainInvitation(&d.ID, &user.ID, email, params.Body.Role, token)
+	err = svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		if err := svc.Services.DomainInvitationService(tx).Create(inv, token); err != nil {
+			return err
+		}
+		return svc.Services.MailService().SendDomainInvitation(lang, email, name, user, d, token)
+	})
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainInvitationNewOK().WithPayload(inv.ToDTO())
+}
+
+// domainInvitationGet finds and returns a pending invitation by its token value
+func domainInvitationGet(tokenValue string) (*data.DomainInvitation, middleware.Responder) {
+	inv, err := svc.Services.DomainInvitationService(nil).FindByToken(tokenValue)
+	if errors.Is(err, svc.ErrBadToken) {
+		return nil, respUnauthorized(exmodels.ErrorBadToken)
+	} else if err != nil {
+		return nil, respServiceError(err)
+	}
+	return inv, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/swag"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"gitlab.com/comentario/comentario/internal/util"
+	"strings"
+)
+
+func DomainOidcProviderDelete(params api_general.DomainOidcProviderDeleteParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Parse the provider ID
+	id, r := parseUUID(params.ProviderUUID)
+	if r != nil {
+		return r
+	}
+
+	// Delete the provider, making sure it belongs to the domain
+	if err := svc.Services.DomainOIDCService(nil).DeleteByDomainID(&d.ID, id); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainOidcProviderDeleteNoContent()
+}
+
+func DomainOidcProviderList(params api_general.DomainOidcProviderListParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Fetch the domain's providers
+	ps, err := svc.Services.DomainOIDCService(nil).ListByDomainID(&d.ID, false)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainOidcProviderListOK().
+		WithPayload(data.SliceToDTOs[*data.DomainOIDCProvider, *models.DomainOidcProvider](ps))
+}
+
+func DomainOidcProviderNew(params api_general.DomainOidcProviderNewParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// The client secret is mandatory for a new provider
+	if params.Body.ClientSecret == "" {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("clientSecret"))
+	}
+
+	// Validate and apply the properties
+	p := data.NewDomainOIDCProvider(&d.ID, &user.ID)
+	if r := domainOidcProviderApplyProps(p, params.Body); r != nil {
+		return r
+	}
+
+	// Persist the provider
+	if err := svc.Services.DomainOIDCService(nil).Create(p, params.Body.ClientSecret); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainOidcProviderNewOK().WithPayload(p.ToDTO())
+}
+
+func DomainOidcProviderUpdate(params api_general.DomainOidcProviderUpdateParams, user *data.User) middleware.Responder {
+	// Find the domain and verify the user's privileges
+	d, _, r := domainGetWithUser(params.UUID, user, true)
+	if r != nil {
+		return r
+	}
+
+	// Parse the provider ID
+	id, r := parseUUID(params.ProviderUUID)
+	if r != nil {
+		return r
+	}
+
+	// Find the provider, making sure it belongs to the domain
+	ds := svc.Services.DomainOIDCService(nil)
+	p, err := ds.FindByDomainID(&d.ID, id)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Validate and apply the properties
+	if r := domainOidcProviderApplyProps(p, params.Body); r != nil {
+		return r
+	}
+
+	// Persist the provider
+	if err := ds.Update(p, params.Body.ClientSecret); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewDomainOidcProviderUpdateOK().WithPayload(p.ToDTO())
+}
+
+// domainOidcProviderApplyProps validates the given properties and applies them to the provider
+func domainOidcProviderApplyProps(p *data.DomainOIDCProvider, props *models.DomainOidcProviderProps) middleware.Responder {
+	// Make sure the secret can be encrypted
+	if config.SecretsConfig.EncKey() == nil {
+		return respBadRequest(exmodels.ErrorFeatureDisabled.WithDetails("encryption secret isn't configured"))
+	}
+
+	// Validate the server URL. Since it's supplied by a domain owner, it must not point to an internal address
+	url := strings.TrimSpace(swag.StringValue(props.URL))
+	if u, err := util.ParseAbsoluteURL(url, false, false); err != nil || !util.IsPublicHost(u.Hostname()) {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("url"))
+	}
+
+	// Apply the values
+	p.Name = strings.TrimSpace(swag.StringValue(props.Name))
+	p.URL = url
+	p.ClientID = strings.TrimSpace(swag.StringValue(props.ClientID))
+	p.IsEnabled = swag.BoolValue(props.Enabled)
+	p.WithScopes(props.Scopes)
+	return nil
+}
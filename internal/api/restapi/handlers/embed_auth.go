@@ -20,6 +20,7 @@ func EmbedAuthLogin(params api_embed.EmbedAuthLoginParams) middleware.Responder
 	user, us, r := loginLocalUser(
 		data.EmailPtrToString(params.Body.Email),
 		swag.StringValue(params.Body.Password),
+		params.Body.TotpCode,
 		string(params.Body.Host),
 		params.HTTPRequest)
 	if r != nil {
@@ -145,6 +146,11 @@ func EmbedAuthSignup(params api_embed.EmbedAuthSignupParams) middleware.Responde
 		return r
 	}
 
+	// Verify the password isn't compromised
+	if r := Verifier.PasswordNotCompromised(data.PasswordPtrToString(params.Body.Password)); r != nil {
+		return r
+	}
+
 	// Create a new user
 	user := data.NewUser(email, data.TrimmedString(params.Body.Name)).
 		WithLangFromReq(params.HTTPRequest).
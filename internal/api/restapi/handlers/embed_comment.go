@@ -118,7 +118,8 @@ func EmbedCommentList(params api_embed.EmbedCommentListParams) middleware.Respon
 	}
 
 	// Fetch the page, registering a new pageview
-	page, _, err := svc.Services.PageService(nil).UpsertByDomainPath(domain, data.PathToString(params.Body.Path), "", params.HTTPRequest)
+	src := data.NewPageViewSource(domain.Host, params.Body.Referrer, params.Body.Query)
+	page, _, err := svc.Services.PageService(nil).UpsertByDomainPath(domain, data.PathToString(params.Body.Path), "", params.HTTPRequest, src)
 	if err != nil {
 		return respServiceError(err)
 	}
@@ -177,6 +178,15 @@ func EmbedCommentList(params api_embed.EmbedCommentListParams) middleware.Respon
 		}
 	}
 
+	// Add the providers registered by the domain itself
+	if ps, err := svc.Services.DomainOIDCService(nil).ListByDomainID(&domain.ID, true); err != nil {
+		return respServiceError(err)
+	} else {
+		for _, p := range ps {
+			pageInfo.Idps = append(pageInfo.Idps, p.FederatedIdP().ToDTO())
+		}
+	}
+
 	// Fetch comments and commenters
 	comments, commenterMap, err := svc.Services.CommentService(nil).ListWithCommenters(
 		user,
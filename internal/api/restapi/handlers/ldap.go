@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/swag"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"gitlab.com/comentario/comentario/internal/util"
+)
+
+// AuthLdapLogin verifies the user's LDAP credentials within a federated authentication session initiated with
+// AuthOauthInit. On success, the client is supposed to proceed to the provider's OAuth callback
+func AuthLdapLogin(params api_general.AuthLdapLoginParams) middleware.Responder {
+	// Make sure the LDAP provider is configured
+	provider, r := Verifier.FederatedIdProvider(config.LDAPProviderID)
+	if r != nil {
+		return r
+	}
+	lp := provider.(*config.LDAPProvider)
+
+	// Obtain the auth session from the cookie
+	cookie, err := params.HTTPRequest.Cookie(util.CookieNameAuthSession)
+	if err != nil {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	}
+	authSessID, err := uuid.Parse(cookie.Value)
+	if err != nil {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	}
+	authSession, err := svc.Services.AuthSessionService(nil).FindByID(&authSessID)
+	if errors.Is(err, svc.ErrNotFound) {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	} else if err != nil {
+		return respServiceError(err)
+	}
+
+	// Recover the provider session
+	sess, err := lp.UnmarshalSession(authSession.Data)
+	if err != nil {
+		logger.Warningf("AuthLdapLogin: failed to unmarshal auth session: %v", err)
+		return respUnauthorized(exmodels.ErrorBadToken)
+	}
+
+	// Verify the credentials
+	if err := lp.Authenticate(sess, swag.StringValue(params.Body.Username), swag.StringValue(params.Body.Password)); errors.Is(err, config.ErrLDAPInvalidCredentials) {
+		util.RandomSleep(util.WrongAuthDelayMin, util.WrongAuthDelayMax)
+		return respUnauthorized(exmodels.ErrorInvalidCredentials)
+	} else if err != nil {
+		logger.Errorf("AuthLdapLogin: %v", err)
+		return respInternalError(nil)
+	}
+
+	// Store the authenticated user in the session
+	if err := svc.Services.AuthSessionService(nil).UpdateData(&authSessID, sess.Marshal()); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewAuthLdapLoginNoContent()
+}
@@ -21,6 +21,7 @@ import (
 	"gitlab.com/comentario/comentario/internal/util"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type ssoPayload struct {
@@ -32,16 +33,33 @@ type ssoPayload struct {
 	Role  string `json:"role"`
 }
 
+// ssoJWTClaims is the claims set of a JWT issued by an SSO provider
+type ssoJWTClaims struct {
+	Nonce   string `json:"nonce"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+	Website string `json:"website"`
+	Role    string `json:"role"`
+}
+
 func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Responder {
 	// SSO authentication is a special case
 	var provider goth.Provider
+	var domainIdP *data.DomainOIDCProvider
 	var r middleware.Responder
 	var idpID string
 	if params.Provider != "sso" {
 		idpID = params.Provider
 
-		// It's a goth provider: find it
-		if provider, r = Verifier.FederatedIdProvider(models.FederatedIdpID(idpID)); r != nil {
+		// It's a goth provider: if it's registered by a domain, look it up in the database
+		if pid := data.ParseDomainOIDCProviderID(models.FederatedIdpID(idpID)); pid != nil {
+			if domainIdP, provider, r = oauthDomainOIDCProvider(pid); r != nil {
+				return r
+			}
+
+			// Otherwise it's a global one: find it
+		} else if provider, r = Verifier.FederatedIdProvider(models.FederatedIdpID(idpID)); r != nil {
 			return r
 		}
 	}
@@ -88,10 +106,21 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 		return oauthFailure(false, "host is missing in request", nil)
 	}
 
+	// A domain-registered provider can only be used on its own domain
+	if domainIdP != nil && (domain == nil || domain.ID != domainIdP.DomainID) {
+		return oauthFailure(false, "identity provider isn't registered for the domain", nil)
+	}
+
+	// Callback parameters come in the query string, except for SAML, whose response is posted as a form
 	reqParams := params.HTTPRequest.URL.Query()
+	if params.HTTPRequest.Method == http.MethodPost {
+		reqParams = params.HTTPRequest.PostForm
+	}
 	var fedUser goth.User
+	var userClaims map[string]any
 	var userWebsiteURL string
 	var userRole models.DomainUserRole
+	var userSuperuser, setSuperuser bool
 
 	// SSO auth
 	nonIntSSO := false
@@ -103,30 +132,61 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 
 		nonIntSSO = domain.SSONonInteractive
 
-		// Verify the payload
+		// If the provider issues JWTs, verify the token
 		payload := ssoPayload{}
-		var payloadBytes []byte
-		if s := reqParams.Get("payload"); s == "" {
-			return oauthFailure(nonIntSSO, "payload is missing", nil)
-		} else if payloadBytes, err = hex.DecodeString(s); err != nil {
-			return oauthFailure(nonIntSSO, "payload: invalid hex encoding", err)
-		} else if err = json.Unmarshal(payloadBytes, &payload); err != nil {
-			return oauthFailureInternal(nonIntSSO, fmt.Errorf("payload: failed to unmarshal: %w", err))
-		} else if payload.Token != token.Value {
-			return oauthFailure(nonIntSSO, "payload: invalid token", nil)
-		}
+		if domain.SSOUsesJWT() {
+			claims := ssoJWTClaims{}
+			if s := reqParams.Get("jwt"); s == "" {
+				return oauthFailure(nonIntSSO, "jwt is missing", nil)
+			} else if keys, err := util.JWTParseKeys(domain.SSOJWTKeys); err != nil {
+				return oauthFailure(nonIntSSO, "domain SSO JWT keys are invalid", err)
+			} else if claimBytes, err := util.JWTVerify(s, keys, domain.SSOJWTIssuer, domain.SSOJWTAudience, time.Now()); err != nil {
+				return oauthFailure(nonIntSSO, "jwt: verification failed", err)
+			} else if err := json.Unmarshal(claimBytes, &claims); err != nil {
+				return oauthFailure(nonIntSSO, "jwt: failed to unmarshal claims", err)
+			} else if err := json.Unmarshal(claimBytes, &userClaims); err != nil {
+				return oauthFailure(nonIntSSO, "jwt: failed to unmarshal claims", err)
+			} else if claims.Nonce != token.Value {
+				return oauthFailure(nonIntSSO, "jwt: invalid nonce", nil)
+			}
 
-		// Verify the HMAC signature
-		if s := reqParams.Get("hmac"); s == "" {
-			return oauthFailure(nonIntSSO, "hmac is missing", nil)
-		} else if signature, err := hex.DecodeString(s); err != nil {
-			return oauthFailure(nonIntSSO, "hmac: invalid hex encoding", err)
-		} else if secBytes, err := domain.SSOSecretBytes(); err != nil {
-			return oauthFailure(nonIntSSO, "domain SSO secret: invalid hex encoding", err)
-		} else if secBytes == nil {
-			return oauthFailure(nonIntSSO, "domain SSO secret not set", nil)
-		} else if !hmac.Equal(signature, util.HMACSign(payloadBytes, secBytes)) {
-			return oauthFailure(nonIntSSO, "hmac: signature verification failed", nil)
+			// Convert the claims into a payload
+			payload = ssoPayload{
+				Token: claims.Nonce,
+				Email: claims.Email,
+				Name:  claims.Name,
+				Photo: claims.Picture,
+				Link:  claims.Website,
+				Role:  claims.Role,
+			}
+
+			// Otherwise, verify the HMAC-signed payload
+		} else {
+			var payloadBytes []byte
+			if s := reqParams.Get("payload"); s == "" {
+				return oauthFailure(nonIntSSO, "payload is missing", nil)
+			} else if payloadBytes, err = hex.DecodeString(s); err != nil {
+				return oauthFailure(nonIntSSO, "payload: invalid hex encoding", err)
+			} else if err = json.Unmarshal(payloadBytes, &payload); err != nil {
+				return oauthFailureInternal(nonIntSSO, fmt.Errorf("payload: failed to unmarshal: %w", err))
+			} else if err = json.Unmarshal(payloadBytes, &userClaims); err != nil {
+				return oauthFailureInternal(nonIntSSO, fmt.Errorf("payload: failed to unmarshal: %w", err))
+			} else if payload.Token != token.Value {
+				return oauthFailure(nonIntSSO, "payload: invalid token", nil)
+			}
+
+			// Verify the HMAC signature
+			if s := reqParams.Get("hmac"); s == "" {
+				return oauthFailure(nonIntSSO, "hmac is missing", nil)
+			} else if signature, err := hex.DecodeString(s); err != nil {
+				return oauthFailure(nonIntSSO, "hmac: invalid hex encoding", err)
+			} else if secBytes, err := domain.SSOSecretBytes(); err != nil {
+				return oauthFailure(nonIntSSO, "domain SSO secret: invalid hex encoding", err)
+			} else if secBytes == nil {
+				return oauthFailure(nonIntSSO, "domain SSO secret not set", nil)
+			} else if !hmac.Equal(signature, util.HMACSign(payloadBytes, secBytes)) {
+				return oauthFailure(nonIntSSO, "hmac: signature verification failed", nil)
+			}
 		}
 
 		// Prepare a federated user, using email as the ID (until #100 is implemented)
@@ -173,6 +233,14 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 		if err != nil {
 			return oauthFailure(false, "fetching user failed", err)
 		}
+
+		// Take over the claims reported by the provider (for OIDC, these come from the ID token and the userinfo)
+		userClaims = fedUser.RawData
+
+		// The LDAP provider may additionally dictate the user's superuser status, based on their group membership
+		if lp, ok := provider.(*config.LDAPProvider); ok {
+			userSuperuser, setSuperuser = lp.SuperuserStatus(&fedUser)
+		}
 	}
 
 	// Validate the federated user
@@ -254,6 +322,9 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 				WithSignup(params.HTTPRequest, authSession.Host, !config.ServerConfig.LogFullIPs).
 				WithFederated(fedUser.UserID, idpID).
 				WithWebsiteURL(userWebsiteURL)
+			if setSuperuser {
+				user.WithSuperuser(userSuperuser)
+			}
 			if err := svc.Services.UserService(tx).Create(user); err != nil {
 				return err
 			}
@@ -299,6 +370,9 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 				WithName(fedUserName).
 				WithFederated(fedUser.UserID, idpID).
 				WithWebsiteURL(userWebsiteURL)
+			if setSuperuser {
+				user.WithSuperuser(userSuperuser)
+			}
 			if err := svc.Services.UserService(tx).Update(user); err != nil {
 				return err
 			}
@@ -333,9 +407,19 @@ func AuthOauthCallback(params api_general.AuthOauthCallbackParams) middleware.Re
 				return err
 			}
 
-			// If a role was returned by the (SSO) provider and it's changing, update the domain user
-			if userRole != "" && userRole != du.Role() {
-				if err := svc.Services.DomainService(tx).UserModify(du.WithRole(userRole)); err != nil {
+			// If no role was returned by the (SSO) provider, consult the domain's role rules, which never apply to owners
+			role := userRole
+			if role == "" && !du.IsAnOwner() {
+				rules, err := svc.Services.DomainService(tx).ListDomainRoleRules(&domain.ID)
+				if err != nil {
+					return err
+				}
+				role = data.MatchDomainRoleRules(rules, userClaims, user.Email)
+			}
+
+			// If the role is changing, update the domain user
+			if role != "" && role != du.Role() {
+				if err := svc.Services.DomainService(tx).UserModify(du.WithRole(role)); err != nil {
 					return err
 				}
 			}
@@ -378,7 +462,23 @@ func AuthOauthInit(params api_general.AuthOauthInitParams) middleware.Responder
 			return oauthFailure(false, exmodels.ErrorInvalidPropertyValue.WithDetails("host").String(), nil)
 		}
 
-		// Otherwise it's a goth provider: find it
+		// If it's a provider registered by a domain, look it up in the database
+	} else if pid := data.ParseDomainOIDCProviderID(models.FederatedIdpID(params.Provider)); pid != nil {
+		var domainIdP *data.DomainOIDCProvider
+		if domainIdP, provider, r = oauthDomainOIDCProvider(pid); r != nil {
+			return r
+		}
+
+		// Such a provider can only be used on its own domain
+		if host == "" {
+			return oauthFailure(false, exmodels.ErrorInvalidPropertyValue.WithDetails("host").String(), nil)
+		} else if domain, err := svc.Services.DomainService(nil).FindByHost(host); err != nil {
+			return oauthFailureInternal(false, err)
+		} else if domain.ID != domainIdP.DomainID {
+			return oauthFailure(false, "identity provider isn't registered for the domain", nil)
+		}
+
+		// Otherwise it's a global goth provider: find it
 	} else if provider, r = Verifier.FederatedIdProvider(models.FederatedIdpID(params.Provider)); r != nil {
 		return r
 	}
@@ -419,17 +519,18 @@ func AuthOauthInit(params api_general.AuthOauthInitParams) middleware.Responder
 			return oauthFailure(nonIntSSO, "failed to parse SSO URL", err)
 		}
 
-		// Add the token and its HMAC signature to the SSO URL
+		// Add the token and its HMAC signature to the SSO URL. A provider issuing JWTs doesn't require the signature, so
+		// it's only added when there's a secret
 		q := ssoURL.Query()
 		q.Set("token", token.Value)
 		if tokenBytes, err := token.ValueBytes(); err != nil {
 			return oauthFailure(false, "failed to parse token value", err)
 		} else if secBytes, err := domain.SSOSecretBytes(); err != nil {
 			return oauthFailure(false, "failed to parse domain SSO secret", err)
-		} else if secBytes == nil {
-			return oauthFailure(false, "domain SSO secret not set", nil)
-		} else {
+		} else if secBytes != nil {
 			q.Set("hmac", hex.EncodeToString(util.HMACSign(tokenBytes, secBytes)))
+		} else if !domain.SSOUsesJWT() {
+			return oauthFailure(false, "domain SSO secret not set", nil)
 		}
 		ssoURL.RawQuery = q.Encode()
 		authURL = ssoURL.String()
@@ -477,6 +578,32 @@ func AuthOauthInit(params api_general.AuthOauthInitParams) middleware.Responder
 			util.If(config.ServerConfig.UseHTTPS(), http.SameSiteNoneMode, http.SameSiteLaxMode))
 }
 
+// oauthDomainOIDCProvider finds an enabled domain OIDC provider by its ID and returns it along with its goth provider
+// instance
+func oauthDomainOIDCProvider(id *uuid.UUID) (*data.DomainOIDCProvider, goth.Provider, middleware.Responder) {
+	// Find the provider
+	p, err := svc.Services.DomainOIDCService(nil).FindByID(id)
+	if errors.Is(err, svc.ErrNotFound) {
+		return nil, nil, respBadRequest(exmodels.ErrorIdPUnknown.WithDetails(id.String()))
+	} else if err != nil {
+		return nil, nil, oauthFailureInternal(false, err)
+	}
+
+	// Make sure it's enabled
+	if !p.IsEnabled {
+		return nil, nil, respBadRequest(exmodels.ErrorIdPUnconfigured.WithDetails(p.QualifiedID()))
+	}
+
+	// Instantiate the goth provider
+	gp, err := svc.Services.DomainOIDCService(nil).Provider(p)
+	if err != nil {
+		return nil, nil, oauthFailure(false, "failed to instantiate identity provider", err)
+	}
+
+	// Succeeded
+	return p, gp, nil
+}
+
 // oauthFailure returns either a generic "Unauthorized" responder (in case of interactive authentication), with the
 // given message in the details, or a postMessage responder (for non-interactive auth), and logs the passed error.
 // The reason it's handled this way is that logging may expose actual (confidential) error details, whereas the response
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/exmodels"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
+	"gitlab.com/comentario/comentario/internal/svc"
+	"gitlab.com/comentario/comentario/internal/util"
+	"strings"
+)
+
+// passkeySessionData is the state of a passkey ceremony, persisted in an auth session
+type passkeySessionData struct {
+	Challenge []byte     `json:"challenge"`        // Random challenge the authenticator must sign
+	UserID    *uuid.UUID `json:"userId,omitempty"` // ID of the user registering a passkey, nil for login
+}
+
+// AuthPasskeyBegin starts a passkey login ceremony bound to an anonymous token
+func AuthPasskeyBegin(params api_general.AuthPasskeyBeginParams) middleware.Responder {
+	// Try to find the passed anonymous token
+	token, err := svc.Services.TokenService(nil).FindByValue(swag.StringValue(params.Body.Token), false)
+	if errors.Is(err, svc.ErrNotFound) {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	} else if err != nil {
+		return respServiceError(err)
+	} else if !token.IsAnonymous() || token.Scope != data.TokenScopeLogin {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	}
+
+	// Start a ceremony
+	ch, r := passkeyBeginCeremony(token.Value, nil)
+	if r != nil {
+		return r
+	}
+
+	// Succeeded
+	return api_general.NewAuthPasskeyBeginOK().WithPayload(ch)
+}
+
+// AuthPasskeyFinish verifies a passkey assertion and, if successful, binds the ceremony's token to the passkey owner
+func AuthPasskeyFinish(params api_general.AuthPasskeyFinishParams) middleware.Responder {
+	// Fetch and remove the ceremony session
+	as, sd, r := passkeyTakeCeremony(params.Body.SessionID)
+	if r != nil {
+		return r
+	} else if sd.UserID != nil {
+		// It's a registration session
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("sessionId"))
+	}
+
+	// Decode the assertion
+	clientData, r := passkeyDecode(swag.StringValue(params.Body.ClientDataJSON), "clientDataJson")
+	if r != nil {
+		return r
+	}
+	authData, r := passkeyDecode(swag.StringValue(params.Body.AuthenticatorData), "authenticatorData")
+	if r != nil {
+		return r
+	}
+	sig, r := passkeyDecode(swag.StringValue(params.Body.Signature), "signature")
+	if r != nil {
+		return r
+	}
+
+	// Make sure the token is still anonymous
+	token, err := svc.Services.TokenService(nil).FindByValue(as.TokenValue, false)
+	if errors.Is(err, svc.ErrNotFound) {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	} else if err != nil {
+		return respServiceError(err)
+	} else if !token.IsAnonymous() {
+		return respUnauthorized(exmodels.ErrorBadToken)
+	}
+
+	// Find the passkey
+	pk, err := svc.Services.PasskeyService(nil).FindByCredentialID(swag.StringValue(params.Body.CredentialID))
+	if errors.Is(err, svc.ErrNotFound) {
+		util.RandomSleep(util.WrongAuthDelayMin, util.WrongAuthDelayMax)
+		return respUnauthorized(exmodels.ErrorInvalidPasskey)
+	} else if err != nil {
+		return respServiceError(err)
+	}
+
+	// Verify the assertion
+	rp, r := passkeyRelyingParty()
+	if r != nil {
+		return r
+	}
+	credID, err := util.WebAuthnEncoding.DecodeString(pk.CredentialID)
+	if err != nil {
+		return respInternalError(nil)
+	}
+	signCount, err := rp.VerifyAssertion(
+		pk.UserID[:],
+		sd.Challenge,
+		&util.WebAuthnCredential{ID: credID, PublicKey: pk.PublicKey, SignCount: uint32(pk.SignCount)},
+		clientData,
+		authData,
+		sig)
+	if errors.Is(err, util.ErrWebAuthnSignCount) {
+		// If the authenticator maintains a signature counter, it must increase; otherwise the authenticator may be
+		// cloned
+		logger.Warningf("AuthPasskeyFinish: signature counter of passkey %s didn't increase", &pk.ID)
+		return respUnauthorized(exmodels.ErrorInvalidPasskey)
+	} else if err != nil {
+		logger.Debugf("AuthPasskeyFinish: passkey %s verification failed: %v", &pk.ID, err)
+		util.RandomSleep(util.WrongAuthDelayMin, util.WrongAuthDelayMax)
+		return respUnauthorized(exmodels.ErrorInvalidPasskey)
+	}
+
+	// Find the passkey owner and verify they're allowed to log in
+	user, err := svc.Services.UserService(nil).FindUserByID(&pk.UserID)
+	if err != nil {
+		return respServiceError(err)
+	} else if errm := svc.Services.AuthService(nil).UserCanAuthenticate(user, true); errm != nil {
+		return respUnauthorized(errm)
+	}
+
+	// Register the passkey usage and bind the token to the user
+	pk.SignCount = int64(signCount)
+	pk.LastUsedTime = data.NowNullable()
+	token.Owner = user.ID
+	err = svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		if err := svc.Services.PasskeyService(tx).UpdateUsage(pk); err != nil {
+			return err
+		}
+		return svc.Services.TokenService(tx).Update(token)
+	})
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewAuthPasskeyFinishNoContent()
+}
+
+// CurUserPasskeyAdd verifies a passkey registration and stores the new passkey for the current user
+func CurUserPasskeyAdd(params api_general.CurUserPasskeyAddParams, user *data.User) middleware.Responder {
+	// Verify it's a local user
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Fetch and remove the ceremony session, and make sure it was started by the same user
+	as, sd, r := passkeyTakeCeremony(params.Body.SessionID)
+	if r != nil {
+		return r
+	}
+	_ = svc.Services.TokenService(nil).DeleteByValue(as.TokenValue)
+	if sd.UserID == nil || *sd.UserID != user.ID {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("sessionId"))
+	}
+
+	// Decode the attestation
+	clientData, r := passkeyDecode(swag.StringValue(params.Body.ClientDataJSON), "clientDataJson")
+	if r != nil {
+		return r
+	}
+	attestation, r := passkeyDecode(swag.StringValue(params.Body.AttestationObject), "attestationObject")
+	if r != nil {
+		return r
+	}
+
+	// Verify the attestation
+	rp, r := passkeyRelyingParty()
+	if r != nil {
+		return r
+	}
+	cred, err := rp.VerifyRegistration(user.ID[:], sd.Challenge, clientData, attestation)
+	if err != nil {
+		logger.Debugf("CurUserPasskeyAdd: passkey verification failed: %v", err)
+		return respBadRequest(exmodels.ErrorInvalidPasskey)
+	}
+
+	// Store the passkey
+	pk := data.NewUserPasskey(&user.ID, cred.ID, cred.PublicKey, cred.SignCount, strings.TrimSpace(swag.StringValue(params.Body.Name)))
+	if err := svc.Services.PasskeyService(nil).Create(pk); err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserPasskeyAddOK().WithPayload(pk.ToDTO())
+}
+
+// CurUserPasskeyBegin starts a passkey registration ceremony for the current user
+func CurUserPasskeyBegin(_ api_general.CurUserPasskeyBeginParams, user *data.User) middleware.Responder {
+	// Verify it's a local user
+	if r := Verifier.UserIsLocal(user); r != nil {
+		return r
+	}
+
+	// Fetch existing passkeys, so that the authenticator doesn't register the same one twice
+	pks, err := svc.Services.PasskeyService(nil).ListByUserID(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+	exclude := make([]string, len(pks))
+	for i, pk := range pks {
+		exclude[i] = pk.CredentialID
+	}
+
+	// An auth session requires a token, so create an internal, anonymous one
+	token, err := authCreateLoginToken(nil)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Start a ceremony
+	ch, r := passkeyBeginCeremony(token.Value, &user.ID)
+	if r != nil {
+		return r
+	}
+
+	// Succeeded
+	algs := make([]int64, len(util.WebAuthnAlgorithms))
+	for i, a := range util.WebAuthnAlgorithms {
+		algs[i] = int64(a)
+	}
+	return api_general.NewCurUserPasskeyBeginOK().
+		WithPayload(&api_general.CurUserPasskeyBeginOKBody{
+			Algorithms:         algs,
+			Challenge:          ch,
+			ExcludeCredentials: exclude,
+			RpName:             swag.String(util.ApplicationName),
+			UserHandle:         swag.String(util.WebAuthnEncoding.EncodeToString(user.ID[:])),
+		})
+}
+
+// CurUserPasskeyList returns passkeys of the current user
+func CurUserPasskeyList(_ api_general.CurUserPasskeyListParams, user *data.User) middleware.Responder {
+	pks, err := svc.Services.PasskeyService(nil).ListByUserID(&user.ID)
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewCurUserPasskeyListOK().WithPayload(data.SliceToDTOs[*data.UserPasskey, *models.UserPasskey](pks))
+}
+
+// passkeyBeginCeremony generates a new challenge and persists it in an auth session bound to the given token. userID
+// must be provided for registration, and nil for login
+func passkeyBeginCeremony(tokenValue string, userID *uuid.UUID) (*models.PasskeyChallenge, middleware.Responder) {
+	// Generate a challenge
+	challenge, err := util.RandomBytes(32)
+	if err != nil {
+		return nil, respInternalError(nil)
+	}
+
+	// Serialise the ceremony state
+	b, err := json.Marshal(&passkeySessionData{Challenge: challenge, UserID: userID})
+	if err != nil {
+		return nil, respInternalError(nil)
+	}
+
+	// Persist the state in an auth session
+	as, err := svc.Services.AuthSessionService(nil).Create(string(b), "", tokenValue)
+	if err != nil {
+		return nil, respServiceError(err)
+	}
+
+	// Succeeded
+	return &models.PasskeyChallenge{
+		Challenge: swag.String(util.WebAuthnEncoding.EncodeToString(challenge)),
+		RpID:      swag.String(config.ServerConfig.ParsedBaseURL().Hostname()),
+		SessionID: strfmt.UUID(as.ID.String()),
+		Timeout:   swag.Int64(util.AuthSessionDuration.Milliseconds()),
+	}, nil
+}
+
+// passkeyDecode decodes the given base64url-encoded value of the named property
+func passkeyDecode(s, propName string) ([]byte, middleware.Responder) {
+	b, err := util.WebAuthnEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails(propName))
+	}
+	return b, nil
+}
+
+// passkeyTakeCeremony fetches and deletes the ceremony auth session with the given ID, returning the session and its
+// decoded state
+func passkeyTakeCeremony(sid strfmt.UUID) (*data.AuthSession, *passkeySessionData, middleware.Responder) {
+	id, r := parseUUID(sid)
+	if r != nil {
+		return nil, nil, r
+	}
+
+	// Take the session
+	as, err := svc.Services.AuthSessionService(nil).TakeByID(id)
+	if errors.Is(err, svc.ErrNotFound) {
+		// Session doesn't exist or has expired
+		return nil, nil, respUnauthorized(exmodels.ErrorBadToken)
+	} else if err != nil {
+		return nil, nil, respServiceError(err)
+	}
+
+	// Decode the session state
+	var sd passkeySessionData
+	if err := json.Unmarshal([]byte(as.Data), &sd); err != nil || len(sd.Challenge) == 0 {
+		return nil, nil, respUnauthorized(exmodels.ErrorBadToken)
+	}
+
+	// Succeeded
+	return as, &sd, nil
+}
+
+// passkeyRelyingParty returns a WebAuthn relying party for the server's base URL
+func passkeyRelyingParty() (*util.WebAuthnRelyingParty, middleware.Responder) {
+	rp, err := util.NewWebAuthnRelyingParty(config.ServerConfig.ParsedBaseURL())
+	if err != nil {
+		logger.Errorf("passkeyRelyingParty: failed to configure WebAuthn: %v", err)
+		return nil, respInternalError(nil)
+	}
+	return rp, nil
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"github.com/go-openapi/runtime/middleware"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/api/restapi/operations/api_general"
+	"gitlab.com/comentario/comentario/internal/config"
+)
+
+// AuthSamlAcs handles the SAML response posted by a SAML IdP, which completes a federated authentication initiated with
+// AuthOauthInit
+func AuthSamlAcs(params api_general.AuthSamlAcsParams) middleware.Responder {
+	// Make sure it's a SAML provider
+	if p, r := Verifier.FederatedIdProvider(models.FederatedIdpID(params.Provider)); r != nil {
+		return r
+	} else if _, ok := p.(*config.SAMLAuthProvider); !ok {
+		return oauthFailure(false, "provider doesn't support SAML", nil)
+	}
+
+	// Proceed the same way as for any other provider; the response is picked up from the posted form
+	return AuthOauthCallback(api_general.AuthOauthCallbackParams{HTTPRequest: params.HTTPRequest, Provider: params.Provider})
+}
+
+// AuthSamlMetadata returns the SAML service provider metadata for the given SAML IdP
+func AuthSamlMetadata(params api_general.AuthSamlMetadataParams) middleware.Responder {
+	// Find the provider
+	p, r := Verifier.FederatedIdProvider(models.FederatedIdpID(params.Provider))
+	if r != nil {
+		return r
+	}
+
+	// Make sure it's a SAML one
+	sp, ok := p.(*config.SAMLAuthProvider)
+	if !ok {
+		return respNotFound(nil)
+	}
+
+	// Succeeded
+	return api_general.NewAuthSamlMetadataOK().WithPayload(sp.Metadata())
+}
@@ -180,6 +180,57 @@ func UserList(params api_general.UserListParams, user *data.User) middleware.Res
 		WithPayload(&api_general.UserListOKBody{Users: data.SliceToDTOs(us)})
 }
 
+func UserMerge(params api_general.UserMergeParams, user *data.User) middleware.Responder {
+	// Verify the user is a superuser
+	if r := Verifier.UserIsSuperuser(user); r != nil {
+		return r
+	}
+
+	// Fetch the target and the source users
+	target, r := userGet(params.UUID)
+	if r != nil {
+		return r
+	}
+	source, r := userGet(*params.Body.SourceUserID)
+	if r != nil {
+		return r
+	}
+
+	// Verify neither is a system account
+	if r := Verifier.UserIsNotSystem(target); r != nil {
+		return r
+	} else if r := Verifier.UserIsNotSystem(source); r != nil {
+		return r
+	}
+
+	// Make sure the users are different, and the current user isn't going to be deleted
+	if r := Verifier.IsAnotherUser(&target.ID, &source.ID); r != nil {
+		return r
+	} else if r := Verifier.IsAnotherUser(&user.ID, &source.ID); r != nil {
+		return r
+	}
+
+	// Merge the users
+	var m *data.UserMerge
+	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		var err error
+		m, err = svc.Services.UserService(tx).Merge(&user.ID, source, target)
+		return err
+	})
+	if err != nil {
+		return respServiceError(err)
+	}
+
+	// Succeeded
+	return api_general.NewUserMergeOK().WithPayload(&api_general.UserMergeOKBody{
+		CountAttrs:       m.CountAttrs,
+		CountComments:    m.CountComments,
+		CountDomainUsers: m.CountDomainUsers,
+		CountSessions:    m.CountSessions,
+		CountVotes:       m.CountVotes,
+	})
+}
+
 func UserSessionList(params api_general.UserSessionListParams, user *data.User) middleware.Responder {
 	// Verify the user is a superuser
 	if r := Verifier.UserIsSuperuser(user); r != nil {
@@ -216,7 +267,7 @@ func UserSessionsExpire(params api_general.UserSessionsExpireParams, user *data.
 
 	// Expire user sessions
 	err := svc.Services.WithTx(func(tx *persistence.DatabaseTx) error {
-		return svc.Services.UserService(tx).ExpireUserSessions(userID)
+		return svc.Services.UserService(tx).ExpireUserSessions(userID, nil)
 	})
 	if err != nil {
 		return respServiceError(err)
@@ -290,6 +341,9 @@ func UserUpdate(params api_general.UserUpdateParams, user *data.User) middleware
 
 		// Update password only if it's provided
 		if password != "" {
+			if r := Verifier.PasswordNotCompromised(string(password)); r != nil {
+				return r
+			}
 			u.WithPassword(string(password))
 		}
 
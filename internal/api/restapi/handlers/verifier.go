@@ -28,6 +28,9 @@ type VerifierService interface {
 	DomainPageCanUpdatePathTo(page *data.DomainPage, newPath string) middleware.Responder
 	// DomainSSOConfig verifies the given domain is properly configured for SSO authentication
 	DomainSSOConfig(domain *data.Domain) middleware.Responder
+	// DomainSSOJWT verifies the SSO JWT settings of the given domain: verification keys, if provided, can be parsed, and
+	// the expected issuer and audience are set then
+	DomainSSOJWT(domain *data.Domain) middleware.Responder
 	// FederatedIdProvider verifies the federated identity provider specified by its ID is properly configured for
 	// authentication, and returns the corresponding Provider interface
 	FederatedIdProvider(id models.FederatedIdpID) (goth.Provider, middleware.Responder)
@@ -38,6 +41,8 @@ type VerifierService interface {
 	// LocalSignupEnabled checks if users are allowed to sign up locally. If domainID == nil, it's a frontend (Admin UI)
 	// sign-up
 	LocalSignupEnabled(domainID *uuid.UUID) middleware.Responder
+	// PasswordNotCompromised verifies the given new password isn't on the list of compromised passwords
+	PasswordNotCompromised(pwd string) middleware.Responder
 	// UserCanAddDomain checks if the provided user is allowed to register a new domain (and become its owner)
 	UserCanAddDomain(user *data.User) middleware.Responder
 	// UserCanChangeEmailTo verifies the user can change their email to the new given value
@@ -67,6 +72,9 @@ type VerifierService interface {
 	UserIsNotSystem(user *data.User) middleware.Responder
 	// UserIsSuperuser verifies the given user is a superuser
 	UserIsSuperuser(user *data.User) middleware.Responder
+	// UserSatisfiesTOTPPolicy verifies the given local user has two-factor authentication enabled if it's required for
+	// superusers or domain owners (as per the dynamic configuration), and the user is one. domainUser can be nil
+	UserSatisfiesTOTPPolicy(user *data.User, domainUser *data.DomainUser) middleware.Responder
 }
 
 // ----------------------------------------------------------------------------------------------------------------------
@@ -128,29 +136,50 @@ func (v *verifier) DomainHostCanBeAdded(host string) middleware.Responder {
 func (v *verifier) DomainSSOConfig(domain *data.Domain) middleware.Responder {
 	// Verify SSO is at all enabled
 	if !domain.AuthSSO {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO isn't enabled"))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO isn't enabled"))
 
 		// Verify SSO URL is set
 	} else if domain.SSOURL == "" {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO URL is missing"))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO URL is missing"))
 
 		// Verify SSO URL is valid and secure (allow insecure in e2e-testing mode)
 	} else if _, err := util.ParseAbsoluteURL(domain.SSOURL, config.ServerConfig.E2e, false); err != nil {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails(err.Error()))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails(err.Error()))
+
+		// If the provider issues JWTs, the verification keys must be valid; the secret is optional then
+	} else if domain.SSOUsesJWT() {
+		if _, err := util.JWTParseKeys(domain.SSOJWTKeys); err != nil {
+			return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO JWT keys are invalid"))
+		} else if domain.SSOJWTIssuer == "" || domain.SSOJWTAudience == "" {
+			return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO JWT issuer or audience isn't configured"))
+		}
 
 		// Verify SSO secret is encoded properly
 	} else if sec, err := domain.SSOSecretBytes(); err != nil {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret is invalid"))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret is invalid"))
 
 		// Verify SSO secret is set
 	} else if sec == nil {
-		respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret isn't configured"))
+		return respBadRequest(exmodels.ErrorSSOMisconfigured.WithDetails("SSO secret isn't configured"))
 	}
 
 	// Succeeded
 	return nil
 }
 
+func (v *verifier) DomainSSOJWT(domain *data.Domain) middleware.Responder {
+	if !domain.SSOUsesJWT() {
+		return nil
+	} else if _, err := util.JWTParseKeys(domain.SSOJWTKeys); err != nil {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("ssoJwtKeys: " + err.Error()))
+	} else if domain.SSOJWTIssuer == "" {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("ssoJwtIssuer is required with ssoJwtKeys"))
+	} else if domain.SSOJWTAudience == "" {
+		return respBadRequest(exmodels.ErrorInvalidPropertyValue.WithDetails("ssoJwtAudience is required with ssoJwtKeys"))
+	}
+	return nil
+}
+
 func (v *verifier) FederatedIdProvider(id models.FederatedIdpID) (goth.Provider, middleware.Responder) {
 	if known, conf, p, _ := config.GetFederatedIdP(id); !known {
 		// Provider ID not known
@@ -210,6 +239,13 @@ func (v *verifier) LocalSignupEnabled(domainID *uuid.UUID) middleware.Responder
 	return nil
 }
 
+func (v *verifier) PasswordNotCompromised(pwd string) middleware.Responder {
+	if util.IsPwnedPassword(pwd) {
+		return respBadRequest(exmodels.ErrorPasswordCompromised)
+	}
+	return nil
+}
+
 func (v *verifier) UserCanAddDomain(user *data.User) middleware.Responder {
 	// If the user isn't a superuser and no new owners are allowed
 	if !user.IsSuperuser && !svc.Services.DynConfigService().GetBool(data.ConfigKeyOperationNewOwnerEnabled) {
@@ -274,14 +310,14 @@ func (v *verifier) UserCanDeleteComment(domainID *uuid.UUID, user *data.User, do
 
 func (v *verifier) UserCanManageDomain(user *data.User, domainUser *data.DomainUser) middleware.Responder {
 	if user.IsSuperuser || domainUser.IsAnOwner() {
-		return nil
+		return v.UserSatisfiesTOTPPolicy(user, domainUser)
 	}
 	return respForbidden(exmodels.ErrorNotDomainOwner)
 }
 
 func (v *verifier) UserCanModerateDomain(user *data.User, domainUser *data.DomainUser) middleware.Responder {
 	if user.IsSuperuser || domainUser.CanModerate() {
-		return nil
+		return v.UserSatisfiesTOTPPolicy(user, domainUser)
 	}
 	return respForbidden(exmodels.ErrorNotModerator)
 }
@@ -366,5 +402,22 @@ func (v *verifier) UserIsSuperuser(user *data.User) middleware.Responder {
 	if !user.IsSuperuser {
 		return respForbidden(exmodels.ErrorNoSuperuser)
 	}
+	return v.UserSatisfiesTOTPPolicy(user, nil)
+}
+
+func (v *verifier) UserSatisfiesTOTPPolicy(user *data.User, domainUser *data.DomainUser) middleware.Responder {
+	// The policy only applies to local users who haven't enabled 2FA: federated ones authenticate elsewhere
+	if user.TOTPEnabled || !user.IsLocal() || user.IsAnonymous() {
+		return nil
+	}
+
+	// Check if 2FA is required for the user's role
+	cfg := svc.Services.DynConfigService()
+	if user.IsSuperuser && cfg.GetBool(data.ConfigKeyAuthTOTPRequiredSuperuser) ||
+		domainUser.IsAnOwner() && cfg.GetBool(data.ConfigKeyAuthTOTPRequiredOwner) {
+		return respForbidden(exmodels.ErrorTOTPRequired)
+	}
+
+	// Succeeded
 	return nil
 }
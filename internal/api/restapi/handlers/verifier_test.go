@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"gitlab.com/comentario/comentario/internal/data"
+	"strings"
+	"testing"
+)
+
+func Test_verifier_DomainSSOConfig(t *testing.T) {
+	secret := sql.NullString{String: strings.Repeat("5e", 32), Valid: true}
+	tests := []struct {
+		name    string
+		domain  *data.Domain
+		wantErr bool
+	}{
+		{"SSO disabled    ", &data.Domain{SSOURL: "https://sso.example.com/", SSOSecret: secret}, true},
+		{"URL missing     ", &data.Domain{AuthSSO: true, SSOSecret: secret}, true},
+		{"URL relative    ", &data.Domain{AuthSSO: true, SSOURL: "/sso", SSOSecret: secret}, true},
+		{"URL insecure    ", &data.Domain{AuthSSO: true, SSOURL: "http://sso.example.com/", SSOSecret: secret}, true},
+		{"secret missing  ", &data.Domain{AuthSSO: true, SSOURL: "https://sso.example.com/"}, true},
+		{"secret not hex  ", &data.Domain{AuthSSO: true, SSOURL: "https://sso.example.com/", SSOSecret: sql.NullString{String: "xyz", Valid: true}}, true},
+		{"secret too short", &data.Domain{AuthSSO: true, SSOURL: "https://sso.example.com/", SSOSecret: sql.NullString{String: "5e5e", Valid: true}}, true},
+		{"valid           ", &data.Domain{AuthSSO: true, SSOURL: "https://sso.example.com/", SSOSecret: secret}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&verifier{}).DomainSSOConfig(tt.domain); (got != nil) != tt.wantErr {
+				t.Errorf("DomainSSOConfig() = %v, wantErr %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_verifier_DomainSSOJWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	b, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() failed: %v", err)
+	}
+	keys := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	tests := []struct {
+		name    string
+		domain  *data.Domain
+		wantErr bool
+	}{
+		{"no keys         ", &data.Domain{}, false},
+		{"invalid keys    ", &data.Domain{SSOJWTKeys: "foo", SSOJWTIssuer: "https://sso.example.com", SSOJWTAudience: "comentario"}, true},
+		{"issuer missing  ", &data.Domain{SSOJWTKeys: keys, SSOJWTAudience: "comentario"}, true},
+		{"audience missing", &data.Domain{SSOJWTKeys: keys, SSOJWTIssuer: "https://sso.example.com"}, true},
+		{"valid           ", &data.Domain{SSOJWTKeys: keys, SSOJWTIssuer: "https://sso.example.com", SSOJWTAudience: "comentario"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&verifier{}).DomainSSOJWT(tt.domain); (got != nil) != tt.wantErr {
+				t.Errorf("DomainSSOJWT() = %v, wantErr %v", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package restapi
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"github.com/go-openapi/errors"
 	"github.com/go-openapi/runtime"
@@ -98,6 +99,40 @@ func makeAPIHandler(apiHandler http.Handler) alice.Constructor {
 	}
 }
 
+// metricsHandler serves server metrics in the Prometheus text exposition format, provided a metrics token is configured
+// and matches the one passed in the Authorization header
+func metricsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Check if the metrics endpoint is enabled and the path is the metrics one
+		if token := config.ServerConfig.MetricsToken; token != "" {
+			if ok, p := config.ServerConfig.PathOfBaseURL(r.URL.Path); ok && p == util.MetricsPath {
+				// Only allow GET requests
+				if r.Method != http.MethodGet {
+					writeError(w, http.StatusMethodNotAllowed)
+					return
+				}
+
+				// Verify the passed token
+				auth := []byte(r.Header.Get("Authorization"))
+				if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+					writeError(w, http.StatusUnauthorized)
+					return
+				}
+
+				// Write out the metrics
+				w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+				if err := svc.Services.MetricsService().Write(w); err != nil {
+					logger.Errorf("Failed to write metrics: %v", err)
+				}
+				return
+			}
+		}
+
+		// Pass on to the next handler otherwise
+		next.ServeHTTP(w, r)
+	})
+}
+
 // redirectToLangRootHandler returns a middleware that redirects the user from the site root or an "incomplete" language
 // root (such as "/en") to the complete/appropriate language root (such as "/en/")
 func redirectToLangRootHandler(next http.Handler) http.Handler {
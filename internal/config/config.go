@@ -3,6 +3,7 @@ package config
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/op/go-logging"
 	"gitlab.com/comentario/comentario/internal/util"
@@ -17,32 +18,37 @@ import (
 // ServerConfiguration stores Comentario server configuration
 type ServerConfiguration struct {
 	// Flags
-	Verbose              []bool `short:"v" long:"verbose"   description:"Verbose logging (-vv for debug)"`
-	NoLogColours         bool   `long:"no-color"            description:"Disable log colouring"                                                                    env:"NO_COLOR"`
-	BaseURL              string `long:"base-url"            description:"Server's own base URL"                              default:"http://localhost:8080"       env:"BASE_URL"`
-	BaseDocsURL          string `long:"base-docs-url"       description:"Base documentation URL"                             default:"https://docs.comentario.app" env:"BASE_DOCS_URL"`
-	TermsOfServiceURL    string `long:"tos-url"             description:"URL of the Terms of Service page"                   default:""                            env:"TOS_URL"`
-	PrivacyPolicyURL     string `long:"privacy-policy-url"  description:"URL of the Privacy Policy page"                     default:""                            env:"PRIVACY_POLICY_URL"`
-	CDNURL               string `long:"cdn-url"             description:"Static file CDN URL (defaults to base URL)"         default:""                            env:"CDN_URL"`
-	EmailFrom            string `long:"email-from"          description:"'From' address in sent emails, defaults to SMTP username"                                 env:"EMAIL_FROM"`
-	DBIdleConns          int    `long:"db-idle-conns"       description:"Max. # of idle DB connections"                      default:"50"                          env:"DB_MAX_IDLE_CONNS"`
-	DisableXSRF          bool   `long:"disable-xsrf"        description:"Disable XSRF protection (development purposes only)"`
-	EnableSwaggerUI      bool   `long:"enable-swagger-ui"   description:"Enable Swagger UI at /api/docs"`
-	PluginPath           string `long:"plugin-path"         description:"Path to plugins"                                    default:""                            env:"PLUGIN_PATH"`
-	StaticPath           string `long:"static-path"         description:"Path to static files"                               default:"./frontend"                  env:"STATIC_PATH"`
-	DBMigrationPath      string `long:"db-migration-path"   description:"Path to DB migration files"                         default:"./db"                        env:"DB_MIGRATION_PATH"`
-	DBDebug              bool   `long:"db-debug"            description:"Enable database debug logging"`
-	TemplatePath         string `long:"template-path"       description:"Path to template files"                             default:"./templates"                 env:"TEMPLATE_PATH"`
-	SecretsFile          string `long:"secrets"             description:"Path to YAML file with secrets"                     default:"secrets.yaml"                env:"SECRETS_FILE"`
-	Superuser            string `long:"superuser"           description:"ID or email of user to be made superuser"           default:""                            env:"SUPERUSER"`
-	LogFullIPs           bool   `long:"log-full-ips"        description:"Log IP addresses in full"                                                                 env:"LOG_FULL_IPS"`
-	HomeContentURL       string `long:"home-content-url"    description:"URL of a HTML page to display on homepage"                                                env:"HOME_CONTENT_URL"`
-	GitLabURL            string `long:"gitlab-url"          description:"Custom GitLab URL for authentication"               default:""                            env:"GITLAB_URL"`
-	DisableLiveUpdate    bool   `long:"no-live-update"      description:"Disable live updates via WebSockets"                                                      env:"NO_LIVE_UPDATE"`
-	DisablePageViewStats bool   `long:"no-page-view-stats"  description:"Disable page view statistics gathering and reporting"                                     env:"NO_PAGE_VIEW_STATS"`
-	StatsMaxDays         uint64 `long:"stats-max-days"      description:"Statistics retention and reporting period, in days" default:"30"                          env:"STATS_MAX_DAYS"`
-	WSMaxClients         uint64 `long:"ws-max-clients"      description:"Maximum number of WebSocket clients"                default:"10000"                       env:"WS_MAX_CLIENTS"`
-	E2e                  bool   `long:"e2e"                 description:"End-2-end testing mode"`
+	Verbose              []bool   `short:"v" long:"verbose"   description:"Verbose logging (-vv for debug)"`
+	NoLogColours         bool     `long:"no-color"            description:"Disable log colouring"                                                                    env:"NO_COLOR"`
+	BaseURL              string   `long:"base-url"            description:"Server's own base URL"                              default:"http://localhost:8080"       env:"BASE_URL"`
+	BaseDocsURL          string   `long:"base-docs-url"       description:"Base documentation URL"                             default:"https://docs.comentario.app" env:"BASE_DOCS_URL"`
+	TermsOfServiceURL    string   `long:"tos-url"             description:"URL of the Terms of Service page"                   default:""                            env:"TOS_URL"`
+	PrivacyPolicyURL     string   `long:"privacy-policy-url"  description:"URL of the Privacy Policy page"                     default:""                            env:"PRIVACY_POLICY_URL"`
+	CDNURL               string   `long:"cdn-url"             description:"Static file CDN URL (defaults to base URL)"         default:""                            env:"CDN_URL"`
+	EmailFrom            string   `long:"email-from"          description:"'From' address in sent emails, defaults to SMTP username"                                 env:"EMAIL_FROM"`
+	DBIdleConns          int      `long:"db-idle-conns"       description:"Max. # of idle DB connections"                      default:"50"                          env:"DB_MAX_IDLE_CONNS"`
+	DisableXSRF          bool     `long:"disable-xsrf"        description:"Disable XSRF protection (development purposes only)"`
+	EnableSwaggerUI      bool     `long:"enable-swagger-ui"   description:"Enable Swagger UI at /api/docs"`
+	PluginPath           string   `long:"plugin-path"         description:"Path to plugins"                                    default:""                            env:"PLUGIN_PATH"`
+	StaticPath           string   `long:"static-path"         description:"Path to static files"                               default:"./frontend"                  env:"STATIC_PATH"`
+	DBMigrationPath      string   `long:"db-migration-path"   description:"Path to DB migration files"                         default:"./db"                        env:"DB_MIGRATION_PATH"`
+	DBDebug              bool     `long:"db-debug"            description:"Enable database debug logging"`
+	TemplatePath         string   `long:"template-path"       description:"Path to template files"                             default:"./templates"                 env:"TEMPLATE_PATH"`
+	SecretsFile          string   `long:"secrets"             description:"Path to YAML file with secrets"                     default:"secrets.yaml"                env:"SECRETS_FILE"`
+	Superuser            string   `long:"superuser"           description:"ID or email of user to be made superuser"           default:""                            env:"SUPERUSER"`
+	LogFullIPs           bool     `long:"log-full-ips"        description:"Log IP addresses in full"                                                                 env:"LOG_FULL_IPS"`
+	HomeContentURL       string   `long:"home-content-url"    description:"URL of a HTML page to display on homepage"                                                env:"HOME_CONTENT_URL"`
+	GitLabURL            string   `long:"gitlab-url"          description:"Custom GitLab URL for authentication"               default:""                            env:"GITLAB_URL"`
+	DisableLiveUpdate    bool     `long:"no-live-update"      description:"Disable live updates via WebSockets"                                                      env:"NO_LIVE_UPDATE"`
+	DisablePageViewStats bool     `long:"no-page-view-stats"  description:"Disable page view statistics gathering and reporting"                                     env:"NO_PAGE_VIEW_STATS"`
+	GeoIPDBs             []string `long:"geoip-db"            description:"Path to a MaxMind-format GeoIP database file (repeatable)"                                env:"GEOIP_DB" env-delim:","`
+	StatsMaxDays         uint64   `long:"stats-max-days"      description:"Raw page view retention/reporting period, in days"  default:"30"                          env:"STATS_MAX_DAYS"`
+	WSMaxClients         uint64   `long:"ws-max-clients"      description:"Maximum number of WebSocket clients"                default:"10000"                       env:"WS_MAX_CLIENTS"`
+	MetricsToken         string   `long:"metrics-token"       description:"Bearer token for the /metrics endpoint (disabled if empty)"                               env:"METRICS_TOKEN"`
+	E2e                  bool     `long:"e2e"                 description:"End-2-end testing mode"`
+	BackupFile           string   `long:"backup"              description:"Back up the entire instance into the given file and exit. Restoring it requires the same encryption secret"`
+	BackupSessions       bool     `long:"backup-sessions"     description:"Include user sessions in the backup"`
+	RestoreFile          string   `long:"restore"             description:"Restore the instance from the given backup file into an empty database and exit"`
 
 	parsedBaseURL *url.URL // The parsed base URL
 	parsedCDNURL  *url.URL // The parsed CDN URL
@@ -140,6 +146,11 @@ func (sc *ServerConfiguration) postProcess() error {
 		return fmt.Errorf("invalid CDN URL: %w", err)
 	}
 
+	// Backup and restore are mutually exclusive
+	if sc.BackupFile != "" && sc.RestoreFile != "" {
+		return errors.New("backup and restore cannot be requested at the same time")
+	}
+
 	// Load and post-process secrets
 	if err := UnmarshalConfigFile(sc.SecretsFile, SecretsConfig); err != nil {
 		return err
@@ -193,6 +204,16 @@ func PostProcess() error {
 		return err
 	}
 
+	// Load GeoIP databases
+	if err := util.ConfigureGeoIP(ServerConfig.GeoIPDBs, util.GeoIPCheckInterval); err != nil {
+		return fmt.Errorf("failed to load GeoIP database: %w", err)
+	}
+
+	// Load the compromised password list
+	if err := util.ConfigurePwnedPasswords(SecretsConfig.PwnedPasswords); err != nil {
+		return fmt.Errorf("failed to load compromised password list: %w", err)
+	}
+
 	// Succeeded
 	return nil
 }
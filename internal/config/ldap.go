@@ -0,0 +1,203 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/markbates/goth"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"golang.org/x/oauth2"
+	"strings"
+	"time"
+)
+
+// LDAPProviderID is the ID (and the goth name) of the LDAP identity provider
+const LDAPProviderID = "ldap"
+
+// ldapTimeout is the timeout applied to connecting and every request to the LDAP server
+const ldapTimeout = 10 * time.Second
+
+// ldapRawDataSuperuser is the key of the user's superuser status in goth.User.RawData
+const ldapRawDataSuperuser = "superuser"
+
+// ErrLDAPInvalidCredentials is returned when the user can't be found or their password is wrong
+var ErrLDAPInvalidCredentials = errors.New("invalid LDAP credentials")
+
+// LDAPProvider is a goth.Provider implementation that authenticates users against an LDAP directory. There's no
+// redirect-based flow in LDAP, so the auth URL points to the frontend login page instead, which submits the user's
+// credentials to be verified with Authenticate, and then proceeds to the callback the same way an OAuth provider does
+type LDAPProvider struct {
+	cfg *LDAPConfig
+}
+
+// Authenticate verifies the given credentials against the directory and, if successful, stores the found user in the
+// provided session, which must originate from BeginAuth or UnmarshalSession. Returns ErrLDAPInvalidCredentials if the
+// user doesn't exist or the password is wrong
+func (p *LDAPProvider) Authenticate(sess goth.Session, username, password string) error {
+	s, ok := sess.(*ldapSession)
+	if !ok || s.State == "" {
+		return errors.New("LDAPProvider.Authenticate: invalid session")
+	}
+
+	// Look the user up and bind as them
+	u, err := p.authenticate(strings.TrimSpace(username), password)
+	if err != nil {
+		return err
+	}
+
+	// Succeeded
+	s.User = u
+	return nil
+}
+
+func (p *LDAPProvider) BeginAuth(state string) (goth.Session, error) {
+	return &ldapSession{State: state}, nil
+}
+
+func (p *LDAPProvider) Debug(bool) {
+	// Not applicable
+}
+
+func (p *LDAPProvider) FetchUser(sess goth.Session) (goth.User, error) {
+	if s, ok := sess.(*ldapSession); !ok || s.User == nil {
+		return goth.User{}, errors.New("user isn't authenticated")
+	} else {
+		return *s.User, nil
+	}
+}
+
+func (p *LDAPProvider) Name() string {
+	return LDAPProviderID
+}
+
+func (p *LDAPProvider) RefreshToken(string) (*oauth2.Token, error) {
+	return nil, errors.New("refresh token is not provided by LDAP")
+}
+
+func (p *LDAPProvider) RefreshTokenAvailable() bool {
+	return false
+}
+
+func (p *LDAPProvider) SetName(string) {
+	// The name is fixed
+}
+
+// SuperuserStatus returns whether the given user, fetched from this provider, must be a superuser, and whether that
+// status is known at all, i.e. a superuser group is configured
+func (p *LDAPProvider) SuperuserStatus(u *goth.User) (superuser, known bool) {
+	superuser, known = u.RawData[ldapRawDataSuperuser].(bool)
+	return
+}
+
+func (p *LDAPProvider) UnmarshalSession(s string) (goth.Session, error) {
+	var sess ldapSession
+	if err := json.Unmarshal([]byte(s), &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// authenticate looks up the user by their login name and verifies their password by binding with it
+func (p *LDAPProvider) authenticate(username, password string) (*goth.User, error) {
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	// Connect to the server
+	conn, err := util.LDAPDial(p.cfg.URL, p.cfg.StartTLS, p.cfg.Insecure, ldapTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("LDAPProvider.authenticate: failed to connect to LDAP server: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Bind as the service account, if any
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAPProvider.authenticate: service account bind failed: %w", err)
+		}
+	}
+
+	// Search for the user, making sure the login name is unambiguous
+	a := &p.cfg.Attributes
+	filter := strings.ReplaceAll(p.cfg.UserFilter, "{username}", util.LDAPEscapeFilterValue(username))
+	entries, err := conn.Search(p.cfg.SearchBase, filter, []string{a.ID, a.Email, a.Name, a.Groups}, 2)
+	if err != nil {
+		return nil, fmt.Errorf("LDAPProvider.authenticate: search failed: %w", err)
+	} else if len(entries) == 0 {
+		return nil, ErrLDAPInvalidCredentials
+	} else if len(entries) > 1 {
+		return nil, fmt.Errorf("LDAPProvider.authenticate: user filter %q matches multiple entries", filter)
+	}
+	e := entries[0]
+
+	// Verify the user's password
+	if err := conn.Bind(e.DN, password); util.LDAPIsInvalidCredentials(err) {
+		return nil, ErrLDAPInvalidCredentials
+	} else if err != nil {
+		return nil, fmt.Errorf("LDAPProvider.authenticate: user bind failed: %w", err)
+	}
+
+	// Map the attributes onto a user
+	u := &goth.User{
+		Provider: LDAPProviderID,
+		UserID:   e.Value(a.ID),
+		Email:    e.Value(a.Email),
+		Name:     e.Value(a.Name),
+		NickName: username,
+	}
+
+	// Determine the superuser status, if there's a group mapping
+	if g := p.cfg.SuperuserGroup; g != "" {
+		su := false
+		for _, v := range e.Values(a.Groups) {
+			if strings.EqualFold(v, g) {
+				su = true
+				break
+			}
+		}
+		u.RawData = map[string]any{ldapRawDataSuperuser: su}
+	}
+	return u, nil
+}
+
+// ldapSession is a goth.Session implementation for LDAPProvider
+type ldapSession struct {
+	State string     `json:"state"`          // Random state, which the callback request must carry
+	User  *goth.User `json:"user,omitempty"` // Authenticated user, once the credentials have been verified
+}
+
+func (s *ldapSession) Authorize(goth.Provider, goth.Params) (string, error) {
+	if s.User == nil {
+		return "", errors.New("user isn't authenticated")
+	}
+	return "", nil
+}
+
+// GetAuthURL returns the URL of the frontend's LDAP login page
+func (s *ldapSession) GetAuthURL() (string, error) {
+	return ServerConfig.URLFor(util.DefaultLanguage.String()+"/auth/ldap", map[string]string{"state": s.State}), nil
+}
+
+func (s *ldapSession) Marshal() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// ldapConfigure configures federated authentication via LDAP
+func ldapConfigure() {
+	if !SecretsConfig.IdP.LDAP.Usable() {
+		logger.Debug("LDAP auth isn't configured or enabled")
+		return
+	}
+
+	logger.Infof("Registering LDAP provider for server %s", SecretsConfig.IdP.LDAP.URL)
+	goth.UseProviders(&LDAPProvider{cfg: &SecretsConfig.IdP.LDAP})
+
+	// Add it to the configured providers map
+	FederatedIdProviders[LDAPProviderID] = &data.FederatedIdentityProvider{
+		ID:       LDAPProviderID,
+		Name:     SecretsConfig.IdP.LDAP.Name,
+		GothName: LDAPProviderID,
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/providers/facebook"
@@ -11,6 +12,8 @@ import (
 	"github.com/markbates/goth/providers/twitter"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"net/http"
 	"strings"
 )
 
@@ -45,6 +48,8 @@ func oauthConfigure() error {
 	gitlabOauthConfigure()
 	googleOauthConfigure()
 	twitterOauthConfigure()
+	ldapConfigure()
+	samlConfigure()
 	return oidcConfigure()
 }
 
@@ -152,6 +157,44 @@ func twitterOauthConfigure() {
 	)
 }
 
+// NewOIDCProvider instantiates a new OIDC provider with the given qualified ID, server URL, client credentials, and
+// scopes. This will also retrieve its configuration via discovery. client is used for all requests to the provider; nil
+// means the default client
+func NewOIDCProvider(qid, url, key, secret string, scopes []string, client *http.Client) (*openidConnect.Provider, error) {
+	// Retrieve the provider configuration. We don't let goth do it, because it would use the default client
+	res, err := goth.HTTPClientWithFallBack(client).Get(strings.TrimSuffix(url, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer util.LogError(res.Body.Close, "NewOIDCProvider, res.Body.Close()")
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("discovery request failed with status %d", res.StatusCode)
+	}
+	var oc openidConnect.OpenIDConfig
+	if err := json.NewDecoder(res.Body).Decode(&oc); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery response: %w", err)
+	}
+
+	op, err := openidConnect.NewCustomisedURL(
+		key,
+		secret,
+		oauthCallbackURL(qid),
+		oc.AuthEndpoint,
+		oc.TokenEndpoint,
+		oc.Issuer,
+		oc.UserInfoEndpoint,
+		oc.EndSessionEndpoint,
+		scopes...)
+	if err != nil {
+		return nil, err
+	}
+	op.HTTPClient = client
+
+	// Set the name explicitly to override goth's default name
+	op.SetName(qid)
+	return op, nil
+}
+
 // oidcConfigure configures federated authentication via OIDC providers
 func oidcConfigure() error {
 	cnt := 0
@@ -161,22 +204,13 @@ func oidcConfigure() error {
 			continue
 		}
 
-		// Instantiate a new OIDC provider. This will also retrieve its configuration via discovery
+		// Instantiate a new OIDC provider
 		qid := p.QualifiedID()
-		op, err := openidConnect.NewNamed(
-			p.ID,
-			p.Key,
-			p.Secret,
-			oauthCallbackURL(qid),
-			strings.TrimSuffix(p.URL, "/")+"/.well-known/openid-configuration",
-			p.Scopes...)
+		op, err := NewOIDCProvider(qid, p.URL, p.Key, p.Secret, p.Scopes, nil)
 		if err != nil {
 			return fmt.Errorf("failed to add OIDC provider (ID=%q): %w", p.ID, err)
 		}
 
-		// Set the name explicitly to override goth's name assigning logic that adds a suffix
-		op.SetName(qid)
-
 		// Register the provider
 		logger.Infof("Registering OIDC provider (ID=%q) for client %s", p.ID, p.Key)
 		goth.UseProviders(op)
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crewjam/saml"
+	"github.com/markbates/goth"
+	dsig "github.com/russellhaering/goxmldsig"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"golang.org/x/oauth2"
+	"net/url"
+	"strings"
+)
+
+const (
+	samlNameIDEmail     = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlNameIDTransient = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+// samlRelayStateLen is the number of random bytes in a relay state, which gets hex-encoded
+const samlRelayStateLen = 16
+
+// SAMLAuthProvider is a goth.Provider implementation that authenticates users against a SAML 2.0 identity provider.
+// Authentication requests are sent using the HTTP-Redirect binding, and responses are received using the HTTP-POST
+// binding at the provider's callback URL
+type SAMLAuthProvider struct {
+	cfg *SAMLProvider
+	sp  *saml.ServiceProvider
+}
+
+// newSAMLAuthProvider returns a new SAMLAuthProvider for the given provider config
+func newSAMLAuthProvider(cfg *SAMLProvider) (*SAMLAuthProvider, error) {
+	acsURL, err := url.Parse(oauthCallbackURL(cfg.QualifiedID()))
+	if err != nil {
+		return nil, err
+	}
+
+	// Describe the IdP by its entity ID, SSO URL, and signing certificates
+	kds := make([]saml.KeyDescriptor, len(cfg.certs))
+	for i, c := range cfg.certs {
+		kds[i] = saml.KeyDescriptor{
+			Use:     "signing",
+			KeyInfo: saml.KeyInfo{X509Data: saml.X509Data{X509Certificates: []saml.X509Certificate{{Data: base64.StdEncoding.EncodeToString(c.Raw)}}}},
+		}
+	}
+	return &SAMLAuthProvider{
+		cfg: cfg,
+		sp: &saml.ServiceProvider{
+			EntityID:    cfg.SPEntityID,
+			Key:         cfg.spKey,
+			Certificate: cfg.spCert,
+			AcsURL:      *acsURL,
+			IDPMetadata: &saml.EntityDescriptor{
+				EntityID: cfg.EntityID,
+				IDPSSODescriptors: []saml.IDPSSODescriptor{{
+					SSODescriptor:        saml.SSODescriptor{RoleDescriptor: saml.RoleDescriptor{KeyDescriptors: kds}},
+					SingleSignOnServices: []saml.Endpoint{{Binding: saml.HTTPRedirectBinding, Location: cfg.SSOURL}},
+				}},
+			},
+			// Leave the name ID format to the IdP, since the library would request a transient one otherwise
+			AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+			SignatureMethod:   dsig.RSASHA256SignatureMethod,
+		},
+	}, nil
+}
+
+// BeginAuth starts a new authentication. The given state isn't used, because it exceeds the 80-byte limit SAML
+// imposes on RelayState; a shorter random nonce is sent instead, and kept in the session
+func (p *SAMLAuthProvider) BeginAuth(string) (goth.Session, error) {
+	// Generate a relay state
+	b, err := util.RandomBytes(samlRelayStateLen)
+	if err != nil {
+		return nil, err
+	}
+	relayState := hex.EncodeToString(b)
+
+	// Build an authentication request
+	req, err := p.sp.MakeAuthenticationRequest(p.cfg.SSOURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign it and encode into the IdP's URL, passing the relay state along
+	authURL, err := req.Redirect(relayState, p.sp)
+	if err != nil {
+		return nil, err
+	}
+	return &samlSession{AuthURL: authURL.String(), RequestID: req.ID, RelayState: relayState}, nil
+}
+
+func (p *SAMLAuthProvider) Debug(bool) {
+	// Not applicable
+}
+
+func (p *SAMLAuthProvider) FetchUser(sess goth.Session) (goth.User, error) {
+	if s, ok := sess.(*samlSession); !ok || s.User == nil {
+		return goth.User{}, errors.New("user isn't authenticated")
+	} else {
+		return *s.User, nil
+	}
+}
+
+// Metadata returns the service provider metadata to be registered with the IdP
+func (p *SAMLAuthProvider) Metadata() *saml.EntityDescriptor {
+	return p.sp.Metadata()
+}
+
+func (p *SAMLAuthProvider) Name() string {
+	return p.cfg.QualifiedID()
+}
+
+func (p *SAMLAuthProvider) RefreshToken(string) (*oauth2.Token, error) {
+	return nil, errors.New("refresh token is not provided by SAML")
+}
+
+func (p *SAMLAuthProvider) RefreshTokenAvailable() bool {
+	return false
+}
+
+func (p *SAMLAuthProvider) SetName(string) {
+	// The name is fixed
+}
+
+func (p *SAMLAuthProvider) UnmarshalSession(s string) (goth.Session, error) {
+	var sess samlSession
+	if err := json.Unmarshal([]byte(s), &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// parseResponse validates the given base64-encoded SAML response, issued in reply to the request with the given ID, and
+// returns the user it asserts
+func (p *SAMLAuthProvider) parseResponse(encoded, requestID string) (*goth.User, error) {
+	// Decode the response
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response encoding: %w", err)
+	}
+
+	// Validate the response, its signature, and the assertion in it (decrypting it if necessary)
+	a, err := p.sp.ParseXMLResponse(b, []string{requestID}, p.sp.AcsURL)
+	if err != nil {
+		var ire *saml.InvalidResponseError
+		if errors.As(err, &ire) && ire.PrivateErr != nil {
+			err = ire.PrivateErr
+		}
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	// Fetch the subject's name ID, which identifies the user
+	if a.Subject == nil || len(a.Subject.SubjectConfirmations) == 0 {
+		return nil, errors.New("assertion has no subject confirmation")
+	}
+	nameID := a.Subject.NameID
+	if nameID == nil || nameID.Value == "" {
+		return nil, errors.New("assertion has no name ID")
+	} else if nameID.Format == samlNameIDTransient {
+		return nil, errors.New("transient name ID can't identify a user")
+	}
+
+	// Collect the attributes
+	attrs := map[string]string{}
+	for _, st := range a.AttributeStatements {
+		for _, at := range st.Attributes {
+			if len(at.Values) > 0 && at.Values[0].Value != "" {
+				for _, n := range []string{at.Name, at.FriendlyName} {
+					if _, ok := attrs[n]; n != "" && !ok {
+						attrs[n] = at.Values[0].Value
+					}
+				}
+			}
+		}
+	}
+
+	// Map the attributes onto a user, falling back to the name ID for the email
+	u := &goth.User{
+		Provider: p.cfg.QualifiedID(),
+		UserID:   nameID.Value,
+		Email:    attrs[p.cfg.Attributes.Email],
+		Name:     attrs[p.cfg.Attributes.Name],
+	}
+	if u.Email == "" && nameID.Format == samlNameIDEmail {
+		u.Email = nameID.Value
+	}
+	u.NickName, _, _ = strings.Cut(u.Email, "@")
+	return u, nil
+}
+
+// samlSession is a goth.Session implementation for SAMLAuthProvider
+type samlSession struct {
+	AuthURL    string     `json:"authURL"`        // URL to redirect the user to, with the encoded request
+	RequestID  string     `json:"requestID"`      // ID of the issued authentication request
+	RelayState string     `json:"relayState"`     // Random nonce, which the response must carry as RelayState
+	User       *goth.User `json:"user,omitempty"` // Authenticated user, once the response has been validated
+}
+
+// Authorize validates the SAML response posted by the IdP and stores the asserted user in the session
+func (s *samlSession) Authorize(provider goth.Provider, params goth.Params) (string, error) {
+	p, ok := provider.(*SAMLAuthProvider)
+	if !ok {
+		return "", errors.New("samlSession.Authorize: provider isn't a SAML one")
+	}
+
+	// Verify the relay state
+	if rs := params.Get("RelayState"); s.RelayState == "" || rs != s.RelayState {
+		return "", fmt.Errorf("samlSession.Authorize: relay state mismatch: want %q, got %q", s.RelayState, rs)
+	}
+
+	// Validate the response
+	u, err := p.parseResponse(params.Get("SAMLResponse"), s.RequestID)
+	if err != nil {
+		return "", fmt.Errorf("samlSession.Authorize: %w", err)
+	}
+
+	// Succeeded
+	s.User = u
+	return "", nil
+}
+
+func (s *samlSession) GetAuthURL() (string, error) {
+	if s.AuthURL == "" {
+		return "", errors.New("auth URL not set")
+	}
+	return s.AuthURL, nil
+}
+
+func (s *samlSession) Marshal() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// samlConfigure configures federated authentication via SAML providers
+func samlConfigure() {
+	cnt := 0
+	for i := range SecretsConfig.IdP.SAML {
+		// Skip unusable ones
+		p := &SecretsConfig.IdP.SAML[i]
+		if !p.Usable() {
+			continue
+		}
+
+		// Default the SP entity ID to the metadata URL, which is a common convention
+		qid := p.QualifiedID()
+		if p.SPEntityID == "" {
+			p.SPEntityID = ServerConfig.URLForAPI(fmt.Sprintf("oauth/%s/metadata", qid), nil)
+		}
+
+		// Register the provider
+		sp, err := newSAMLAuthProvider(p)
+		if err != nil {
+			logger.Errorf("Failed to create SAML provider (ID=%q): %v", p.ID, err)
+			continue
+		}
+		logger.Infof("Registering SAML provider (ID=%q) for entity %s", p.ID, p.EntityID)
+		goth.UseProviders(sp)
+
+		// Add it to the configured providers map
+		mid := models.FederatedIdpID(qid)
+		FederatedIdProviders[mid] = &data.FederatedIdentityProvider{
+			ID:       mid,
+			Name:     p.Name,
+			GothName: qid,
+		}
+		cnt++
+	}
+
+	// If no configure providers available
+	if cnt == 0 {
+		logger.Debug("No SAML providers configured or enabled")
+	}
+}
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// samlTestKeyCert returns a new RSA key and a self-signed certificate for it
+func samlTestKeyCert(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() failed: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() failed: %v", err)
+	}
+	return key, cert
+}
+
+// newTestSAMLAuthProvider returns a new SAMLAuthProvider trusting the given IdP certificate
+func newTestSAMLAuthProvider(t *testing.T, idpCert *x509.Certificate) *SAMLAuthProvider {
+	ServerConfig = ServerConfiguration{parsedBaseURL: mustParseURL("https://comentario.example.com")}
+	spKey, spCert := samlTestKeyCert(t)
+	p, err := newSAMLAuthProvider(&SAMLProvider{
+		ID:         "corp",
+		EntityID:   "https://idp.example.com",
+		SSOURL:     "https://idp.example.com/sso",
+		SPEntityID: "https://comentario.example.com/sp",
+		Attributes: SAMLAttributes{Email: "mail", Name: "displayName"},
+		certs:      []*x509.Certificate{idpCert},
+		spKey:      spKey,
+		spCert:     spCert,
+	})
+	if err != nil {
+		t.Fatalf("newSAMLAuthProvider() failed: %v", err)
+	}
+	return p
+}
+
+func TestSAMLAuthProvider_BeginAuth(t *testing.T) {
+	_, idpCert := samlTestKeyCert(t)
+	p := newTestSAMLAuthProvider(t, idpCert)
+
+	// Pass a state like the one generated by AuthOauthInit, which is too long for a RelayState
+	sess, err := p.BeginAuth(base64.URLEncoding.EncodeToString(make([]byte, 64)))
+	if err != nil {
+		t.Fatalf("BeginAuth() failed: %v", err)
+	}
+	s := sess.(*samlSession)
+	if s.RequestID == "" || s.RelayState == "" || len(s.RelayState) > 80 {
+		t.Errorf("BeginAuth() got session %#v", s)
+	}
+
+	// Verify the URL
+	u, err := url.Parse(s.AuthURL)
+	if err != nil {
+		t.Fatalf("url.Parse() failed: %v", err)
+	}
+	q := u.Query()
+	if u.Host != "idp.example.com" || u.Path != "/sso" {
+		t.Errorf("BeginAuth() got URL %q", s.AuthURL)
+	}
+	if q.Get("RelayState") != s.RelayState {
+		t.Errorf("BeginAuth() got RelayState %q", q.Get("RelayState"))
+	}
+	if q.Get("SigAlg") != dsig.RSASHA256SignatureMethod || q.Get("Signature") == "" {
+		t.Errorf("BeginAuth() request isn't signed: %q", s.AuthURL)
+	}
+
+	// Verify the request
+	b, err := base64.StdEncoding.DecodeString(q.Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("DecodeString() failed: %v", err)
+	}
+	req, err := io.ReadAll(flate.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatalf("inflate failed: %v", err)
+	}
+	for _, want := range []string{
+		`ID="` + s.RequestID + `"`,
+		`AssertionConsumerServiceURL="https://comentario.example.com/api/oauth/saml:corp/callback"`,
+		`>https://comentario.example.com/sp</saml:Issuer>`,
+		`<samlp:NameIDPolicy AllowCreate="true"/>`,
+	} {
+		if !strings.Contains(string(req), want) {
+			t.Errorf("BeginAuth() request %q doesn't contain %q", req, want)
+		}
+	}
+}
+
+// samlTestResponse returns a SAML response for the given request ID, with the given name ID format, audience, and
+// attributes, optionally signing its assertion and/or the response itself with the given key
+func samlTestResponse(t *testing.T, key *rsa.PrivateKey, cert *x509.Certificate, requestID, nameIDFormat, audience, attrs string, signAssertion, signResponse bool) string {
+	now := time.Now().UTC()
+	ts := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+	acs := "https://comentario.example.com/api/oauth/saml:corp/callback"
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(fmt.Sprintf(
+		`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_r1" Version="2.0" IssueInstant="%[1]s" Destination="%[3]s" InResponseTo="%[4]s">`+
+			`<saml:Issuer>https://idp.example.com</saml:Issuer>`+
+			`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>`+
+			`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1" Version="2.0" IssueInstant="%[1]s">`+
+			`<saml:Issuer>https://idp.example.com</saml:Issuer>`+
+			`<saml:Subject><saml:NameID Format="%[5]s">jdoe@example.com</saml:NameID>`+
+			`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData NotOnOrAfter="%[2]s" Recipient="%[3]s" InResponseTo="%[4]s"/></saml:SubjectConfirmation></saml:Subject>`+
+			`<saml:Conditions NotBefore="%[1]s" NotOnOrAfter="%[2]s"><saml:AudienceRestriction><saml:Audience>%[6]s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`+
+			`<saml:AttributeStatement>%[7]s</saml:AttributeStatement>`+
+			`</saml:Assertion></samlp:Response>`,
+		ts(0), ts(5*time.Minute), acs, requestID, nameIDFormat, audience, attrs))
+	if err != nil {
+		t.Fatalf("ReadFromString() failed: %v", err)
+	}
+
+	// Sign the requested elements
+	ctx := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}))
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	sign := func(el *etree.Element) *etree.Element {
+		signed, err := ctx.SignEnveloped(el)
+		if err != nil {
+			t.Fatalf("SignEnveloped() failed: %v", err)
+		}
+		return signed
+	}
+	if signAssertion {
+		a := doc.Root().SelectElement("Assertion")
+		doc.Root().RemoveChild(a)
+		doc.Root().AddChild(sign(a))
+	}
+	if signResponse {
+		doc.SetRoot(sign(doc.Root()))
+	}
+	s, err := doc.WriteToString()
+	if err != nil {
+		t.Fatalf("WriteToString() failed: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestSAMLAuthProvider_parseResponse(t *testing.T) {
+	idpKey, idpCert := samlTestKeyCert(t)
+	otherKey, otherCert := samlTestKeyCert(t)
+	p := newTestSAMLAuthProvider(t, idpCert)
+
+	const (
+		reqID      = "_req1"
+		persistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+		sp         = "https://comentario.example.com/sp"
+		attrs      = `<saml:Attribute Name="mail"><saml:AttributeValue>john@example.com</saml:AttributeValue></saml:Attribute>` +
+			`<saml:Attribute Name="urn:oid:2.16.840.1.113730.3.1.241" FriendlyName="displayName"><saml:AttributeValue>John Doe</saml:AttributeValue></saml:Attribute>`
+	)
+	tests := []struct {
+		name      string
+		resp      string
+		wantErr   string
+		wantEmail string
+		wantName  string
+	}{
+		{"assertion signed     ", samlTestResponse(t, idpKey, idpCert, reqID, persistent, sp, attrs, true, false), "", "john@example.com", "John Doe"},
+		{"response signed      ", samlTestResponse(t, idpKey, idpCert, reqID, persistent, sp, attrs, false, true), "", "john@example.com", "John Doe"},
+		{"both signed          ", samlTestResponse(t, idpKey, idpCert, reqID, persistent, sp, attrs, true, true), "", "john@example.com", "John Doe"},
+		{"email from name ID   ", samlTestResponse(t, idpKey, idpCert, reqID, samlNameIDEmail, sp, "", true, false), "", "jdoe@example.com", ""},
+		{"not base64           ", "<Response/>", "invalid response encoding", "", ""},
+		{"unsigned             ", samlTestResponse(t, idpKey, idpCert, reqID, persistent, sp, attrs, false, false), "invalid response", "", ""},
+		{"signed by other key  ", samlTestResponse(t, otherKey, otherCert, reqID, persistent, sp, attrs, true, false), "invalid response", "", ""},
+		{"wrong request ID     ", samlTestResponse(t, idpKey, idpCert, "_req2", persistent, sp, attrs, true, false), "invalid response", "", ""},
+		{"wrong audience       ", samlTestResponse(t, idpKey, idpCert, reqID, persistent, "https://other", attrs, true, false), "invalid response", "", ""},
+		{"transient name ID    ", samlTestResponse(t, idpKey, idpCert, reqID, samlNameIDTransient, sp, attrs, true, false), "transient name ID can't identify a user", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := p.parseResponse(tt.resp, reqID)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("parseResponse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseResponse() failed: %v", err)
+			}
+			if u.Provider != p.cfg.QualifiedID() {
+				t.Errorf("parseResponse() Provider = %q", u.Provider)
+			}
+			if u.UserID != "jdoe@example.com" || u.Email != tt.wantEmail || u.Name != tt.wantName {
+				t.Errorf("parseResponse() got user ID %q, email %q, name %q, want jdoe@example.com, %q, %q", u.UserID, u.Email, u.Name, tt.wantEmail, tt.wantName)
+			}
+		})
+	}
+}
+
+func Test_samlSession_Authorize(t *testing.T) {
+	idpKey, idpCert := samlTestKeyCert(t)
+	p := newTestSAMLAuthProvider(t, idpCert)
+	const persistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	tests := []struct {
+		name       string
+		relayState func(sent string) string
+		wantErr    bool
+	}{
+		{"relay state echoed  ", func(sent string) string { return sent }, false},
+		{"relay state missing ", func(string) string { return "" }, true},
+		{"relay state mismatch", func(sent string) string { return sent + "x" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Start an authentication and persist the session, the way AuthOauthInit does
+			sess, err := p.BeginAuth(base64.URLEncoding.EncodeToString(make([]byte, 64)))
+			if err != nil {
+				t.Fatalf("BeginAuth() failed: %v", err)
+			}
+			sess, err = p.UnmarshalSession(sess.Marshal())
+			if err != nil {
+				t.Fatalf("UnmarshalSession() failed: %v", err)
+			}
+
+			// Act as the IdP: pick up the request ID and the relay state from the auth URL, and post a response back
+			authURL, _ := sess.GetAuthURL()
+			u, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatalf("url.Parse() failed: %v", err)
+			}
+			b, _ := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+			req, err := io.ReadAll(flate.NewReader(bytes.NewReader(b)))
+			if err != nil {
+				t.Fatalf("inflate failed: %v", err)
+			}
+			doc := etree.NewDocument()
+			if err := doc.ReadFromBytes(req); err != nil {
+				t.Fatalf("ReadFromBytes() failed: %v", err)
+			}
+			form := url.Values{
+				"SAMLResponse": {samlTestResponse(t, idpKey, idpCert, doc.Root().SelectAttrValue("ID", ""), persistent, "https://comentario.example.com/sp", "", true, false)},
+				"RelayState":   {tt.relayState(u.Query().Get("RelayState"))},
+			}
+
+			// Complete the authentication
+			_, err = sess.Authorize(p, form)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			user, err := p.FetchUser(sess)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("FetchUser() succeeded, want error")
+				}
+			} else if err != nil {
+				t.Errorf("FetchUser() failed: %v", err)
+			} else if user.UserID != "jdoe@example.com" {
+				t.Errorf("FetchUser() got user ID %q, want jdoe@example.com", user.UserID)
+			}
+		})
+	}
+}
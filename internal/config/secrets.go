@@ -1,7 +1,10 @@
 package config
 
 import (
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"gitlab.com/comentario/comentario/internal/util"
@@ -101,6 +104,173 @@ func (p *OIDCProvider) validate() error {
 	return nil
 }
 
+// LDAPAttributes maps LDAP entry attributes onto user properties
+type LDAPAttributes struct {
+	ID     string `yaml:"id"`     // Attribute holding a unique, immutable user ID, defaults to "uid"
+	Email  string `yaml:"email"`  // Attribute holding the user's email, defaults to "mail"
+	Name   string `yaml:"name"`   // Attribute holding the user's display name, defaults to "cn"
+	Groups string `yaml:"groups"` // Attribute listing DNs of groups the user is a member of, defaults to "memberOf"
+}
+
+// LDAPConfig stores LDAP (or Active Directory) identity provider configuration
+type LDAPConfig struct {
+	Disableable    `yaml:",inline"`
+	Name           string         `yaml:"name"`           // Provider display name, defaults to "LDAP"
+	URL            string         `yaml:"url"`            // Server URL, e.g. "ldaps://ldap.example.com"
+	StartTLS       bool           `yaml:"startTLS"`       // Whether to upgrade a plain "ldap://" connection with StartTLS
+	Insecure       bool           `yaml:"insecure"`       // Skip server certificate verification
+	BindDN         string         `yaml:"bindDN"`         // DN of the service account used for looking users up; if empty, an anonymous search is used
+	BindPassword   string         `yaml:"bindPassword"`   // Password of the service account
+	SearchBase     string         `yaml:"searchBase"`     // DN to search users under
+	UserFilter     string         `yaml:"userFilter"`     // Filter for looking a user up, with "{username}" standing for the login name. Defaults to "(uid={username})"
+	Attributes     LDAPAttributes `yaml:"attributes"`     // Attribute mapping
+	SuperuserGroup string         `yaml:"superuserGroup"` // Optional DN of a group whose members get superuser privileges (and non-members lose them)
+}
+
+// Usable returns whether the instance isn't disabled and the server is configured
+func (c *LDAPConfig) Usable() bool {
+	return !c.Disable && c.URL != "" && c.SearchBase != ""
+}
+
+// validate the LDAP configuration, filling in the defaults
+func (c *LDAPConfig) validate() error {
+	// Don't bother if it's disabled or not configured
+	if c.Disable || c.URL == "" {
+		return nil
+	}
+
+	// URL
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Hostname() == "" {
+		return errors.New("server URL must be a valid ldap:// or ldaps:// URL")
+	} else if c.StartTLS && u.Scheme == "ldaps" {
+		return errors.New("startTLS cannot be used with an ldaps:// URL")
+	}
+
+	// Bind credentials and search base
+	if c.BindDN != "" && c.BindPassword == "" {
+		return errors.New("bind password must be specified along with bind DN")
+	}
+	if c.SearchBase == "" {
+		return errors.New("search base must be specified")
+	}
+
+	// User filter
+	if c.UserFilter == "" {
+		c.UserFilter = "(uid={username})"
+	} else if !strings.Contains(c.UserFilter, "{username}") {
+		return errors.New("user filter must contain the {username} placeholder")
+	}
+
+	// Defaults
+	if c.Name == "" {
+		c.Name = "LDAP"
+	}
+	c.Attributes.ID = util.If(c.Attributes.ID == "", "uid", c.Attributes.ID)
+	c.Attributes.Email = util.If(c.Attributes.Email == "", "mail", c.Attributes.Email)
+	c.Attributes.Name = util.If(c.Attributes.Name == "", "cn", c.Attributes.Name)
+	c.Attributes.Groups = util.If(c.Attributes.Groups == "", "memberOf", c.Attributes.Groups)
+	return nil
+}
+
+// SAMLAttributes maps SAML assertion attributes onto user properties. An attribute is matched by either its Name or
+// its FriendlyName
+type SAMLAttributes struct {
+	Email string `yaml:"email"` // Attribute holding the user's email, defaults to "urn:oid:0.9.2342.19200300.100.1.3" (mail)
+	Name  string `yaml:"name"`  // Attribute holding the user's display name, defaults to "urn:oid:2.16.840.1.113730.3.1.241" (displayName)
+}
+
+// SAMLProvider stores SAML 2.0 identity provider configuration
+type SAMLProvider struct {
+	Disableable `yaml:",inline"`
+	ID          string         `yaml:"id"`         // Unique provider ID, e.g. "adfs"
+	Name        string         `yaml:"name"`       // Provider display name, e.g. "Corporate login"
+	EntityID    string         `yaml:"entityID"`   // IdP entity ID, which must match the Issuer of its responses
+	SSOURL      string         `yaml:"ssoURL"`     // IdP single sign-on URL supporting the HTTP-Redirect binding
+	Cert        string         `yaml:"cert"`       // PEM-encoded certificate(s) the IdP signs its responses with
+	SPEntityID  string         `yaml:"spEntityID"` // Entity ID of Comentario as a service provider, defaults to its metadata URL
+	SPKey       string         `yaml:"spKey"`      // PEM-encoded RSA private key for signing authentication requests
+	SPCert      string         `yaml:"spCert"`     // PEM-encoded certificate matching the SP key, published in the SP metadata
+	Attributes  SAMLAttributes `yaml:"attributes"` // Attribute mapping
+
+	certs  []*x509.Certificate // Parsed IdP certificates
+	spKey  *rsa.PrivateKey     // Parsed SP key
+	spCert *x509.Certificate   // Parsed SP certificate
+}
+
+// QualifiedID returns the provider's ID prepended with the common SAML prefix
+func (p *SAMLProvider) QualifiedID() string {
+	return "saml:" + p.ID
+}
+
+// Usable returns whether the instance isn't disabled
+func (p *SAMLProvider) Usable() bool {
+	return !p.Disable
+}
+
+// validate the SAML provider configuration, parsing the keys and certificates and filling in the defaults
+func (p *SAMLProvider) validate() error {
+	// Don't bother if it's disabled
+	if p.Disable {
+		return nil
+	}
+
+	// ID
+	switch {
+	case p.ID == "":
+		return errors.New("provider ID must be specified")
+	case len(p.ID) > 32:
+		return fmt.Errorf("provider ID cannot exceed 32 characters (%d supplied)", len(p.ID))
+	case !reOIDCProviderID.MatchString(p.ID):
+		return errors.New("provider ID must consist of lowercase characters, digits, and dashes only")
+	}
+
+	// Name and entity ID
+	if p.Name == "" {
+		return errors.New("provider name must be specified")
+	}
+	if p.EntityID == "" {
+		return errors.New("provider entity ID must be specified")
+	}
+
+	// SSO URL
+	if p.SSOURL == "" {
+		return errors.New("provider SSO URL must be specified")
+	} else if !util.IsValidURL(p.SSOURL, false) {
+		return errors.New("invalid provider SSO URL")
+	}
+
+	// IdP certificates
+	var err error
+	if p.certs, err = parsePEMCertificates(p.Cert); err != nil {
+		return fmt.Errorf("invalid provider certificate: %w", err)
+	} else if len(p.certs) == 0 {
+		return errors.New("provider certificate must be specified")
+	}
+
+	// SP key
+	if p.SPKey == "" {
+		return errors.New("SP key must be specified")
+	} else if p.spKey, err = parsePEMRSAKey(p.SPKey); err != nil {
+		return fmt.Errorf("invalid SP key: %w", err)
+	}
+
+	// SP certificate
+	if certs, err := parsePEMCertificates(p.SPCert); err != nil {
+		return fmt.Errorf("invalid SP certificate: %w", err)
+	} else if len(certs) != 1 {
+		return errors.New("exactly one SP certificate must be specified")
+	} else if pub, ok := certs[0].PublicKey.(*rsa.PublicKey); !ok || !pub.Equal(&p.spKey.PublicKey) {
+		return errors.New("SP certificate doesn't match SP key")
+	} else {
+		p.spCert = certs[0]
+	}
+
+	// Defaults
+	p.Attributes.Email = util.If(p.Attributes.Email == "", "urn:oid:0.9.2342.19200300.100.1.3", p.Attributes.Email)
+	p.Attributes.Name = util.If(p.Attributes.Name == "", "urn:oid:2.16.840.1.113730.3.1.241", p.Attributes.Name)
+	return nil
+}
+
 // PostgresConfig describes PostgreSQL settings. Used when at least host is provided
 type PostgresConfig struct {
 	Host           string `yaml:"host"`        // Host
@@ -287,6 +457,8 @@ type FederatedIdPConfig struct {
 	Google   KeySecret      `yaml:"google"`   // Google auth config
 	Twitter  KeySecret      `yaml:"twitter"`  // Twitter auth config
 	OIDC     []OIDCProvider `yaml:"oidc"`     // OIDC provider specs
+	LDAP     LDAPConfig     `yaml:"ldap"`     // LDAP provider config
+	SAML     []SAMLProvider `yaml:"saml"`     // SAML provider specs
 }
 
 // validate the configuration
@@ -306,6 +478,27 @@ func (c *FederatedIdPConfig) validate() error {
 		ids[p.ID] = true
 	}
 
+	// Validate the LDAP config
+	if err := c.LDAP.validate(); err != nil {
+		return fmt.Errorf("invalid LDAP provider config: %w", err)
+	}
+
+	// Iterate all available SAML entries
+	ids = map[string]bool{}
+	for i := range c.SAML {
+		// Validate the config
+		p := &c.SAML[i]
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("invalid SAML provider (ID=%q) config: %w", p.ID, err)
+		}
+
+		// Make sure the ID is unique
+		if ids[p.ID] {
+			return fmt.Errorf("duplicate SAML provider ID: %q", p.ID)
+		}
+		ids[p.ID] = true
+	}
+
 	// Succeeded
 	return nil
 }
@@ -319,15 +512,18 @@ type ExtensionsConfig struct {
 
 // SecretsConfiguration accumulates the entire configuration provided in a secrets file
 type SecretsConfiguration struct {
-	Postgres   PostgresConfig       `yaml:"postgres"`   // PostgreSQL config
-	SQLite3    SQLite3Config        `yaml:"sqlite3"`    // SQLite3 config
-	SMTPServer SMTPServerConfig     `yaml:"smtpServer"` // SMTP server config
-	IdP        FederatedIdPConfig   `yaml:"idp"`        // Federated identity provider config
-	Extensions ExtensionsConfig     `yaml:"extensions"` // Extensions config
-	XSRFSecret string               `yaml:"xsrfSecret"` // Optional random string to generate XSRF key from
-	Plugins    map[string]yaml.Node `yaml:"plugins"`    // Optional plugin config, a map indexed by plugin ID. Gets read as raw YAML nodes
+	Postgres       PostgresConfig       `yaml:"postgres"`       // PostgreSQL config
+	SQLite3        SQLite3Config        `yaml:"sqlite3"`        // SQLite3 config
+	SMTPServer     SMTPServerConfig     `yaml:"smtpServer"`     // SMTP server config
+	IdP            FederatedIdPConfig   `yaml:"idp"`            // Federated identity provider config
+	Extensions     ExtensionsConfig     `yaml:"extensions"`     // Extensions config
+	XSRFSecret     string               `yaml:"xsrfSecret"`     // Optional random string to generate XSRF key from
+	EncSecret      string               `yaml:"encSecret"`      // Optional random string to generate the key for encrypting sensitive data in the database from
+	Plugins        map[string]yaml.Node `yaml:"plugins"`        // Optional plugin config, a map indexed by plugin ID. Gets read as raw YAML nodes
+	PwnedPasswords string               `yaml:"pwnedPasswords"` // Optional path to a file listing compromised passwords, which users aren't allowed to choose
 
 	xsrfKey []byte // The generated XSRF key for the server
+	encKey  []byte // The generated data encryption key, nil if no encryption secret is provided
 }
 
 // PostProcess signals the configuration the values have been assigned
@@ -348,10 +544,22 @@ func (sc *SecretsConfiguration) PostProcess() error {
 		return err
 	}
 
+	// Hash the encryption secret if it's provided. Unlike the XSRF key, there's no random fallback as the encrypted data
+	// must remain readable after a restart
+	if sc.EncSecret != "" {
+		x := sha256.Sum256([]byte(sc.EncSecret))
+		sc.encKey = x[:]
+	}
+
 	// Succeeded
 	return nil
 }
 
+// EncKey returns the key for encrypting sensitive data in the database, or nil if it isn't configured
+func (sc *SecretsConfiguration) EncKey() []byte {
+	return sc.encKey
+}
+
 // XSRFKey returns the XSRF key for the server
 func (sc *SecretsConfiguration) XSRFKey() []byte {
 	return sc.xsrfKey
@@ -383,3 +591,41 @@ func (sc *SecretsConfiguration) validate() error {
 		sc.SMTPServer.validate(),
 		sc.IdP.validate())
 }
+
+// parsePEMCertificates parses all PEM-encoded certificates in the given string
+func parsePEMCertificates(s string) ([]*x509.Certificate, error) {
+	var res []*x509.Certificate
+	for rest := []byte(s); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		} else if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block type %q", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, cert)
+	}
+	return res, nil
+}
+
+// parsePEMRSAKey parses a PEM-encoded RSA private key, either in PKCS #1 or in PKCS #8 format
+func parsePEMRSAKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if rk, ok := k.(*rsa.PrivateKey); ok {
+		return rk, nil
+	}
+	return nil, errors.New("key isn't an RSA key")
+}
@@ -1,10 +1,16 @@
 package config
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
 	"net/url"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestKeySecret_Usable(t *testing.T) {
@@ -85,6 +91,85 @@ func TestOIDCProvider_validate(t *testing.T) {
 	}
 }
 
+func TestSAMLProvider_QualifiedID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{"empty", "", "saml:"},
+		{"adfs", "adfs", "saml:adfs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &SAMLProvider{ID: tt.id}
+			if got := p.QualifiedID(); got != tt.want {
+				t.Errorf("QualifiedID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSAMLProvider_validate(t *testing.T) {
+	// Generate two PEM-encoded key pairs with certificates
+	newKeyCert := func() (string, string) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey() failed: %v", err)
+		}
+		tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("CreateCertificate() failed: %v", err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	spKey, spCert := newKeyCert()
+	_, idpCert := newKeyCert()
+
+	valid := func(f func(p *SAMLProvider)) SAMLProvider {
+		p := SAMLProvider{ID: "corp", Name: "Corp", EntityID: "https://idp", SSOURL: "https://idp/sso", Cert: idpCert, SPKey: spKey, SPCert: spCert}
+		if f != nil {
+			f(&p)
+		}
+		return p
+	}
+	tests := []struct {
+		name string
+		cfg  SAMLProvider
+		err  string
+	}{
+		{"empty           ", SAMLProvider{}, "provider ID must be specified"},
+		{"disabled        ", SAMLProvider{Disableable: Disableable{Disable: true}}, ""},
+		{"id too long     ", valid(func(p *SAMLProvider) { p.ID = "too-long-because-max-32ch-allowed" }), "provider ID cannot exceed 32 characters (33 supplied)"},
+		{"id with cap char", valid(func(p *SAMLProvider) { p.ID = "someID" }), "provider ID must consist of lowercase characters, digits, and dashes only"},
+		{"no name         ", valid(func(p *SAMLProvider) { p.Name = "" }), "provider name must be specified"},
+		{"no entity ID    ", valid(func(p *SAMLProvider) { p.EntityID = "" }), "provider entity ID must be specified"},
+		{"no SSO URL      ", valid(func(p *SAMLProvider) { p.SSOURL = "" }), "provider SSO URL must be specified"},
+		{"insecure SSO URL", valid(func(p *SAMLProvider) { p.SSOURL = "http://idp/sso" }), "invalid provider SSO URL"},
+		{"no cert         ", valid(func(p *SAMLProvider) { p.Cert = "" }), "provider certificate must be specified"},
+		{"key as cert     ", valid(func(p *SAMLProvider) { p.Cert = spKey }), `invalid provider certificate: unexpected PEM block type "RSA PRIVATE KEY"`},
+		{"no SP key       ", valid(func(p *SAMLProvider) { p.SPKey = "" }), "SP key must be specified"},
+		{"bad SP key      ", valid(func(p *SAMLProvider) { p.SPKey = "foo" }), "invalid SP key: no PEM data found"},
+		{"no SP cert      ", valid(func(p *SAMLProvider) { p.SPCert = "" }), "exactly one SP certificate must be specified"},
+		{"wrong SP cert   ", valid(func(p *SAMLProvider) { p.SPCert = idpCert }), "SP certificate doesn't match SP key"},
+		{"valid           ", valid(nil), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.cfg
+			if err := c.validate(); (err != nil) != (tt.err != "") {
+				t.Errorf("validate() has error = %v, want %v", err != nil, tt.err != "")
+			} else if err != nil && err.Error() != tt.err {
+				t.Errorf("validate() error = %q, want %q", err, tt.err)
+			} else if err == nil && !c.Disable && (c.spKey == nil || c.spCert == nil || len(c.certs) != 1 || c.Attributes.Email == "") {
+				t.Errorf("validate() didn't fill in the parsed and default values")
+			}
+		})
+	}
+}
+
 func TestPostgresConfig_ConnectString(t *testing.T) {
 	tests := []struct {
 		name      string
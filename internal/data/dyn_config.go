@@ -161,6 +161,7 @@ const (
 	DynConfigItemSectionIntegrations DynConfigItemSectionKey = "integrations"
 	DynConfigItemSectionMarkdown     DynConfigItemSectionKey = "markdown"
 	DynConfigItemSectionMisc         DynConfigItemSectionKey = "misc"
+	DynConfigItemSectionRetention    DynConfigItemSectionKey = "retention"
 )
 
 // Instance (global) settings
@@ -170,8 +171,13 @@ const (
 	ConfigKeyAuthSignupConfirmCommenter DynConfigItemKey = "auth.signup.confirm.commenter"
 	ConfigKeyAuthSignupConfirmUser      DynConfigItemKey = "auth.signup.confirm.user"
 	ConfigKeyAuthSignupEnabled          DynConfigItemKey = "auth.signup.enabled"
+	ConfigKeyAuthTOTPRequiredOwner      DynConfigItemKey = "auth.totp.required.owner"
+	ConfigKeyAuthTOTPRequiredSuperuser  DynConfigItemKey = "auth.totp.required.superuser"
 	ConfigKeyIntegrationsUseGravatar    DynConfigItemKey = "integrations.useGravatar"
 	ConfigKeyOperationNewOwnerEnabled   DynConfigItemKey = "operation.newOwner.enabled"
+	ConfigKeyRetentionCommentIPDays     DynConfigItemKey = "retention.comments.authorIp.days"
+	ConfigKeyRetentionCommentDelDays    DynConfigItemKey = "retention.comments.deleted.days"
+	ConfigKeyRetentionUserSessionDays   DynConfigItemKey = "retention.userSessions.days"
 )
 
 // Domain settings
@@ -203,8 +209,13 @@ var DefaultDynInstanceConfig = DynConfigMap{
 	ConfigKeyAuthSignupConfirmCommenter:                                     {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
 	ConfigKeyAuthSignupConfirmUser:                                          {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
 	ConfigKeyAuthSignupEnabled:                                              {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
+	ConfigKeyAuthTOTPRequiredOwner:                                          {DefaultValue: "false", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
+	ConfigKeyAuthTOTPRequiredSuperuser:                                      {DefaultValue: "false", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionAuth},
 	ConfigKeyIntegrationsUseGravatar:                                        {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionIntegrations},
 	ConfigKeyOperationNewOwnerEnabled:                                       {DefaultValue: "false", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionMisc},
+	ConfigKeyRetentionCommentIPDays:                                         {DefaultValue: "0", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionRetention, Min: 0, Max: 36500},
+	ConfigKeyRetentionCommentDelDays:                                        {DefaultValue: "0", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionRetention, Min: 0, Max: 36500},
+	ConfigKeyRetentionUserSessionDays:                                       {DefaultValue: "0", Datatype: ConfigDatatypeInt, Section: DynConfigItemSectionRetention, Min: 0, Max: 36500},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentDeletionAuthor:    {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentDeletionModerator: {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
 	ConfigKeyDomainDefaultsPrefix + DomainConfigKeyCommentEditingAuthor:     {DefaultValue: "true", Datatype: ConfigDatatypeBool, Section: DynConfigItemSectionComments},
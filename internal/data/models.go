@@ -1,6 +1,8 @@
 package data
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
@@ -15,9 +17,10 @@ import (
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/util"
-	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/text/language"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 )
@@ -28,6 +31,7 @@ var AnonymousUser = &User{Name: "Anonymous", SystemAccount: true}
 const (
 	MaxPageTitleLength     = 100 // Maximum length allowed for a page title
 	MaxPendingReasonLength = 255 // Maximum length allowed for Comment.PendingReason field
+	MaxViewSourceLength    = 255 // Maximum length allowed for page view source (referrer host and UTM) fields
 	ColourIndexCount       = 60  // Number of colours in the palette used to colourise users based on their IDs
 )
 
@@ -94,6 +98,9 @@ const (
 	TokenScopeConfirmEmail       = TokenScope("confirm-email")        // Bearer makes their account confirmed
 	TokenScopeConfirmEmailUpdate = TokenScope("confirm-email-update") // Bearer confirms updating their email
 	TokenScopeLogin              = TokenScope("login")                // Bearer is eligible for a one-time login
+	TokenScopeDataExport         = TokenScope("data-export")          // Bearer can download their personal data export
+	TokenScopeDomainInvite       = TokenScope("domain-invite")        // Bearer can accept an invitation to a domain
+	TokenScopeLoginRevoke        = TokenScope("login-revoke")         // Bearer can revoke an unrecognised login session
 )
 
 // Token is, well, a token
@@ -195,6 +202,10 @@ type User struct {
 	FailedLoginAttempts int            `db:"failed_login_attempts"`                           // Number of failed login attempts
 	IsLocked            bool           `db:"is_locked"`                                       // Whether the user is locked out
 	LockedTime          sql.NullTime   `db:"ts_locked"`                                       // When the user was locked
+	TOTPSecret          string         `db:"totp_secret"`                                     // Base32-encoded TOTP secret, empty if not enrolled
+	TOTPEnabled         bool           `db:"totp_enabled"`                                    // Whether TOTP two-factor authentication is enabled
+	TOTPLastStep        int64          `db:"totp_last_step"`                                  // Last accepted TOTP time step, to prevent code reuse
+	TOTPRecovery        string         `db:"totp_recovery"`                                   // Space-separated hashes of unused TOTP recovery codes
 	HasAvatar           bool           `db:"has_avatar"         goqu:"skipinsert,skipupdate"` // Whether the user has an avatar image. Calculated field populated only while loading from the DB
 	CountDomainsOwned   int            `db:"owned_domain_count" goqu:"skipinsert,skipupdate"` // Number of domains the user owns (-1 means "unknown"). Calculated field populated only while loading from the DB
 }
@@ -386,6 +397,7 @@ func (u *User) ToPrincipal(attr intf.AttrValues, du *DomainUser) *models.Princip
 		IsOwner:             du.IsAnOwner(),
 		IsSso:               u.FederatedSSO,
 		IsSuperuser:         u.IsSuperuser,
+		IsTotpEnabled:       u.TOTPEnabled,
 		LangID:              u.LangID,
 		Name:                u.Name,
 		NotifyCommentStatus: du != nil && du.NotifyCommentStatus,
@@ -399,9 +411,40 @@ func (u *User) ToPrincipal(attr intf.AttrValues, du *DomainUser) *models.Princip
 	return dto
 }
 
+// VerifyTOTP checks the provided code against the user's TOTP secret or, failing that, the unused recovery codes. On
+// success, it records the used time step or consumes the recovery code, respectively, and returns true
+func (u *User) VerifyTOTP(code string) bool {
+	if !u.TOTPEnabled {
+		return false
+	}
+
+	// Try a TOTP code first
+	if step := util.TOTPVerify(u.TOTPSecret, code, time.Now(), u.TOTPLastStep); step > 0 {
+		u.TOTPLastStep = step
+		return true
+	}
+
+	// Try a recovery code
+	h := util.TOTPHashRecoveryCode(code)
+	hashes := strings.Fields(u.TOTPRecovery)
+	for i, rh := range hashes {
+		if subtle.ConstantTimeCompare([]byte(rh), []byte(h)) == 1 {
+			u.TOTPRecovery = strings.Join(append(hashes[:i], hashes[i+1:]...), " ")
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordNeedsRehash returns whether the user's password hash is produced by an outdated algorithm or with outdated
+// parameters, and should be upgraded
+func (u *User) PasswordNeedsRehash() bool {
+	return util.PasswordNeedsRehash(u.PasswordHash)
+}
+
 // VerifyPassword checks whether the provided password matches the hash
 func (u *User) VerifyPassword(s string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(s)) == nil
+	return util.VerifyPassword(u.PasswordHash, s)
 }
 
 // WithBanned sets the value of Banned, BannedTime, and UserBanned. byUser can be nil
@@ -512,25 +555,33 @@ func (u *User) WithName(s string) *User {
 }
 
 // WithPassword updates the PasswordHash from the provided plain-text password. If s is empty, also sets the hash to
-// empty
+// empty. If the password doesn't change, but its hash is outdated, the hash gets upgraded
 func (u *User) WithPassword(s string) *User {
 	// If no password is provided, remove the hash. This means the user won't be able to log in
 	if s == "" {
 		u.PasswordHash = ""
 
 		// Check if the password is actually changing
-	} else if !u.VerifyPassword(s) {
+	} else if changed := !u.VerifyPassword(s); changed || u.PasswordNeedsRehash() {
 		// Hash and save the password
-		h, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
+		h, err := util.HashPassword(s)
 		if err != nil {
 			panic(err)
 		}
-		u.PasswordChangeTime = time.Now().UTC()
-		u.PasswordHash = string(h)
+		if changed {
+			u.PasswordChangeTime = time.Now().UTC()
+		}
+		u.PasswordHash = h
 	}
 	return u
 }
 
+// WithPasswordHash sets the PasswordHash value directly, which must be produced by a supported algorithm
+func (u *User) WithPasswordHash(h string) *User {
+	u.PasswordHash = h
+	return u
+}
+
 // WithRemarks sets the Remarks value
 func (u *User) WithRemarks(s string) *User {
 	u.Remarks = s
@@ -551,6 +602,28 @@ func (u *User) WithSuperuser(b bool) *User {
 	return u
 }
 
+// WithTOTP sets up the TOTP values. If secret is empty, disables TOTP and removes the secret and recovery codes;
+// otherwise stores the (not yet enabled) secret
+func (u *User) WithTOTP(secret string) *User {
+	u.TOTPSecret = secret
+	u.TOTPEnabled = false
+	u.TOTPLastStep = 0
+	u.TOTPRecovery = ""
+	return u
+}
+
+// WithTOTPEnabled enables TOTP, recording the given accepted time step and hashes of the recovery codes
+func (u *User) WithTOTPEnabled(step int64, recoveryCodes []string) *User {
+	hashes := make([]string, len(recoveryCodes))
+	for i, c := range recoveryCodes {
+		hashes[i] = util.TOTPHashRecoveryCode(c)
+	}
+	u.TOTPEnabled = true
+	u.TOTPLastStep = step
+	u.TOTPRecovery = strings.Join(hashes, " ")
+	return u
+}
+
 // WithWebsiteURL sets the WebsiteURL value
 func (u *User) WithWebsiteURL(s string) *User {
 	u.WebsiteURL = s
@@ -619,6 +692,183 @@ func (ua *UserAvatar) Set(size UserAvatarSize, data []byte) {
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// APITokenPrefix is the prefix of every personal API token value, which makes the tokens easily recognisable
+const APITokenPrefix = "cmpat_"
+
+// APITokenScope is a scope granted to a personal API token
+type APITokenScope string
+
+const (
+	APITokenScopeDomainRead = APITokenScope("domain-read") // Bearer can read domains, their pages, comments, users, and stats
+	APITokenScopeExport     = APITokenScope("export")      // Bearer can export domain data and stats
+	APITokenScopeModeration = APITokenScope("moderation")  // Bearer can moderate and delete comments
+	APITokenScopeUserSync   = APITokenScope("user-sync")   // Bearer can update and deactivate domain's SSO users
+)
+
+// UserAPIToken is a personal, long-lived API token of a user, used for automation. Only a hash of the token value is
+// stored
+type UserAPIToken struct {
+	ID           uuid.UUID    `db:"id"           goqu:"skipupdate"` // Unique record ID
+	UserID       uuid.UUID    `db:"user_id"      goqu:"skipupdate"` // ID of the user who owns the token
+	Name         string       `db:"name"`                           // User-given token name
+	ValueHash    string       `db:"value_hash"   goqu:"skipupdate"` // SHA-256 hash of the token value, as a hex string
+	Scopes       string       `db:"scopes"`                         // Comma-separated list of scopes granted to the token
+	CreatedTime  time.Time    `db:"ts_created"   goqu:"skipupdate"` // When the token was created
+	ExpiresTime  sql.NullTime `db:"ts_expires"`                     // When the token expires, if ever
+	LastUsedTime sql.NullTime `db:"ts_last_used"`                   // When the token was last used
+}
+
+// NewUserAPIToken instantiates a new UserAPIToken with a random value, which is returned alongside
+func NewUserAPIToken(userID *uuid.UUID, name string, scopes []APITokenScope, expires sql.NullTime) (*UserAPIToken, string, error) {
+	// Generate a random 32-byte value
+	b, err := util.RandomBytes(32)
+	if err != nil {
+		return nil, "", err
+	}
+	value := APITokenPrefix + hex.EncodeToString(b)
+
+	// Convert the scopes into strings
+	ss := make([]string, len(scopes))
+	for i, sc := range scopes {
+		ss[i] = string(sc)
+	}
+
+	return &UserAPIToken{
+			ID:          uuid.New(),
+			UserID:      *userID,
+			Name:        name,
+			ValueHash:   HashAPITokenValue(value),
+			Scopes:      strings.Join(ss, ","),
+			CreatedTime: time.Now().UTC(),
+			ExpiresTime: expires,
+		},
+		value,
+		nil
+}
+
+// HashAPITokenValue returns a hex-encoded SHA-256 hash of the given token value
+func HashAPITokenValue(value string) string {
+	h := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(h[:])
+}
+
+// HasScopes returns whether all the given scopes are granted to the token
+func (t *UserAPIToken) HasScopes(scopes []string) bool {
+	granted := t.ScopeList()
+	for _, sc := range scopes {
+		if !slices.Contains(granted, APITokenScope(sc)) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsExpired returns whether the token has expired
+func (t *UserAPIToken) IsExpired() bool {
+	return t.ExpiresTime.Valid && !t.ExpiresTime.Time.After(time.Now())
+}
+
+// ScopeList returns the scopes granted to the token as a slice
+func (t *UserAPIToken) ScopeList() []APITokenScope {
+	var res []APITokenScope
+	for _, sc := range strings.Split(t.Scopes, ",") {
+		if sc != "" {
+			res = append(res, APITokenScope(sc))
+		}
+	}
+	return res
+}
+
+// ToDTO converts this token into an API model
+func (t *UserAPIToken) ToDTO() *models.APIToken {
+	scopes := []models.APITokenScope{}
+	for _, sc := range t.ScopeList() {
+		scopes = append(scopes, models.APITokenScope(sc))
+	}
+	return &models.APIToken{
+		CreatedTime:  strfmt.DateTime(t.CreatedTime),
+		ExpiresTime:  NullDateTime(t.ExpiresTime),
+		ID:           strfmt.UUID(t.ID.String()),
+		LastUsedTime: NullDateTime(t.LastUsedTime),
+		Name:         t.Name,
+		Scopes:       scopes,
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// UserMerge is an audit record of merging one user (source) into another (target)
+type UserMerge struct {
+	ID                 uuid.UUID     `db:"id"                   goqu:"skipupdate"` // Unique record ID
+	CreatedTime        time.Time     `db:"ts_created"           goqu:"skipupdate"` // When the merge was performed
+	UserCreated        uuid.NullUUID `db:"user_created"`                           // Reference to the user who performed the merge
+	TargetUserID       uuid.NullUUID `db:"target_user_id"`                         // Reference to the user the source account was merged into
+	SourceUserID       uuid.UUID     `db:"source_user_id"`                         // ID of the merged (and deleted) source user
+	SourceEmail        string        `db:"source_email"`                           // Email of the source user
+	SourceName         string        `db:"source_name"`                            // Name of the source user
+	SourceFederatedIdP string        `db:"source_federated_idp"`                   // Federated IdP ID of the source user, if any
+	SourceFederatedID  string        `db:"source_federated_id"`                    // Federated user ID of the source user, if any
+	CountComments      int64         `db:"count_comments"`                         // Number of reassigned comment references
+	CountVotes         int64         `db:"count_votes"`                            // Number of reassigned votes
+	CountDomainUsers   int64         `db:"count_domain_users"`                     // Number of reassigned or merged domain user records
+	CountSessions      int64         `db:"count_sessions"`                         // Number of reassigned sessions
+	CountAttrs         int64         `db:"count_attrs"`                            // Number of reassigned attributes
+}
+
+// NewUserMerge instantiates a new UserMerge record for merging the source user into the target one
+func NewUserMerge(curUserID *uuid.UUID, source, target *User) *UserMerge {
+	return &UserMerge{
+		ID:                 uuid.New(),
+		CreatedTime:        time.Now().UTC(),
+		UserCreated:        uuid.NullUUID{UUID: *curUserID, Valid: true},
+		TargetUserID:       uuid.NullUUID{UUID: target.ID, Valid: true},
+		SourceUserID:       source.ID,
+		SourceEmail:        source.Email,
+		SourceName:         source.Name,
+		SourceFederatedIdP: source.FederatedIdP.String,
+		SourceFederatedID:  source.FederatedID,
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// UserPasskey represents a WebAuthn credential (passkey) registered by a user
+type UserPasskey struct {
+	ID           uuid.UUID    `db:"id"            goqu:"skipupdate"` // Unique record ID
+	UserID       uuid.UUID    `db:"user_id"       goqu:"skipupdate"` // ID of the user who owns the passkey
+	CredentialID string       `db:"credential_id" goqu:"skipupdate"` // Base64url-encoded credential ID, as issued by the authenticator
+	PublicKey    []byte       `db:"public_key"    goqu:"skipupdate"` // COSE-encoded credential public key
+	SignCount    int64        `db:"sign_count"`                      // Last seen signature counter value
+	Name         string       `db:"name"`                            // User-given passkey name
+	CreatedTime  time.Time    `db:"ts_created"    goqu:"skipupdate"` // When the passkey was registered
+	LastUsedTime sql.NullTime `db:"ts_last_used"`                    // When the passkey was last used to log in
+}
+
+// NewUserPasskey instantiates a new UserPasskey
+func NewUserPasskey(userID *uuid.UUID, credentialID, publicKey []byte, signCount uint32, name string) *UserPasskey {
+	return &UserPasskey{
+		ID:           uuid.New(),
+		UserID:       *userID,
+		CredentialID: util.WebAuthnEncoding.EncodeToString(credentialID),
+		PublicKey:    publicKey,
+		SignCount:    int64(signCount),
+		Name:         name,
+		CreatedTime:  time.Now().UTC(),
+	}
+}
+
+// ToDTO converts this passkey into an API model
+func (pk *UserPasskey) ToDTO() *models.UserPasskey {
+	return &models.UserPasskey{
+		CreatedTime:  strfmt.DateTime(pk.CreatedTime),
+		ID:           strfmt.UUID(pk.ID.String()),
+		LastUsedTime: NullDateTime(pk.LastUsedTime),
+		Name:         pk.Name,
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
 // UserSession represents an authenticated user session
 type UserSession struct {
 	ID             uuid.UUID `db:"id"`                 // Unique session ID
@@ -668,6 +918,23 @@ func (us *UserSession) EncodeIDs() string {
 	return base64.RawURLEncoding.EncodeToString(append(us.UserID[:], us.ID[:]...))
 }
 
+// IsUnusual returns whether this session looks unusual compared to the given recent sessions of the same user, that is,
+// none of them was created in the same country with the same browser and OS. Sessions in recent with the same ID as
+// this one are ignored. A session is never considered unusual if there are no (other) recent sessions
+func (us *UserSession) IsUnusual(recent []*UserSession) bool {
+	seen := false
+	for _, r := range recent {
+		if r.ID == us.ID {
+			continue
+		}
+		if r.Country == us.Country && r.BrowserName == us.BrowserName && r.OSName == us.OSName {
+			return false
+		}
+		seen = true
+	}
+	return seen
+}
+
 // ToDTO converts this user session into an API model
 func (us *UserSession) ToDTO() *models.UserSession {
 	return &models.UserSession{
@@ -713,6 +980,9 @@ type Domain struct {
 	SSOURL            string                `db:"sso_url"`                      // SSO provider URL
 	SSOSecret         sql.NullString        `db:"sso_secret"`                   // SSO secret as a hex string
 	SSONonInteractive bool                  `db:"sso_noninteractive"`           // Whether to use a non-interactive SSO login
+	SSOJWTKeys        string                `db:"sso_jwt_keys"`                 // PEM-encoded public key(s) or JWKS document to verify SSO JWTs with. If empty, HMAC-signed SSO payloads are used
+	SSOJWTIssuer      string                `db:"sso_jwt_issuer"`               // Expected issuer ("iss" claim) of SSO JWTs
+	SSOJWTAudience    string                `db:"sso_jwt_audience"`             // Expected audience ("aud" claim) of SSO JWTs
 	ModAnonymous      bool                  `db:"mod_anonymous"`                // Whether all anonymous comments are to be approved by a moderator
 	ModAuthenticated  bool                  `db:"mod_authenticated"`            // Whether all non-anonymous comments are to be approved by a moderator
 	ModNumComments    int                   `db:"mod_num_comments"`             // Number of first comments by user on this domain that require a moderator approval
@@ -780,6 +1050,9 @@ func (d *Domain) FromDTO(dto *models.Domain) {
 	d.ModNumComments = int(dto.ModNumComments)
 	d.ModUserAgeDays = int(dto.ModUserAgeDays)
 	d.Name = dto.Name
+	d.SSOJWTAudience = strings.TrimSpace(dto.SsoJwtAudience)
+	d.SSOJWTIssuer = strings.TrimSpace(dto.SsoJwtIssuer)
+	d.SSOJWTKeys = strings.TrimSpace(dto.SsoJwtKeys)
 	d.SSONonInteractive = dto.SsoNonInteractive
 	d.SSOURL = dto.SsoURL
 }
@@ -822,6 +1095,11 @@ func (d *Domain) SSOSecretNew() error {
 	return nil
 }
 
+// SSOUsesJWT returns whether the domain's SSO identity provider sends signed JWTs (as opposed to HMAC-signed payloads)
+func (d *Domain) SSOUsesJWT() bool {
+	return d.SSOJWTKeys != ""
+}
+
 // ToDTO converts this model into an API model
 func (d *Domain) ToDTO() *models.Domain {
 	return &models.Domain{
@@ -845,6 +1123,9 @@ func (d *Domain) ToDTO() *models.Domain {
 		ModUserAgeDays:      uint64(d.ModUserAgeDays),
 		Name:                d.Name,
 		RootURL:             strfmt.URI(d.RootURL()),
+		SsoJwtAudience:      d.SSOJWTAudience,
+		SsoJwtIssuer:        d.SSOJWTIssuer,
+		SsoJwtKeys:          d.SSOJWTKeys,
 		SsoNonInteractive:   d.SSONonInteractive,
 		SsoSecretConfigured: d.SSOSecret.Valid,
 		SsoURL:              d.SSOURL,
@@ -1028,6 +1309,206 @@ func (n *NullDomainUser) ToDomainUser() *DomainUser {
 
 // ---------------------------------------------------------------------------------------------------------------------
 
+// DomainInvitation is an invitation for a user, identified by email, to join a domain with a specific role. It's
+// accepted using the linked token, and gets deleted along with it
+type DomainInvitation struct {
+	ID          uuid.UUID             `db:"id"           goqu:"skipupdate"` // Unique record ID
+	DomainID    uuid.UUID             `db:"domain_id"    goqu:"skipupdate"` // ID of the domain the user is invited to
+	Email       string                `db:"email"`                          // Email of the invited user
+	Role        models.DomainUserRole `db:"role"`                           // Role to grant the user on the domain
+	TokenValue  string                `db:"token_value"`                    // Value of the token sent to the invited user
+	CreatedTime time.Time             `db:"ts_created"   goqu:"skipupdate"` // When the record was created
+	UserCreated uuid.NullUUID         `db:"user_created" goqu:"skipupdate"` // Reference to the user who sent the invitation
+	ExpiresTime time.Time             `db:"ts_expires"`                     // When the invitation expires
+}
+
+// NewDomainInvitation instantiates a new DomainInvitation, linked to the given token
+func NewDomainInvitation(domainID, userID *uuid.UUID, email string, role models.DomainUserRole, token *Token) *DomainInvitation {
+	return &DomainInvitation{
+		ID:          uuid.New(),
+		DomainID:    *domainID,
+		Email:       email,
+		Role:        role,
+		TokenValue:  token.Value,
+		CreatedTime: time.Now().UTC(),
+		UserCreated: uuid.NullUUID{UUID: *userID, Valid: true},
+		ExpiresTime: token.ExpiresTime,
+	}
+}
+
+// ToDTO converts this invitation into an API model. The token value is never exposed
+func (i *DomainInvitation) ToDTO() *models.DomainInvitation {
+	return &models.DomainInvitation{
+		CreatedTime: strfmt.DateTime(i.CreatedTime),
+		DomainID:    strfmt.UUID(i.DomainID.String()),
+		Email:       strfmt.Email(i.Email),
+		ExpiresTime: strfmt.DateTime(i.ExpiresTime),
+		ID:          strfmt.UUID(i.ID.String()),
+		Role:        i.Role,
+		UserCreated: NullUUIDStr(&i.UserCreated),
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// DomainOIDCProviderIDPrefix is the prefix of the federated IdP ID of every domain OIDC provider
+const DomainOIDCProviderIDPrefix = "doidc:"
+
+// DomainOIDCProvider is an OIDC identity provider registered by a domain owner, which is only available on that domain
+type DomainOIDCProvider struct {
+	ID           uuid.UUID     `db:"id"            goqu:"skipupdate"` // Unique record ID
+	DomainID     uuid.UUID     `db:"domain_id"     goqu:"skipupdate"` // ID of the domain the provider is registered for
+	Name         string        `db:"name"`                            // Provider display name
+	URL          string        `db:"url"`                             // OIDC server URL
+	ClientID     string        `db:"client_id"`                       // OIDC client ID
+	ClientSecret []byte        `db:"client_secret"`                   // OIDC client secret, encrypted with the server's encryption key
+	Scopes       string        `db:"scopes"`                          // Space-separated list of additional scopes to request
+	IsEnabled    bool          `db:"is_enabled"`                      // Whether the provider is available for login
+	CreatedTime  time.Time     `db:"ts_created"    goqu:"skipupdate"` // When the record was created
+	UserCreated  uuid.NullUUID `db:"user_created"  goqu:"skipupdate"` // Reference to the user who created the record
+	UpdatedTime  time.Time     `db:"ts_updated"`                      // When the record was last updated
+}
+
+// NewDomainOIDCProvider instantiates a new DomainOIDCProvider
+func NewDomainOIDCProvider(domainID, userID *uuid.UUID) *DomainOIDCProvider {
+	now := time.Now().UTC()
+	return &DomainOIDCProvider{
+		ID:          uuid.New(),
+		DomainID:    *domainID,
+		IsEnabled:   true,
+		CreatedTime: now,
+		UserCreated: uuid.NullUUID{UUID: *userID, Valid: true},
+		UpdatedTime: now,
+	}
+}
+
+// ParseDomainOIDCProviderID parses the given federated IdP ID and returns the ID of the domain OIDC provider it refers
+// to, or nil if it isn't a valid domain OIDC provider ID
+func ParseDomainOIDCProviderID(id models.FederatedIdpID) *uuid.UUID {
+	if s, ok := strings.CutPrefix(string(id), DomainOIDCProviderIDPrefix); ok {
+		if u, err := uuid.Parse(s); err == nil {
+			return &u
+		}
+	}
+	return nil
+}
+
+// FederatedIdP returns a FederatedIdentityProvider describing this provider
+func (p *DomainOIDCProvider) FederatedIdP() *FederatedIdentityProvider {
+	qid := p.QualifiedID()
+	return &FederatedIdentityProvider{
+		ID:       models.FederatedIdpID(qid),
+		Name:     p.Name,
+		GothName: qid,
+	}
+}
+
+// QualifiedID returns the provider's federated IdP ID, which is the record ID in its compact (dashless) form prepended
+// with the common prefix
+func (p *DomainOIDCProvider) QualifiedID() string {
+	return DomainOIDCProviderIDPrefix + hex.EncodeToString(p.ID[:])
+}
+
+// ScopeList returns the additional scopes to request as a slice
+func (p *DomainOIDCProvider) ScopeList() []string {
+	return strings.Fields(p.Scopes)
+}
+
+// ToDTO converts this provider into an API model. The client secret is never exposed
+func (p *DomainOIDCProvider) ToDTO() *models.DomainOidcProvider {
+	return &models.DomainOidcProvider{
+		ClientID:       p.ClientID,
+		CreatedTime:    strfmt.DateTime(p.CreatedTime),
+		DomainID:       strfmt.UUID(p.DomainID.String()),
+		Enabled:        p.IsEnabled,
+		FederatedIdpID: models.FederatedIdpID(p.QualifiedID()),
+		ID:             strfmt.UUID(p.ID.String()),
+		Name:           p.Name,
+		Scopes:         p.ScopeList(),
+		UpdatedTime:    strfmt.DateTime(p.UpdatedTime),
+		URL:            p.URL,
+	}
+}
+
+// WithScopes sets the Scopes value from the given slice
+func (p *DomainOIDCProvider) WithScopes(scopes []string) *DomainOIDCProvider {
+	p.Scopes = strings.Join(scopes, " ")
+	return p
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+const (
+	DomainRoleRuleClaimEmailDomain = "email_domain" // Pseudo-claim holding the domain part of the user's email
+	DomainRoleRuleAnyValue         = "*"            // Rule value that matches any non-empty claim value
+)
+
+// DomainRoleRule is a rule that maps a federated identity claim to a role on a domain. A domain's rules are evaluated
+// in sequence on every federated login, and the first matching one determines the user's role
+type DomainRoleRule struct {
+	DomainID uuid.UUID             `db:"domain_id"` // Reference to the domain the rule belongs to
+	Seq      int                   `db:"seq"`       // Rule's position in the domain's rule list
+	Claim    string                `db:"claim"`     // Name of the claim to match, or DomainRoleRuleClaimEmailDomain
+	Value    string                `db:"value"`     // Value the claim must have (case-insensitive), or DomainRoleRuleAnyValue
+	Role     models.DomainUserRole `db:"role"`      // Role to assign to a matching user
+}
+
+// MatchDomainRoleRules returns the role dictated by the first of the given rules matching the given claims and email,
+// or an empty string if none matches
+func MatchDomainRoleRules(rules []*DomainRoleRule, claims map[string]any, email string) models.DomainUserRole {
+	for _, r := range rules {
+		if r.Matches(claims, email) {
+			return r.Role
+		}
+	}
+	return ""
+}
+
+// Matches returns whether the rule matches the given claims and email
+func (r *DomainRoleRule) Matches(claims map[string]any, email string) bool {
+	// Collect the values of the claim
+	var values []string
+	if r.Claim == DomainRoleRuleClaimEmailDomain {
+		if _, domain, ok := strings.Cut(email, "@"); ok {
+			values = []string{domain}
+		}
+	} else {
+		switch v := claims[r.Claim].(type) {
+		case nil:
+			// Claim is missing
+		case string:
+			values = []string{v}
+		case []string:
+			values = v
+		case []any:
+			for _, e := range v {
+				values = append(values, fmt.Sprint(e))
+			}
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+	}
+
+	// Compare the values with the rule's one
+	for _, v := range values {
+		if v != "" && (r.Value == DomainRoleRuleAnyValue || strings.EqualFold(v, r.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToDTO converts this rule into an API model
+func (r *DomainRoleRule) ToDTO() *models.DomainRoleRule {
+	return &models.DomainRoleRule{
+		Claim: r.Claim,
+		Role:  r.Role,
+		Value: r.Value,
+	}
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
 // DomainPage represents a page on a specific domain
 type DomainPage struct {
 	ID            uuid.UUID `db:"id"             goqu:"skipupdate"` // Unique record ID
@@ -1110,11 +1591,162 @@ type DomainPageView struct {
 	Proto          string    `db:"proto"`              // The protocol version, like "HTTP/1.0"
 	IP             string    `db:"ip"`                 // IP address the session was created from
 	Country        string    `db:"country"`            // 2-letter country code matching the ip
+	Region         string    `db:"region"`             // Region (first-level subdivision) matching the ip
+	City           string    `db:"city"`               // City matching the ip
 	BrowserName    string    `db:"ua_browser_name"`    // Name of the user's browser
 	BrowserVersion string    `db:"ua_browser_version"` // Version of the user's browser
 	OSName         string    `db:"ua_os_name"`         // Name of the user's OS
 	OSVersion      string    `db:"ua_os_version"`      // Version of the user's OS
 	Device         string    `db:"ua_device"`          // User's device type
+	ReferrerHost   string    `db:"ref_host"`           // Host of the (external) page the visitor came from
+	UTMSource      string    `db:"utm_source"`         // Value of the utm_source landing page URL parameter
+	UTMMedium      string    `db:"utm_medium"`         // Value of the utm_medium landing page URL parameter
+	UTMCampaign    string    `db:"utm_campaign"`       // Value of the utm_campaign landing page URL parameter
+}
+
+// PageViewSource describes where a page visitor came from
+type PageViewSource struct {
+	ReferrerHost string // Host of the (external) page the visitor came from
+	UTMSource    string // Value of the utm_source landing page URL parameter
+	UTMMedium    string // Value of the utm_medium landing page URL parameter
+	UTMCampaign  string // Value of the utm_campaign landing page URL parameter
+}
+
+// NewPageViewSource parses the given referrer URL and landing page URL query string into a PageViewSource. Referrers
+// pointing to the domain host itself (that is, internal navigation) are ignored
+func NewPageViewSource(domainHost, referrer, query string) *PageViewSource {
+	src := &PageViewSource{}
+
+	// Extract the referrer host
+	if u, err := url.Parse(strings.TrimSpace(referrer)); err == nil && u.Host != "" {
+		if h := strings.ToLower(u.Host); h != strings.ToLower(domainHost) {
+			src.ReferrerHost = util.TruncateStr(h, MaxViewSourceLength)
+		}
+	}
+
+	// Extract UTM parameters, ignoring any malformed ones
+	q, _ := url.ParseQuery(strings.TrimPrefix(query, "?"))
+	src.UTMSource = util.TruncateStr(strings.TrimSpace(q.Get("utm_source")), MaxViewSourceLength)
+	src.UTMMedium = util.TruncateStr(strings.TrimSpace(q.Get("utm_medium")), MaxViewSourceLength)
+	src.UTMCampaign = util.TruncateStr(strings.TrimSpace(q.Get("utm_campaign")), MaxViewSourceLength)
+	return src
+}
+
+// StatsDailyPage is a daily per-page statistics rollup database record
+type StatsDailyPage struct {
+	PageID     uuid.UUID `db:"page_id"`     // Reference to the page
+	Day        time.Time `db:"ts_day"`      // Start of the day (UTC)
+	CountViews int64     `db:"count_views"` // Number of page views on the day
+}
+
+// StatsDailyViews is a daily per-page, per-dimension page view statistics rollup database record
+type StatsDailyViews struct {
+	PageID     uuid.UUID `db:"page_id"`     // Reference to the page
+	Day        time.Time `db:"ts_day"`      // Start of the day (UTC)
+	Dimension  string    `db:"dimension"`   // Dimension, which is a page view column name, like "country"
+	Element    string    `db:"element"`     // Dimension element, like "DE"
+	CountViews int64     `db:"count_views"` // Number of page views on the day with this element
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// StatsGranularity describes the size of a statistics time series bucket
+type StatsGranularity string
+
+//goland:noinspection GoUnusedConst
+const (
+	StatsGranularityHour  StatsGranularity = "hour"  // One bucket per hour
+	StatsGranularityDay   StatsGranularity = "day"   // One bucket per day
+	StatsGranularityWeek  StatsGranularity = "week"  // One bucket per ISO week, starting on Monday
+	StatsGranularityMonth StatsGranularity = "month" // One bucket per calendar month
+)
+
+// Buckets returns the start times of all buckets covering the time range [from, to)
+func (g StatsGranularity) Buckets(from, to time.Time) []time.Time {
+	var res []time.Time
+	for t := g.Truncate(from); t.Before(to); t = g.Next(t) {
+		res = append(res, t)
+	}
+	return res
+}
+
+// BucketCount returns the number of buckets covering the time range [from, to), without producing them
+func (g StatsGranularity) BucketCount(from, to time.Time) int64 {
+	start, end := g.Truncate(from), g.Truncate(to)
+	if !start.Before(to) {
+		return 0
+	}
+
+	// Count whole buckets between the start and the end boundaries
+	var n int64
+	switch g {
+	case StatsGranularityHour:
+		n = int64(end.Sub(start) / time.Hour)
+	case StatsGranularityWeek:
+		n = int64(end.Sub(start) / (7 * 24 * time.Hour))
+	case StatsGranularityMonth:
+		n = int64(end.Year()-start.Year())*12 + int64(end.Month()-start.Month())
+	default:
+		n = int64(end.Sub(start) / (24 * time.Hour))
+	}
+
+	// Add the last bucket if the range doesn't end on a bucket boundary
+	if end.Before(to) {
+		n++
+	}
+	return n
+}
+
+// IsValid returns whether the granularity is a known one
+func (g StatsGranularity) IsValid() bool {
+	switch g {
+	case StatsGranularityHour, StatsGranularityDay, StatsGranularityWeek, StatsGranularityMonth:
+		return true
+	}
+	return false
+}
+
+// Label returns a human-readable label for the bucket starting at the given time
+func (g StatsGranularity) Label(t time.Time) string {
+	switch g {
+	case StatsGranularityHour:
+		return t.Format("2006-01-02 15:00")
+	case StatsGranularityWeek:
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", y, w)
+	case StatsGranularityMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// Next returns the start of the bucket following the one starting at the given time
+func (g StatsGranularity) Next(t time.Time) time.Time {
+	switch g {
+	case StatsGranularityHour:
+		return t.Add(time.Hour)
+	case StatsGranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case StatsGranularityMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// Truncate returns the start of the bucket the given time falls into, in UTC
+func (g StatsGranularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case StatsGranularityHour:
+		return t.Truncate(time.Hour)
+	case StatsGranularityWeek:
+		// Weeks start on Monday
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	case StatsGranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
 }
 
 // ---------------------------------------------------------------------------------------------------------------------
@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/models"
 	"reflect"
 	"testing"
 	"time"
@@ -124,6 +125,79 @@ func TestUser_ColourIndex(t *testing.T) {
 	}
 }
 
+func TestUserAPIToken_HasScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes string
+		want   []string
+		ok     bool
+	}{
+		{"no scopes granted, none wanted", "", nil, true},
+		{"no scopes granted, one wanted ", "", []string{"export"}, false},
+		{"one granted, none wanted      ", "export", nil, true},
+		{"one granted, same wanted      ", "export", []string{"export"}, true},
+		{"one granted, other wanted     ", "export", []string{"moderation"}, false},
+		{"all granted, two wanted       ", "domain-read,export,moderation", []string{"moderation", "domain-read"}, true},
+		{"two granted, all wanted       ", "domain-read,export", []string{"domain-read", "export", "moderation"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := &UserAPIToken{Scopes: tt.scopes}
+			if got := tok.HasScopes(tt.want); got != tt.ok {
+				t.Errorf("HasScopes() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestUserAPIToken_IsExpired(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires sql.NullTime
+		want    bool
+	}{
+		{"never ", sql.NullTime{}, false},
+		{"past  ", sql.NullTime{Time: time.Now().UTC().Add(-time.Minute), Valid: true}, true},
+		{"future", sql.NullTime{Time: time.Now().UTC().Add(time.Minute), Valid: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := &UserAPIToken{ExpiresTime: tt.expires}
+			if got := tok.IsExpired(); got != tt.want {
+				t.Errorf("IsExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserSession_IsUnusual(t *testing.T) {
+	id := uuid.New()
+	sess := func(id uuid.UUID, country, browser, os string) *UserSession {
+		return &UserSession{ID: id, Country: country, BrowserName: browser, OSName: os}
+	}
+	tests := []struct {
+		name   string
+		recent []*UserSession
+		want   bool
+	}{
+		{"no recent sessions        ", nil, false},
+		{"only itself               ", []*UserSession{sess(id, "de", "Firefox", "Linux")}, false},
+		{"same everything           ", []*UserSession{sess(uuid.New(), "de", "Firefox", "Linux")}, false},
+		{"other country             ", []*UserSession{sess(uuid.New(), "nl", "Firefox", "Linux")}, true},
+		{"other browser             ", []*UserSession{sess(uuid.New(), "de", "Chrome", "Linux")}, true},
+		{"other OS                  ", []*UserSession{sess(uuid.New(), "de", "Firefox", "Windows")}, true},
+		{"one of several matches    ", []*UserSession{sess(uuid.New(), "nl", "Chrome", "Linux"), sess(uuid.New(), "de", "Firefox", "Linux")}, false},
+		{"itself and a different one", []*UserSession{sess(id, "de", "Firefox", "Linux"), sess(uuid.New(), "de", "Safari", "MacOSX")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sess(id, "de", "Firefox", "Linux").IsUnusual(tt.recent); got != tt.want {
+				t.Errorf("IsUnusual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDomainUser_AgeInDays(t *testing.T) {
 	tests := []struct {
 		name string
@@ -284,6 +358,9 @@ func TestDomain_CloneWithClearance(t *testing.T) {
 		SSOURL:            "https://foo.com",
 		SSOSecret:         sql.NullString{Valid: true, String: "c0ffee"},
 		SSONonInteractive: true,
+		SSOJWTKeys:        "-----BEGIN PUBLIC KEY-----",
+		SSOJWTIssuer:      "https://foo.com",
+		SSOJWTAudience:    "comentario",
 		ModAnonymous:      true,
 		ModAuthenticated:  true,
 		ModNumComments:    13,
@@ -334,6 +411,64 @@ func TestDomain_CloneWithClearance(t *testing.T) {
 	}
 }
 
+func TestParseDomainOIDCProviderID(t *testing.T) {
+	id := uuid.MustParse("0b5e6fc2-7e2c-4fdb-8a5a-a6c1f1c3d2e4")
+	tests := []struct {
+		name string
+		id   models.FederatedIdpID
+		want *uuid.UUID
+	}{
+		{"empty            ", "", nil},
+		{"global provider  ", "google", nil},
+		{"global OIDC      ", "oidc:0b5e6fc27e2c4fdb8a5aa6c1f1c3d2e4", nil},
+		{"prefix only      ", "doidc:", nil},
+		{"invalid UUID     ", "doidc:0b5e6fc27e2c4fdb8a5aa6c1f1c3d2", nil},
+		{"compact UUID     ", "doidc:0b5e6fc27e2c4fdb8a5aa6c1f1c3d2e4", &id},
+		{"qualified ID     ", models.FederatedIdpID((&DomainOIDCProvider{ID: id}).QualifiedID()), &id},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseDomainOIDCProviderID(tt.id); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDomainOIDCProviderID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDomainRoleRules(t *testing.T) {
+	rules := []*DomainRoleRule{
+		{Claim: "groups", Value: "Moderators", Role: models.DomainUserRoleModerator},
+		{Claim: DomainRoleRuleClaimEmailDomain, Value: "staff.example.com", Role: models.DomainUserRoleModerator},
+		{Claim: "suspended", Value: "true", Role: models.DomainUserRoleReadonly},
+		{Claim: "department", Value: DomainRoleRuleAnyValue, Role: models.DomainUserRoleCommenter},
+	}
+	tests := []struct {
+		name   string
+		claims map[string]any
+		email  string
+		want   models.DomainUserRole
+	}{
+		{"no claims          ", nil, "joe@example.com", ""},
+		{"group in list      ", map[string]any{"groups": []any{"users", "moderators"}}, "joe@example.com", models.DomainUserRoleModerator},
+		{"group as string    ", map[string]any{"groups": "moderators"}, "joe@example.com", models.DomainUserRoleModerator},
+		{"other group        ", map[string]any{"groups": []any{"users"}}, "joe@example.com", ""},
+		{"email domain       ", nil, "joe@Staff.Example.com", models.DomainUserRoleModerator},
+		{"email subdomain    ", nil, "joe@x.staff.example.com", ""},
+		{"bool claim         ", map[string]any{"suspended": true}, "joe@example.com", models.DomainUserRoleReadonly},
+		{"first match wins   ", map[string]any{"suspended": true}, "joe@staff.example.com", models.DomainUserRoleModerator},
+		{"any value          ", map[string]any{"department": "sales"}, "joe@example.com", models.DomainUserRoleCommenter},
+		{"any value, empty   ", map[string]any{"department": ""}, "joe@example.com", ""},
+		{"number claim       ", map[string]any{"department": 42.0}, "joe@example.com", models.DomainUserRoleCommenter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchDomainRoleRules(rules, tt.claims, tt.email); got != tt.want {
+				t.Errorf("MatchDomainRoleRules() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDomainPage_DisplayTitle(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -356,6 +491,111 @@ func TestDomainPage_DisplayTitle(t *testing.T) {
 	}
 }
 
+func TestNewPageViewSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		referrer string
+		query    string
+		want     *PageViewSource
+	}{
+		{"empty             ", "", "", &PageViewSource{}},
+		{"external referrer ", "https://News.Example.com/item?id=1", "", &PageViewSource{ReferrerHost: "news.example.com"}},
+		{"internal referrer ", "https://blog.org/other/", "", &PageViewSource{}},
+		{"relative referrer ", "/other/", "", &PageViewSource{}},
+		{"UTM               ", "", "?utm_source=newsletter&utm_medium=email&utm_campaign=spring+sale", &PageViewSource{UTMSource: "newsletter", UTMMedium: "email", UTMCampaign: "spring sale"}},
+		{"UTM, no question  ", "", "utm_source=x&foo=bar", &PageViewSource{UTMSource: "x"}},
+		{"malformed query   ", "", "utm_source=%zz&utm_medium=social", &PageViewSource{UTMMedium: "social"}},
+		{"referrer and UTM  ", "http://t.co/abc", "?utm_campaign=launch", &PageViewSource{ReferrerHost: "t.co", UTMCampaign: "launch"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPageViewSource("blog.org", tt.referrer, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewPageViewSource() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsGranularity_BucketCount(t *testing.T) {
+	ts := time.Date(2024, 5, 15, 13, 47, 12, 0, time.UTC)
+	tests := []struct {
+		name string
+		g    StatsGranularity
+		to   time.Time
+	}{
+		{"hour, empty      ", StatsGranularityHour, ts},
+		{"hour, partial    ", StatsGranularityHour, ts.Add(time.Minute)},
+		{"hour, boundary   ", StatsGranularityHour, time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"hour, days       ", StatsGranularityHour, ts.AddDate(0, 0, 5)},
+		{"day, partial     ", StatsGranularityDay, ts.Add(time.Hour)},
+		{"day, year        ", StatsGranularityDay, ts.AddDate(1, 0, 0)},
+		{"day, boundary    ", StatsGranularityDay, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"week, months     ", StatsGranularityWeek, ts.AddDate(0, 3, 0)},
+		{"week, boundary   ", StatsGranularityWeek, time.Date(2024, 5, 27, 0, 0, 0, 0, time.UTC)},
+		{"month, same month", StatsGranularityMonth, ts.Add(time.Hour)},
+		{"month, years     ", StatsGranularityMonth, ts.AddDate(3, 2, 0)},
+		{"month, boundary  ", StatsGranularityMonth, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"month, before    ", StatsGranularityMonth, ts.AddDate(0, -1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := tt.g.BucketCount(ts, tt.to), int64(len(tt.g.Buckets(ts, tt.to))); got != want {
+				t.Errorf("BucketCount() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestStatsGranularity_Truncate(t *testing.T) {
+	// Wednesday
+	ts := time.Date(2024, 5, 15, 13, 47, 12, 0, time.UTC)
+	tests := []struct {
+		name      string
+		g         StatsGranularity
+		want      time.Time
+		wantLabel string
+		wantNext  time.Time
+	}{
+		{"hour ", StatsGranularityHour, time.Date(2024, 5, 15, 13, 0, 0, 0, time.UTC), "2024-05-15 13:00", time.Date(2024, 5, 15, 14, 0, 0, 0, time.UTC)},
+		{"day  ", StatsGranularityDay, time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), "2024-05-15", time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"week ", StatsGranularityWeek, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), "2024-W20", time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+		{"month", StatsGranularityMonth, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "2024-05", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.g.Truncate(ts)
+			if !got.Equal(tt.want) {
+				t.Errorf("Truncate() = %v, want %v", got, tt.want)
+			}
+			if l := tt.g.Label(got); l != tt.wantLabel {
+				t.Errorf("Label() = %v, want %v", l, tt.wantLabel)
+			}
+			if n := tt.g.Next(got); !n.Equal(tt.wantNext) {
+				t.Errorf("Next() = %v, want %v", n, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestStatsGranularity_Truncate_Week(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   time.Time
+		want time.Time
+	}{
+		{"Monday", time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{"Sunday", time.Date(2024, 5, 19, 23, 59, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{"Year boundary", time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatsGranularityWeek.Truncate(tt.ts); !got.Equal(tt.want) {
+				t.Errorf("Truncate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestComment_IsAnonymous(t *testing.T) {
 	tests := []struct {
 		name string
@@ -331,13 +331,34 @@ func (db *Database) Shutdown() error {
 	return nil
 }
 
+// Stats returns the database connection pool statistics
+func (db *Database) Stats() sql.DBStats {
+	return db.db.Stats()
+}
+
 // StartOfDay returns an expression for truncating the given datetime column to the start of day
 func (db *Database) StartOfDay(col string) exp.LiteralExpression {
+	return db.TruncateDateTime(col, "day")
+}
+
+// TruncateDateTime returns an expression for truncating the given datetime column to the start of the given unit,
+// which is one of "hour", "day", "week" (starting on Monday), or "month"
+func (db *Database) TruncateDateTime(col, unit string) exp.LiteralExpression {
 	switch db.dialect {
 	case dbPostgres:
-		col = fmt.Sprintf("date_trunc('day', %s)", col)
+		col = fmt.Sprintf("date_trunc('%s', %s)", unit, col)
 	case dbSQLite3:
-		col = fmt.Sprintf("strftime('%%FT00:00:00Z', %s)", col)
+		switch unit {
+		case "hour":
+			col = fmt.Sprintf("strftime('%%Y-%%m-%%dT%%H:00:00Z', %s)", col)
+		case "week":
+			// Move to the next Sunday (unless it's already one), then 6 days back
+			col = fmt.Sprintf("strftime('%%FT00:00:00Z', %s, 'weekday 0', '-6 days')", col)
+		case "month":
+			col = fmt.Sprintf("strftime('%%Y-%%m-01T00:00:00Z', %s)", col)
+		default:
+			col = fmt.Sprintf("strftime('%%FT00:00:00Z', %s)", col)
+		}
 	}
 	return goqu.L(col)
 }
@@ -0,0 +1,104 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
+)
+
+// APITokenService is a service interface for dealing with UserAPIToken objects
+type APITokenService interface {
+	// Create persists a new API token
+	Create(t *data.UserAPIToken) error
+	// DeleteByUserID deletes an API token with the given ID, belonging to the given user. Returns ErrNotFound if there's
+	// no such token
+	DeleteByUserID(userID, id *uuid.UUID) error
+	// FindByValue finds and returns an API token by its value
+	FindByValue(value string) (*data.UserAPIToken, error)
+	// ListByUserID returns all API tokens of the given user, sorted by creation time
+	ListByUserID(userID *uuid.UUID) ([]*data.UserAPIToken, error)
+	// UpdateLastUsed updates the last used timestamp of the given API token in the database
+	UpdateLastUsed(t *data.UserAPIToken) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// apiTokenService is a blueprint APITokenService implementation
+type apiTokenService struct{ dbTxAware }
+
+func (svc *apiTokenService) Create(t *data.UserAPIToken) error {
+	logger.Debugf("apiTokenService.Create(%#v)", t)
+
+	// Insert a new record
+	if err := persistence.ExecOne(svc.dbx().Insert("cm_user_api_tokens").Rows(t)); err != nil {
+		return translateDBErrors("apiTokenService.Create/Insert", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *apiTokenService) DeleteByUserID(userID, id *uuid.UUID) error {
+	logger.Debugf("apiTokenService.DeleteByUserID(%s, %s)", userID, id)
+
+	// Delete the record
+	err := persistence.ExecOne(svc.dbx().Delete("cm_user_api_tokens").Where(goqu.Ex{"user_id": userID, "id": id}))
+	if err != nil {
+		return translateDBErrors("apiTokenService.DeleteByUserID/Delete", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *apiTokenService) FindByValue(value string) (*data.UserAPIToken, error) {
+	// Don't log the value itself as it's a secret
+	logger.Debug("apiTokenService.FindByValue(...)")
+
+	// Query the database
+	var t data.UserAPIToken
+	b, err := svc.dbx().From("cm_user_api_tokens").
+		Where(goqu.Ex{"value_hash": data.HashAPITokenValue(value)}).
+		ScanStruct(&t)
+	if err != nil {
+		return nil, translateDBErrors("apiTokenService.FindByValue/ScanStruct", err)
+	} else if !b {
+		return nil, ErrNotFound
+	}
+
+	// Succeeded
+	return &t, nil
+}
+
+func (svc *apiTokenService) ListByUserID(userID *uuid.UUID) ([]*data.UserAPIToken, error) {
+	logger.Debugf("apiTokenService.ListByUserID(%s)", userID)
+
+	// Query user tokens
+	var ts []*data.UserAPIToken
+	err := svc.dbx().From("cm_user_api_tokens").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("ts_created").Asc()).
+		ScanStructs(&ts)
+	if err != nil {
+		return nil, translateDBErrors("apiTokenService.ListByUserID/ScanStructs", err)
+	}
+
+	// Succeeded
+	return ts, nil
+}
+
+func (svc *apiTokenService) UpdateLastUsed(t *data.UserAPIToken) error {
+	logger.Debugf("apiTokenService.UpdateLastUsed(%s)", &t.ID)
+
+	// Update the record
+	err := persistence.ExecOne(svc.dbx().Update("cm_user_api_tokens").
+		Set(goqu.Record{"ts_last_used": t.LastUsedTime}).
+		Where(goqu.Ex{"id": &t.ID}))
+	if err != nil {
+		return translateDBErrors("apiTokenService.UpdateLastUsed/Update", err)
+	}
+
+	// Succeeded
+	return nil
+}
@@ -12,8 +12,12 @@ import (
 type AuthSessionService interface {
 	// Create saves a new auth session
 	Create(sessData, host, token string) (*data.AuthSession, error)
+	// FindByID returns an existing, non-expired auth session by its ID
+	FindByID(id *uuid.UUID) (*data.AuthSession, error)
 	// TakeByID returns and deletes an existing auth session by its ID
 	TakeByID(id *uuid.UUID) (*data.AuthSession, error)
+	// UpdateData updates the data of an existing, non-expired auth session
+	UpdateData(id *uuid.UUID, sessData string) error
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -36,6 +40,24 @@ func (svc *authSessionService) Create(sessData, host, token string) (*data.AuthS
 	return as, nil
 }
 
+func (svc *authSessionService) FindByID(id *uuid.UUID) (*data.AuthSession, error) {
+	logger.Debugf("authSessionService.FindByID(%s)", id)
+
+	// Query the session
+	var as data.AuthSession
+	b, err := svc.dbx().From("cm_auth_sessions").
+		Where(goqu.C("id").Eq(id), goqu.C("ts_expires").Gt(time.Now().UTC())).
+		ScanStruct(&as)
+	if err != nil {
+		return nil, translateDBErrors("authSessionService.FindByID/ScanStruct", err)
+	} else if !b {
+		return nil, ErrNotFound
+	}
+
+	// Succeeded
+	return &as, nil
+}
+
 func (svc *authSessionService) TakeByID(id *uuid.UUID) (*data.AuthSession, error) {
 	logger.Debugf("authSessionService.TakeByID(%s)", id)
 
@@ -55,3 +77,18 @@ func (svc *authSessionService) TakeByID(id *uuid.UUID) (*data.AuthSession, error
 	// Succeeded
 	return &as, nil
 }
+
+func (svc *authSessionService) UpdateData(id *uuid.UUID, sessData string) error {
+	logger.Debugf("authSessionService.UpdateData(%s, %q)", id, sessData)
+
+	// Update the session
+	err := persistence.ExecOne(svc.dbx().Update("cm_auth_sessions").
+		Set(goqu.Record{"data": sessData}).
+		Where(goqu.C("id").Eq(id), goqu.C("ts_expires").Gt(time.Now().UTC())))
+	if err != nil {
+		return translateDBErrors("authSessionService.UpdateData/ExecOne", err)
+	}
+
+	// Succeeded
+	return nil
+}
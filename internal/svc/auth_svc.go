@@ -11,6 +11,7 @@ import (
 	"gitlab.com/comentario/comentario/internal/util"
 	"net/http"
 	"slices"
+	"strings"
 )
 
 var (
@@ -22,6 +23,9 @@ var (
 
 // AuthService is a service interface to authenticate users
 type AuthService interface {
+	// AuthenticateAPIToken inspects the personal API token (usually provided in a header) and determines if it's valid
+	// and has all the provided scopes
+	AuthenticateAPIToken(tokenStr string, scopes []string) (*data.User, error)
 	// AuthenticateBearerToken inspects the token (usually provided in a header) and determines if the token is of one of
 	// the provided scopes
 	AuthenticateBearerToken(tokenStr string, scopes []string) (*data.User, error)
@@ -50,6 +54,45 @@ type AuthService interface {
 // authService is a blueprint AuthSessionService implementation
 type authService struct{ dbTxAware }
 
+// AuthenticateAPIToken inspects the personal API token (usually provided in a header) and determines if it's valid
+// and has all the provided scopes
+func (svc *authService) AuthenticateAPIToken(tokenStr string, scopes []string) (*data.User, error) {
+	// Quickly reject anything not looking like an API token
+	if !strings.HasPrefix(tokenStr, data.APITokenPrefix) {
+		return nil, ErrUnauthorised
+	}
+
+	// Try to find the token
+	tSvc := Services.APITokenService(nil)
+	token, err := tSvc.FindByValue(tokenStr)
+	if err != nil {
+		return nil, ErrUnauthorised
+	}
+
+	// Check the token hasn't expired and has all the required scopes
+	if token.IsExpired() || !token.HasScopes(scopes) {
+		return nil, ErrUnauthorised
+	}
+
+	// Token seems legitimate, now find its owner
+	var user *data.User
+	if user, err = Services.UserService(nil).FindUserByID(&token.UserID); err != nil {
+		return nil, ErrInternalError
+
+		// Verify the user is allowed to authenticate at all
+	} else if err := svc.UserCanAuthenticate(user, true); err != nil {
+		// Not allowed
+		return nil, ErrUnauthorised
+	}
+
+	// Register the token usage, ignoring any error
+	token.LastUsedTime = data.NowNullable()
+	_ = tSvc.UpdateLastUsed(token)
+
+	// Succeeded
+	return user, nil
+}
+
 // AuthenticateBearerToken inspects the token (usually provided in a header) and determines if the token is of one of
 // the provided scopes
 func (svc *authService) AuthenticateBearerToken(tokenStr string, scopes []string) (*data.User, error) {
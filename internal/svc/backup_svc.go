@@ -0,0 +1,518 @@
+package svc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
+	"io"
+	"time"
+)
+
+// BackupService is a service interface for backing up and restoring the entire instance
+type BackupService interface {
+	// Backup writes a portable, gzip-compressed archive of the entire instance into the given writer. inclSessions
+	// indicates whether user sessions must also be included
+	Backup(w io.Writer, inclSessions bool) error
+	// Restore loads an archive previously created with Backup from the given reader into the database, which must be
+	// empty
+	Restore(r io.Reader) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+const (
+	backupFormat  = "comentario-backup" // Backup archive format identifier
+	backupVersion = 1                   // Current backup archive format version
+)
+
+// ErrBackupDBNotEmpty is returned when a restore is attempted into a non-empty database
+var ErrBackupDBNotEmpty = errors.New("database isn't empty: restore is only possible into an empty database")
+
+// ErrBackupEncKey is returned when encrypted data in the archive can't be decrypted with the configured encryption key
+var ErrBackupEncKey = errors.New("encrypted data can't be restored: the instance must use the same encryption secret as the one the backup was made on")
+
+// backupHeader is the first record of a backup archive
+type backupHeader struct {
+	Format      string    `json:"format"`      // Archive format identifier, must be backupFormat
+	Version     int       `json:"version"`     // Archive format version
+	CreatedTime time.Time `json:"created"`     // When the archive was created
+	DBVersion   string    `json:"dbVersion"`   // Version of the database the archive was created from
+	HasSessions bool      `json:"hasSessions"` // Whether the archive includes user sessions
+}
+
+// backupRecord is a single table row record of a backup archive
+type backupRecord struct {
+	Table string          `json:"table"` // Name of the table the row belongs to
+	Row   json.RawMessage `json:"row"`   // Row data
+}
+
+// backupAttr is an attribute row of a user or a domain
+type backupAttr struct {
+	OwnerID        uuid.UUID `db:"owner_id"` // ID of the owning user or domain
+	data.Attribute           // Attribute itself
+}
+
+// backupDomainConfig is a domain configuration row
+type backupDomainConfig struct {
+	DomainID        uuid.UUID `db:"domain_id"` // ID of the domain
+	dynConfigRecord           // Config record itself
+}
+
+// backupDomainUser is a domain user row, including the moderation paths
+type backupDomainUser struct {
+	data.DomainUser        // Domain user itself
+	ModerationPaths string `db:"moderation_paths"` // Paths the user receives moderation notifications for
+}
+
+// backupDomainIdP is a domain identity provider link row
+type backupDomainIdP struct {
+	DomainID uuid.UUID             `db:"domain_id"`  // ID of the domain
+	FedIdPID models.FederatedIdpID `db:"fed_idp_id"` // ID of the federated identity provider
+}
+
+// backupTable describes how a single table is backed up and restored
+type backupTable struct {
+	name     string                                              // Table name
+	sessions bool                                                // Whether the table holds user sessions
+	backup   func(svc *backupService, enc *json.Encoder) error   // Function writing all table rows to the encoder
+	restore  func(svc *backupService, row json.RawMessage) error // Function inserting a single row into the table
+	finalise func(svc *backupService) error                      // Optional function called once all rows are restored
+}
+
+// backupTables lists all backed up tables, in the order they're restored
+var backupTables = []*backupTable{
+	{
+		name: "cm_users",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			// Skip the anonymous user, it's always created by the migrations. Calculated fields are irrelevant
+			return backupRows[data.User](enc, "cm_users",
+				svc.dbx().From(goqu.T("cm_users").As("u")).
+					Select(goqu.I("u.*"), goqu.V(false).As("has_avatar"), goqu.V(-1).As("owned_domain_count")).
+					Where(goqu.I("u.id").Neq(data.AnonymousUser.ID)).
+					Order(goqu.I("u.ts_created").Asc()))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(u *data.User) error {
+				// Users can reference each other, so postpone the references until all users are in
+				if u.UserCreated.Valid || u.UserBanned.Valid {
+					svc.userRefs = append(svc.userRefs, *u)
+				}
+				u.UserCreated, u.UserBanned = uuid.NullUUID{}, uuid.NullUUID{}
+				return svc.insert("cm_users", u)
+			})
+		},
+		finalise: func(svc *backupService) error {
+			for _, u := range svc.userRefs {
+				err := persistence.ExecOne(svc.dbx().Update("cm_users").
+					Set(goqu.Record{"user_created": u.UserCreated, "user_banned": u.UserBanned}).
+					Where(goqu.Ex{"id": &u.ID}))
+				if err != nil {
+					return translateDBErrors("backupService.Restore/ExecOne[cm_users]", err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name: "cm_user_avatars",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.UserAvatar](enc, "cm_user_avatars", svc.dbx().From("cm_user_avatars"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(ua *data.UserAvatar) error { return svc.insert("cm_user_avatars", ua) })
+		},
+	},
+	{
+		name: "cm_user_attrs",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[backupAttr](enc, "cm_user_attrs",
+				svc.dbx().From("cm_user_attrs").Select(goqu.C("user_id").As("owner_id"), "key", "value", "ts_updated"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(a *backupAttr) error { return svc.insertAttr("cm_user_attrs", "user_id", a) })
+		},
+	},
+	{
+		name: "cm_user_api_tokens",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.UserAPIToken](enc, "cm_user_api_tokens", svc.dbx().From("cm_user_api_tokens"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(t *data.UserAPIToken) error { return svc.insert("cm_user_api_tokens", t) })
+		},
+	},
+	{
+		name: "cm_user_merges",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.UserMerge](enc, "cm_user_merges", svc.dbx().From("cm_user_merges"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(m *data.UserMerge) error { return svc.insert("cm_user_merges", m) })
+		},
+	},
+	{
+		name: "cm_user_passkeys",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.UserPasskey](enc, "cm_user_passkeys", svc.dbx().From("cm_user_passkeys"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(pk *data.UserPasskey) error { return svc.insert("cm_user_passkeys", pk) })
+		},
+	},
+	{
+		name:     "cm_user_sessions",
+		sessions: true,
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.UserSession](enc, "cm_user_sessions", svc.dbx().From("cm_user_sessions"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(us *data.UserSession) error { return svc.insert("cm_user_sessions", us) })
+		},
+	},
+	{
+		name: "cm_configuration",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[dynConfigRecord](enc, "cm_configuration", svc.dbx().From("cm_configuration"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			// The instance may have already stored its config on a previous start, hence the upsert
+			return restoreRow(row, func(r *dynConfigRecord) error {
+				_, err := svc.dbx().Insert("cm_configuration").
+					Rows(r).
+					OnConflict(goqu.DoUpdate("key", goqu.Record{"value": r.Value, "ts_updated": r.UpdatedTime, "user_updated": r.UserUpdated})).
+					Executor().Exec()
+				return translateDBErrors("backupService.Restore/Exec[cm_configuration]", err)
+			})
+		},
+	},
+	{
+		name: "cm_domains",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.Domain](enc, "cm_domains", svc.dbx().From("cm_domains"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(d *data.Domain) error { return svc.insert("cm_domains", d) })
+		},
+	},
+	{
+		name: "cm_domain_configuration",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[backupDomainConfig](enc, "cm_domain_configuration", svc.dbx().From("cm_domain_configuration"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(r *backupDomainConfig) error { return svc.insert("cm_domain_configuration", r) })
+		},
+	},
+	{
+		name: "cm_domain_attrs",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[backupAttr](enc, "cm_domain_attrs",
+				svc.dbx().From("cm_domain_attrs").Select(goqu.C("domain_id").As("owner_id"), "key", "value", "ts_updated"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(a *backupAttr) error { return svc.insertAttr("cm_domain_attrs", "domain_id", a) })
+		},
+	},
+	{
+		name: "cm_domains_users",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[backupDomainUser](enc, "cm_domains_users", svc.dbx().From("cm_domains_users"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(du *backupDomainUser) error { return svc.insert("cm_domains_users", du) })
+		},
+	},
+	{
+		name: "cm_domains_idps",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[backupDomainIdP](enc, "cm_domains_idps", svc.dbx().From("cm_domains_idps"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(r *backupDomainIdP) error { return svc.insert("cm_domains_idps", r) })
+		},
+	},
+	{
+		name: "cm_domain_oidc_providers",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.DomainOIDCProvider](enc, "cm_domain_oidc_providers", svc.dbx().From("cm_domain_oidc_providers"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(p *data.DomainOIDCProvider) error {
+				// Client secrets are encrypted with the key of the instance the backup was made on, so refuse to restore
+				// them unless this instance can decrypt them
+				if _, err := getDomainOIDCSecret(p); err != nil {
+					return fmt.Errorf("%w: %w", ErrBackupEncKey, err)
+				}
+				return svc.insert("cm_domain_oidc_providers", p)
+			})
+		},
+	},
+	{
+		name: "cm_domain_role_rules",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.DomainRoleRule](enc, "cm_domain_role_rules", svc.dbx().From("cm_domain_role_rules"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(r *data.DomainRoleRule) error { return svc.insert("cm_domain_role_rules", r) })
+		},
+	},
+	{
+		name: "cm_domains_extensions",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.DomainExtensionConfig](enc, "cm_domains_extensions", svc.dbx().From("cm_domains_extensions"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(r *data.DomainExtensionConfig) error { return svc.insert("cm_domains_extensions", r) })
+		},
+	},
+	{
+		name: "cm_domain_pages",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.DomainPage](enc, "cm_domain_pages", svc.dbx().From("cm_domain_pages"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(p *data.DomainPage) error { return svc.insert("cm_domain_pages", p) })
+		},
+	},
+	{
+		name: "cm_domain_page_views",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.DomainPageView](enc, "cm_domain_page_views", svc.dbx().From("cm_domain_page_views"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(pv *data.DomainPageView) error { return svc.insert("cm_domain_page_views", pv) })
+		},
+	},
+	{
+		name: "cm_stats_daily_pages",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.StatsDailyPage](enc, "cm_stats_daily_pages", svc.dbx().From("cm_stats_daily_pages"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(r *data.StatsDailyPage) error { return svc.insert("cm_stats_daily_pages", r) })
+		},
+	},
+	{
+		name: "cm_stats_daily_views",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.StatsDailyViews](enc, "cm_stats_daily_views", svc.dbx().From("cm_stats_daily_views"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(r *data.StatsDailyViews) error { return svc.insert("cm_stats_daily_views", r) })
+		},
+	},
+	{
+		name: "cm_comments",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.Comment](enc, "cm_comments", svc.dbx().From("cm_comments"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(c *data.Comment) error {
+				// Postpone linking to the parent until all comments are in
+				if c.ParentID.Valid {
+					svc.commentParents = append(svc.commentParents, [2]uuid.UUID{c.ID, c.ParentID.UUID})
+					c.ParentID = uuid.NullUUID{}
+				}
+				return svc.insert("cm_comments", c)
+			})
+		},
+		finalise: func(svc *backupService) error {
+			for _, cp := range svc.commentParents {
+				err := persistence.ExecOne(svc.dbx().Update("cm_comments").
+					Set(goqu.Record{"parent_id": &cp[1]}).
+					Where(goqu.Ex{"id": &cp[0]}))
+				if err != nil {
+					return translateDBErrors("backupService.Restore/ExecOne[cm_comments]", err)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name: "cm_comment_votes",
+		backup: func(svc *backupService, enc *json.Encoder) error {
+			return backupRows[data.CommentVote](enc, "cm_comment_votes", svc.dbx().From("cm_comment_votes"))
+		},
+		restore: func(svc *backupService, row json.RawMessage) error {
+			return restoreRow(row, func(v *data.CommentVote) error { return svc.insert("cm_comment_votes", v) })
+		},
+	},
+}
+
+// backupService is a blueprint BackupService implementation
+type backupService struct {
+	dbTxAware
+	userRefs       []data.User    // Restored users referencing other users
+	commentParents [][2]uuid.UUID // Restored (comment ID, parent ID) pairs
+}
+
+func (svc *backupService) Backup(w io.Writer, inclSessions bool) error {
+	logger.Debugf("backupService.Backup(%v)", inclSessions)
+
+	// Compress the output
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	// Write the header
+	hdr := backupHeader{
+		Format:      backupFormat,
+		Version:     backupVersion,
+		CreatedTime: time.Now().UTC(),
+		DBVersion:   Services.DBVersion(),
+		HasSessions: inclSessions,
+	}
+	if err := enc.Encode(&hdr); err != nil {
+		return err
+	}
+
+	// Write out every table
+	for _, t := range backupTables {
+		if t.sessions && !inclSessions {
+			continue
+		}
+		if err := t.backup(svc, enc); err != nil {
+			return fmt.Errorf("failed to back up table %s: %w", t.name, err)
+		}
+	}
+
+	// Succeeded
+	return gz.Close()
+}
+
+func (svc *backupService) Restore(r io.Reader) error {
+	logger.Debug("backupService.Restore(...)")
+
+	// Make sure the database is empty
+	if err := svc.checkEmpty(); err != nil {
+		return err
+	}
+
+	// Decompress the input
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return fmt.Errorf("failed to decompress the archive: %w", err)
+	}
+	defer gz.Close()
+	dec := json.NewDecoder(gz)
+
+	// Read and validate the header
+	var hdr backupHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return fmt.Errorf("failed to read the archive header: %w", err)
+	} else if hdr.Format != backupFormat {
+		return fmt.Errorf("not a backup archive (format %q)", hdr.Format)
+	} else if hdr.Version < 1 || hdr.Version > backupVersion {
+		return fmt.Errorf("unsupported backup archive version: %d", hdr.Version)
+	}
+	logger.Infof("Restoring backup created on %s from database %q", hdr.CreatedTime.Format(time.RFC3339), hdr.DBVersion)
+
+	// Index the tables by name
+	tables := make(map[string]*backupTable, len(backupTables))
+	for _, t := range backupTables {
+		tables[t.name] = t
+	}
+
+	// Iterate all rows in the archive
+	counts := make(map[string]int)
+	for {
+		var rec backupRecord
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read the archive: %w", err)
+		}
+
+		// Restore the row
+		if t, ok := tables[rec.Table]; !ok {
+			return fmt.Errorf("unknown table in the archive: %q", rec.Table)
+		} else if err := t.restore(svc, rec.Row); err != nil {
+			return fmt.Errorf("failed to restore a row in table %s: %w", rec.Table, err)
+		}
+		counts[rec.Table]++
+	}
+
+	// Finalise the tables and report the results
+	for _, t := range backupTables {
+		if t.finalise != nil {
+			if err := t.finalise(svc); err != nil {
+				return err
+			}
+		}
+		logger.Infof("Restored %d rows into %s", counts[t.name], t.name)
+	}
+
+	// Succeeded
+	return nil
+}
+
+// checkEmpty returns ErrBackupDBNotEmpty if the database contains any users (except the anonymous one) or domains
+func (svc *backupService) checkEmpty() error {
+	var cnt int
+	if _, err := svc.dbx().From("cm_users").Select(goqu.COUNT("*")).Where(goqu.C("id").Neq(data.AnonymousUser.ID)).ScanVal(&cnt); err != nil {
+		return translateDBErrors("backupService.checkEmpty/ScanVal[cm_users]", err)
+	} else if cnt > 0 {
+		return ErrBackupDBNotEmpty
+	}
+	if _, err := svc.dbx().From("cm_domains").Select(goqu.COUNT("*")).ScanVal(&cnt); err != nil {
+		return translateDBErrors("backupService.checkEmpty/ScanVal[cm_domains]", err)
+	} else if cnt > 0 {
+		return ErrBackupDBNotEmpty
+	}
+	return nil
+}
+
+// insert inserts the given row into the specified table
+func (svc *backupService) insert(table string, row any) error {
+	_, err := svc.dbx().Insert(table).Rows(row).Executor().Exec()
+	return translateDBErrors("backupService.insert/Exec["+table+"]", err)
+}
+
+// insertAttr inserts the given attribute row into the specified table, using ownerCol as the owner column name
+func (svc *backupService) insertAttr(table, ownerCol string, a *backupAttr) error {
+	_, err := svc.dbx().Insert(table).
+		Rows(goqu.Record{ownerCol: &a.OwnerID, "key": a.Key, "value": a.Value, "ts_updated": a.UpdatedTime}).
+		Executor().Exec()
+	return translateDBErrors("backupService.insertAttr/Exec["+table+"]", err)
+}
+
+// backupRows runs the given query and writes every row of the result, scanned into T, as a record of the specified
+// table into the encoder
+func backupRows[T any](enc *json.Encoder, table string, q *goqu.SelectDataset) error {
+	// Stream the rows rather than loading them all into memory
+	scanner, err := q.Executor().Scanner()
+	if err != nil {
+		return translateDBErrors("backupRows/Scanner", err)
+	}
+	defer scanner.Close()
+
+	for scanner.Next() {
+		var row T
+		if err := scanner.ScanStruct(&row); err != nil {
+			return translateDBErrors("backupRows/ScanStruct", err)
+		}
+		b, err := json.Marshal(&row)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(&backupRecord{Table: table, Row: b}); err != nil {
+			return err
+		}
+	}
+	return translateDBErrors("backupRows/Next", scanner.Err())
+}
+
+// restoreRow unmarshals the given row data into T and passes it to the provided function
+func restoreRow[T any](row json.RawMessage, fn func(*T) error) error {
+	var v T
+	if err := json.Unmarshal(row, &v); err != nil {
+		return err
+	}
+	return fn(&v)
+}
@@ -1,15 +1,19 @@
 package svc
 
 import (
-	"database/sql"
+	"fmt"
 	"github.com/doug-martin/goqu/v9"
 	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/persistence"
 	"gitlab.com/comentario/comentario/internal/util"
 	"sync"
 	"time"
 )
 
+// cleanupIPBatchSize is the maximum number of distinct IPs anonymised with a single statement
+const cleanupIPBatchSize = 250
+
 // CleanupService is a service that cleans up stale data and deals with data inconsistencies
 type CleanupService interface {
 	// Run the service
@@ -22,12 +26,16 @@ type CleanupService interface {
 func NewCleanupService(db *persistence.Database) CleanupService {
 	cs := &cleanupService{dbTxAware: dbTxAware{db: db}, stop: make(chan bool, 1)}
 	cs.cl = []*cleaner{
-		newCleaner("expired auth sessions", "Removed %d expired auth sessions", time.Hour, cs.cleanupExpiredAuthSessions),
-		newCleaner("expired tokens", "Removed %d expired tokens", time.Hour, cs.cleanupExpiredTokens),
-		newCleaner("expired user sessions", "Removed %d expired user sessions", util.OneDay, cs.cleanupExpiredUserSessions),
-		newCleaner("stale page views", "Removed %d stale page views", util.OneDay, cs.cleanupStalePageViews),
-		newCleaner("domain comment count", "Updated comment count in %d domains", 12*time.Hour, cs.updateDomainCommentCounts),
-		newCleaner("domain page comment count", "Updated comment count in %d domain pages", 12*time.Hour, cs.updateDomainPageCommentCounts),
+		newCleaner("expired auth sessions", "Removed %d expired auth sessions", time.Hour, execCleanup(cs.cleanupExpiredAuthSessions)),
+		newCleaner("expired tokens", "Removed %d expired tokens", time.Hour, execCleanup(cs.cleanupExpiredTokens)),
+		newCleaner("expired user sessions", "Removed %d expired user sessions", util.OneDay, execCleanup(cs.cleanupExpiredUserSessions)),
+		newCleaner("stats rollup", "Stored %d statistics rollup records", 10*time.Minute, cs.rollupStats),
+		newCleaner("stale page views", "Removed %d stale page views", util.OneDay, execCleanup(cs.cleanupStalePageViews)),
+		newCleaner("domain comment count", "Updated comment count in %d domains", 12*time.Hour, execCleanup(cs.updateDomainCommentCounts)),
+		newCleaner("comment author IP anonymisation", "Anonymised author IP in %d comments past retention period", util.OneDay, cs.anonymiseCommentAuthorIPs),
+		newCleaner("old user sessions", "Removed %d user sessions past retention period", util.OneDay, execRetentionCleanup(data.ConfigKeyRetentionUserSessionDays, cs.cleanupOldUserSessions)),
+		newCleaner("old deleted comments", "Purged %d deleted comments past retention period", util.OneDay, execRetentionCleanup(data.ConfigKeyRetentionCommentDelDays, cs.cleanupOldDeletedComments)),
+		newCleaner("domain page comment count", "Updated comment count in %d domain pages", 12*time.Hour, execCleanup(cs.updateDomainPageCommentCounts)),
 	}
 	return cs
 }
@@ -35,7 +43,7 @@ func NewCleanupService(db *persistence.Database) CleanupService {
 //----------------------------------------------------------------------------------------------------------------------
 
 // newCleaner instantiates and returns a new cleaner
-func newCleaner(title, logFmt string, interval time.Duration, proc func() persistence.Executable) *cleaner {
+func newCleaner(title, logFmt string, interval time.Duration, proc func() (int64, error)) *cleaner {
 	return &cleaner{
 		title:    title,
 		logFmt:   logFmt,
@@ -47,21 +55,17 @@ func newCleaner(title, logFmt string, interval time.Duration, proc func() persis
 
 // cleaner describes a cleanup routine
 type cleaner struct {
-	title    string                        // Routine title
-	logFmt   string                        // Log line format, using %d as a placeholder for the number of rows affected by the Executable
-	interval time.Duration                 // Sleep interval between consecutive runs
-	proc     func() persistence.Executable // Cleanup procedure, which returns an Executable to execute
-	stop     chan bool                     // Cleaner stop signal
+	title    string                // Routine title
+	logFmt   string                // Log line format, using %d as a placeholder for the number of rows affected
+	interval time.Duration         // Sleep interval between consecutive runs
+	proc     func() (int64, error) // Cleanup procedure, which returns the number of rows affected
+	stop     chan bool             // Cleaner stop signal
 }
 
 // run the cleaner routine
 func (c *cleaner) run() (i int64, err error) {
-	var res sql.Result
-	if res, err = c.proc().Executor().Exec(); err != nil {
-		logger.Errorf("cleanupService.runCleaner/Exec[%s]: %v", c.title, err)
-
-	} else if i, err = res.RowsAffected(); err != nil {
-		logger.Errorf("cleanupService.runCleaner/RowsAffected[%s]: %v", c.title, err)
+	if i, err = c.proc(); err != nil {
+		logger.Errorf("cleanupService.runCleaner[%s]: %v", c.title, err)
 
 	} else if i > 0 {
 		logger.Infof(c.logFmt, i)
@@ -69,6 +73,40 @@ func (c *cleaner) run() (i int64, err error) {
 	return
 }
 
+// execCleanup returns a cleanup procedure that executes the Executable returned by proc
+func execCleanup(proc func() persistence.Executable) func() (int64, error) {
+	return func() (int64, error) {
+		if res, err := proc().Executor().Exec(); err != nil {
+			return 0, fmt.Errorf("exec: %w", err)
+		} else if i, err := res.RowsAffected(); err != nil {
+			return 0, fmt.Errorf("rows affected: %w", err)
+		} else {
+			return i, nil
+		}
+	}
+}
+
+// execRetentionCleanup returns a cleanup procedure that executes the Executable returned by proc for the cutoff moment
+// derived from the retention period (in days) configured under the given key. Does nothing if the period is zero
+func execRetentionCleanup(key data.DynConfigItemKey, proc func(cutoff time.Time) persistence.Executable) func() (int64, error) {
+	return func() (int64, error) {
+		if cutoff, ok := retentionCutoff(key); ok {
+			return execCleanup(func() persistence.Executable { return proc(cutoff) })()
+		}
+		return 0, nil
+	}
+}
+
+// retentionCutoff returns the moment before which data is to be cleaned up according to the retention period (in
+// days) configured under the given key, and whether the retention is configured at all
+func retentionCutoff(key data.DynConfigItemKey) (time.Time, bool) {
+	days := Services.DynConfigService().GetInt(key)
+	if days <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().UTC().AddDate(0, 0, -days), true
+}
+
 //----------------------------------------------------------------------------------------------------------------------
 
 // cleanupService is a blueprint CleanupService implementation
@@ -99,6 +137,54 @@ func (svc *cleanupService) Shutdown() {
 	svc.wg.Wait()
 }
 
+// anonymiseCommentAuthorIPs masks the author IP of comments created before the configured retention period
+func (svc *cleanupService) anonymiseCommentAuthorIPs() (int64, error) {
+	cutoff, ok := retentionCutoff(data.ConfigKeyRetentionCommentIPDays)
+	if !ok {
+		return 0, nil
+	}
+
+	var cnt int64
+	for {
+		// Fetch a batch of distinct IPs that aren't masked yet (masked IPs end with an "x")
+		var ips []string
+		err := svc.dbx().From("cm_comments").
+			Select("author_ip").
+			Distinct().
+			Where(
+				goqu.I("ts_created").Lt(cutoff),
+				goqu.I("author_ip").Neq(""),
+				goqu.I("author_ip").NotLike("%x")).
+			Limit(cleanupIPBatchSize).
+			ScanVals(&ips)
+		if err != nil {
+			return cnt, fmt.Errorf("select: %w", err)
+		} else if len(ips) == 0 {
+			return cnt, nil
+		}
+
+		// Mask all IPs in the batch with a single statement. Values MaskIP can't make sense of are blanked, so that they
+		// don't get picked up again
+		ce := goqu.Case().Value(goqu.I("author_ip"))
+		for _, ip := range ips {
+			masked := util.MaskIP(ip)
+			if masked == ip {
+				masked = ""
+			}
+			ce = ce.When(ip, masked)
+		}
+		i, err := execCleanup(func() persistence.Executable {
+			return svc.dbx().Update("cm_comments").
+				Set(goqu.Record{"author_ip": ce}).
+				Where(goqu.I("author_ip").In(ips), goqu.I("ts_created").Lt(cutoff))
+		})()
+		cnt += i
+		if err != nil || len(ips) < cleanupIPBatchSize {
+			return cnt, err
+		}
+	}
+}
+
 // cleanupExpiredAuthSessions removes all expired auth sessions from the database
 func (svc *cleanupService) cleanupExpiredAuthSessions() persistence.Executable {
 	return svc.dbx().Delete("cm_auth_sessions").Where(goqu.I("ts_expires").Lt(time.Now().UTC()))
@@ -114,12 +200,41 @@ func (svc *cleanupService) cleanupExpiredUserSessions() persistence.Executable {
 	return svc.dbx().Delete("cm_user_sessions").Where(goqu.I("ts_expires").Lt(time.Now().UTC()))
 }
 
-// cleanupStalePageViews removes stale page view stats from the database
+// cleanupOldDeletedComments permanently removes comments marked deleted before the given moment. Comments that still
+// have replies are kept so that their (non-deleted) children don't go along with them
+func (svc *cleanupService) cleanupOldDeletedComments(cutoff time.Time) persistence.Executable {
+	return svc.dbx().Delete("cm_comments").
+		Where(
+			goqu.I("is_deleted").IsTrue(),
+			goqu.I("ts_deleted").Lt(cutoff),
+			goqu.I("id").NotIn(
+				svc.dbx().From("cm_comments").Select("parent_id").Where(goqu.I("parent_id").IsNotNull())))
+}
+
+// cleanupOldUserSessions removes all user sessions created before the given moment, regardless of their expiration
+func (svc *cleanupService) cleanupOldUserSessions(cutoff time.Time) persistence.Executable {
+	return svc.dbx().Delete("cm_user_sessions").Where(goqu.I("ts_created").Lt(cutoff))
+}
+
+// cleanupStalePageViews removes stale page view stats from the database. Only page views that have been rolled up
+// are removed
 func (svc *cleanupService) cleanupStalePageViews() persistence.Executable {
 	// Retain pageviews for a day longer than max. number of days to account for date changes
 	retainFor := util.OneDay * time.Duration(config.ServerConfig.StatsMaxDays+1)
 	return svc.dbx().Delete("cm_domain_page_views").
-		Where(goqu.I("ts_created").Lt(time.Now().UTC().Add(-retainFor)))
+		Where(
+			goqu.I("ts_created").Lt(time.Now().UTC().Add(-retainFor)),
+			// The last rolled-up day may be incomplete, hence the strict comparison
+			goqu.I("ts_created").Lt(svc.dbx().From("cm_stats_daily_pages").Select(goqu.MAX("ts_day"))))
+}
+
+// rollupStats aggregates page views into the statistics rollup tables
+func (svc *cleanupService) rollupStats() (cnt int64, err error) {
+	err = Services.WithTx(func(tx *persistence.DatabaseTx) error {
+		cnt, err = Services.StatsService(tx).Rollup()
+		return err
+	})
+	return
 }
 
 // updateDomainCommentCounts ensures the number of comments for each domain is correct
@@ -14,6 +14,9 @@ import (
 	"time"
 )
 
+// commentIDBatchSize is the maximum number of comment IDs passed to a single query
+const commentIDBatchSize = 500
+
 // CommentService is a service interface for dealing with comments
 type CommentService interface {
 	// Count returns number of comments for the given domain and, optionally, page.
@@ -35,11 +38,21 @@ type CommentService interface {
 	DeleteByUser(userID *uuid.UUID) (int64, error)
 	// Edited persists the text changes of the given comment in the database
 	Edited(comment *data.Comment) error
+	// FilterExistingIDs returns the set of the given comment IDs that already exist in the database, in any domain
+	FilterExistingIDs(ids []uuid.UUID) (map[uuid.UUID]bool, error)
 	// FindByID finds and returns a comment with the given ID
 	FindByID(id *uuid.UUID) (*data.Comment, error)
 	// ListByDomain returns a list of comments for the given domain. No comment property filtering is applied, so
-	// minimum access privileges are domain moderator
-	ListByDomain(domainID *uuid.UUID) ([]*models.Comment, error)
+	// minimum access privileges are domain moderator. If since is provided, only returns comments created, edited,
+	// moderated, or deleted after that moment
+	ListByDomain(domainID *uuid.UUID, since *time.Time) ([]*models.Comment, error)
+	// ListByUser returns a list of all comments created by the given user, across all domains
+	ListByUser(userID *uuid.UUID) ([]*models.Comment, error)
+	// ListVotesByDomain returns a list of comment votes for the given domain. If since is provided, only returns votes
+	// cast or changed after that moment
+	ListVotesByDomain(domainID *uuid.UUID, since *time.Time) ([]*data.CommentVote, error)
+	// ListVotesByUser returns a list of all comment votes cast by the given user, across all domains
+	ListVotesByUser(userID *uuid.UUID) ([]*data.CommentVote, error)
 	// ListWithCommenters returns a list of comments and related commenters for the given domain and, optionally, page
 	// and/or user.
 	//   - curUser is the current authenticated/anonymous user.
@@ -71,6 +84,10 @@ type CommentService interface {
 	Moderated(comment *data.Comment) error
 	// MoveToPage moves all comments from the source to the target page
 	MoveToPage(sourcePageID, targetPageID *uuid.UUID) error
+	// Replace updates all properties of an existing comment in the database, except for its ID
+	Replace(comment *data.Comment) error
+	// SaveVote inserts or updates the given vote as is, without updating the comment's score
+	SaveVote(vote *data.CommentVote) error
 	// SetMarkdown updates the Markdown/HTML properties of the given comment in the specified domain. editedUserID
 	// should point to the user who edited the comment in case it's edited, otherwise nil
 	SetMarkdown(comment *data.Comment, markdown string, domainID, editedUserID *uuid.UUID) error
@@ -187,6 +204,26 @@ func (svc *commentService) Edited(comment *data.Comment) error {
 	return nil
 }
 
+func (svc *commentService) FilterExistingIDs(ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	logger.Debugf("commentService.FilterExistingIDs([%d items])", len(ids))
+
+	// Query the database in batches to stay within the bound variable limit
+	res := make(map[uuid.UUID]bool)
+	for i := 0; i < len(ids); i += commentIDBatchSize {
+		var found []uuid.UUID
+		q := svc.dbx().From("cm_comments").Select("id").Where(goqu.C("id").In(ids[i:min(i+commentIDBatchSize, len(ids))]))
+		if err := q.ScanVals(&found); err != nil {
+			return nil, translateDBErrors("commentService.FilterExistingIDs/ScanVals", err)
+		}
+		for _, id := range found {
+			res[id] = true
+		}
+	}
+
+	// Succeeded
+	return res, nil
+}
+
 func (svc *commentService) FindByID(id *uuid.UUID) (*data.Comment, error) {
 	logger.Debugf("commentService.FindByID(%s)", id)
 
@@ -202,8 +239,8 @@ func (svc *commentService) FindByID(id *uuid.UUID) (*data.Comment, error) {
 	return &c, nil
 }
 
-func (svc *commentService) ListByDomain(domainID *uuid.UUID) ([]*models.Comment, error) {
-	logger.Debugf("commentService.ListByDomain(%s)", domainID)
+func (svc *commentService) ListByDomain(domainID *uuid.UUID, since *time.Time) ([]*models.Comment, error) {
+	logger.Debugf("commentService.ListByDomain(%s, %v)", domainID, since)
 
 	// Prepare a query
 	q := svc.dbx().From(goqu.T("cm_comments").As("c")).
@@ -215,6 +252,15 @@ func (svc *commentService) ListByDomain(domainID *uuid.UUID) ([]*models.Comment,
 		// Filter by page domain
 		Where(goqu.Ex{"p.domain_id": domainID})
 
+	// If there's a start time specified, only include comments that have changed after it
+	if since != nil {
+		q = q.Where(goqu.Or(
+			goqu.I("c.ts_created").Gt(*since),
+			goqu.I("c.ts_edited").Gt(*since),
+			goqu.I("c.ts_moderated").Gt(*since),
+			goqu.I("c.ts_deleted").Gt(*since)))
+	}
+
 	// Fetch the comments
 	var dbRecs []struct {
 		data.Comment
@@ -236,6 +282,85 @@ func (svc *commentService) ListByDomain(domainID *uuid.UUID) ([]*models.Comment,
 	return comments, nil
 }
 
+func (svc *commentService) ListByUser(userID *uuid.UUID) ([]*models.Comment, error) {
+	logger.Debugf("commentService.ListByUser(%s)", userID)
+
+	// Query the user's comments
+	var dbRecs []struct {
+		data.Comment
+		PagePath    string `db:"path"`
+		DomainHost  string `db:"host"`
+		DomainHTTPS bool   `db:"is_https"`
+	}
+	err := svc.dbx().From(goqu.T("cm_comments").As("c")).
+		Select("c.*", "p.path", "d.host", "d.is_https").
+		// Join comment pages
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+		// Join domain
+		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
+		// Filter by author
+		Where(goqu.Ex{"c.user_created": userID}).
+		Order(goqu.I("c.ts_created").Asc()).
+		ScanStructs(&dbRecs)
+	if err != nil {
+		return nil, translateDBErrors("commentService.ListByUser/ScanStructs", err)
+	}
+
+	// Convert models into DTOs
+	var comments []*models.Comment
+	for _, r := range dbRecs {
+		comments = append(comments, r.Comment.ToDTO(r.DomainHTTPS, r.DomainHost, r.PagePath))
+	}
+
+	// Succeeded
+	return comments, nil
+}
+
+func (svc *commentService) ListVotesByDomain(domainID *uuid.UUID, since *time.Time) ([]*data.CommentVote, error) {
+	logger.Debugf("commentService.ListVotesByDomain(%s, %v)", domainID, since)
+
+	// Prepare a query
+	q := svc.dbx().From(goqu.T("cm_comment_votes").As("v")).
+		Select("v.*").
+		// Join comments
+		Join(goqu.T("cm_comments").As("c"), goqu.On(goqu.Ex{"c.id": goqu.I("v.comment_id")})).
+		// Join comment pages
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+		// Filter by page domain
+		Where(goqu.Ex{"p.domain_id": domainID})
+
+	// If there's a start time specified, only include votes cast after it
+	if since != nil {
+		q = q.Where(goqu.I("v.ts_voted").Gt(*since))
+	}
+
+	// Fetch the votes
+	var vs []*data.CommentVote
+	if err := q.ScanStructs(&vs); err != nil {
+		return nil, translateDBErrors("commentService.ListVotesByDomain/ScanStructs", err)
+	}
+
+	// Succeeded
+	return vs, nil
+}
+
+func (svc *commentService) ListVotesByUser(userID *uuid.UUID) ([]*data.CommentVote, error) {
+	logger.Debugf("commentService.ListVotesByUser(%s)", userID)
+
+	// Query the user's votes
+	var vs []*data.CommentVote
+	err := svc.dbx().From("cm_comment_votes").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("ts_voted").Asc()).
+		ScanStructs(&vs)
+	if err != nil {
+		return nil, translateDBErrors("commentService.ListVotesByUser/ScanStructs", err)
+	}
+
+	// Succeeded
+	return vs, nil
+}
+
 func (svc *commentService) ListWithCommenters(curUser *data.User, curDomainUser *data.DomainUser,
 	domainID, pageID, authorUserID, replyToUserID *uuid.UUID,
 	inclApproved, inclPending, inclRejected, inclDeleted, removeOrphans bool,
@@ -549,6 +674,60 @@ func (svc *commentService) MoveToPage(sourcePageID, targetPageID *uuid.UUID) err
 	return nil
 }
 
+func (svc *commentService) Replace(comment *data.Comment) error {
+	logger.Debugf("commentService.Replace(%#v)", comment)
+
+	// Update the row in the database
+	err := persistence.ExecOne(
+		svc.dbx().Update("cm_comments").
+			Set(goqu.Record{
+				"parent_id":      comment.ParentID,
+				"page_id":        &comment.PageID,
+				"markdown":       comment.Markdown,
+				"html":           comment.HTML,
+				"score":          comment.Score,
+				"is_sticky":      comment.IsSticky,
+				"is_approved":    comment.IsApproved,
+				"is_pending":     comment.IsPending,
+				"is_deleted":     comment.IsDeleted,
+				"ts_created":     comment.CreatedTime,
+				"ts_moderated":   comment.ModeratedTime,
+				"ts_deleted":     comment.DeletedTime,
+				"ts_edited":      comment.EditedTime,
+				"user_created":   comment.UserCreated,
+				"user_moderated": comment.UserModerated,
+				"user_deleted":   comment.UserDeleted,
+				"user_edited":    comment.UserEdited,
+				"pending_reason": util.TruncateStr(comment.PendingReason, data.MaxPendingReasonLength),
+				"author_name":    comment.AuthorName,
+				"author_ip":      comment.AuthorIP,
+				"author_country": comment.AuthorCountry,
+			}).
+			Where(goqu.Ex{"id": &comment.ID}))
+	if err != nil {
+		return translateDBErrors("commentService.Replace/Update", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *commentService) SaveVote(vote *data.CommentVote) error {
+	logger.Debugf("commentService.SaveVote(%#v)", vote)
+
+	// Insert or update the vote
+	err := persistence.ExecOne(
+		svc.dbx().Insert("cm_comment_votes").
+			Rows(vote).
+			OnConflict(goqu.DoUpdate("comment_id, user_id", goqu.Record{"negative": vote.IsNegative, "ts_voted": vote.VotedTime})))
+	if err != nil {
+		return translateDBErrors("commentService.SaveVote/Insert", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
 func (svc *commentService) SetMarkdown(comment *data.Comment, markdown string, domainID, editedUserID *uuid.UUID) error {
 	logger.Debugf("commentService.SetMarkdown(%v, %q, %s, %s)", comment, markdown, domainID, editedUserID)
 
@@ -0,0 +1,107 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
+	"time"
+)
+
+// DomainInvitationService is a service interface for dealing with DomainInvitation objects
+type DomainInvitationService interface {
+	// Create persists a new invitation along with its token, revoking any pending invitation of the same email to the
+	// same domain
+	Create(inv *data.DomainInvitation, token *data.Token) error
+	// DeleteByDomainID revokes an invitation with the given ID to the given domain by deleting its token. Returns
+	// ErrNotFound if there's no such invitation
+	DeleteByDomainID(domainID, id *uuid.UUID) error
+	// FindByToken finds and returns a pending invitation by its token value. Returns ErrBadToken if there's no such
+	// invitation or it's expired
+	FindByToken(s string) (*data.DomainInvitation, error)
+	// ListByDomainID returns pending invitations to the given domain, sorted by email
+	ListByDomainID(domainID *uuid.UUID) ([]*data.DomainInvitation, error)
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// domainInvitationService is a blueprint DomainInvitationService implementation
+type domainInvitationService struct{ dbTxAware }
+
+func (svc *domainInvitationService) Create(inv *data.DomainInvitation, token *data.Token) error {
+	logger.Debugf("domainInvitationService.Create(%#v, ...)", inv)
+
+	// Revoke any earlier invitation of the same user by deleting its token
+	_, err := svc.dbx().Delete("cm_tokens").
+		Where(goqu.C("value").In(
+			svc.dbx().From("cm_domain_invitations").
+				Select("token_value").
+				Where(goqu.Ex{"domain_id": &inv.DomainID, "email": inv.Email}))).
+		Executor().Exec()
+	if err != nil {
+		return translateDBErrors("domainInvitationService.Create/Delete", err)
+	}
+
+	// Persist the token
+	if err := Services.TokenService(svc.tx).Create(token); err != nil {
+		return err
+	}
+
+	// Insert a new invitation record
+	if err := persistence.ExecOne(svc.dbx().Insert("cm_domain_invitations").Rows(inv)); err != nil {
+		return translateDBErrors("domainInvitationService.Create/Insert", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *domainInvitationService) DeleteByDomainID(domainID, id *uuid.UUID) error {
+	logger.Debugf("domainInvitationService.DeleteByDomainID(%s, %s)", domainID, id)
+
+	// Delete the token, which also deletes the invitation
+	err := persistence.ExecOne(svc.dbx().Delete("cm_tokens").
+		Where(goqu.C("value").In(
+			svc.dbx().From("cm_domain_invitations").
+				Select("token_value").
+				Where(goqu.Ex{"domain_id": domainID, "id": id}))))
+	if err != nil {
+		return translateDBErrors("domainInvitationService.DeleteByDomainID/Delete", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *domainInvitationService) FindByToken(s string) (*data.DomainInvitation, error) {
+	logger.Debugf("domainInvitationService.FindByToken(%x)", s)
+
+	// Query the invitation
+	var inv data.DomainInvitation
+	if b, err := svc.dbx().From("cm_domain_invitations").
+		Where(goqu.Ex{"token_value": s}, goqu.C("ts_expires").Gt(time.Now().UTC())).
+		ScanStruct(&inv); err != nil {
+		return nil, translateDBErrors("domainInvitationService.FindByToken/ScanStruct", err)
+	} else if !b {
+		return nil, ErrBadToken
+	}
+
+	// Succeeded
+	return &inv, nil
+}
+
+func (svc *domainInvitationService) ListByDomainID(domainID *uuid.UUID) ([]*data.DomainInvitation, error) {
+	logger.Debugf("domainInvitationService.ListByDomainID(%s)", domainID)
+
+	// Query the invitations
+	var invs []*data.DomainInvitation
+	if err := svc.dbx().From("cm_domain_invitations").
+		Where(goqu.Ex{"domain_id": domainID}, goqu.C("ts_expires").Gt(time.Now().UTC())).
+		Order(goqu.I("email").Asc()).
+		ScanStructs(&invs); err != nil {
+		return nil, translateDBErrors("domainInvitationService.ListByDomainID/ScanStructs", err)
+	}
+
+	// Succeeded
+	return invs, nil
+}
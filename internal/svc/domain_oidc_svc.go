@@ -0,0 +1,240 @@
+package svc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/markbates/goth"
+	"github.com/op/go-logging"
+	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
+	"gitlab.com/comentario/comentario/internal/util"
+	"time"
+)
+
+// ErrNoEncKey is returned when an operation requires encrypting or decrypting data, but no encryption secret is
+// configured
+var ErrNoEncKey = errors.New("services: encryption secret isn't configured")
+
+// DomainOIDCService is a service interface for dealing with DomainOIDCProvider objects
+type DomainOIDCService interface {
+	// Create persists a new domain OIDC provider, encrypting the given client secret
+	Create(p *data.DomainOIDCProvider, secret string) error
+	// DeleteByDomainID deletes a provider with the given ID, registered for the given domain. Returns ErrNotFound if
+	// there's no such provider
+	DeleteByDomainID(domainID, id *uuid.UUID) error
+	// FindByDomainID finds and returns a provider with the given ID, registered for the given domain
+	FindByDomainID(domainID, id *uuid.UUID) (*data.DomainOIDCProvider, error)
+	// FindByID finds and returns a provider by its ID
+	FindByID(id *uuid.UUID) (*data.DomainOIDCProvider, error)
+	// ListByDomainID returns OIDC providers registered for the given domain, sorted by name, optionally only the
+	// enabled ones
+	ListByDomainID(domainID *uuid.UUID, enabledOnly bool) ([]*data.DomainOIDCProvider, error)
+	// Provider returns a goth provider instance for the given domain OIDC provider
+	Provider(p *data.DomainOIDCProvider) (goth.Provider, error)
+	// Update updates the provider in the database. If secret isn't empty, the client secret gets replaced with it
+	Update(p *data.DomainOIDCProvider, secret string) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// domainOIDCClient is the HTTP client used for requests to domain OIDC providers
+var domainOIDCClient = util.PublicHTTPClient(util.OIDCRequestTimeout)
+
+// domainOIDCService is a blueprint DomainOIDCService implementation
+type domainOIDCService struct {
+	dbTxAware
+	cache *domainOIDCCache
+}
+
+func (svc *domainOIDCService) Create(p *data.DomainOIDCProvider, secret string) error {
+	logger.Debugf("domainOIDCService.Create(%#v, ...)", p)
+
+	// Encrypt the secret
+	if err := setDomainOIDCSecret(p, secret); err != nil {
+		return err
+	}
+
+	// Insert a new record
+	if err := persistence.ExecOne(svc.dbx().Insert("cm_domain_oidc_providers").Rows(p)); err != nil {
+		return translateDBErrors("domainOIDCService.Create/Insert", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *domainOIDCService) DeleteByDomainID(domainID, id *uuid.UUID) error {
+	logger.Debugf("domainOIDCService.DeleteByDomainID(%s, %s)", domainID, id)
+
+	// Delete the record
+	err := persistence.ExecOne(svc.dbx().Delete("cm_domain_oidc_providers").Where(goqu.Ex{"domain_id": domainID, "id": id}))
+	if err != nil {
+		return translateDBErrors("domainOIDCService.DeleteByDomainID/Delete", err)
+	}
+
+	// Drop any cached instance
+	svc.cache.c.Delete(*id)
+
+	// Succeeded
+	return nil
+}
+
+func (svc *domainOIDCService) FindByDomainID(domainID, id *uuid.UUID) (*data.DomainOIDCProvider, error) {
+	logger.Debugf("domainOIDCService.FindByDomainID(%s, %s)", domainID, id)
+	return svc.find(goqu.Ex{"domain_id": domainID, "id": id})
+}
+
+func (svc *domainOIDCService) FindByID(id *uuid.UUID) (*data.DomainOIDCProvider, error) {
+	logger.Debugf("domainOIDCService.FindByID(%s)", id)
+	return svc.find(goqu.Ex{"id": id})
+}
+
+func (svc *domainOIDCService) ListByDomainID(domainID *uuid.UUID, enabledOnly bool) ([]*data.DomainOIDCProvider, error) {
+	logger.Debugf("domainOIDCService.ListByDomainID(%s, %v)", domainID, enabledOnly)
+
+	// Prepare a query
+	q := svc.dbx().From("cm_domain_oidc_providers").Where(goqu.Ex{"domain_id": domainID}).Order(goqu.I("name").Asc())
+	if enabledOnly {
+		q = q.Where(goqu.Ex{"is_enabled": true})
+	}
+
+	// Query the providers
+	var ps []*data.DomainOIDCProvider
+	if err := q.ScanStructs(&ps); err != nil {
+		return nil, translateDBErrors("domainOIDCService.ListByDomainID/ScanStructs", err)
+	}
+
+	// Succeeded
+	return ps, nil
+}
+
+func (svc *domainOIDCService) Provider(p *data.DomainOIDCProvider) (goth.Provider, error) {
+	logger.Debugf("domainOIDCService.Provider(%s)", &p.ID)
+
+	// Try to find a cached instance. If the provider has been updated since it was cached (possibly by another
+	// instance of the server), discard it
+	if ci := svc.cache.c.Get(p.ID); ci != nil && ci.Value().updated.Equal(p.UpdatedTime) {
+		return ci.Value().provider, nil
+	}
+
+	// Cache miss: decrypt the client secret
+	secret, err := getDomainOIDCSecret(p)
+	if err != nil {
+		return nil, fmt.Errorf("domainOIDCService.Provider: %w", err)
+	}
+
+	// Instantiate a new provider, which also fetches its configuration via discovery. The provider URL is supplied by a
+	// domain owner, so only allow connecting to public addresses
+	op, err := config.NewOIDCProvider(p.QualifiedID(), p.URL, p.ClientID, string(secret), p.ScopeList(), domainOIDCClient)
+	if err != nil {
+		logger.Warningf("domainOIDCService.Provider: failed to instantiate provider %s: %v", &p.ID, err)
+		return nil, ErrResourceFetch
+	}
+
+	// Cache the instance
+	svc.cache.c.Set(p.ID, &domainOIDCCacheItem{provider: op, updated: p.UpdatedTime}, ttlcache.DefaultTTL)
+	return op, nil
+}
+
+func (svc *domainOIDCService) Update(p *data.DomainOIDCProvider, secret string) error {
+	logger.Debugf("domainOIDCService.Update(%#v, ...)", p)
+
+	// Replace the secret, if it's provided
+	if secret != "" {
+		if err := setDomainOIDCSecret(p, secret); err != nil {
+			return err
+		}
+	}
+
+	// Update the record
+	p.UpdatedTime = time.Now().UTC()
+	if err := persistence.ExecOne(svc.dbx().Update("cm_domain_oidc_providers").Set(p).Where(goqu.Ex{"id": &p.ID})); err != nil {
+		return translateDBErrors("domainOIDCService.Update/Update", err)
+	}
+
+	// Drop any cached instance
+	svc.cache.c.Delete(p.ID)
+
+	// Succeeded
+	return nil
+}
+
+// find finds and returns a provider matching the given expression
+func (svc *domainOIDCService) find(ex goqu.Ex) (*data.DomainOIDCProvider, error) {
+	var p data.DomainOIDCProvider
+	if b, err := svc.dbx().From("cm_domain_oidc_providers").Where(ex).ScanStruct(&p); err != nil {
+		return nil, translateDBErrors("domainOIDCService.find/ScanStruct", err)
+	} else if !b {
+		return nil, ErrNotFound
+	}
+
+	// Succeeded
+	return &p, nil
+}
+
+// getDomainOIDCSecret decrypts and returns the secret stored in the provider
+func getDomainOIDCSecret(p *data.DomainOIDCProvider) ([]byte, error) {
+	key := config.SecretsConfig.EncKey()
+	if key == nil {
+		return nil, ErrNoEncKey
+	}
+	b, err := util.DecryptAES(p.ClientSecret, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt client secret: %w", err)
+	}
+	return b, nil
+}
+
+// setDomainOIDCSecret encrypts the given secret and stores it in the provider
+func setDomainOIDCSecret(p *data.DomainOIDCProvider, secret string) error {
+	key := config.SecretsConfig.EncKey()
+	if key == nil {
+		return ErrNoEncKey
+	}
+	b, err := util.EncryptAES([]byte(secret), key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt client secret: %w", err)
+	}
+	p.ClientSecret = b
+	return nil
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// domainOIDCCacheItem is a goth provider instance, cached along with the update timestamp of the provider it was
+// created from
+type domainOIDCCacheItem struct {
+	provider goth.Provider // Provider instance
+	updated  time.Time     // UpdatedTime of the provider record
+}
+
+// domainOIDCCache is a cache of instantiated domain OIDC providers, which spares fetching their discovery documents on
+// every login
+type domainOIDCCache struct {
+	c *ttlcache.Cache[uuid.UUID, *domainOIDCCacheItem] // Cached items per provider ID
+}
+
+// newDomainOIDCCache creates a new domainOIDCCache
+func newDomainOIDCCache() *domainOIDCCache {
+	dc := &domainOIDCCache{
+		c: ttlcache.New[uuid.UUID, *domainOIDCCacheItem](
+			ttlcache.WithTTL[uuid.UUID, *domainOIDCCacheItem](util.OIDCProviderCacheTTL),
+		),
+	}
+
+	// Debug logging
+	if logger.IsEnabledFor(logging.DEBUG) {
+		dc.c.OnEviction(func(_ context.Context, reason ttlcache.EvictionReason, i *ttlcache.Item[uuid.UUID, *domainOIDCCacheItem]) {
+			logger.Debugf("domainOIDCCache: evicted %s, reason=%d", i.Key(), reason)
+		})
+	}
+
+	// Start the cache cleaner
+	go dc.c.Start()
+	return dc
+}
@@ -63,6 +63,9 @@ type DomainService interface {
 	// ListDomainFederatedIdPs fetches and returns a list of federated identity providers enabled for the domain with
 	// the given ID
 	ListDomainFederatedIdPs(domainID *uuid.UUID) ([]models.FederatedIdpID, error)
+	// ListDomainRoleRules fetches and returns role mapping rules of the domain with the given ID, in the order of
+	// evaluation
+	ListDomainRoleRules(domainID *uuid.UUID) ([]*data.DomainRoleRule, error)
 	// PurgeByID permanently removes specified comments for the specified domain by its ID.
 	//   - deleted indicates whether to remove comments marked as deleted
 	//   - userDeleted indicates whether to remove comments created by now deleted users
@@ -72,6 +75,8 @@ type DomainService interface {
 	SaveExtensions(domainID *uuid.UUID, extensions []*data.DomainExtension) error
 	// SaveIdPs saves domain's identity provider links
 	SaveIdPs(domainID *uuid.UUID, idps []models.FederatedIdpID) error
+	// SaveRoleRules replaces domain's role mapping rules with the given ones, numbering them in the given order
+	SaveRoleRules(domainID *uuid.UUID, rules []*data.DomainRoleRule) error
 	// SetReadonly sets the readonly status for the given domain
 	SetReadonly(domainID *uuid.UUID, readonly bool) error
 	// Update updates an existing domain record in the database
@@ -434,6 +439,20 @@ func (svc *domainService) ListDomainFederatedIdPs(domainID *uuid.UUID) ([]models
 	return res, nil
 }
 
+func (svc *domainService) ListDomainRoleRules(domainID *uuid.UUID) ([]*data.DomainRoleRule, error) {
+	logger.Debugf("domainService.ListDomainRoleRules(%s)", domainID)
+
+	// Query domain's rules
+	var rules []*data.DomainRoleRule
+	err := svc.dbx().From("cm_domain_role_rules").Where(goqu.Ex{"domain_id": domainID}).Order(goqu.I("seq").Asc()).ScanStructs(&rules)
+	if err != nil {
+		return nil, translateDBErrors("domainService.ListDomainRoleRules/ScanStructs", err)
+	}
+
+	// Succeeded
+	return rules, nil
+}
+
 func (svc *domainService) PurgeByID(id *uuid.UUID, deleted, userDeleted bool) (int64, error) {
 	logger.Debugf("domainService.PurgeByID(%s, %v, %v)", id, deleted, userDeleted)
 
@@ -525,6 +544,29 @@ func (svc *domainService) SaveIdPs(domainID *uuid.UUID, idps []models.FederatedI
 	return nil
 }
 
+func (svc *domainService) SaveRoleRules(domainID *uuid.UUID, rules []*data.DomainRoleRule) error {
+	logger.Debugf("domainService.SaveRoleRules(%s, %v)", domainID, rules)
+
+	// Delete any existing rules
+	if _, err := svc.dbx().Delete("cm_domain_role_rules").Where(goqu.Ex{"domain_id": domainID}).Executor().Exec(); err != nil {
+		return translateDBErrors("domainService.SaveRoleRules/Exec[delete]", err)
+	}
+
+	// Insert the rules, if any, numbering them sequentially
+	if len(rules) > 0 {
+		for i, r := range rules {
+			r.DomainID = *domainID
+			r.Seq = i
+		}
+		if _, err := svc.dbx().Insert("cm_domain_role_rules").Rows(rules).Executor().Exec(); err != nil {
+			return translateDBErrors("domainService.SaveRoleRules/Exec[insert]", err)
+		}
+	}
+
+	// Succeeded
+	return nil
+}
+
 func (svc *domainService) SetReadonly(domainID *uuid.UUID, readonly bool) error {
 	logger.Debugf("domainService.SetReadonly(%s, %v)", domainID, readonly)
 
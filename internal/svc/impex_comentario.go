@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/extend/intf"
 	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/util"
 	"strings"
@@ -53,6 +55,7 @@ type CommenterV1 struct {
 	IsModerator  bool      `json:"isModerator"`
 	JoinDate     time.Time `json:"joinDate"`
 	Name         string    `json:"name"`
+	PasswordHash string    `json:"passwordHash"` // Only present in exports made from a Commento database dump
 	Provider     string    `json:"provider"`
 	WebsiteURL   string    `json:"websiteUrl"`
 }
@@ -60,44 +63,176 @@ type CommenterV1 struct {
 const AnonymousCommenterHexIDV1 = HexIDV1("0000000000000000000000000000000000000000000000000000000000000000")
 
 //----------------------------------------------------------------------------------------------------------------------
-// V3 export format
+// V3/V4 export format
 //----------------------------------------------------------------------------------------------------------------------
 
-type comentarioExportV3 struct {
-	Version    int                  `json:"version"`
-	Pages      []*models.DomainPage `json:"pages"`
-	Comments   []*models.Comment    `json:"comments"`
-	Commenters []*models.Commenter  `json:"commenters"`
+// comentarioExportV4 is the native export format. It's a superset of V3, which only contained pages, comments, and
+// commenters, so it's used for unmarshalling both versions
+type comentarioExportV4 struct {
+	Version         int                              `json:"version"`
+	Since           *strfmt.DateTime                 `json:"since,omitempty"` // Start time of an incremental export, nil for a full one
+	Config          map[data.DynConfigItemKey]string `json:"config,omitempty"`
+	Extensions      []*comentarioExportExtension     `json:"extensions,omitempty"`
+	IdPs            []models.FederatedIdpID          `json:"idps,omitempty"`
+	Attributes      intf.AttrValues                  `json:"attributes,omitempty"`
+	Pages           []*models.DomainPage             `json:"pages"`
+	Comments        []*models.Comment                `json:"comments"`
+	Commenters      []*comentarioExportCommenter     `json:"commenters"`
+	Votes           []*comentarioExportVote          `json:"votes,omitempty"`
+	DeletedComments []*comentarioExportTombstone     `json:"deletedComments,omitempty"` // Only used in incremental exports
 }
 
-func comentarioExport(domainID *uuid.UUID) ([]byte, error) {
+// comentarioExportCommenter is a commenter extended with domain user properties (V4+). User attributes aren't part of
+// the export since they aren't domain-specific
+type comentarioExportCommenter struct {
+	*models.Commenter
+	IsOwner             bool  `json:"isOwner,omitempty"`
+	NotifyReplies       *bool `json:"notifyReplies,omitempty"`
+	NotifyModerator     *bool `json:"notifyModerator,omitempty"`
+	NotifyCommentStatus *bool `json:"notifyCommentStatus,omitempty"`
+}
+
+// comentarioExportExtension describes an extension enabled for the domain (V4+)
+type comentarioExportExtension struct {
+	ID     models.DomainExtensionID `json:"id"`
+	Config string                   `json:"config,omitempty"`
+}
+
+// comentarioExportVote describes a comment vote (V4+)
+type comentarioExportVote struct {
+	CommentID strfmt.UUID     `json:"commentId"`
+	UserID    strfmt.UUID     `json:"userId"`
+	Negative  bool            `json:"negative,omitempty"`
+	VotedTime strfmt.DateTime `json:"votedTime"`
+}
+
+// comentarioExportTombstone describes a comment deleted after the start time of an incremental export
+type comentarioExportTombstone struct {
+	ID          strfmt.UUID     `json:"id"`
+	DeletedTime strfmt.DateTime `json:"deletedTime"`
+	UserDeleted strfmt.UUID     `json:"userDeleted,omitempty"`
+}
+
+func comentarioExport(domainID *uuid.UUID, since *time.Time) ([]byte, error) {
 	// Create an export data object
-	exp := comentarioExportV3{Version: 3}
+	exp := comentarioExportV4{Version: 4}
+	if since != nil {
+		dt := strfmt.DateTime(*since)
+		exp.Since = &dt
+	}
 
-	// Fetch pages
-	if ps, err := Services.PageService(nil).ListByDomain(domainID); err != nil {
+	// Fetch domain configuration
+	if cfg, err := Services.DomainConfigService(nil).GetAll(domainID); err != nil {
 		return nil, err
 	} else {
-		exp.Pages = data.SliceToDTOs[*data.DomainPage, *models.DomainPage](ps)
+		exp.Config = make(map[data.DynConfigItemKey]string, len(cfg))
+		for key, item := range cfg {
+			exp.Config[key] = item.Value
+		}
+	}
+
+	// Fetch domain extensions
+	if des, err := Services.DomainService(nil).ListDomainExtensions(domainID); err != nil {
+		return nil, err
+	} else {
+		for _, de := range des {
+			exp.Extensions = append(exp.Extensions, &comentarioExportExtension{
+				ID:     de.ID,
+				Config: util.If(de.HasDefaultConfig(), "", de.Config),
+			})
+		}
+	}
+
+	// Fetch domain identity providers
+	if idps, err := Services.DomainService(nil).ListDomainFederatedIdPs(domainID); err != nil {
+		return nil, err
+	} else {
+		exp.IdPs = idps
+	}
+
+	// Fetch domain attributes
+	if attrs, err := Services.DomainAttrService(nil).GetAll(domainID); err != nil {
+		return nil, err
+	} else if len(attrs) > 0 {
+		exp.Attributes = attrs
 	}
 
 	// Fetch comments
-	if cs, err := Services.CommentService(nil).ListByDomain(domainID); err != nil {
+	refPageIDs := map[strfmt.UUID]bool{}
+	refUserIDs := map[strfmt.UUID]bool{}
+	if cs, err := Services.CommentService(nil).ListByDomain(domainID, since); err != nil {
+		return nil, err
+	} else {
+		for _, c := range cs {
+			// In an incremental export, deleted comments are only exported as tombstones
+			if since != nil && c.IsDeleted {
+				exp.DeletedComments = append(exp.DeletedComments, &comentarioExportTombstone{
+					ID:          c.ID,
+					DeletedTime: c.DeletedTime,
+					UserDeleted: c.UserDeleted,
+				})
+				refUserIDs[c.UserDeleted] = true
+				continue
+			}
+
+			// Collect references to pages and users
+			exp.Comments = append(exp.Comments, c)
+			refPageIDs[c.PageID] = true
+			refUserIDs[c.UserCreated] = true
+			refUserIDs[c.UserModerated] = true
+			refUserIDs[c.UserDeleted] = true
+			refUserIDs[c.UserEdited] = true
+		}
+	}
+
+	// Fetch votes
+	if vs, err := Services.CommentService(nil).ListVotesByDomain(domainID, since); err != nil {
 		return nil, err
 	} else {
-		exp.Comments = cs
+		for _, v := range vs {
+			uid := strfmt.UUID(v.UserID.String())
+			exp.Votes = append(exp.Votes, &comentarioExportVote{
+				CommentID: strfmt.UUID(v.CommentID.String()),
+				UserID:    uid,
+				Negative:  v.IsNegative,
+				VotedTime: strfmt.DateTime(v.VotedTime),
+			})
+			refUserIDs[uid] = true
+		}
 	}
 
-	// Fetch commenters
+	// Fetch pages. An incremental export only includes pages created since or referenced by the exported comments
+	if ps, err := Services.PageService(nil).ListByDomain(domainID); err != nil {
+		return nil, err
+	} else {
+		for _, p := range ps {
+			if since == nil || p.CreatedTime.After(*since) || refPageIDs[strfmt.UUID(p.ID.String())] {
+				exp.Pages = append(exp.Pages, p.ToDTO())
+			}
+		}
+	}
+
+	// Fetch commenters. An incremental export only includes users added since or referenced by the exported comments
+	// or votes
 	if um, dus, err := Services.UserService(nil).ListByDomain(domainID, false, "", "", data.SortAsc, -1); err != nil {
 		return nil, err
 	} else {
-		cs := make([]*models.Commenter, 0, len(dus))
+		cs := make([]*comentarioExportCommenter, 0, len(dus))
 		for _, du := range dus {
-			// Find the related user instance
+			// Skip irrelevant users in an incremental export
+			if since != nil && !du.CreatedTime.After(*since) && !refUserIDs[strfmt.UUID(du.UserID.String())] {
+				continue
+			}
+
+			// Find the related user instance and convert the User/DomainUser combo into a commenter
 			if u, ok := um[du.UserID]; ok {
-				// Convert the User/DomainUser combo into a commenter
-				cs = append(cs, u.ToCommenter(du.IsCommenter, du.IsModerator))
+				cs = append(cs, &comentarioExportCommenter{
+					Commenter:           u.ToCommenter(du.IsCommenter, du.IsModerator),
+					IsOwner:             du.IsOwner,
+					NotifyReplies:       &du.NotifyReplies,
+					NotifyModerator:     &du.NotifyModerator,
+					NotifyCommentStatus: &du.NotifyCommentStatus,
+				})
 			}
 		}
 		exp.Commenters = cs
@@ -134,8 +269,8 @@ func comentarioImport(curUser *data.User, domain *data.Domain, buf []byte) *Impo
 	case 1:
 		return comentarioImportV1(curUser, domain, buf)
 
-	case 3:
-		return comentarioImportV3(curUser, domain, buf)
+	case 3, 4:
+		return comentarioImportV3V4(curUser, domain, buf)
 
 	default:
 		// Unrecognised version
@@ -167,30 +302,45 @@ func comentarioImportV1(curUser *data.User, domain *data.Domain, buf []byte) *Im
 	for _, commenter := range exp.Commenters {
 		result.UsersTotal++
 
+		// A password hash can only be carried over from a Commento (bcrypt) hash, and only when a superuser runs the
+		// import: otherwise any domain owner could set up a working login for someone else's email. In the latter case
+		// the user isn't considered confirmed either
+		var pwdHash string
+		if commenter.Provider == "commento" && util.IsBcryptPasswordHash(commenter.PasswordHash) {
+			pwdHash = commenter.PasswordHash
+		}
+		trusted := pwdHash == "" || curUser.IsSuperuser
+
 		// Import the user and domain user
-		var user *data.User
-		if u, userAdded, domainUserAdded, err := importUserByEmail(
+		user, userAdded, domainUserAdded, err := importUserByEmail(
 			commenter.Email,
 			"", // Local auth only
 			commenter.Name,
 			commenter.WebsiteURL,
 			"Imported from Commento/Comentario",
-			true,
+			trusted,
 			false, // No SSO flag support in the export
 			&curUser.ID,
 			&domain.ID,
 			commenter.JoinDate,
-		); err != nil {
+		)
+		if err != nil {
 			return result.WithError(err)
-		} else {
-			user = u
+		}
 
-			// Increment user counters
-			if userAdded {
-				result.UsersAdded++
-			}
-			if domainUserAdded {
-				result.DomainUsersAdded++
+		// Increment user counters
+		if userAdded {
+			result.UsersAdded++
+		}
+		if domainUserAdded {
+			result.DomainUsersAdded++
+		}
+
+		// Carry over the password hash of a newly added local user. It gets upgraded to the current algorithm on the
+		// user's first login
+		if userAdded && pwdHash != "" && curUser.IsSuperuser {
+			if err := Services.UserService(nil).Persist(user.WithPasswordHash(pwdHash)); err != nil {
+				return result.WithError(err)
 			}
 		}
 
@@ -241,7 +391,7 @@ func comentarioImportV1(curUser *data.User, domain *data.Domain, buf []byte) *Im
 			pageID = id
 
 			// Page doesn't exist. Find or insert a page with this path
-		} else if page, added, err := Services.PageService(nil).UpsertByDomainPath(domain, pagePath, "", nil); err != nil {
+		} else if page, added, err := Services.PageService(nil).UpsertByDomainPath(domain, pagePath, "", nil, nil); err != nil {
 			return result.WithError(err)
 
 		} else {
@@ -315,16 +465,23 @@ func comentarioImportV1(curUser *data.User, domain *data.Domain, buf []byte) *Im
 	return result
 }
 
-func comentarioImportV3(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
-	// Unmarshal the data
-	var exp comentarioExportV3
+func comentarioImportV3V4(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
+	// Unmarshal the data. V4 is a superset of V3, so the same structure is used for both
+	var exp comentarioExportV4
 	if err := json.Unmarshal(buf, &exp); err != nil {
-		logger.Errorf("comentarioImportV3/Unmarshal: %v", err)
+		logger.Errorf("comentarioImportV3V4/Unmarshal: %v", err)
 		return importError(err)
 	}
 
 	result := &ImportResult{}
 
+	// Import domain settings, which are only available since V4
+	if exp.Version >= 4 {
+		if err := comentarioImportDomainSettings(curUser, domain, &exp); err != nil {
+			return result.WithError(err)
+		}
+	}
+
 	// Create a map of user IDs
 	commenterIDMap := map[strfmt.UUID]uuid.UUID{
 		strfmt.UUID(data.AnonymousUser.ID.String()): data.AnonymousUser.ID,
@@ -332,35 +489,46 @@ func comentarioImportV3(curUser *data.User, domain *data.Domain, buf []byte) *Im
 	for _, commenter := range exp.Commenters {
 		result.UsersTotal++
 
+		// Skip malformed entries
+		if commenter.Commenter == nil {
+			continue
+		}
+
 		// Import the user and domain user
-		var user *data.User
-		if u, userAdded, domainUserAdded, err := importUserByEmail(
+		user, userAdded, domainUserAdded, err := importUserByEmail(
 			string(commenter.Email),
 			string(commenter.FederatedIDP),
 			commenter.Name,
 			string(commenter.WebsiteURL),
-			"Imported from Comentario V3",
+			fmt.Sprintf("Imported from Comentario V%d", exp.Version),
 			true,
 			commenter.FederatedSso,
 			&curUser.ID,
 			&domain.ID,
 			time.Time(commenter.CreatedTime),
-		); err != nil {
+		)
+		if err != nil {
 			return result.WithError(err)
-		} else {
-			user = u
+		}
 
-			// Increment user counters
-			if userAdded {
-				result.UsersAdded++
-			}
-			if domainUserAdded {
-				result.DomainUsersAdded++
-			}
+		// Increment user counters
+		if userAdded {
+			result.UsersAdded++
+		}
+		if domainUserAdded {
+			result.DomainUsersAdded++
 		}
 
-		// Add the commenter's hex-to-ID mapping
+		// Add the commenter's ID mapping
 		commenterIDMap[commenter.ID] = user.ID
+
+		// Import domain user properties, which are only available since V4. Only apply them to a domain user just added
+		// by the import, so that the file can't alter existing memberships
+		if exp.Version >= 4 && domainUserAdded {
+			if err := comentarioImportCommenterV4(curUser, domain, user, commenter); err != nil {
+				return result.WithError(err)
+			}
+		}
 	}
 
 	// Create a map of page IDs
@@ -369,7 +537,7 @@ func comentarioImportV3(curUser *data.User, domain *data.Domain, buf []byte) *Im
 		result.PagesTotal++
 
 		// Find the page for the comment based on path
-		p, added, err := Services.PageService(nil).UpsertByDomainPath(domain, string(page.Path), page.Title, nil)
+		p, added, err := Services.PageService(nil).UpsertByDomainPath(domain, string(page.Path), page.Title, nil, nil)
 		if err != nil {
 			return result.WithError(err)
 
@@ -384,14 +552,52 @@ func comentarioImportV3(curUser *data.User, domain *data.Domain, buf []byte) *Im
 		}
 	}
 
-	// Prepare a map of comment IDs (randomly generated)
-	commentIDMap := make(map[strfmt.UUID]uuid.UUID, len(exp.Comments))
+	// Fetch comments already existing in the domain, to update them instead of creating duplicates
+	existingComments := map[strfmt.UUID]*models.Comment{}
+	if cs, err := Services.CommentService(nil).ListByDomain(&domain.ID, nil); err != nil {
+		return result.WithError(err)
+	} else {
+		for _, c := range cs {
+			existingComments[c.ID] = c
+		}
+	}
+
+	// Prepare a map of comment IDs. Existing comments retain their IDs, and so do new ones, unless the ID is invalid or
+	// already taken by a comment in another domain
+	commentIDMap := make(map[strfmt.UUID]uuid.UUID, len(exp.Comments)+len(existingComments))
+	for sid := range existingComments {
+		commentIDMap[sid] = uuid.MustParse(string(sid))
+	}
+	var newIDs []uuid.UUID
+	for _, c := range exp.Comments {
+		if _, ok := existingComments[c.ID]; ok {
+			continue
+		}
+		if id, err := uuid.Parse(string(c.ID)); err == nil {
+			newIDs = append(newIDs, id)
+		}
+	}
+	takenIDs, err := Services.CommentService(nil).FilterExistingIDs(newIDs)
+	if err != nil {
+		return result.WithError(err)
+	}
 	for _, c := range exp.Comments {
-		commentIDMap[c.ID] = uuid.New()
+		if _, ok := existingComments[c.ID]; ok {
+			continue
+		}
+		if id, err := uuid.Parse(string(c.ID)); err != nil || takenIDs[id] {
+			commentIDMap[c.ID] = uuid.New()
+		} else {
+			commentIDMap[c.ID] = id
+		}
 	}
 
-	// Create a map that groups comment lists by their parent ID
+	// Create a map that groups comment lists by their parent ID, counting the new comments
 	commentParentIDMap := map[uuid.UUID][]*data.Comment{}
+	countNew := 0
+
+	// Keep track of comment count changes per page
+	countsPerPage := map[uuid.UUID]int{}
 
 	// Iterate over all comments
 	for _, comment := range exp.Comments {
@@ -451,11 +657,32 @@ func comentarioImportV3(curUser *data.User, domain *data.Domain, buf []byte) *Im
 			CreatedTime:   time.Time(comment.CreatedTime),
 			ModeratedTime: data.ToNullDateTime(comment.ModeratedTime),
 			DeletedTime:   data.ToNullDateTime(comment.DeletedTime),
+			EditedTime:    data.ToNullDateTime(comment.EditedTime),
 			UserCreated:   uuid.NullUUID{UUID: uid, Valid: true},
 			UserModerated: umID,
 			UserDeleted:   udID,
 			UserEdited:    ueID,
+			PendingReason: comment.PendingReason,
 			AuthorName:    comment.AuthorName,
+			AuthorIP:      comment.AuthorIP,
+			AuthorCountry: comment.AuthorCountry,
+		}
+
+		// If the comment already exists, update it in place
+		if ec, ok := existingComments[comment.ID]; ok {
+			if err := Services.CommentService(nil).Replace(c); err != nil {
+				return result.WithError(err)
+			}
+			result.CommentsUpdated++
+
+			// Adjust the page counts, taking into account the comment may have been moved or (un)deleted
+			if !ec.IsDeleted {
+				countsPerPage[uuid.MustParse(string(ec.PageID))]--
+			}
+			if !c.IsDeleted {
+				countsPerPage[c.PageID]++
+			}
+			continue
 		}
 
 		// File it under the appropriate parent ID
@@ -464,23 +691,176 @@ func comentarioImportV3(curUser *data.User, domain *data.Domain, buf []byte) *Im
 		} else {
 			commentParentIDMap[pzID] = []*data.Comment{c}
 		}
+		countNew++
 	}
 
 	// Recurse the comment tree (map) to insert the comments in the right order (parents-to-children), starting with the
 	// root (= zero UUID)
-	countsPerPage := map[uuid.UUID]int{}
 	result.CommentsImported, result.CommentsNonDeleted, result.Error = insertCommentsForParent(util.ZeroUUID, commentParentIDMap, countsPerPage)
 
-	// Increase comment count on the domain, ignoring errors
-	_ = Services.DomainService(nil).IncrementCounts(&domain.ID, result.CommentsNonDeleted, 0)
+	// Also insert replies to comments that already exist in the domain
+	for pid := range commentParentIDMap {
+		if result.Error != nil {
+			break
+		}
+		if _, ok := existingComments[strfmt.UUID(pid.String())]; ok {
+			var cci, ccnd int
+			cci, ccnd, result.Error = insertCommentsForParent(pid, commentParentIDMap, countsPerPage)
+			result.CommentsImported += cci
+			result.CommentsNonDeleted += ccnd
+		}
+	}
 
-	// Increase comment counts on all pages
+	// New comments that couldn't be reached from the root or an existing comment (e.g. because their parent is missing
+	// from the export or the parent chain is circular) are skipped
+	if result.Error == nil {
+		result.CommentsSkipped += countNew - result.CommentsImported
+	}
+
+	// Import votes, skipping those referring to unknown comments or users
+	for _, v := range exp.Votes {
+		if result.Error != nil {
+			break
+		}
+		cid, ok := commentIDMap[v.CommentID]
+		if !ok {
+			continue
+		}
+		uid, ok := commenterIDMap[v.UserID]
+		if !ok || uid == data.AnonymousUser.ID {
+			continue
+		}
+		result.Error = Services.CommentService(nil).SaveVote(&data.CommentVote{
+			CommentID:  cid,
+			UserID:     uid,
+			IsNegative: v.Negative,
+			VotedTime:  time.Time(v.VotedTime),
+		})
+	}
+
+	// Apply tombstones by marking the corresponding existing comments deleted
+	for _, t := range exp.DeletedComments {
+		if result.Error != nil {
+			break
+		}
+
+		// Skip comments that don't exist or are already deleted
+		ec, ok := existingComments[t.ID]
+		if !ok || ec.IsDeleted {
+			continue
+		}
+
+		// Map the deleting user, falling back to the current one
+		udID, ok := commenterIDMap[t.UserDeleted]
+		if !ok {
+			udID = curUser.ID
+		}
+
+		// Mark the comment deleted
+		id := uuid.MustParse(string(t.ID))
+		if result.Error = Services.CommentService(nil).MarkDeleted(&id, &udID); result.Error == nil {
+			result.CommentsDeleted++
+			countsPerPage[uuid.MustParse(string(ec.PageID))]--
+		}
+	}
+
+	// Update comment counts on all pages, ignoring errors
+	countDomain := 0
 	for pageID, pc := range countsPerPage {
-		if pc > 0 {
+		if pc != 0 {
 			_ = Services.PageService(nil).IncrementCounts(&pageID, pc, 0)
+			countDomain += pc
 		}
 	}
 
+	// Update comment count on the domain, ignoring errors
+	if countDomain != 0 {
+		_ = Services.DomainService(nil).IncrementCounts(&domain.ID, countDomain, 0)
+	}
+
 	// Succeeded
 	return result
 }
+
+// comentarioImportCommenterV4 applies the domain user properties of the given V4 commenter to the corresponding domain
+// user. Roles are only imported if the current user is a superuser, otherwise the new domain user stays a commenter.
+// The current user's domain roles are left intact to prevent them from locking themselves out of the domain
+func comentarioImportCommenterV4(curUser *data.User, domain *data.Domain, user *data.User, commenter *comentarioExportCommenter) error {
+	// Skip the current and anonymous users
+	if user.ID == curUser.ID || user.IsAnonymous() {
+		return nil
+	}
+
+	// Update domain user roles and notification flags
+	_, du, err := Services.DomainService(nil).FindDomainUserByID(&domain.ID, &user.ID, true)
+	if err != nil {
+		return err
+	}
+	if curUser.IsSuperuser {
+		du.IsOwner = commenter.IsOwner
+		du.IsModerator = commenter.IsOwner || commenter.IsModerator
+		du.IsCommenter = du.IsModerator || commenter.IsCommenter
+	}
+	du.NotifyReplies = util.If(commenter.NotifyReplies == nil, du.NotifyReplies, *commenter.NotifyReplies)
+	du.NotifyModerator = util.If(commenter.NotifyModerator == nil, du.NotifyModerator, *commenter.NotifyModerator)
+	du.NotifyCommentStatus = util.If(commenter.NotifyCommentStatus == nil, du.NotifyCommentStatus, *commenter.NotifyCommentStatus)
+	return Services.DomainService(nil).UserModify(du)
+}
+
+// comentarioImportDomainSettings applies the domain configuration, extensions, identity providers, and attributes
+// contained in the given V4 export to the specified domain
+func comentarioImportDomainSettings(curUser *data.User, domain *data.Domain, exp *comentarioExportV4) error {
+	// Import configuration, skipping any invalid items
+	if len(exp.Config) > 0 {
+		vals := make(map[data.DynConfigItemKey]string, len(exp.Config))
+		for key, value := range exp.Config {
+			if err := Services.DomainConfigService(nil).ValidateKeyValue(string(key), value); err != nil {
+				logger.Warningf("comentarioImportDomainSettings: skipping config item: %v", err)
+				continue
+			}
+			vals[key] = value
+		}
+		if err := Services.DomainConfigService(nil).Update(&domain.ID, &curUser.ID, vals); err != nil {
+			return err
+		}
+	}
+
+	// Import extensions, only keeping those known and enabled globally
+	var des []*data.DomainExtension
+	for _, e := range exp.Extensions {
+		if ext, ok := data.DomainExtensions[e.ID]; ok && ext.Enabled {
+			des = append(des, &data.DomainExtension{
+				ID:          e.ID,
+				Name:        ext.Name,
+				Config:      util.If(e.Config == "", ext.Config, e.Config),
+				KeyRequired: ext.KeyRequired,
+				KeyProvided: ext.KeyProvided,
+				Enabled:     true,
+			})
+		}
+	}
+	if err := Services.DomainService(nil).SaveExtensions(&domain.ID, des); err != nil {
+		return err
+	}
+
+	// Import identity providers, only keeping those enabled globally
+	var idps []models.FederatedIdpID
+	for _, id := range exp.IdPs {
+		if _, ok, _, _ := config.GetFederatedIdP(id); ok {
+			idps = append(idps, id)
+		}
+	}
+	if err := Services.DomainService(nil).SaveIdPs(&domain.ID, idps); err != nil {
+		return err
+	}
+
+	// Import domain attributes, if any
+	if len(exp.Attributes) > 0 {
+		if err := Services.DomainAttrService(nil).Set(&domain.ID, exp.Attributes); err != nil {
+			return err
+		}
+	}
+
+	// Succeeded
+	return nil
+}
@@ -132,7 +132,7 @@ func disqusImport(curUser *data.User, domain *data.Domain, buf []byte) *ImportRe
 			pageID = id
 
 			// Page doesn't exist. Find or insert a page with this path
-		} else if page, added, err := Services.PageService(nil).UpsertByDomainPath(domain, u.Path, thread.Title, nil); err != nil {
+		} else if page, added, err := Services.PageService(nil).UpsertByDomainPath(domain, u.Path, thread.Title, nil, nil); err != nil {
 			return result.WithError(err)
 
 		} else {
@@ -19,6 +19,8 @@ type ImportResult struct {
 	CommentsImported   int   // Number of imported comments
 	CommentsSkipped    int   // Number of skipped comments
 	CommentsNonDeleted int   // Number of non-deleted imported comments
+	CommentsUpdated    int   // Number of existing comments updated
+	CommentsDeleted    int   // Number of existing comments marked deleted
 	Error              error // Any error occurred during the import
 }
 
@@ -27,8 +29,10 @@ func (ir *ImportResult) ToDTO() *models.ImportResult {
 	dto := &models.ImportResult{
 		CommentsImported:   uint64(ir.CommentsImported),
 		CommentsNonDeleted: uint64(ir.CommentsNonDeleted),
+		CommentsDeleted:    uint64(ir.CommentsDeleted),
 		CommentsSkipped:    uint64(ir.CommentsSkipped),
 		CommentsTotal:      uint64(ir.CommentsTotal),
+		CommentsUpdated:    uint64(ir.CommentsUpdated),
 		DomainUsersAdded:   uint64(ir.DomainUsersAdded),
 		PagesAdded:         uint64(ir.PagesAdded),
 		PagesTotal:         uint64(ir.PagesTotal),
@@ -51,8 +55,13 @@ func (ir *ImportResult) WithError(err error) *ImportResult {
 
 // ImportExportService is a service interface for dealing with data import/export
 type ImportExportService interface {
-	// Export exports the data for the specified domain, returning gzip-compressed binary data
-	Export(domainID *uuid.UUID) ([]byte, error)
+	// Export exports the data for the specified domain, returning gzip-compressed binary data. If since is provided,
+	// the export is incremental, i.e. only includes comments created or changed after that moment, along with the pages
+	// and commenters they refer to, and tombstones for comments deleted since then
+	Export(domainID *uuid.UUID, since *time.Time) ([]byte, error)
+	// ExportUser exports all personal data of the given user (profile, attributes, avatar, sessions, domain
+	// memberships, comments, and votes), returning gzip-compressed binary data
+	ExportUser(user *data.User) ([]byte, error)
 	// Import performs data import in the native Comentario (or legacy Commento v1/Comentario v2) format from the
 	// provided data. Returns the number of imported comments: total and non-deleted
 	Import(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult
@@ -74,9 +83,14 @@ func importError(err error) *ImportResult {
 	return &ImportResult{Error: err}
 }
 
-func (svc *importExportService) Export(domainID *uuid.UUID) ([]byte, error) {
-	logger.Debugf("importExportService.Export(%s)", domainID)
-	return comentarioExport(domainID)
+func (svc *importExportService) Export(domainID *uuid.UUID, since *time.Time) ([]byte, error) {
+	logger.Debugf("importExportService.Export(%s, %v)", domainID, since)
+	return comentarioExport(domainID, since)
+}
+
+func (svc *importExportService) ExportUser(user *data.User) ([]byte, error) {
+	logger.Debugf("importExportService.ExportUser(%s)", &user.ID)
+	return userDataExport(user)
 }
 
 func (svc *importExportService) Import(curUser *data.User, domain *data.Domain, buf []byte) *ImportResult {
@@ -0,0 +1,119 @@
+package svc
+
+import (
+	"encoding/json"
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/extend/intf"
+	"gitlab.com/comentario/comentario/internal/api/models"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/util"
+	"time"
+)
+
+// userExport is the personal data export of a single user
+type userExport struct {
+	Version    int                     `json:"version"`
+	ExportTime strfmt.DateTime         `json:"exportTime"`
+	Profile    *models.User            `json:"profile"`
+	Attributes intf.AttrValues         `json:"attributes,omitempty"`
+	Avatar     []byte                  `json:"avatar,omitempty"` // Largest avatar image, as a base64-encoded JPEG
+	Sessions   []*models.UserSession   `json:"sessions"`
+	Domains    []*userExportDomainUser `json:"domains"`
+	Comments   []*models.Comment       `json:"comments"`
+	Votes      []*userExportVote       `json:"votes"`
+}
+
+// userExportDomainUser is a user's membership in a domain
+type userExportDomainUser struct {
+	*models.DomainUser
+	Host string `json:"host"`
+}
+
+// userExportVote is a comment vote cast by the user
+type userExportVote struct {
+	CommentID strfmt.UUID     `json:"commentId"`
+	Negative  bool            `json:"negative,omitempty"`
+	VotedTime strfmt.DateTime `json:"votedTime"`
+}
+
+// userDataExport collects all personal data of the given user, returning it as gzip-compressed JSON
+func userDataExport(user *data.User) ([]byte, error) {
+	exp := userExport{Version: 1, ExportTime: strfmt.DateTime(time.Now().UTC()), Profile: user.ToDTO()}
+
+	// Remarks are internal notes of the administrators rather than the user's data
+	exp.Profile.Remarks = ""
+
+	// Fetch user attributes
+	if attrs, err := Services.UserAttrService(nil).GetAll(&user.ID); err != nil {
+		return nil, err
+	} else if len(attrs) > 0 {
+		exp.Attributes = attrs
+	}
+
+	// Fetch the avatar, if any
+	if ua, err := Services.AvatarService(nil).GetByUserID(&user.ID); err != nil {
+		return nil, err
+	} else if ua != nil {
+		exp.Avatar = ua.Get(data.UserAvatarSizeL)
+	}
+
+	// Fetch user sessions
+	if ss, err := Services.UserService(nil).ListUserSessions(&user.ID, -1); err != nil {
+		return nil, err
+	} else {
+		exp.Sessions = data.SliceToDTOs[*data.UserSession, *models.UserSession](ss)
+	}
+
+	// Fetch domain memberships
+	if ds, dus, err := Services.DomainService(nil).ListByDomainUser(&user.ID, &user.ID, true, true, "", "", data.SortAsc, -1); err != nil {
+		return nil, err
+	} else {
+		hosts := make(map[uuid.UUID]string, len(ds))
+		for _, d := range ds {
+			hosts[d.ID] = d.Host
+		}
+		exp.Domains = make([]*userExportDomainUser, 0, len(dus))
+		for _, du := range dus {
+			exp.Domains = append(exp.Domains, &userExportDomainUser{DomainUser: du.ToDTO(), Host: hosts[du.DomainID]})
+		}
+	}
+
+	// Fetch comments
+	if cs, err := Services.CommentService(nil).ListByUser(&user.ID); err != nil {
+		return nil, err
+	} else {
+		exp.Comments = cs
+	}
+
+	// Fetch votes
+	if vs, err := Services.CommentService(nil).ListVotesByUser(&user.ID); err != nil {
+		return nil, err
+	} else {
+		exp.Votes = make([]*userExportVote, 0, len(vs))
+		for _, v := range vs {
+			exp.Votes = append(exp.Votes, &userExportVote{
+				CommentID: strfmt.UUID(v.CommentID.String()),
+				Negative:  v.IsNegative,
+				VotedTime: strfmt.DateTime(v.VotedTime),
+			})
+		}
+	}
+
+	// Convert the data into JSON
+	jsonData, err := json.Marshal(exp)
+	if err != nil {
+		logger.Errorf("userDataExport/Marshal: %v", err)
+		return nil, err
+	}
+
+	// Compress the JSON data with Gzip
+	gzippedData, err := util.CompressGzip(jsonData)
+	if err != nil {
+		logger.Errorf("userDataExport/CompressGzip: %v", err)
+		return nil, err
+	}
+
+	// Succeeded
+	return gzippedData, nil
+}
@@ -97,7 +97,7 @@ func wordpressImport(curUser *data.User, domain *data.Domain, buf []byte) *Impor
 				pageID = id
 
 				// Page doesn't exist. Find or insert a page with this path
-			} else if page, added, err := Services.PageService(nil).UpsertByDomainPath(domain, u.Path, post.Title, nil); err != nil {
+			} else if page, added, err := Services.PageService(nil).UpsertByDomainPath(domain, u.Path, post.Title, nil, nil); err != nil {
 				return result.WithError(err)
 
 			} else {
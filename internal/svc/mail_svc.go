@@ -11,7 +11,9 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type MailNotificationKind string
@@ -24,14 +26,23 @@ const (
 
 // MailService is a service interface for sending mails
 type MailService interface {
+	// NumFailures returns the number of emails that failed to be sent since the service has been started
+	NumFailures() int64
 	// SendCommentNotification sends an email notification about a comment to the given recipient
 	SendCommentNotification(kind MailNotificationKind, recipient *data.User, canModerate bool, domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenterName string) error
 	// SendConfirmEmail sends an email with a confirmation link
 	SendConfirmEmail(user *data.User, token *data.Token) error
+	// SendDataExport sends an email with a link for downloading the user's personal data export
+	SendDataExport(user *data.User, token *data.Token) error
+	// SendDomainInvitation sends an email inviting the recipient, identified by their email, language, and name, to join
+	// the given domain
+	SendDomainInvitation(lang, email, name string, inviter *data.User, domain *data.Domain, token *data.Token) error
 	// SendEmailUpdateConfirmEmail sends an email for changing the given user's email address
 	SendEmailUpdateConfirmEmail(user *data.User, token *data.Token, newEmail string, hmacSignature []byte) error
 	// SendPasswordReset sends an email with a password reset link
 	SendPasswordReset(user *data.User, token *data.Token) error
+	// SendUnusualLogin notifies the user about a login that looks unusual, providing a link for revoking the session
+	SendUnusualLogin(user *data.User, us *data.UserSession, token *data.Token) error
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -47,6 +58,11 @@ func newMailService() *mailService {
 type mailService struct {
 	templates map[string]*template.Template // Template cache
 	templMu   sync.RWMutex                  // Template cache mutex
+	numFails  atomic.Int64                  // Number of failed send attempts
+}
+
+func (svc *mailService) NumFailures() int64 {
+	return svc.numFails.Load()
 }
 
 func (svc *mailService) SendCommentNotification(kind MailNotificationKind, recipient *data.User, canModerate bool, domain *data.Domain, page *data.DomainPage, comment *data.Comment, commenterName string) error {
@@ -139,6 +155,47 @@ func (svc *mailService) SendConfirmEmail(user *data.User, token *data.Token) err
 		})
 }
 
+func (svc *mailService) SendDataExport(user *data.User, token *data.Token) error {
+	i18n := Services.I18nService()
+	t := func(id string) string { return i18n.Translate(user.LangID, id) }
+	return svc.sendFromTemplate(
+		user.LangID,
+		"",
+		user.Email,
+		t("yourDataExport"),
+		"action.gohtml",
+		map[string]any{
+			"ActionAct":     t("dataExportAct"),
+			"ActionButton":  t("actionDownloadYourData"),
+			"ActionRequest": t("dataExportRequest"),
+			"ActionURL":     config.ServerConfig.URLForAPI("user/data-export", map[string]string{"access_token": token.Value}),
+			"EmailReason":   t("dataExportExplanation") + " " + t("ignoreEmail"),
+			"Title":         t("yourDataExport"),
+			"UserName":      user.Name,
+		})
+}
+
+func (svc *mailService) SendDomainInvitation(lang, email, name string, inviter *data.User, domain *data.Domain, token *data.Token) error {
+	i18n := Services.I18nService()
+	t := func(id string, args ...reflect.Value) string { return i18n.Translate(lang, id, args...) }
+	title := t("youAreInvited", reflect.ValueOf(domain.Host))
+	return svc.sendFromTemplate(
+		lang,
+		"",
+		email,
+		title,
+		"action.gohtml",
+		map[string]any{
+			"ActionAct":     t("domainInvitationAct"),
+			"ActionButton":  t("actionAcceptInvitation"),
+			"ActionRequest": t("domainInvitationRequest", reflect.ValueOf(inviter.Name), reflect.ValueOf(domain.Host)),
+			"ActionURL":     i18n.FrontendURL(lang, "", map[string]string{"invitationToken": token.Value}),
+			"EmailReason":   t("domainInvitationExpl"),
+			"Title":         title,
+			"UserName":      name,
+		})
+}
+
 func (svc *mailService) SendEmailUpdateConfirmEmail(user *data.User, token *data.Token, newEmail string, hmacSignature []byte) error {
 	i18n := Services.I18nService()
 	t := func(id string) string { return i18n.Translate(user.LangID, id) }
@@ -185,6 +242,39 @@ func (svc *mailService) SendPasswordReset(user *data.User, token *data.Token) er
 		})
 }
 
+func (svc *mailService) SendUnusualLogin(user *data.User, us *data.UserSession, token *data.Token) error {
+	i18n := Services.I18nService()
+	t := func(id string, args ...reflect.Value) string { return i18n.Translate(user.LangID, id, args...) }
+
+	// Describe the session
+	country := us.Country
+	if country == "" {
+		country = t("unknownCountry")
+	}
+	return svc.sendFromTemplate(
+		user.LangID,
+		"",
+		user.Email,
+		t("unusualLogin"),
+		"action.gohtml",
+		map[string]any{
+			"ActionAct":    t("unusualLoginAct"),
+			"ActionButton": t("actionThisWasntMe"),
+			"ActionRequest": t(
+				"unusualLoginRequest",
+				reflect.ValueOf(strings.TrimSpace(us.BrowserName+" "+us.BrowserVersion)),
+				reflect.ValueOf(strings.TrimSpace(us.OSName+" "+us.OSVersion)),
+				reflect.ValueOf(country)),
+			"ActionURL": i18n.FrontendURL(
+				user.LangID,
+				"",
+				map[string]string{"loginRevokeToken": token.Value, "session": us.ID.String()}),
+			"EmailReason": t("unusualLoginExpl"),
+			"Title":       t("unusualLogin"),
+			"UserName":    user.Name,
+		})
+}
+
 // getTemplate returns a cached template by its language and name, or nil if there's none
 func (svc *mailService) getTemplate(lang, name string) *template.Template {
 	svc.templMu.RLock()
@@ -254,6 +344,7 @@ func (svc *mailService) send(replyTo, recipient, subject, htmlMessage string, em
 	// Send a new mail
 	err := util.TheMailer.Mail(replyTo, recipient, subject, htmlMessage, embedFiles...)
 	if err != nil {
+		svc.numFails.Add(1)
 		logger.Warningf("Failed to send email to %s: %v", recipient, err)
 	} else {
 		logger.Debugf("Successfully sent an email to '%s'", recipient)
@@ -5,8 +5,10 @@ import (
 	"github.com/doug-martin/goqu/v9/exp"
 	xintf "gitlab.com/comentario/comentario/extend/intf"
 	"gitlab.com/comentario/comentario/internal/config"
+	"gitlab.com/comentario/comentario/internal/data"
 	"gitlab.com/comentario/comentario/internal/intf"
 	"gitlab.com/comentario/comentario/internal/persistence"
+	"os"
 	"sync"
 )
 
@@ -30,18 +32,26 @@ type ServiceManager interface {
 	// Shutdown performs necessary teardown of the services
 	Shutdown()
 
+	// APITokenService returns an instance of APITokenService
+	APITokenService(tx *persistence.DatabaseTx) APITokenService
 	// AuthService returns an instance of AuthService
 	AuthService(tx *persistence.DatabaseTx) AuthService
 	// AuthSessionService returns an instance of AuthSessionService
 	AuthSessionService(tx *persistence.DatabaseTx) AuthSessionService
 	// AvatarService returns an instance of AvatarService
 	AvatarService(tx *persistence.DatabaseTx) AvatarService
+	// BackupService returns an instance of BackupService
+	BackupService(tx *persistence.DatabaseTx) BackupService
 	// CommentService returns an instance of CommentService
 	CommentService(tx *persistence.DatabaseTx) CommentService
 	// DomainAttrService returns an instance of an plugin.AttrStore for domains
 	DomainAttrService(tx *persistence.DatabaseTx) xintf.AttrStore
 	// DomainConfigService returns an instance of DomainConfigService
 	DomainConfigService(tx *persistence.DatabaseTx) DomainConfigService
+	// DomainInvitationService returns an instance of DomainInvitationService
+	DomainInvitationService(tx *persistence.DatabaseTx) DomainInvitationService
+	// DomainOIDCService returns an instance of DomainOIDCService
+	DomainOIDCService(tx *persistence.DatabaseTx) DomainOIDCService
 	// DomainService returns an instance of DomainService
 	DomainService(tx *persistence.DatabaseTx) DomainService
 	// DynConfigService returns an instance of DynConfigService
@@ -54,10 +64,14 @@ type ServiceManager interface {
 	ImportExportService(tx *persistence.DatabaseTx) ImportExportService
 	// MailService returns an instance of MailService
 	MailService() MailService
+	// MetricsService returns an instance of MetricsService
+	MetricsService() MetricsService
 	// PageService returns an instance of PageService
 	PageService(tx *persistence.DatabaseTx) PageService
 	// PageTitleFetcher returns an instance of PageTitleFetcher
 	PageTitleFetcher() PageTitleFetcher
+	// PasskeyService returns an instance of PasskeyService
+	PasskeyService(tx *persistence.DatabaseTx) PasskeyService
 	// PerlustrationService returns an instance of PerlustrationService
 	PerlustrationService() PerlustrationService
 	// PluginManager returns an instance of PluginManager
@@ -68,6 +82,9 @@ type ServiceManager interface {
 	StatsService(tx *persistence.DatabaseTx) StatsService
 	// TokenService returns an instance of TokenService
 	TokenService(tx *persistence.DatabaseTx) TokenService
+	// TruncateDateTime returns an expression for truncating the given datetime database table column to the start of a
+	// stats bucket with the given granularity
+	TruncateDateTime(col string, g data.StatsGranularity) exp.LiteralExpression
 	// UserService returns an instance of UserService
 	UserService(tx *persistence.DatabaseTx) UserService
 	// UserAttrService returns an instance of an plugin.AttrStore for users
@@ -111,6 +128,7 @@ type serviceManager struct {
 	ptfMu       sync.Mutex            // Mutex for ptf
 	cleanSvc    CleanupService        // Cleanup service singleton
 	domCfgCache *domainConfigCache    // Domain config cache singleton
+	domOIDCache *domainOIDCCache      // Domain OIDC provider cache singleton
 	dynCfgSvc   DynConfigService      // Dynamic config service singleton
 	i18nSvc     I18nService           // I18n service singleton
 	mailSvc     MailService           // Mail service singleton
@@ -125,6 +143,7 @@ type serviceManager struct {
 func newServiceManager() *serviceManager {
 	return &serviceManager{
 		domCfgCache: newDomainConfigCache(),
+		domOIDCache: newDomainOIDCCache(),
 		i18nSvc:     newI18nService(),
 		mailSvc:     newMailService(),
 		perlSvc:     &perlustrationService{},
@@ -145,6 +164,10 @@ func (m *serviceManager) GravatarProcessor() GravatarProcessor {
 	return m.gp
 }
 
+func (m *serviceManager) APITokenService(tx *persistence.DatabaseTx) APITokenService {
+	return &apiTokenService{dbTxAware{tx: tx, db: m.db}}
+}
+
 func (m *serviceManager) AuthService(tx *persistence.DatabaseTx) AuthService {
 	return &authService{dbTxAware{tx: tx, db: m.db}}
 }
@@ -157,6 +180,10 @@ func (m *serviceManager) AvatarService(tx *persistence.DatabaseTx) AvatarService
 	return &avatarService{dbTxAware{tx: tx, db: m.db}}
 }
 
+func (m *serviceManager) BackupService(tx *persistence.DatabaseTx) BackupService {
+	return &backupService{dbTxAware: dbTxAware{tx: tx, db: m.db}}
+}
+
 func (m *serviceManager) CommentService(tx *persistence.DatabaseTx) CommentService {
 	return &commentService{dbTxAware{tx: tx, db: m.db}}
 }
@@ -177,6 +204,14 @@ func (m *serviceManager) DomainConfigService(tx *persistence.DatabaseTx) DomainC
 	return newDomainConfigService(m.domCfgCache, tx, m.db)
 }
 
+func (m *serviceManager) DomainInvitationService(tx *persistence.DatabaseTx) DomainInvitationService {
+	return &domainInvitationService{dbTxAware{tx: tx, db: m.db}}
+}
+
+func (m *serviceManager) DomainOIDCService(tx *persistence.DatabaseTx) DomainOIDCService {
+	return &domainOIDCService{dbTxAware: dbTxAware{tx: tx, db: m.db}, cache: m.domOIDCache}
+}
+
 func (m *serviceManager) DomainService(tx *persistence.DatabaseTx) DomainService {
 	return &domainService{dbTxAware{tx: tx, db: m.db}}
 }
@@ -208,6 +243,14 @@ func (m *serviceManager) E2eRecreateDBSchema(seedSQL string) error {
 		return err
 	}
 
+	// Roll up the seeded stats
+	if err := m.WithTx(func(tx *persistence.DatabaseTx) error {
+		_, err := m.StatsService(tx).Rollup()
+		return err
+	}); err != nil {
+		return err
+	}
+
 	// Succeeded
 	return nil
 }
@@ -246,6 +289,15 @@ func (m *serviceManager) Initialise() {
 		logger.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// If a backup or a restore is requested, run it and exit
+	if config.ServerConfig.BackupFile != "" || config.ServerConfig.RestoreFile != "" {
+		if err := m.runBackupRestore(); err != nil {
+			logger.Fatalf("Backup/restore failed: %v", err)
+		}
+		_ = m.db.Shutdown()
+		os.Exit(0)
+	}
+
 	// Run post-init tasks
 	if err := m.postDBInit(); err != nil {
 		logger.Fatalf("Post-DB-init tasks failed: %v", err)
@@ -257,10 +309,53 @@ func (m *serviceManager) Initialise() {
 	}
 }
 
+// runBackupRestore backs up the instance into, or restores it from the file specified in the configuration
+func (m *serviceManager) runBackupRestore() error {
+	// Backup
+	if fn := config.ServerConfig.BackupFile; fn != "" {
+		logger.Infof("Backing up the instance into %s", fn)
+		// The backup contains credentials, so make it only accessible to the owner
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		err = m.WithTx(func(tx *persistence.DatabaseTx) error {
+			return m.BackupService(tx).Backup(f, config.ServerConfig.BackupSessions)
+		})
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		if err == nil {
+			logger.Info("Backup completed successfully")
+		}
+		return err
+	}
+
+	// Restore
+	fn := config.ServerConfig.RestoreFile
+	logger.Infof("Restoring the instance from %s", fn)
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := m.WithTx(func(tx *persistence.DatabaseTx) error { return m.BackupService(tx).Restore(f) }); err != nil {
+		return err
+	}
+
+	// Succeeded
+	logger.Info("Restore completed successfully")
+	return nil
+}
+
 func (m *serviceManager) MailService() MailService {
 	return m.mailSvc
 }
 
+func (m *serviceManager) MetricsService() MetricsService {
+	return &metricsService{dbTxAware: dbTxAware{db: m.db}, mailSvc: m.mailSvc, wsSvc: m.wsSvc}
+}
+
 func (m *serviceManager) PageService(tx *persistence.DatabaseTx) PageService {
 	return &pageService{dbTxAware{tx: tx, db: m.db}}
 }
@@ -274,6 +369,10 @@ func (m *serviceManager) PageTitleFetcher() PageTitleFetcher {
 	return m.ptf
 }
 
+func (m *serviceManager) PasskeyService(tx *persistence.DatabaseTx) PasskeyService {
+	return &passkeyService{dbTxAware{tx: tx, db: m.db}}
+}
+
 func (m *serviceManager) PerlustrationService() PerlustrationService {
 	return m.perlSvc
 }
@@ -331,6 +430,10 @@ func (m *serviceManager) TokenService(tx *persistence.DatabaseTx) TokenService {
 	return &tokenService{dbTxAware{tx: tx, db: m.db}}
 }
 
+func (m *serviceManager) TruncateDateTime(col string, g data.StatsGranularity) exp.LiteralExpression {
+	return m.db.TruncateDateTime(col, string(g))
+}
+
 func (m *serviceManager) UserAttrService(tx *persistence.DatabaseTx) xintf.AttrStore {
 	return newTxAttrStore(m.userAttrs, tx, m.db)
 }
@@ -0,0 +1,117 @@
+package svc
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"io"
+	"strings"
+)
+
+// MetricsService is a service interface for exposing server metrics
+type MetricsService interface {
+	// Write collects the current metrics and writes them to the given writer in the Prometheus text exposition format
+	Write(w io.Writer) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// domainMetrics groups metrics collected for a single domain
+type domainMetrics struct {
+	Host          string `db:"host"`           // Domain host
+	CountComments int64  `db:"count_comments"` // Total number of comments
+	CountViews    int64  `db:"count_views"`    // Total number of views
+	CountPending  int64  `db:"count_pending"`  // Number of comments pending moderation
+}
+
+// metricWriter is a helper for writing metrics in the Prometheus text exposition format
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+// metric writes a single-sample metric along with its help and type lines
+func (mw *metricWriter) metric(name, typ, help string, value any) {
+	mw.header(name, typ, help)
+	mw.sample(name, "", value)
+}
+
+// header writes help and type lines of a metric
+func (mw *metricWriter) header(name, typ, help string) {
+	_, _ = fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a metric sample, optionally with a single label
+func (mw *metricWriter) sample(name, label string, value any) {
+	if label != "" {
+		_, _ = fmt.Fprintf(mw.w, "%s{%s} %v\n", name, label, value)
+	} else {
+		_, _ = fmt.Fprintf(mw.w, "%s %v\n", name, value)
+	}
+}
+
+// promLabelEscaper escapes label values according to the Prometheus text exposition format
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// metricsService is a blueprint MetricsService implementation
+type metricsService struct {
+	dbTxAware
+	mailSvc MailService       // Mail service to query failure counts from
+	wsSvc   WebSocketsService // WebSockets service to query client counts from
+}
+
+func (svc *metricsService) Write(w io.Writer) error {
+	logger.Debug("metricsService.Write()")
+
+	// Collect per-domain figures
+	var domains []*domainMetrics
+	err := svc.dbx().From(goqu.T("cm_domains").As("d")).
+		Select(
+			"d.host", "d.count_comments", "d.count_views",
+			svc.dbx().From(goqu.T("cm_comments").As("c")).
+				Select(goqu.COUNT(goqu.I("c.id"))).
+				Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+				Where(
+					goqu.Ex{"p.domain_id": goqu.I("d.id")},
+					goqu.I("c.is_pending").IsTrue(),
+					goqu.I("c.is_deleted").IsFalse()).
+				As("count_pending")).
+		Order(goqu.I("d.host").Asc()).
+		ScanStructs(&domains)
+	if err != nil {
+		return translateDBErrors("metricsService.Write/ScanStructs", err)
+	}
+
+	// Write domain metrics
+	mw := &metricWriter{w: bufio.NewWriter(w)}
+	for _, m := range []struct {
+		name, typ, help string
+		value           func(*domainMetrics) int64
+	}{
+		{"comentario_domain_comments", "gauge", "Number of comments on the domain.", func(d *domainMetrics) int64 { return d.CountComments }},
+		{"comentario_domain_views_total", "counter", "Number of page views on the domain.", func(d *domainMetrics) int64 { return d.CountViews }},
+		{"comentario_domain_comments_pending", "gauge", "Number of comments pending moderation on the domain.", func(d *domainMetrics) int64 { return d.CountPending }},
+	} {
+		mw.header(m.name, m.typ, m.help)
+		for _, d := range domains {
+			mw.sample(m.name, fmt.Sprintf(`domain="%s"`, promLabelEscaper.Replace(d.Host)), m.value(d))
+		}
+	}
+
+	// Write WebSockets and mail metrics
+	mw.metric("comentario_websocket_clients", "gauge", "Number of connected WebSocket clients.", svc.wsSvc.NumClients())
+	mw.metric("comentario_mail_send_failures_total", "counter", "Number of emails that failed to be sent.", svc.mailSvc.NumFailures())
+
+	// Write database pool metrics
+	st := svc.db.Stats()
+	mw.metric("comentario_db_connections_max_open", "gauge", "Maximum number of open database connections.", st.MaxOpenConnections)
+	mw.metric("comentario_db_connections_open", "gauge", "Number of established database connections.", st.OpenConnections)
+	mw.metric("comentario_db_connections_in_use", "gauge", "Number of database connections currently in use.", st.InUse)
+	mw.metric("comentario_db_connections_idle", "gauge", "Number of idle database connections.", st.Idle)
+	mw.metric("comentario_db_wait_count_total", "counter", "Number of waits for a database connection.", st.WaitCount)
+	mw.metric("comentario_db_wait_duration_seconds_total", "counter", "Time spent waiting for a database connection.", st.WaitDuration.Seconds())
+
+	// Flush the output
+	return mw.w.Flush()
+}
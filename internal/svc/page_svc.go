@@ -47,8 +47,8 @@ type PageService interface {
 	Update(page *data.DomainPage) error
 	// UpsertByDomainPath queries a page, inserting a new page database record if necessary, optionally registering a
 	// new pageview (if req is not nil), returning whether the page was added. title is an optional page title, if not
-	// provided, it will be fetched from the URL in the background
-	UpsertByDomainPath(domain *data.Domain, path, title string, req *http.Request) (*data.DomainPage, bool, error)
+	// provided, it will be fetched from the URL in the background. src optionally describes where the visitor came from
+	UpsertByDomainPath(domain *data.Domain, path, title string, req *http.Request, src *data.PageViewSource) (*data.DomainPage, bool, error)
 }
 
 // PageTitleFetcher is a service for background page title fetching
@@ -290,7 +290,7 @@ func (svc *pageService) Update(page *data.DomainPage) error {
 	return nil
 }
 
-func (svc *pageService) UpsertByDomainPath(domain *data.Domain, path, title string, req *http.Request) (*data.DomainPage, bool, error) {
+func (svc *pageService) UpsertByDomainPath(domain *data.Domain, path, title string, req *http.Request, src *data.PageViewSource) (*data.DomainPage, bool, error) {
 	logger.Debugf("pageService.UpsertByDomainPath(%#v, %q, %q, ...)", domain, path, title)
 
 	// Try to insert a page, querying the resulting page
@@ -328,19 +328,19 @@ func (svc *pageService) UpsertByDomainPath(domain *data.Domain, path, title stri
 
 	// Also register visit details in the background, if required
 	if !config.ServerConfig.DisablePageViewStats && req != nil {
-		go svc.insertPageView(&pResult.ID, req)
+		go svc.insertPageView(&pResult.ID, req, src)
 	}
 
 	// Succeeded
 	return &pResult, added, nil
 }
 
-// insertPageView registers a new page visit in the database
-func (svc *pageService) insertPageView(pageID *uuid.UUID, req *http.Request) {
+// insertPageView registers a new page visit in the database. src is optional
+func (svc *pageService) insertPageView(pageID *uuid.UUID, req *http.Request, src *data.PageViewSource) {
 	logger.Debugf("pageService.insertPageView(%s, ...)", pageID)
 
-	// Extract the remote IP and country
-	ip, country := util.UserIPCountry(req, !config.ServerConfig.LogFullIPs)
+	// Extract the remote IP and its geolocation
+	ip, geo := util.UserIPGeo(req, !config.ServerConfig.LogFullIPs)
 
 	// Parse the User Agent header
 	ua := uasurfer.Parse(util.UserAgent(req))
@@ -351,13 +351,21 @@ func (svc *pageService) insertPageView(pageID *uuid.UUID, req *http.Request) {
 		CreatedTime:    time.Now().UTC(),
 		Proto:          req.Proto,
 		IP:             ip,
-		Country:        country,
+		Country:        geo.Country,
+		Region:         geo.Region,
+		City:           geo.City,
 		BrowserName:    ua.Browser.Name.StringTrimPrefix(),
 		BrowserVersion: util.FormatVersion(&ua.Browser.Version),
 		OSName:         ua.OS.Name.StringTrimPrefix(),
 		OSVersion:      util.FormatVersion(&ua.OS.Version),
 		Device:         ua.DeviceType.StringTrimPrefix(),
 	}
+	if src != nil {
+		r.ReferrerHost = src.ReferrerHost
+		r.UTMSource = src.UTMSource
+		r.UTMMedium = src.UTMMedium
+		r.UTMCampaign = src.UTMCampaign
+	}
 	if err := persistence.ExecOne(svc.dbx().Insert("cm_domain_page_views").Rows(r)); err != nil {
 		_ = translateDBErrors("pageService.insertPageView/Insert", err)
 	}
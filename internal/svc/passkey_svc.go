@@ -0,0 +1,108 @@
+package svc
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
+)
+
+// PasskeyService is a service interface for dealing with UserPasskey objects
+type PasskeyService interface {
+	// Create persists a new passkey
+	Create(pk *data.UserPasskey) error
+	// DeleteByUserID deletes passkeys with the given IDs, belonging to the given user. IDs not belonging to the user
+	// are silently ignored
+	DeleteByUserID(userID *uuid.UUID, ids []uuid.UUID) error
+	// FindByCredentialID finds and returns a passkey by its base64url-encoded credential ID
+	FindByCredentialID(credentialID string) (*data.UserPasskey, error)
+	// ListByUserID returns all passkeys of the given user, sorted by creation time
+	ListByUserID(userID *uuid.UUID) ([]*data.UserPasskey, error)
+	// UpdateUsage updates the signature counter and the last used timestamp of the given passkey in the database
+	UpdateUsage(pk *data.UserPasskey) error
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// passkeyService is a blueprint PasskeyService implementation
+type passkeyService struct{ dbTxAware }
+
+func (svc *passkeyService) Create(pk *data.UserPasskey) error {
+	logger.Debugf("passkeyService.Create(%#v)", pk)
+
+	// Insert a new record
+	if err := persistence.ExecOne(svc.dbx().Insert("cm_user_passkeys").Rows(pk)); err != nil {
+		return translateDBErrors("passkeyService.Create/Insert", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *passkeyService) DeleteByUserID(userID *uuid.UUID, ids []uuid.UUID) error {
+	logger.Debugf("passkeyService.DeleteByUserID(%s, %v)", userID, ids)
+
+	// Nothing to do if no IDs given
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Delete the records
+	_, err := svc.dbx().Delete("cm_user_passkeys").
+		Where(goqu.Ex{"user_id": userID, "id": ids}).
+		Executor().
+		Exec()
+	if err != nil {
+		return translateDBErrors("passkeyService.DeleteByUserID/Delete", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *passkeyService) FindByCredentialID(credentialID string) (*data.UserPasskey, error) {
+	logger.Debugf("passkeyService.FindByCredentialID(%q)", credentialID)
+
+	// Query the database
+	var pk data.UserPasskey
+	if b, err := svc.dbx().From("cm_user_passkeys").Where(goqu.Ex{"credential_id": credentialID}).ScanStruct(&pk); err != nil {
+		return nil, translateDBErrors("passkeyService.FindByCredentialID/ScanStruct", err)
+	} else if !b {
+		return nil, ErrNotFound
+	}
+
+	// Succeeded
+	return &pk, nil
+}
+
+func (svc *passkeyService) ListByUserID(userID *uuid.UUID) ([]*data.UserPasskey, error) {
+	logger.Debugf("passkeyService.ListByUserID(%s)", userID)
+
+	// Query user passkeys
+	var pks []*data.UserPasskey
+	err := svc.dbx().From("cm_user_passkeys").
+		Where(goqu.Ex{"user_id": userID}).
+		Order(goqu.I("ts_created").Asc()).
+		ScanStructs(&pks)
+	if err != nil {
+		return nil, translateDBErrors("passkeyService.ListByUserID/ScanStructs", err)
+	}
+
+	// Succeeded
+	return pks, nil
+}
+
+func (svc *passkeyService) UpdateUsage(pk *data.UserPasskey) error {
+	logger.Debugf("passkeyService.UpdateUsage(%#v)", pk)
+
+	// Update the record
+	err := persistence.ExecOne(svc.dbx().Update("cm_user_passkeys").
+		Set(goqu.Record{"sign_count": pk.SignCount, "ts_last_used": pk.LastUsedTime}).
+		Where(goqu.Ex{"id": &pk.ID}))
+	if err != nil {
+		return translateDBErrors("passkeyService.UpdateUsage/Update", err)
+	}
+
+	// Succeeded
+	return nil
+}
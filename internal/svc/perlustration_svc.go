@@ -26,6 +26,7 @@ type commentScanningContext struct {
 	User       *data.User       // User who submitted the comment
 	DomainUser *data.DomainUser // Domain user corresponding to User
 	IsEdit     bool             // Whether the comment was edited, as opposed to a new comment
+	Geo        *util.GeoInfo    // Geolocation of the commenter's IP address, including its autonomous system
 }
 
 // CommentScanner can scan a comment for inappropriate content
@@ -145,6 +146,7 @@ func (svc *perlustrationService) NeedsModeration(
 		User:       user,
 		DomainUser: domainUser,
 		IsEdit:     isEdit,
+		Geo:        util.GeoByIP(util.UserIP(req)),
 	}
 	if b, reason, err := svc.scan(ctx); b && err == nil {
 		// Don't consider inappropriate if an error occurred
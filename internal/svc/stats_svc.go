@@ -4,12 +4,16 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
 	"gitlab.com/comentario/comentario/internal/api/exmodels"
 	"gitlab.com/comentario/comentario/internal/api/models"
 	"gitlab.com/comentario/comentario/internal/config"
 	"gitlab.com/comentario/comentario/internal/data"
+	"gitlab.com/comentario/comentario/internal/persistence"
 	"gitlab.com/comentario/comentario/internal/util"
+	"sort"
 	"time"
 )
 
@@ -26,17 +30,40 @@ type StatsService interface {
 	GetDailyDomainUserCounts(isSuperuser bool, userID, domainID *uuid.UUID, numDays uint64) ([]uint64, error)
 	// GetDailyViewCounts collects and returns a daily statistics for views, optionally limited to a specific domain
 	GetDailyViewCounts(isSuperuser bool, userID, domainID *uuid.UUID, numDays uint64) ([]uint64, error)
+	// GetDomainPageTotals returns view and comment totals for the last numDays days for every page of the given domain,
+	// ordered by page path
+	GetDomainPageTotals(domainID *uuid.UUID, numDays uint64) ([]*StatsPageTotals, error)
+	// GetEngagement collects and returns engagement and community health figures for the last numDays days, optionally
+	// limited to a specific domain
+	GetEngagement(isSuperuser bool, userID, domainID *uuid.UUID, numDays uint64) (*StatsEngagement, error)
 	// GetTopPages collects and returns top num performing page items by the given property prop (either "views" or
 	// "comments")
 	GetTopPages(isSuperuser bool, prop string, userID, domainID *uuid.UUID, numDays, num uint64) ([]*exmodels.PageStatsItem, error)
 	// GetTotals collects and returns total figures for all domains accessible to the specified user
 	GetTotals(curUser *data.User) (*StatsTotals, error)
+	// GetSeries collects and returns a time series for the given metric ("comments", "domainUsers", "domainPages", or
+	// "views") over the time range [from, to), split into buckets of the given granularity. The series can optionally
+	// be limited to a specific domain and/or page. The first bucket starts at the from time truncated to the granularity.
+	// Unless the granularity is hourly, views are counted using daily rollups
+	GetSeries(isSuperuser bool, metric string, userID, domainID, pageID *uuid.UUID, from, to time.Time, g data.StatsGranularity) ([]*StatsBucket, error)
 	// GetViewStats returns view numbers for the given dimension values, optionally limited to a specific domain
 	GetViewStats(isSuperuser bool, dimension string, userID, domainID *uuid.UUID, numDays uint64) (exmodels.StatsDimensionCounts, error)
-	// MovePageViews moves all page views from the source to the target page
+	// MovePageViews moves all page views and statistics rollups from the source to the target page
 	MovePageViews(sourcePageID, targetPageID *uuid.UUID) error
+	// Rollup aggregates page views into the daily statistics rollup tables, starting from the last rolled-up day, and
+	// returns the number of written rollup records. Comments aren't rolled up, since older comments can be imported,
+	// deleted, or moderated at any time
+	Rollup() (int64, error)
 }
 
+// StatsViewDimensions lists page view columns that are rolled up as dimensions
+var StatsViewDimensions = []string{
+	"proto", "country", "region", "city", "ua_browser_name", "ua_os_name", "ua_device", "ref_host", "utm_source", "utm_medium", "utm_campaign",
+}
+
+// statsRollupBatchSize is the maximum number of rollup records inserted with a single statement
+const statsRollupBatchSize = 100
+
 //----------------------------------------------------------------------------------------------------------------------
 
 // statsService is a blueprint StatsService implementation
@@ -148,16 +175,7 @@ func (svc *statsService) GetDailyViewCounts(isSuperuser bool, userID, domainID *
 	numDays, start := getStatsStartDate(numDays)
 
 	// Prepare a query for view counts, grouped by day
-	date := Services.StartOfDay("v.ts_created")
-	q := svc.dbx().From(goqu.T("cm_domain_page_views").As("v")).
-		Select(goqu.COUNT("*").As("cnt"), date.As("date")).
-		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("v.page_id")})).
-		// Filter by domain
-		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
-		// Select only last N days
-		Where(goqu.I("v.ts_created").Gte(start)).
-		GroupBy(date).
-		Order(date.Asc())
+	q := svc.dailyRollupQuery("s.count_views", start)
 
 	// Filter by domain, if any
 	if domainID != nil {
@@ -173,6 +191,275 @@ func (svc *statsService) GetDailyViewCounts(isSuperuser bool, userID, domainID *
 	return svc.queryDailyStats(q, start, numDays)
 }
 
+func (svc *statsService) GetDomainPageTotals(domainID *uuid.UUID, numDays uint64) ([]*StatsPageTotals, error) {
+	logger.Debugf("statsService.GetDomainPageTotals(%s, %d)", domainID, numDays)
+
+	// Calculate the start date
+	_, start := getStatsStartDate(numDays)
+
+	// Query the domain's pages along with their view rollups and comment counts within the period
+	var res []*StatsPageTotals
+	err := svc.dbx().From(goqu.T("cm_domain_pages").As("p")).
+		Select(
+			"p.path", "p.title",
+			goqu.COALESCE(goqu.SUM(goqu.I("s.count_views")), 0).As("cnt_views"),
+			svc.dbx().From(goqu.T("cm_comments").As("c")).
+				Select(goqu.COUNT("*")).
+				Where(goqu.Ex{"c.page_id": goqu.I("p.id"), "c.is_deleted": false}, goqu.I("c.ts_created").Gte(start)).
+				As("cnt_comments")).
+		LeftJoin(
+			goqu.T("cm_stats_daily_pages").As("s"),
+			goqu.On(goqu.Ex{"s.page_id": goqu.I("p.id")}, goqu.I("s.ts_day").Gte(start))).
+		Where(goqu.Ex{"p.domain_id": domainID}).
+		GroupBy("p.id", "p.path", "p.title").
+		Order(goqu.I("p.path").Asc()).
+		ScanStructs(&res)
+	if err != nil {
+		return nil, translateDBErrors("statsService.GetDomainPageTotals/ScanStructs", err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *statsService) GetEngagement(isSuperuser bool, userID, domainID *uuid.UUID, numDays uint64) (*StatsEngagement, error) {
+	logger.Debugf("statsService.GetEngagement(%v, %s, %s, %d)", isSuperuser, userID, domainID, numDays)
+
+	// Calculate the start date
+	_, start := getStatsStartDate(numDays)
+	res := &StatsEngagement{MedianFirstReply: -1, OldestPending: -1}
+
+	// Count views, unless stats gathering is disabled
+	if !config.ServerConfig.DisablePageViewStats {
+		q := svc.engagementScope(
+			svc.dbx().From(goqu.T("cm_stats_daily_pages").As("s")).
+				Select(goqu.COALESCE(goqu.SUM(goqu.I("s.count_views")), 0)).
+				Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("s.page_id")})).
+				Where(goqu.I("s.ts_day").Gte(start)),
+			isSuperuser, userID, domainID)
+		if _, err := q.ScanVal(&res.CountViews); err != nil {
+			return nil, translateDBErrors("statsService.GetEngagement/ScanVal[views]", err)
+		}
+	}
+
+	// Count non-deleted comments created within the period
+	qComments := svc.engagementScope(
+		svc.dbx().From(goqu.T("cm_comments").As("c")).
+			Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+			Where(goqu.I("c.is_deleted").IsFalse(), goqu.I("c.ts_created").Gte(start)),
+		isSuperuser, userID, domainID)
+	var err error
+	if res.CountComments, err = qComments.Count(); err != nil {
+		return nil, translateDBErrors("statsService.GetEngagement/Count[comments]", err)
+	}
+	if res.CountViews > 0 {
+		res.Conversion = float64(res.CountComments) / float64(res.CountViews)
+	}
+
+	// Count root comments, and fetch only those comments that take part in a thread, i.e. replies and comments having
+	// replies within the period
+	countRoots, err := qComments.Where(goqu.I("c.parent_id").IsNull()).Count()
+	if err != nil {
+		return nil, translateDBErrors("statsService.GetEngagement/Count[roots]", err)
+	}
+	var comments []*engagementComment
+	err = qComments.
+		Select("c.id", "c.parent_id", "c.ts_created").
+		Where(goqu.Or(
+			goqu.I("c.parent_id").IsNotNull(),
+			goqu.I("c.id").In(
+				svc.dbx().From(goqu.T("cm_comments").As("r")).
+					Select("r.parent_id").
+					Where(goqu.I("r.is_deleted").IsFalse(), goqu.I("r.ts_created").Gte(start))))).
+		ScanStructs(&comments)
+	if err != nil {
+		return nil, translateDBErrors("statsService.GetEngagement/ScanStructs[comments]", err)
+	}
+
+	// Collect thread depths and reply delays
+	depths, delays := engagementThreadStats(comments, countRoots)
+	res.ThreadDepths = depths
+	if len(delays) > 0 {
+		res.MedianFirstReply = medianDuration(delays)
+	}
+
+	// Count active commenters, i.e. registered users who have commented within the period
+	qCommenters := qComments.
+		Select(goqu.COUNT(goqu.I("c.user_created").Distinct())).
+		Where(goqu.I("c.user_created").IsNotNull(), goqu.I("c.user_created").Neq(data.AnonymousUser.ID))
+	if _, err := qCommenters.ScanVal(&res.CountActiveCommenters); err != nil {
+		return nil, translateDBErrors("statsService.GetEngagement/ScanVal[active]", err)
+	}
+
+	// Count returning commenters, i.e. those of them who have commented before the period
+	if res.CountActiveCommenters > 0 {
+		qBefore := svc.engagementScope(
+			svc.dbx().From(goqu.T("cm_comments").As("c")).
+				Select("c.user_created").
+				Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+				Where(goqu.I("c.is_deleted").IsFalse(), goqu.I("c.ts_created").Lt(start)),
+			isSuperuser, userID, domainID)
+		if _, err := qCommenters.Where(goqu.I("c.user_created").In(qBefore)).ScanVal(&res.CountReturningCommenters); err != nil {
+			return nil, translateDBErrors("statsService.GetEngagement/ScanVal[returning]", err)
+		}
+	}
+	res.CountNewCommenters = res.CountActiveCommenters - res.CountReturningCommenters
+
+	// Count pending comments, regardless of the period
+	qPending := svc.engagementScope(
+		svc.dbx().From(goqu.T("cm_comments").As("c")).
+			Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+			Where(goqu.I("c.is_deleted").IsFalse(), goqu.I("c.is_pending").IsTrue()),
+		isSuperuser, userID, domainID)
+	if res.CountPending, err = qPending.Count(); err != nil {
+		return nil, translateDBErrors("statsService.GetEngagement/Count[pending]", err)
+	}
+
+	// Determine the age of the oldest pending comment
+	if res.CountPending > 0 {
+		var ts time.Time
+		if _, err := qPending.Select("c.ts_created").Order(goqu.I("c.ts_created").Asc()).Limit(1).ScanVal(&ts); err != nil {
+			return nil, translateDBErrors("statsService.GetEngagement/ScanVal[oldestPending]", err)
+		}
+		res.OldestPending = time.Since(ts)
+	}
+
+	// Collect moderation decisions made within the period, per moderator
+	qModerators := svc.engagementScope(
+		svc.dbx().From(goqu.T("cm_comments").As("c")).
+			Select(
+				goqu.I("c.user_moderated").As("user_id"),
+				goqu.MAX(goqu.I("u.name")).As("name"),
+				goqu.SUM(goqu.Case().When(goqu.I("c.is_approved").IsTrue(), 1).Else(0)).As("cnt_approved"),
+				goqu.SUM(goqu.Case().When(goqu.I("c.is_approved").IsFalse(), 1).Else(0)).As("cnt_rejected")).
+			Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+			Join(goqu.T("cm_users").As("u"), goqu.On(goqu.Ex{"u.id": goqu.I("c.user_moderated")})).
+			Where(
+				goqu.I("c.is_deleted").IsFalse(),
+				goqu.I("c.is_pending").IsFalse(),
+				goqu.I("c.ts_moderated").Gte(start)).
+			GroupBy("c.user_moderated").
+			Order(goqu.I("name").Asc(), goqu.I("c.user_moderated").Asc()),
+		isSuperuser, userID, domainID)
+	if err := qModerators.ScanStructs(&res.Moderators); err != nil {
+		return nil, translateDBErrors("statsService.GetEngagement/ScanStructs[moderators]", err)
+	}
+
+	// Succeeded
+	return res, nil
+}
+
+func (svc *statsService) GetSeries(isSuperuser bool, metric string, userID, domainID, pageID *uuid.UUID, from, to time.Time, g data.StatsGranularity) ([]*StatsBucket, error) {
+	logger.Debugf("statsService.GetSeries(%v, %q, %s, %s, %s, %s, %s, %s)", isSuperuser, metric, userID, domainID, pageID, from, to, g)
+
+	// Calculate the bucket start times
+	buckets := g.Buckets(from, to)
+	if len(buckets) == 0 {
+		return []*StatsBucket{}, nil
+	}
+	start := buckets[0]
+
+	// Return a nil slice for views unless stats gathering is enabled
+	if metric == "views" && config.ServerConfig.DisablePageViewStats {
+		return nil, nil
+	}
+
+	// Prepare a query for the metric in question. Views are counted using daily rollups, unless an hourly series is
+	// requested
+	var q *goqu.SelectDataset
+	var col, pageCol string
+	var cnt exp.Aliaseable = goqu.COUNT("*")
+	switch metric {
+	case "comments":
+		col, pageCol = "c.ts_created", "c.page_id"
+		q = svc.dbx().From(goqu.T("cm_comments").As("c")).
+			Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("c.page_id")})).
+			Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
+			// Exclude deleted comments
+			Where(goqu.I("c.is_deleted").IsFalse())
+
+	case "views":
+		if g == data.StatsGranularityHour {
+			col, pageCol = "v.ts_created", "v.page_id"
+			q = svc.dbx().From(goqu.T("cm_domain_page_views").As("v"))
+		} else {
+			col, pageCol = "s.ts_day", "s.page_id"
+			cnt = goqu.SUM(goqu.I("s.count_views"))
+			q = svc.dbx().From(goqu.T("cm_stats_daily_pages").As("s"))
+		}
+		q = q.
+			Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I(pageCol)})).
+			Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")}))
+
+	case "domainUsers":
+		col = "u.ts_created"
+		q = svc.dbx().From(goqu.T("cm_domains_users").As("u")).
+			Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("u.domain_id")}))
+
+	case "domainPages":
+		col, pageCol = "p.ts_created", "p.id"
+		q = svc.dbx().From(goqu.T("cm_domain_pages").As("p")).
+			Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")}))
+
+	default:
+		return nil, fmt.Errorf("statsService.GetSeries: invalid metric value %q", metric)
+	}
+
+	// Count rows grouped by bucket, within the requested time range
+	date := Services.TruncateDateTime(col, g)
+	q = q.
+		Select(cnt.As("cnt"), date.As("date")).
+		Where(goqu.I(col).Gte(start), goqu.I(col).Lt(to)).
+		GroupBy(date)
+
+	// Filter by domain, if any
+	if domainID != nil {
+		q = q.Where(goqu.Ex{"d.id": domainID})
+	}
+
+	// Filter by page, if any
+	if pageID != nil {
+		if pageCol == "" {
+			return nil, fmt.Errorf("statsService.GetSeries: metric %q can't be filtered by page", metric)
+		}
+		q = q.Where(goqu.Ex{pageCol: pageID})
+	}
+
+	// If the user isn't a superuser, filter by owned domains
+	if !isSuperuser {
+		q = addStatsOwnedDomainFilter(q, userID)
+	}
+
+	// Query the data
+	var dbRecs []struct {
+		// The date has to be fetched as a string, see queryDailyStats()
+		Date  string `db:"date"`
+		Count uint64 `db:"cnt"`
+	}
+	if err := q.ScanStructs(&dbRecs); err != nil {
+		return nil, translateDBErrors("statsService.GetSeries/ScanStructs", err)
+	}
+
+	// Index the counts by bucket start
+	counts := make(map[time.Time]uint64, len(dbRecs))
+	for _, r := range dbRecs {
+		t, err := time.Parse(time.RFC3339, r.Date)
+		if err != nil {
+			return nil, translateDBErrors("statsService.GetSeries[parse datetime string]", err)
+		}
+		counts[t.UTC()] += r.Count
+	}
+
+	// Convert the buckets into a series, filling any gaps with zeroes
+	res := make([]*StatsBucket, len(buckets))
+	for i, t := range buckets {
+		res[i] = &StatsBucket{Start: t, Label: g.Label(t), Count: counts[t]}
+	}
+
+	// Succeeded
+	return res, nil
+}
+
 func (svc *statsService) GetTopPages(isSuperuser bool, prop string, userID, domainID *uuid.UUID, numDays, num uint64) ([]*exmodels.PageStatsItem, error) {
 	logger.Debugf("statsService.GetTopPages(%v, %q, %s, %s, %d, %d)", isSuperuser, prop, userID, domainID, numDays, num)
 
@@ -185,6 +472,10 @@ func (svc *statsService) GetTopPages(isSuperuser bool, prop string, userID, doma
 	numDays, start := getStatsStartDate(numDays)
 
 	// Prepare a counting query, grouped by page
+	cnt := goqu.COUNT("*")
+	if prop == "views" {
+		cnt = goqu.SUM(goqu.I("s.count_views"))
+	}
 	q := svc.dbx().From(goqu.T("cm_domain_pages").As("p")).
 		Select(
 			// Domain page fields
@@ -192,22 +483,24 @@ func (svc *statsService) GetTopPages(isSuperuser bool, prop string, userID, doma
 			// Domain fields
 			goqu.I("d.host").As("domain_host"),
 			// Aggregate count
-			goqu.COUNT("*").As("cnt")).
+			cnt.As("cnt")).
 		// Join the domain
 		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
 		GroupBy("d.host", "p.id").
+		// Skip pages with nothing to count
+		Having(cnt.Gt(0)).
 		// Sort by count, descending, then, additionally, by page ID for stable ordering
 		Order(goqu.I("cnt").Desc(), goqu.I("p.id").Asc()).
 		Limit(uint(num))
 
-	// Set up a roll-up condition
+	// Set up a roll-up condition. Views are counted using daily rollups, comments directly
 	switch prop {
 	case "views":
 		q = q.
-			// Join the page's views
-			Join(goqu.T("cm_domain_page_views").As("v"), goqu.On(goqu.Ex{"v.page_id": goqu.I("p.id")})).
+			// Join the page's daily rollups
+			Join(goqu.T("cm_stats_daily_pages").As("s"), goqu.On(goqu.Ex{"s.page_id": goqu.I("p.id")})).
 			// Select only last N days
-			Where(goqu.I("v.ts_created").Gte(start))
+			Where(goqu.I("s.ts_day").Gte(start))
 	case "comments":
 		q = q.
 			// Join the page's comments
@@ -278,16 +571,16 @@ func (svc *statsService) GetViewStats(isSuperuser bool, dimension string, userID
 	// Calculate the start date
 	_, start := getStatsStartDate(numDays)
 
-	// Prepare a query for view counts, grouped by the specified dimension
-	q := svc.dbx().From(goqu.T("cm_domain_page_views").As("v")).
-		Select(goqu.COUNT("*").As("cnt"), goqu.I(dimension).As("el")).
+	// Prepare a query for view counts of the specified dimension, grouped by element
+	q := svc.dbx().From(goqu.T("cm_stats_daily_views").As("s")).
+		Select(goqu.SUM(goqu.I("s.count_views")).As("cnt"), goqu.I("s.element").As("el")).
 		// Join the page in question
-		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("v.page_id")})).
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("s.page_id")})).
 		// Filter by domain
 		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
 		// Select only last N days
-		Where(goqu.I("v.ts_created").Gte(start)).
-		GroupBy(dimension).
+		Where(goqu.Ex{"s.dimension": dimension}, goqu.I("s.ts_day").Gte(start)).
+		GroupBy("s.element").
 		// Sort by count in descending order, and by element - for stable ordering
 		Order(goqu.I("cnt").Desc(), goqu.I("el").Asc())
 
@@ -314,15 +607,105 @@ func (svc *statsService) GetViewStats(isSuperuser bool, dimension string, userID
 func (svc *statsService) MovePageViews(sourcePageID, targetPageID *uuid.UUID) error {
 	logger.Debugf("statsService.MovePageViews(%s, %s)", sourcePageID, targetPageID)
 
-	// Update comment rows in the database
+	// Update page view rows in the database
 	if _, err := svc.dbx().Update("cm_domain_page_views").Set(goqu.Record{"page_id": targetPageID}).Where(goqu.Ex{"page_id": sourcePageID}).Executor().Exec(); err != nil {
 		return translateDBErrors("statsService.MovePageViews/Exec", err)
 	}
 
+	// Merge the source page's daily rollups into the target page's ones
+	var pages []*data.StatsDailyPage
+	if err := svc.dbx().From("cm_stats_daily_pages").Where(goqu.Ex{"page_id": sourcePageID}).ScanStructs(&pages); err != nil {
+		return translateDBErrors("statsService.MovePageViews/ScanStructs[pages]", err)
+	}
+	for _, r := range pages {
+		r.PageID = *targetPageID
+	}
+	err := insertRollups(svc.dbx(), "cm_stats_daily_pages", pages, goqu.DoUpdate("page_id, ts_day", goqu.Record{
+		"count_views": goqu.L("cm_stats_daily_pages.count_views + excluded.count_views"),
+	}))
+	if err != nil {
+		return err
+	}
+
+	// Merge the source page's dimension rollups into the target page's ones
+	var views []*data.StatsDailyViews
+	if err := svc.dbx().From("cm_stats_daily_views").Where(goqu.Ex{"page_id": sourcePageID}).ScanStructs(&views); err != nil {
+		return translateDBErrors("statsService.MovePageViews/ScanStructs[views]", err)
+	}
+	for _, r := range views {
+		r.PageID = *targetPageID
+	}
+	err = insertRollups(svc.dbx(), "cm_stats_daily_views", views, goqu.DoUpdate("page_id, ts_day, dimension, element", goqu.Record{
+		"count_views": goqu.L("cm_stats_daily_views.count_views + excluded.count_views"),
+	}))
+	if err != nil {
+		return err
+	}
+
+	// Remove the source page's rollups
+	for _, t := range []string{"cm_stats_daily_pages", "cm_stats_daily_views"} {
+		if _, err := svc.dbx().Delete(t).Where(goqu.Ex{"page_id": sourcePageID}).Executor().Exec(); err != nil {
+			return translateDBErrors("statsService.MovePageViews/Exec[delete "+t+"]", err)
+		}
+	}
+
 	// Succeeded
 	return nil
 }
 
+func (svc *statsService) Rollup() (int64, error) {
+	logger.Debug("statsService.Rollup()")
+
+	// Determine the day to start from
+	start, err := svc.rollupStartDay()
+	if err != nil {
+		return 0, err
+	} else if start.IsZero() {
+		// Nothing to roll up
+		return 0, nil
+	}
+
+	// Remove existing rollups from that day on, since they're going to be recalculated
+	for _, t := range []string{"cm_stats_daily_pages", "cm_stats_daily_views"} {
+		if _, err := svc.dbx().Delete(t).Where(goqu.I("ts_day").Gte(start)).Executor().Exec(); err != nil {
+			return 0, translateDBErrors("statsService.Rollup/Exec[delete "+t+"]", err)
+		}
+	}
+
+	// Aggregate page views per page and day
+	recs, err := svc.rollupQuery("cm_domain_page_views", "", start)
+	if err != nil {
+		return 0, err
+	}
+	pages := make([]*data.StatsDailyPage, len(recs))
+	for i, r := range recs {
+		pages[i] = &data.StatsDailyPage{PageID: r.PageID, Day: r.Day, CountViews: r.Count}
+	}
+
+	// Aggregate page views per page, day, and dimension
+	var views []*data.StatsDailyViews
+	for _, dim := range StatsViewDimensions {
+		recs, err := svc.rollupQuery("cm_domain_page_views", dim, start)
+		if err != nil {
+			return 0, err
+		}
+		for _, r := range recs {
+			views = append(views, &data.StatsDailyViews{PageID: r.PageID, Day: r.Day, Dimension: dim, Element: r.Element, CountViews: r.Count})
+		}
+	}
+
+	// Store the rollups
+	if err := insertRollups(svc.dbx(), "cm_stats_daily_pages", pages, nil); err != nil {
+		return 0, err
+	}
+	if err := insertRollups(svc.dbx(), "cm_stats_daily_views", views, nil); err != nil {
+		return 0, err
+	}
+
+	// Succeeded
+	return int64(len(pages) + len(views)), nil
+}
+
 // fillCommentCommenterStats fills the statistics for comments and commenters in totals
 func (svc *statsService) fillCommentCommenterStats(curUser *data.User, totals *StatsTotals) error {
 	// Prepare a query
@@ -534,6 +917,112 @@ func (svc *statsService) queryDailyStats(ds *goqu.SelectDataset, start time.Time
 	return res, nil
 }
 
+// dailyRollupQuery returns a query for the given daily page rollup column sum, grouped by day, starting from the given
+// date
+func (svc *statsService) dailyRollupQuery(col string, start time.Time) *goqu.SelectDataset {
+	return svc.dbx().From(goqu.T("cm_stats_daily_pages").As("s")).
+		Select(goqu.SUM(goqu.I(col)).As("cnt"), goqu.I("s.ts_day").As("date")).
+		Join(goqu.T("cm_domain_pages").As("p"), goqu.On(goqu.Ex{"p.id": goqu.I("s.page_id")})).
+		// Filter by domain
+		Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")})).
+		// Select only last N days, with anything to count
+		Where(goqu.I("s.ts_day").Gte(start), goqu.I(col).Gt(0)).
+		GroupBy("s.ts_day").
+		Order(goqu.I("s.ts_day").Asc())
+}
+
+// engagementScope joins the domain to the given query (which must have the page aliased as "p") and limits it to the
+// given domain, if any, and to the domains owned by the user, unless they're a superuser
+func (svc *statsService) engagementScope(q *goqu.SelectDataset, isSuperuser bool, userID, domainID *uuid.UUID) *goqu.SelectDataset {
+	q = q.Join(goqu.T("cm_domains").As("d"), goqu.On(goqu.Ex{"d.id": goqu.I("p.domain_id")}))
+
+	// Filter by domain, if any
+	if domainID != nil {
+		q = q.Where(goqu.Ex{"d.id": domainID})
+	}
+
+	// If the user isn't a superuser, filter by owned domains
+	if !isSuperuser {
+		q = addStatsOwnedDomainFilter(q, userID)
+	}
+	return q
+}
+
+// statsRollupRecord is an aggregated count of rows in a table per page, day, and, optionally, dimension element
+type statsRollupRecord struct {
+	PageID  uuid.UUID `db:"page_id"`
+	Date    string    `db:"date"` // Fetched as a string, see queryDailyStats()
+	Element string    `db:"el"`
+	Count   int64     `db:"cnt"`
+	Day     time.Time // Parsed Date
+}
+
+// rollupQuery counts rows in the given table created since start, grouped by page, day, and, optionally, the specified
+// dimension column
+func (svc *statsService) rollupQuery(table, dimension string, start time.Time) ([]*statsRollupRecord, error) {
+	date := Services.StartOfDay("ts_created")
+	q := svc.dbx().From(table).
+		Select("page_id", date.As("date"), goqu.COUNT("*").As("cnt")).
+		Where(goqu.I("ts_created").Gte(start)).
+		GroupBy("page_id", date)
+	if dimension == "" {
+		q = q.SelectAppend(goqu.V("").As("el"))
+	} else {
+		q = q.SelectAppend(goqu.I(dimension).As("el")).GroupByAppend(dimension)
+	}
+
+	// Query the data
+	var res []*statsRollupRecord
+	if err := q.ScanStructs(&res); err != nil {
+		return nil, translateDBErrors("statsService.rollupQuery/ScanStructs", err)
+	}
+
+	// Parse the returned dates
+	for _, r := range res {
+		t, err := time.Parse(time.RFC3339, r.Date)
+		if err != nil {
+			return nil, translateDBErrors("statsService.rollupQuery[parse datetime string]", err)
+		}
+		r.Day = t.UTC()
+	}
+	return res, nil
+}
+
+// rollupStartDay returns the day to start rolling up from: the last rolled-up day, which may be incomplete, or, if
+// there's none, the day of the earliest page view. Returns a zero time if there's nothing to roll up
+func (svc *statsService) rollupStartDay() (time.Time, error) {
+	// Try the last rolled-up day first
+	var t time.Time
+	if ok, err := svc.dbx().From("cm_stats_daily_pages").Select("ts_day").Order(goqu.I("ts_day").Desc()).Limit(1).ScanVal(&t); err != nil {
+		return t, translateDBErrors("statsService.rollupStartDay/ScanVal[rollups]", err)
+	} else if ok {
+		return t.UTC(), nil
+	}
+
+	// No rollups yet: find the earliest page view
+	if ok, err := svc.dbx().From("cm_domain_page_views").Select("ts_created").Order(goqu.I("ts_created").Asc()).Limit(1).ScanVal(&t); err != nil {
+		return t, translateDBErrors("statsService.rollupStartDay/ScanVal[views]", err)
+	} else if !ok {
+		return time.Time{}, nil
+	}
+	return t.UTC().Truncate(util.OneDay), nil
+}
+
+// insertRollups inserts the given rollup records into the specified table in batches, optionally resolving conflicts
+// using the provided action
+func insertRollups[T any](dbx persistence.DBX, table string, recs []T, onConflict exp.ConflictExpression) error {
+	for i := 0; i < len(recs); i += statsRollupBatchSize {
+		q := dbx.Insert(table).Rows(recs[i:min(i+statsRollupBatchSize, len(recs))])
+		if onConflict != nil {
+			q = q.OnConflict(onConflict)
+		}
+		if _, err := q.Executor().Exec(); err != nil {
+			return translateDBErrors("insertRollups/Exec["+table+"]", err)
+		}
+	}
+	return nil
+}
+
 // addStatsOwnedDomainFilter adds a join condition for domains owned by the given user, to the given query
 func addStatsOwnedDomainFilter(q *goqu.SelectDataset, userID *uuid.UUID) *goqu.SelectDataset {
 	return q.Join(
@@ -554,6 +1043,183 @@ func getStatsStartDate(numDays uint64) (uint64, time.Time) {
 
 //----------------------------------------------------------------------------------------------------------------------
 
+// StatsBucket is a single labelled bucket of a statistics time series
+type StatsBucket struct {
+	Start time.Time // Start of the bucket
+	Label string    // Human-readable bucket label
+	Count uint64    // Count within the bucket
+}
+
+// ToDTO converts the object into an API model
+func (b *StatsBucket) ToDTO() *models.StatsBucket {
+	return &models.StatsBucket{
+		Count: b.Count,
+		Label: b.Label,
+		Start: strfmt.DateTime(b.Start),
+	}
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// StatsEngagement groups engagement and community health figures
+type StatsEngagement struct {
+	CountViews               int64               // Number of page views
+	CountComments            int64               // Number of comments
+	Conversion               float64             // Number of comments per page view
+	CountActiveCommenters    int64               // Number of distinct registered commenters
+	CountNewCommenters       int64               // Number of active commenters who haven't commented before the period
+	CountReturningCommenters int64               // Number of active commenters who have commented before the period
+	MedianFirstReply         time.Duration       // Median time between a comment and its first reply, -1 if unknown
+	CountPending             int64               // Number of comments pending moderation
+	OldestPending            time.Duration       // Age of the oldest comment pending moderation, -1 if there's none
+	Moderators               []*StatsModerator   // Moderation decisions per moderator
+	ThreadDepths             []*StatsThreadDepth // Distribution of threads by their depth
+}
+
+// ToDTO converts the object into an API model
+func (e *StatsEngagement) ToDTO() *models.StatsEngagement {
+	return &models.StatsEngagement{
+		Conversion:               e.Conversion,
+		CountActiveCommenters:    e.CountActiveCommenters,
+		CountComments:            e.CountComments,
+		CountNewCommenters:       e.CountNewCommenters,
+		CountPending:             e.CountPending,
+		CountReturningCommenters: e.CountReturningCommenters,
+		CountViews:               e.CountViews,
+		MedianFirstReplySeconds:  durationSeconds(e.MedianFirstReply),
+		Moderators:               data.SliceToDTOs[*StatsModerator, *models.StatsModerator](e.Moderators),
+		OldestPendingSeconds:     durationSeconds(e.OldestPending),
+		ThreadDepths:             data.SliceToDTOs[*StatsThreadDepth, *models.StatsThreadDepth](e.ThreadDepths),
+	}
+}
+
+// StatsModerator groups moderation decisions taken by a single moderator
+type StatsModerator struct {
+	UserID        uuid.UUID `db:"user_id"`      // Moderator user ID
+	Name          string    `db:"name"`         // Moderator name
+	CountApproved int64     `db:"cnt_approved"` // Number of approved comments
+	CountRejected int64     `db:"cnt_rejected"` // Number of rejected comments
+}
+
+// ApprovalRate returns the share of approved comments in all moderated ones
+func (m *StatsModerator) ApprovalRate() float64 {
+	if total := m.CountApproved + m.CountRejected; total > 0 {
+		return float64(m.CountApproved) / float64(total)
+	}
+	return 0
+}
+
+// ToDTO converts the object into an API model
+func (m *StatsModerator) ToDTO() *models.StatsModerator {
+	return &models.StatsModerator{
+		ApprovalRate:  m.ApprovalRate(),
+		CountApproved: m.CountApproved,
+		CountRejected: m.CountRejected,
+		Name:          m.Name,
+		UserID:        strfmt.UUID(m.UserID.String()),
+	}
+}
+
+// StatsThreadDepth is a number of comment threads having the given depth
+type StatsThreadDepth struct {
+	Depth int   // Thread depth, 1 meaning a root comment without replies
+	Count int64 // Number of threads
+}
+
+// ToDTO converts the object into an API model
+func (d *StatsThreadDepth) ToDTO() *models.StatsThreadDepth {
+	return &models.StatsThreadDepth{
+		Count: d.Count,
+		Depth: int64(d.Depth),
+	}
+}
+
+// engagementComment is a comment excerpt used for engagement stats
+type engagementComment struct {
+	ID          uuid.UUID     `db:"id"`
+	ParentID    uuid.NullUUID `db:"parent_id"`
+	CreatedTime time.Time     `db:"ts_created"`
+}
+
+// engagementThreadStats returns the depth distribution of threads rooted in the given comments, sorted by depth, and
+// the delays between each comment and its first reply. countRoots is the total number of root comments, including
+// those without replies, which needn't be in the list. Replies whose parent isn't in the list are ignored
+func engagementThreadStats(comments []*engagementComment, countRoots int64) ([]*StatsThreadDepth, []time.Duration) {
+	// Index the comments and find each comment's first reply
+	byID := make(map[uuid.UUID]*engagementComment, len(comments))
+	for _, c := range comments {
+		byID[c.ID] = c
+	}
+	firstReply := map[uuid.UUID]time.Time{}
+	for _, c := range comments {
+		if c.ParentID.Valid && byID[c.ParentID.UUID] != nil {
+			if t, ok := firstReply[c.ParentID.UUID]; !ok || c.CreatedTime.Before(t) {
+				firstReply[c.ParentID.UUID] = c.CreatedTime
+			}
+		}
+	}
+
+	// Calculate reply delays
+	var delays []time.Duration
+	for id, t := range firstReply {
+		delays = append(delays, t.Sub(byID[id].CreatedTime))
+	}
+
+	// Walk up from each comment to its root, tracking the maximum depth per root
+	maxDepth := map[uuid.UUID]int{}
+	for _, c := range comments {
+		depth, cur := 1, c
+		for cur.ParentID.Valid {
+			parent := byID[cur.ParentID.UUID]
+			if parent == nil || depth > len(comments) {
+				// Orphaned reply (or a cycle, which must never happen): skip it
+				cur = nil
+				break
+			}
+			cur = parent
+			depth++
+		}
+		if cur != nil && depth > maxDepth[cur.ID] {
+			maxDepth[cur.ID] = depth
+		}
+	}
+
+	// Count threads by depth, the roots not seen above being single-comment threads
+	counts := map[int]int64{}
+	for _, d := range maxDepth {
+		counts[d]++
+	}
+	if n := countRoots - int64(len(maxDepth)) + counts[1]; n > 0 {
+		counts[1] = n
+	}
+	depths := make([]*StatsThreadDepth, 0, len(counts))
+	for d, cnt := range counts {
+		depths = append(depths, &StatsThreadDepth{Depth: d, Count: cnt})
+	}
+	sort.Slice(depths, func(i, j int) bool { return depths[i].Depth < depths[j].Depth })
+	return depths, delays
+}
+
+// durationSeconds converts the given duration into whole seconds, keeping negative values as -1
+func durationSeconds(d time.Duration) int64 {
+	if d < 0 {
+		return -1
+	}
+	return int64(d / time.Second)
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// StatsPageTotals groups view and comment totals of a single page
+type StatsPageTotals struct {
+	Path          string `db:"path"`         // Page path
+	Title         string `db:"title"`        // Page title
+	CountViews    int64  `db:"cnt_views"`    // Number of views
+	CountComments int64  `db:"cnt_comments"` // Number of comments
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
 // StatsTotals groups total statistical figures
 type StatsTotals struct {
 	CountUsersTotal       int64 // Total number of users the current user can manage (superuser only)
@@ -0,0 +1,62 @@
+package svc
+
+import (
+	"github.com/google/uuid"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_engagementThreadStats(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	id := func(i byte) uuid.UUID { return uuid.UUID{i} }
+	c := func(i, parent byte, minutes int) *engagementComment {
+		r := &engagementComment{ID: id(i), CreatedTime: ts.Add(time.Duration(minutes) * time.Minute)}
+		if parent > 0 {
+			r.ParentID = uuid.NullUUID{UUID: id(parent), Valid: true}
+		}
+		return r
+	}
+	tests := []struct {
+		name       string
+		comments   []*engagementComment
+		countRoots int64
+		wantDepths []*StatsThreadDepth
+		wantDelays []time.Duration
+	}{
+		{"No comments           ", nil, 0, []*StatsThreadDepth{}, nil},
+		{"Roots not in list     ", nil, 3, []*StatsThreadDepth{{1, 3}}, nil},
+		{"Lone roots in list    ", []*engagementComment{c(1, 0, 0), c(2, 0, 5)}, 2, []*StatsThreadDepth{{1, 2}}, nil},
+		{"Single reply          ", []*engagementComment{c(1, 0, 0), c(2, 1, 10)}, 1, []*StatsThreadDepth{{2, 1}}, []time.Duration{10 * time.Minute}},
+		{"Single reply and roots", []*engagementComment{c(1, 0, 0), c(2, 1, 10)}, 4, []*StatsThreadDepth{{1, 3}, {2, 1}}, []time.Duration{10 * time.Minute}},
+		{"First reply counts    ", []*engagementComment{c(1, 0, 0), c(3, 1, 30), c(2, 1, 20)}, 1, []*StatsThreadDepth{{2, 1}}, []time.Duration{20 * time.Minute}},
+		{
+			"Deep thread           ",
+			[]*engagementComment{c(1, 0, 0), c(2, 1, 1), c(3, 2, 3), c(4, 3, 7), c(5, 1, 2)},
+			1,
+			[]*StatsThreadDepth{{4, 1}},
+			[]time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute},
+		},
+		{
+			"Multiple threads      ",
+			[]*engagementComment{c(1, 0, 0), c(2, 1, 5), c(3, 0, 0), c(4, 3, 1), c(5, 4, 2), c(6, 0, 0), c(7, 6, 60)},
+			5,
+			[]*StatsThreadDepth{{1, 2}, {2, 2}, {3, 1}},
+			[]time.Duration{time.Minute, time.Minute, 5 * time.Minute, time.Hour},
+		},
+		{"Orphaned replies      ", []*engagementComment{c(2, 1, 5), c(3, 2, 6)}, 0, []*StatsThreadDepth{}, []time.Duration{time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDepths, gotDelays := engagementThreadStats(tt.comments, tt.countRoots)
+			if !reflect.DeepEqual(gotDepths, tt.wantDepths) {
+				t.Errorf("engagementThreadStats() depths = %v, want %v", gotDepths, tt.wantDepths)
+			}
+			sort.Slice(gotDelays, func(i, j int) bool { return gotDelays[i] < gotDelays[j] })
+			if !reflect.DeepEqual(gotDelays, tt.wantDelays) {
+				t.Errorf("engagementThreadStats() delays = %v, want %v", gotDelays, tt.wantDelays)
+			}
+		})
+	}
+}
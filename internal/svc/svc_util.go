@@ -5,6 +5,8 @@ import (
 	"errors"
 	"github.com/op/go-logging"
 	"gitlab.com/comentario/comentario/internal/util"
+	"sort"
+	"time"
 )
 
 // logger represents a package-wide logger instance
@@ -40,3 +42,16 @@ func translateDBErrors(op string, errs ...error) error {
 		return ErrDB
 	}
 }
+
+// medianDuration returns the median of the given durations, or 0 if there's none. The passed slice gets sorted
+func medianDuration(ds []time.Duration) time.Duration {
+	n := len(ds)
+	if n == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	if n%2 == 1 {
+		return ds[n/2]
+	}
+	return (ds[n/2-1] + ds[n/2]) / 2
+}
@@ -4,8 +4,32 @@ import (
 	"database/sql"
 	"errors"
 	"testing"
+	"time"
 )
 
+func Test_medianDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		ds   []time.Duration
+		want time.Duration
+	}{
+		{"Nil         ", nil, 0},
+		{"Empty       ", []time.Duration{}, 0},
+		{"Single      ", []time.Duration{5}, 5},
+		{"Odd number  ", []time.Duration{9, 1, 5}, 5},
+		{"Even number ", []time.Duration{10, 1, 4, 2}, 3},
+		{"Duplicates  ", []time.Duration{7, 7, 7, 1}, 7},
+		{"Real values ", []time.Duration{time.Hour, time.Minute, 3 * time.Hour}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := medianDuration(tt.ds); got != tt.want {
+				t.Errorf("medianDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_translateDBErrors(t *testing.T) {
 	tests := []struct {
 		name    string
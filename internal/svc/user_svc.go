@@ -36,8 +36,11 @@ type UserService interface {
 	DeleteUserSession(id *uuid.UUID) error
 	// EnsureSuperuser ensures that the user with the given ID or email is a superuser
 	EnsureSuperuser(idOrEmail string) error
-	// ExpireUserSessions expires all sessions of the given user
-	ExpireUserSessions(userID *uuid.UUID) error
+	// ExpireUserSession expires an active session with the given ID of the given user. Returns ErrNotFound if there's
+	// no such session
+	ExpireUserSession(userID, id *uuid.UUID) error
+	// ExpireUserSessions expires all sessions of the given user, except the one with exceptID, if it's not nil
+	ExpireUserSessions(userID, exceptID *uuid.UUID) error
 	// FindDomainUserByID fetches and returns a User and DomainUser by domain and user IDs. If the user exists, but
 	// there's no record for the user on that domain, returns nil for DomainUser
 	FindDomainUserByID(userID, domainID *uuid.UUID) (*data.User, *data.DomainUser, error)
@@ -67,10 +70,17 @@ type UserService interface {
 	// ListDomainModerators fetches and returns a list of moderator users for the domain with the given ID. If
 	// enabledNotifyOnly is true, only includes users who have moderator notifications enabled for that domain
 	ListDomainModerators(domainID *uuid.UUID, enabledNotifyOnly bool) ([]*data.User, error)
+	// ListActiveUserSessions returns all unexpired sessions of a user, sorted in reverse chronological order
+	ListActiveUserSessions(userID *uuid.UUID) ([]*data.UserSession, error)
 	// ListUserSessions returns all sessions of a user, sorted in reverse chronological order
 	//   - userID is ID of the user to fetch sessions for
 	//   - pageIndex is the page index, if negative, no pagination is applied.
 	ListUserSessions(userID *uuid.UUID, pageIndex int) ([]*data.UserSession, error)
+	// Merge moves everything that belongs to the source user (comments and other user references, votes, domain
+	// roles, sessions, and attributes) over to the target user, then deletes the source user. On conflicts, the
+	// target's votes and attributes win, and domain roles are combined into the highest one. curUserID is the user
+	// performing the merge. Returns the persisted audit record of the merge
+	Merge(curUserID *uuid.UUID, source, target *data.User) (*data.UserMerge, error)
 	// Persist persists the given user's data in the database, by updating it. It differs from Update() in that it
 	// doesn't fire the update event
 	Persist(u *data.User) error
@@ -80,6 +90,10 @@ type UserService interface {
 	UpdateBanned(curUserID *uuid.UUID, u *data.User, banned bool) error
 	// UpdateLoginLocked updates the given user's last login and lockout fields in the database
 	UpdateLoginLocked(u *data.User) error
+	// UpdateTOTPUsage updates the given user's last accepted TOTP time step and remaining recovery codes in the
+	// database, provided they still hold the given previous values there. Returns ErrNotFound otherwise, which means
+	// the same code has concurrently been used elsewhere
+	UpdateTOTPUsage(u *data.User, prevStep int64, prevRecovery string) error
 }
 
 //----------------------------------------------------------------------------------------------------------------------
@@ -259,11 +273,33 @@ func (svc *userService) EnsureSuperuser(idOrEmail string) error {
 	return svc.Persist(u)
 }
 
-func (svc *userService) ExpireUserSessions(userID *uuid.UUID) error {
-	logger.Debugf("userService.ExpireUserSessions(%s)", userID)
+func (svc *userService) ExpireUserSession(userID, id *uuid.UUID) error {
+	logger.Debugf("userService.ExpireUserSession(%s, %s)", userID, id)
+
+	// Update the session, if it's still active
+	now := time.Now().UTC()
+	err := persistence.ExecOne(svc.dbx().Update("cm_user_sessions").
+		Set(goqu.Record{"ts_expires": now}).
+		Where(goqu.Ex{"id": id, "user_id": userID}, goqu.C("ts_expires").Gt(now)))
+	if err != nil {
+		return translateDBErrors("userService.ExpireUserSession/Update", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+func (svc *userService) ExpireUserSessions(userID, exceptID *uuid.UUID) error {
+	logger.Debugf("userService.ExpireUserSessions(%s, %v)", userID, exceptID)
+
+	// Prepare a query
+	q := svc.dbx().Update("cm_user_sessions").Set(goqu.Record{"ts_expires": time.Now().UTC()}).Where(goqu.Ex{"user_id": userID})
+	if exceptID != nil {
+		q = q.Where(goqu.C("id").Neq(exceptID))
+	}
 
 	// Update all user's sessions
-	if _, err := svc.dbx().Update("cm_user_sessions").Set(goqu.Record{"ts_expires": time.Now().UTC()}).Where(goqu.Ex{"user_id": userID}).Executor().Exec(); err != nil {
+	if _, err := q.Executor().Exec(); err != nil {
 		return translateDBErrors("userService.ExpireUserSessions/Exec", err)
 	}
 
@@ -702,6 +738,22 @@ func (svc *userService) ListDomainModerators(domainID *uuid.UUID, enabledNotifyO
 	return users, nil
 }
 
+func (svc *userService) ListActiveUserSessions(userID *uuid.UUID) ([]*data.UserSession, error) {
+	logger.Debugf("userService.ListActiveUserSessions(%s)", userID)
+
+	// Query unexpired user sessions
+	var us []*data.UserSession
+	if err := svc.dbx().From("cm_user_sessions").
+		Where(goqu.Ex{"user_id": userID}, goqu.C("ts_expires").Gt(time.Now().UTC())).
+		Order(goqu.I("ts_created").Desc()).
+		ScanStructs(&us); err != nil {
+		return nil, translateDBErrors("userService.ListActiveUserSessions/ScanStructs", err)
+	}
+
+	// Succeeded
+	return us, nil
+}
+
 func (svc *userService) ListUserSessions(userID *uuid.UUID, pageIndex int) ([]*data.UserSession, error) {
 	logger.Debugf("userService.ListUserSessions(%s, %d)", userID, pageIndex)
 
@@ -725,6 +777,132 @@ func (svc *userService) ListUserSessions(userID *uuid.UUID, pageIndex int) ([]*d
 	return us, nil
 }
 
+func (svc *userService) Merge(curUserID *uuid.UUID, source, target *data.User) (*data.UserMerge, error) {
+	logger.Debugf("userService.Merge(%s, %v, %v)", curUserID, source, target)
+	m := data.NewUserMerge(curUserID, source, target)
+
+	// Reassign comment user references
+	for _, col := range []string{"user_created", "user_edited", "user_moderated", "user_deleted"} {
+		cnt, err := svc.mergeExec("cm_comments/"+col, svc.dbx().Update("cm_comments").
+			Set(goqu.Record{col: &target.ID}).
+			Where(goqu.Ex{col: &source.ID}))
+		if err != nil {
+			return nil, err
+		}
+		m.CountComments += cnt
+	}
+
+	// Reassign other user references, which aren't reported
+	for _, ref := range [][2]string{
+		{"cm_users", "user_created"},
+		{"cm_users", "user_banned"},
+		{"cm_configuration", "user_updated"},
+		{"cm_domain_configuration", "user_updated"},
+		{"cm_domain_invitations", "user_created"},
+		{"cm_domain_oidc_providers", "user_created"},
+		{"cm_user_merges", "user_created"},
+		{"cm_user_merges", "target_user_id"},
+	} {
+		if _, err := svc.mergeExec(ref[0]+"/"+ref[1], svc.dbx().Update(ref[0]).
+			Set(goqu.Record{ref[1]: &target.ID}).
+			Where(goqu.Ex{ref[1]: &source.ID})); err != nil {
+			return nil, err
+		}
+	}
+
+	// Move votes. If both users voted for the same comment, the target's vote wins, and the comment's score gets
+	// corrected for the dropped one
+	qTargetVoted := svc.dbx().From("cm_comment_votes").Select("comment_id").Where(goqu.Ex{"user_id": &target.ID})
+	for _, negative := range []bool{false, true} {
+		if _, err := svc.mergeExec("cm_comments/score", svc.dbx().Update("cm_comments").
+			Set(goqu.Record{"score": goqu.L("score + ?", util.If(negative, 1, -1))}).
+			Where(
+				goqu.I("id").In(svc.dbx().From("cm_comment_votes").
+					Select("comment_id").
+					Where(goqu.Ex{"user_id": &source.ID, "negative": negative})),
+				goqu.I("id").In(qTargetVoted))); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := svc.mergeExec("cm_comment_votes/delete", svc.dbx().Delete("cm_comment_votes").
+		Where(goqu.Ex{"user_id": &source.ID}, goqu.I("comment_id").In(qTargetVoted))); err != nil {
+		return nil, err
+	}
+	var err error
+	if m.CountVotes, err = svc.mergeExec("cm_comment_votes", svc.dbx().Update("cm_comment_votes").
+		Set(goqu.Record{"user_id": &target.ID}).
+		Where(goqu.Ex{"user_id": &source.ID})); err != nil {
+		return nil, err
+	}
+
+	// Move domain users. If both users are registered on the same domain, the target's record is kept, with the
+	// highest of both roles
+	var dus []*data.DomainUser
+	if err := svc.dbx().From("cm_domains_users").Where(goqu.Ex{"user_id": &source.ID}).ScanStructs(&dus); err != nil {
+		return nil, translateDBErrors("userService.Merge/ScanStructs[cm_domains_users]", err)
+	}
+	for _, du := range dus {
+		var tdu data.DomainUser
+		if b, err := svc.dbx().From("cm_domains_users").Where(goqu.Ex{"domain_id": &du.DomainID, "user_id": &target.ID}).ScanStruct(&tdu); err != nil {
+			return nil, translateDBErrors("userService.Merge/ScanStruct[cm_domains_users]", err)
+
+		} else if !b {
+			// No target domain user: simply reassign the record
+			if err := persistence.ExecOne(svc.dbx().Update("cm_domains_users").
+				Set(goqu.Record{"user_id": &target.ID}).
+				Where(goqu.Ex{"domain_id": &du.DomainID, "user_id": &source.ID})); err != nil {
+				return nil, translateDBErrors("userService.Merge/Update[cm_domains_users]", err)
+			}
+
+		} else {
+			// Upgrade the target's role if the source's one is higher
+			if du.IsOwner && !tdu.IsOwner || du.IsModerator && !tdu.IsModerator || du.IsCommenter && !tdu.IsCommenter {
+				tdu.IsOwner = tdu.IsOwner || du.IsOwner
+				tdu.IsModerator = tdu.IsModerator || du.IsModerator
+				tdu.IsCommenter = tdu.IsCommenter || du.IsCommenter
+				if err := Services.DomainService(svc.tx).UserModify(&tdu); err != nil {
+					return nil, err
+				}
+			}
+
+			// Drop the source's record
+			if err := persistence.ExecOne(svc.dbx().Delete("cm_domains_users").Where(goqu.Ex{"domain_id": &du.DomainID, "user_id": &source.ID})); err != nil {
+				return nil, translateDBErrors("userService.Merge/Delete[cm_domains_users]", err)
+			}
+		}
+		m.CountDomainUsers++
+	}
+
+	// Move sessions
+	if m.CountSessions, err = svc.mergeExec("cm_user_sessions", svc.dbx().Update("cm_user_sessions").
+		Set(goqu.Record{"user_id": &target.ID}).
+		Where(goqu.Ex{"user_id": &source.ID})); err != nil {
+		return nil, err
+	}
+
+	// Move attributes the target doesn't have yet
+	if m.CountAttrs, err = svc.mergeExec("cm_user_attrs", svc.dbx().Update("cm_user_attrs").
+		Set(goqu.Record{"user_id": &target.ID}).
+		Where(
+			goqu.Ex{"user_id": &source.ID},
+			goqu.I("key").NotIn(svc.dbx().From("cm_user_attrs").Select("key").Where(goqu.Ex{"user_id": &target.ID})))); err != nil {
+		return nil, err
+	}
+
+	// Delete the source user, along with anything left of theirs
+	if _, err := svc.DeleteUserByID(source, false, false); err != nil {
+		return nil, err
+	}
+
+	// Persist the audit record
+	if err := persistence.ExecOne(svc.dbx().Insert("cm_user_merges").Rows(m)); err != nil {
+		return nil, translateDBErrors("userService.Merge/Insert[cm_user_merges]", err)
+	}
+
+	// Succeeded
+	return m, nil
+}
+
 func (svc *userService) Persist(u *data.User) error {
 	if err := persistence.ExecOne(svc.dbx().Update("cm_users").Set(u).Where(goqu.Ex{"id": &u.ID})); err != nil {
 		return translateDBErrors("userService.Persist/Update", err)
@@ -783,6 +961,33 @@ func (svc *userService) UpdateLoginLocked(u *data.User) error {
 	return svc.Persist(u)
 }
 
+func (svc *userService) UpdateTOTPUsage(u *data.User, prevStep int64, prevRecovery string) error {
+	logger.Debugf("userService.UpdateTOTPUsage(%v, %d, ...)", u, prevStep)
+
+	// Update the record, unless it's been changed in the meantime
+	err := persistence.ExecOne(svc.dbx().Update("cm_users").
+		Set(goqu.Record{"totp_last_step": u.TOTPLastStep, "totp_recovery": u.TOTPRecovery}).
+		Where(goqu.Ex{"id": &u.ID, "totp_last_step": prevStep, "totp_recovery": prevRecovery}))
+	if err != nil {
+		return translateDBErrors("userService.UpdateTOTPUsage/ExecOne", err)
+	}
+
+	// Succeeded
+	return nil
+}
+
+// mergeExec executes the given merge statement and returns the number of affected rows. op is the statement name used
+// in error reporting
+func (svc *userService) mergeExec(op string, q persistence.Executable) (int64, error) {
+	if res, err := q.Executor().Exec(); err != nil {
+		return 0, translateDBErrors("userService.Merge/Exec["+op+"]", err)
+	} else if cnt, err := res.RowsAffected(); err != nil {
+		return 0, translateDBErrors("userService.Merge/RowsAffected["+op+"]", err)
+	} else {
+		return cnt, nil
+	}
+}
+
 // handleUserEvent fires a user event. It returns true if the user has been modified during the event handling
 func handleUserEvent[E plugin.UserPayload](e E, u *data.User, tx *persistence.DatabaseTx) (changed bool, err error) {
 	// Skip unless the plugin manager is active
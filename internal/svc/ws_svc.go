@@ -26,6 +26,8 @@ type WebSocketsService interface {
 	Active() bool
 	// Add a new WebSocket subscription by upgrading the provided HTTP request
 	Add(w http.ResponseWriter, r *http.Request) error
+	// NumClients returns the number of currently connected clients
+	NumClients() int
 	// Run the service
 	Run() error
 	// Send a message to relevant clients
@@ -118,6 +120,10 @@ func (svc *webSocketsService) Add(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+func (svc *webSocketsService) NumClients() int {
+	return int(svc.numClients.Load())
+}
+
 func (svc *webSocketsService) Run() error {
 	logger.Debug("webSocketsService.Run()")
 
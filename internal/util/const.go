@@ -13,6 +13,7 @@ const (
 	APIPath         = "api/"           // Root path of the API requests
 	SwaggerUIPath   = APIPath + "docs" // Root path of the Swagger UI
 	WebSocketsPath  = "ws/"            // Root path of the WebSockets endpoints
+	MetricsPath     = "metrics"        // Path of the Prometheus metrics endpoint
 
 	GitLabProjectID   = "42486427"                                                             // ID of Comentario GitLab project
 	GitLabReleasesURL = "https://gitlab.com/api/v4/projects/" + GitLabProjectID + "/releases/" // URL of the releases endpoint
@@ -22,6 +23,8 @@ const (
 	DBMaxAttempts = 10 // Max number of attempts to connect to the database
 
 	ResultPageSize = 25 // Max number of database rows to return
+
+	StatsMaxBuckets = 1000 // Max number of buckets in a stats time series
 )
 
 // Cookie names
@@ -49,9 +52,15 @@ const (
 	LangCookieDuration       = 365 * OneDay     // How long the language cookie stays valid
 	UserConfirmEmailDuration = 3 * OneDay       // How long the token in the confirmation email stays valid
 	UserPwdResetDuration     = 12 * time.Hour   // How long the token in the password-reset email stays valid
+	UserDataExportDuration   = 24 * time.Hour   // How long the link in the personal data export email stays valid
+	DomainInvitationDuration = 7 * OneDay       // How long the link in the domain invitation email stays valid
+	UserLoginRevokeDuration  = 7 * OneDay       // How long the link in the unusual login email stays valid
 	AvatarFetchTimeout       = 5 * time.Second  // Timeout for fetching external avatars
 	ConfigCacheTTL           = 30 * time.Second // TTL for cached configs
 	AttrCacheTTL             = 10 * time.Second // TTL for cached attributes
+	OIDCProviderCacheTTL     = time.Hour        // TTL for cached domain OIDC providers (and their discovered configuration)
+	OIDCRequestTimeout       = 10 * time.Second // Timeout for requests to domain OIDC providers
+	GeoIPCheckInterval       = time.Minute      // How often GeoIP database files are checked for changes
 )
 
 var (
@@ -100,6 +109,9 @@ func init() {
 		// Embed endpoints are cross-site by design because scripts are always loaded from a different origin
 		"api/embed/",
 
+		// SAML IdPs post their responses to the OAuth callback cross-site
+		"api/oauth/",
+
 		// Avoid setting the XSRF session cookies on static resources because it prevents caching them (when combined
 		// with the "Vary: Cookie" HTTP header automatically added by the runtime)
 		"en/fonts/",
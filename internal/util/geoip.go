@@ -0,0 +1,171 @@
+package util
+
+import (
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/phuslu/iploc"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GeoInfo holds geolocation information resolved for an IP address
+type GeoInfo struct {
+	Country string // 2-letter country code
+	Region  string // Name of the region (first-level subdivision)
+	City    string // Name of the city
+	ASN     uint32 // Number of the autonomous system
+	ASOrg   string // Organisation of the autonomous system
+}
+
+// geoIPRecord is a MaxMind DB record, combining the fields of the City and ASN databases
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint32 `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoIPDatabase is a MaxMind DB file that gets reloaded whenever it changes on disk
+type geoIPDatabase struct {
+	path    string            // Path to the file
+	modTime time.Time         // Modification time of the loaded file
+	size    int64             // Size of the loaded file
+	reader  *maxminddb.Reader // Loaded database reader, nil if none
+}
+
+var (
+	geoIPDBs   []*geoIPDatabase // Configured GeoIP databases
+	geoIPMu    sync.RWMutex     // Mutex for geoIPDBs
+	geoIPWatch sync.Once        // Ensures the change watcher is only started once
+)
+
+// ConfigureGeoIP loads the MaxMind-format GeoIP database files at the given paths and starts watching them for changes,
+// reloading each file once it's modified. Lookups fall back to the built-in country resolution when no database is
+// configured or no database has a record for the address
+func ConfigureGeoIP(paths []string, checkInterval time.Duration) error {
+	var dbs []*geoIPDatabase
+	for _, p := range paths {
+		db := &geoIPDatabase{path: p}
+		if _, err := db.reload(); err != nil {
+			return err
+		}
+		dbs = append(dbs, db)
+	}
+
+	// Install the databases
+	geoIPMu.Lock()
+	geoIPDBs = dbs
+	geoIPMu.Unlock()
+
+	// Start a watcher, if there's anything to watch
+	if len(dbs) > 0 {
+		geoIPWatch.Do(func() { go watchGeoIP(checkInterval) })
+	}
+	return nil
+}
+
+// GeoByIP resolves the given IP address into geolocation information
+func GeoByIP(ip string) *GeoInfo {
+	res := &GeoInfo{}
+	pip := net.ParseIP(ip)
+	if pip == nil {
+		return res
+	}
+
+	// Look the address up in every database, with the earlier ones taking precedence
+	geoIPMu.RLock()
+	for _, db := range geoIPDBs {
+		if db.reader != nil {
+			var rec geoIPRecord
+			if err := db.reader.Lookup(pip, &rec); err != nil {
+				logger.Debugf("GeoIP lookup of %s in %s failed: %v", ip, db.path, err)
+			} else {
+				res.fill(&rec)
+			}
+		}
+	}
+	geoIPMu.RUnlock()
+
+	// Fall back to the built-in country resolution. Convert "ZZ" (=unknown) into an empty string
+	if res.Country == "" {
+		if c := iploc.Country(pip); c != "ZZ" {
+			res.Country = c
+		}
+	}
+	return res
+}
+
+// fill sets any unset properties from the given database record
+func (g *GeoInfo) fill(rec *geoIPRecord) {
+	if g.Country == "" {
+		g.Country = strings.ToUpper(rec.Country.ISOCode)
+	}
+	if g.Region == "" && len(rec.Subdivisions) > 0 {
+		g.Region = rec.Subdivisions[0].Names["en"]
+	}
+	if g.City == "" {
+		g.City = rec.City.Names["en"]
+	}
+	if g.ASN == 0 {
+		g.ASN = rec.ASN
+	}
+	if g.ASOrg == "" {
+		g.ASOrg = rec.ASOrg
+	}
+}
+
+// reload (re)loads the database file if it has changed since the last load, and returns whether it was reloaded
+func (db *geoIPDatabase) reload() (bool, error) {
+	fi, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+
+	// Skip if the file hasn't changed
+	if db.reader != nil && fi.ModTime().Equal(db.modTime) && fi.Size() == db.size {
+		return false, nil
+	}
+
+	// Load the file into memory, so that a replaced reader needs no closing
+	b, err := os.ReadFile(db.path)
+	if err != nil {
+		return false, err
+	}
+	r, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return false, err
+	}
+	db.reader, db.modTime, db.size = r, fi.ModTime(), fi.Size()
+	logger.Infof("Loaded GeoIP database %s (%s)", db.path, r.Metadata.DatabaseType)
+	return true, nil
+}
+
+// watchGeoIP periodically checks the configured GeoIP databases for changes and reloads those changed. A failed reload
+// keeps the previously loaded database in use
+func watchGeoIP(interval time.Duration) {
+	for range time.Tick(interval) {
+		geoIPMu.RLock()
+		dbs := geoIPDBs
+		geoIPMu.RUnlock()
+		for _, db := range dbs {
+			// Load a copy so that lookups never see a half-updated database
+			c := *db
+			if ok, err := c.reload(); err != nil {
+				logger.Warningf("Failed to reload GeoIP database %s: %v", db.path, err)
+			} else if ok {
+				geoIPMu.Lock()
+				*db = c
+				geoIPMu.Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWT signature algorithms
+const (
+	JWTAlgES256 = "ES256"
+	JWTAlgRS256 = "RS256"
+)
+
+// JWTLeeway is the allowed clock skew when validating JWT time claims
+const JWTLeeway = time.Minute
+
+// jwtEncoding is the encoding used for JWK values
+var jwtEncoding = base64.RawURLEncoding
+
+// JWTKey is a public key for verifying JWT signatures
+type JWTKey struct {
+	ID  string           // Optional key ID, only available for keys coming from a JWKS
+	Key crypto.PublicKey // Key itself, either *rsa.PublicKey or *ecdsa.PublicKey (P-256)
+}
+
+// jwk is a single JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWTParseKeys parses the given string, which is either a JSON Web Key Set document or one or more PEM blocks holding
+// public keys or certificates, and returns the RSA and P-256 ECDSA keys in it
+func JWTParseKeys(s string) ([]*JWTKey, error) {
+	s = strings.TrimSpace(s)
+	var res []*JWTKey
+
+	// A JWKS is a JSON object
+	if strings.HasPrefix(s, "{") {
+		var jwks struct {
+			Keys []jwk `json:"keys"`
+		}
+		if err := json.Unmarshal([]byte(s), &jwks); err != nil {
+			return nil, fmt.Errorf("jwt: failed to parse JWKS: %w", err)
+		}
+		for i, k := range jwks.Keys {
+			// Skip keys not meant for signing
+			if k.Use != "" && k.Use != "sig" {
+				continue
+			}
+			if key, err := k.publicKey(); err != nil {
+				return nil, fmt.Errorf("jwt: JWKS key #%d: %w", i, err)
+			} else if key != nil {
+				res = append(res, &JWTKey{ID: k.Kid, Key: key})
+			}
+		}
+
+	} else {
+		// Otherwise, iterate PEM blocks
+		rest := []byte(s)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			switch block.Type {
+			case "PUBLIC KEY", "RSA PUBLIC KEY", "CERTIFICATE":
+			default:
+				return nil, fmt.Errorf("jwt: unsupported PEM block type %q", block.Type)
+			}
+
+			// Try an RSA key first, then an ECDSA one
+			b := pem.EncodeToMemory(block)
+			if key, err := jwt.ParseRSAPublicKeyFromPEM(b); err == nil {
+				res = append(res, &JWTKey{Key: key})
+			} else if key, err := jwt.ParseECPublicKeyFromPEM(b); err != nil {
+				return nil, fmt.Errorf("jwt: failed to parse PEM block %q: %w", block.Type, err)
+			} else if key.Curve != elliptic.P256() {
+				return nil, errors.New("jwt: only P-256 ECDSA keys are supported")
+			} else {
+				res = append(res, &JWTKey{Key: key})
+			}
+		}
+	}
+
+	// Make sure there's at least one key
+	if len(res) == 0 {
+		return nil, errors.New("jwt: no usable public keys found")
+	}
+	return res, nil
+}
+
+// JWTVerify parses the given compact-serialised JWT, verifies its signature against the given keys, validates its
+// issuer, audience, and time claims, and returns its (JSON) claims set. The token must have an expiration time
+func JWTVerify(token string, keys []*JWTKey, issuer, audience string, now time.Time) ([]byte, error) {
+	p := jwt.NewParser(
+		jwt.WithValidMethods([]string{JWTAlgRS256, JWTAlgES256}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(JWTLeeway),
+		jwt.WithTimeFunc(func() time.Time { return now }))
+
+	// Verify the token, offering all keys matching its key ID, if any
+	t, err := p.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		var ks jwt.VerificationKeySet
+		for _, k := range keys {
+			if kid == "" || k.ID == "" || k.ID == kid {
+				ks.Keys = append(ks.Keys, k.Key)
+			}
+		}
+		return ks, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
+
+	// Return the raw claims: the parse has already validated the token's structure
+	claims, err := p.DecodeSegment(strings.Split(t.Raw, ".")[1])
+	if err != nil {
+		return nil, fmt.Errorf("jwt: failed to decode claims: %w", err)
+	}
+	return claims, nil
+}
+
+// publicKey converts the JWK into a public key. Returns nil if the key type isn't supported
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := jwtEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := jwtEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key parameters")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := jwtEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := jwtEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		//goland:noinspection GoDeprecation
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point isn't on the curve")
+		}
+		return pub, nil
+	}
+
+	// Unsupported key type: skip it
+	return nil, nil
+}
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAPEntry is a directory entry returned by an LDAP search
+type LDAPEntry struct {
+	*ldap.Entry
+}
+
+// Value returns the first value of the given attribute, or an empty string if there's none. Binary values (those not
+// being valid UTF-8) are returned hex-encoded
+func (e *LDAPEntry) Value(attr string) string {
+	if vs := e.GetEqualFoldRawAttributeValues(attr); len(vs) > 0 {
+		return ldapValueString(vs[0])
+	}
+	return ""
+}
+
+// Values returns all values of the given attribute, with binary values hex-encoded
+func (e *LDAPEntry) Values(attr string) []string {
+	var res []string
+	for _, v := range e.GetEqualFoldRawAttributeValues(attr) {
+		res = append(res, ldapValueString(v))
+	}
+	return res
+}
+
+// LDAPConn is a connection to an LDAP server
+type LDAPConn struct {
+	conn    *ldap.Conn
+	timeout time.Duration
+}
+
+// LDAPDial connects to the LDAP server at the given URL ("ldap://" or "ldaps://"), optionally upgrading a plain
+// connection with StartTLS. insecure disables server certificate verification. timeout applies to connecting and to
+// every subsequent operation
+func LDAPDial(rawURL string, startTLS, insecure bool, timeout time.Duration) (*LDAPConn, error) {
+	// Parse the URL
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return nil, errors.New("invalid LDAP URL: host is missing")
+	}
+	switch u.Scheme {
+	case "ldap":
+	case "ldaps":
+		if startTLS {
+			return nil, errors.New("StartTLS cannot be used with an ldaps:// URL")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme: %q", u.Scheme)
+	}
+	tlsCfg := &tls.Config{ServerName: host, InsecureSkipVerify: insecure}
+
+	// Connect to the server
+	conn, err := ldap.DialURL(
+		u.Scheme+"://"+u.Host,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsCfg))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	// Upgrade the connection, if needed
+	if startTLS {
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	// Succeeded
+	return &LDAPConn{conn: conn, timeout: timeout}, nil
+}
+
+// LDAPEscapeFilterValue escapes the given string for use as a value in an LDAP filter, as per RFC 4515
+func LDAPEscapeFilterValue(s string) string {
+	return ldap.EscapeFilter(s)
+}
+
+// LDAPIsInvalidCredentials returns whether the given error is a bind failure due to a wrong DN or password
+func LDAPIsInvalidCredentials(err error) bool {
+	return ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials)
+}
+
+// Bind authenticates the connection with the given DN and password. An empty password is rejected since the server
+// would otherwise treat it as an unauthenticated bind, which always succeeds
+func (c *LDAPConn) Bind(dn, password string) error {
+	if password == "" {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("empty password"))
+	}
+	return c.conn.Bind(dn, password)
+}
+
+// Close unbinds and closes the connection
+func (c *LDAPConn) Close() error {
+	if err := c.conn.Unbind(); err != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// Search performs a subtree search under the given base DN, returning at most sizeLimit entries (0 means no limit)
+// matching the filter, with only the given attributes. Exceeding the size limit isn't considered an error: the
+// entries received so far are returned. Referrals aren't followed
+func (c *LDAPConn) Search(baseDN, filter string, attrs []string, sizeLimit int) ([]*LDAPEntry, error) {
+	sr, err := c.conn.Search(ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		sizeLimit,
+		int(c.timeout/time.Second),
+		false,
+		filter,
+		attrs,
+		nil))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	res := make([]*LDAPEntry, len(sr.Entries))
+	for i, e := range sr.Entries {
+		res[i] = &LDAPEntry{e}
+	}
+	return res, nil
+}
+
+// ldapValueString converts an attribute value into a string, hex-encoding it if it isn't valid UTF-8
+func ldapValueString(b []byte) string {
+	if s := string(b); strings.ToValidUTF8(s, "�") == s {
+		return s
+	}
+	return hex.EncodeToString(b)
+}
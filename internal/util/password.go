@@ -0,0 +1,219 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordHasher is a password hashing algorithm. Every hash it produces starts with an algorithm-specific prefix,
+// which allows to pick the right algorithm when verifying a stored hash
+type passwordHasher interface {
+	// Handles returns whether the given hash has been produced by this algorithm
+	Handles(hash string) bool
+	// Hash returns a hash of the given plain-text password
+	Hash(pwd string) (string, error)
+	// Verify returns whether the given plain-text password matches the hash
+	Verify(hash, pwd string) bool
+	// Outdated returns whether the hash has been produced with parameters weaker than the current ones
+	Outdated(hash string) bool
+}
+
+// passwordHashers lists all supported password hashing algorithms, the first one being the default used for new hashes
+var passwordHashers = []passwordHasher{
+	&argon2idHasher{memory: 19 * 1024, iterations: 2, parallelism: 1, saltLen: 16, keyLen: 32},
+	&bcryptHasher{minCost: bcrypt.DefaultCost},
+}
+
+// HashPassword returns a hash of the given plain-text password, produced by the default algorithm
+func HashPassword(pwd string) (string, error) {
+	return passwordHashers[0].Hash(pwd)
+}
+
+// IsBcryptPasswordHash returns whether the given string is a well-formed bcrypt hash with an acceptable cost
+func IsBcryptPasswordHash(hash string) bool {
+	b := &bcryptHasher{}
+	if !b.Handles(hash) {
+		return false
+	}
+	_, err := b.cost(hash)
+	return err == nil
+}
+
+// PasswordNeedsRehash returns whether the given hash has to be upgraded, because it's produced by an algorithm other
+// than the default one, or with outdated parameters
+func PasswordNeedsRehash(hash string) bool {
+	h := findPasswordHasher(hash)
+	return h != nil && (h != passwordHashers[0] || h.Outdated(hash))
+}
+
+// VerifyPassword returns whether the given plain-text password matches the hash, which can be produced by any of the
+// supported algorithms
+func VerifyPassword(hash, pwd string) bool {
+	if h := findPasswordHasher(hash); h != nil {
+		return h.Verify(hash, pwd)
+	}
+	return false
+}
+
+// findPasswordHasher returns the algorithm that produced the given hash, or nil if there's none
+func findPasswordHasher(hash string) passwordHasher {
+	for _, h := range passwordHashers {
+		if h.Handles(hash) {
+			return h
+		}
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// Upper limits of Argon2id parameters accepted in a stored hash, which protect against a (planted) hash that would take
+// excessive memory or time to verify
+const (
+	argon2idMaxMemory      = 256 * 1024 // KiB
+	argon2idMaxIterations  = 16
+	argon2idMaxParallelism = 16
+	argon2idMaxSaltLen     = 64 // Bytes
+	argon2idMaxKeyLen      = 64 // Bytes
+)
+
+// argon2idHasher is a passwordHasher producing Argon2id hashes in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type argon2idHasher struct {
+	memory      uint32 // Memory size, in KiB
+	iterations  uint32 // Number of passes over the memory
+	parallelism uint8  // Number of threads
+	saltLen     int    // Salt length, in bytes
+	keyLen      uint32 // Key length, in bytes
+}
+
+const argon2idPrefix = "$argon2id$"
+
+func (a *argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (a *argon2idHasher) Hash(pwd string) (string, error) {
+	salt := make([]byte, a.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pwd), salt, a.iterations, a.memory, a.parallelism, a.keyLen)
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		a.memory,
+		a.iterations,
+		a.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *argon2idHasher) Verify(hash, pwd string) bool {
+	p, salt, key, err := a.parse(hash)
+	if err != nil {
+		return false
+	}
+	k := argon2.IDKey([]byte(pwd), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(k, key) == 1
+}
+
+func (a *argon2idHasher) Outdated(hash string) bool {
+	p, salt, key, err := a.parse(hash)
+	return err != nil ||
+		p.memory < a.memory ||
+		p.iterations < a.iterations ||
+		p.parallelism < a.parallelism ||
+		len(salt) < a.saltLen ||
+		len(key) < int(a.keyLen)
+}
+
+// parse splits the given hash into its parameters, salt, and key
+func (a *argon2idHasher) parse(hash string) (p *argon2idHasher, salt, key []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(hash, argon2idPrefix), "$")
+	if len(parts) != 4 {
+		return nil, nil, nil, errors.New("invalid argon2id hash format")
+	}
+
+	// Check the version
+	var ver int
+	if _, err = fmt.Sscanf(parts[0], "v=%d", &ver); err != nil {
+		return
+	} else if ver != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2id version: %d", ver)
+	}
+
+	// Parse the parameters
+	p = &argon2idHasher{}
+	if _, err = fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return
+	}
+
+	// Decode the salt and the key
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil {
+		return
+	}
+	if p.memory == 0 || p.memory > argon2idMaxMemory ||
+		p.iterations == 0 || p.iterations > argon2idMaxIterations ||
+		p.parallelism == 0 || p.parallelism > argon2idMaxParallelism ||
+		len(salt) > argon2idMaxSaltLen ||
+		len(key) == 0 || len(key) > argon2idMaxKeyLen {
+		return nil, nil, nil, errors.New("invalid argon2id hash parameters")
+	}
+	return
+}
+
+// ---------------------------------------------------------------------------------------------------------------------
+
+// bcryptMaxCost is the highest bcrypt cost accepted in a stored hash, which protects against a (planted) hash that would
+// take excessive time to verify
+const bcryptMaxCost = 16
+
+// bcryptHasher is a passwordHasher producing bcrypt hashes, which start with $2a$, $2b$, or $2y$. This is the legacy
+// algorithm, also used by Commento
+type bcryptHasher struct {
+	minCost int // Cost of new hashes, any lower cost is considered outdated
+}
+
+func (b *bcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b *bcryptHasher) Hash(pwd string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(pwd), b.minCost)
+	return string(h), err
+}
+
+func (b *bcryptHasher) Verify(hash, pwd string) bool {
+	if _, err := b.cost(hash); err != nil {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pwd)) == nil
+}
+
+func (b *bcryptHasher) Outdated(hash string) bool {
+	cost, err := b.cost(hash)
+	return err != nil || cost < b.minCost
+}
+
+// cost returns the cost of the given hash, failing if it's malformed or exceeds bcryptMaxCost
+func (b *bcryptHasher) cost(hash string) (int, error) {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return 0, err
+	} else if cost > bcryptMaxCost {
+		return 0, fmt.Errorf("bcrypt cost %d exceeds the maximum of %d", cost, bcryptMaxCost)
+	}
+	return cost, nil
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"os"
+	"strings"
+)
+
+// pwnedFPRate is the false-positive rate of the compromised password filter, i.e. the share of passwords that get
+// rejected without actually being on the list
+const pwnedFPRate = 0.001
+
+// pwnedFilter is the loaded compromised password filter, nil if none is configured
+var pwnedFilter *bloomFilter
+
+// ConfigurePwnedPasswords loads the list of compromised passwords from the file at the given path into memory. Every
+// non-empty line of the file is either a hex-encoded SHA-1 hash of a password, optionally followed by a colon and an
+// occurrence count (which is the format of Have I Been Pwned downloads), or a plain-text password. An empty path
+// disables the check
+func ConfigurePwnedPasswords(path string) error {
+	if path == "" {
+		pwnedFilter = nil
+		return nil
+	}
+
+	// Count the entries first to size the filter
+	n, err := pwnedScan(path, nil)
+	if err != nil {
+		return err
+	}
+
+	// Fill the filter
+	f := newBloomFilter(n, pwnedFPRate)
+	if _, err := pwnedScan(path, f.add); err != nil {
+		return err
+	}
+	pwnedFilter = f
+	logger.Infof("Loaded %d compromised passwords from %s", n, path)
+	return nil
+}
+
+// IsPwnedPassword returns whether the given password is on the list of compromised passwords. There's a small chance
+// of a false positive, but never of a false negative. Always returns false if no list is configured
+func IsPwnedPassword(s string) bool {
+	return pwnedFilter != nil && pwnedFilter.has(sha1.Sum([]byte(s)))
+}
+
+// pwnedScan reads the compromised password file at the given path, calling fn (if not nil) for the SHA-1 hash of every
+// entry. Returns the number of entries
+func pwnedScan(path string, fn func(h [sha1.Size]byte)) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer LogError(f.Close, "pwnedScan, f.Close()")
+
+	var n uint64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if fn != nil {
+			fn(pwnedParseLine(line))
+		}
+		n++
+	}
+	return n, sc.Err()
+}
+
+// pwnedParseLine converts a line of the compromised password file into a SHA-1 hash
+func pwnedParseLine(line string) [sha1.Size]byte {
+	var h [sha1.Size]byte
+	if hl := hex.EncodedLen(sha1.Size); len(line) == hl || len(line) > hl && line[hl] == ':' {
+		if _, err := hex.Decode(h[:], []byte(line[:hl])); err == nil {
+			return h
+		}
+	}
+
+	// Not a hash: consider it a plain-text password
+	return sha1.Sum([]byte(line))
+}
+
+//----------------------------------------------------------------------------------------------------------------------
+
+// bloomFilter is a Bloom filter of SHA-1 hashes. Since the hashes are already uniformly distributed, their bits are
+// used for indexing directly, by means of double hashing
+type bloomFilter struct {
+	bits []uint64 // Filter bits
+	m    uint64   // Number of bits
+	k    uint64   // Number of bits set per entry
+}
+
+// newBloomFilter returns a new, empty Bloom filter, sized for n entries with the given false-positive rate
+func newBloomFilter(n uint64, fpRate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(max(n, 1)) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(max(math.Round(float64(m)/float64(max(n, 1))*math.Ln2), 1))
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// add adds the given hash to the filter
+func (f *bloomFilter) add(h [sha1.Size]byte) {
+	h1, h2 := bloomSplit(h)
+	for i := uint64(0); i < f.k; i++ {
+		idx := (h1 + i*h2) % f.m
+		f.bits[idx/64] |= 1 << (idx % 64)
+	}
+}
+
+// has returns whether the given hash is (probably) in the filter
+func (f *bloomFilter) has(h [sha1.Size]byte) bool {
+	h1, h2 := bloomSplit(h)
+	for i := uint64(0); i < f.k; i++ {
+		idx := (h1 + i*h2) % f.m
+		if f.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomSplit derives two hash values from the given SHA-1 hash. The second one is made odd so that it never degenerates
+// into zero
+func bloomSplit(h [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(h[0:8]), binary.BigEndian.Uint64(h[8:16]) | 1
+}
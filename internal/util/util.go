@@ -4,6 +4,8 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
 	cryptorand "crypto/rand"
 	"crypto/sha256"
@@ -13,7 +15,6 @@ import (
 	"github.com/avct/uasurfer"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/op/go-logging"
-	"github.com/phuslu/iploc"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	gmhtml "github.com/yuin/goldmark/renderer/html"
@@ -27,6 +28,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode/utf8"
 )
@@ -117,11 +119,7 @@ func CompressGzip(b []byte) ([]byte, error) {
 
 // CountryByIP tries to determine the country code for the given IP address
 func CountryByIP(ip string) string {
-	// Parse the IP and convert it to a country code. Convert "ZZ" (=unknown) into an empty string
-	if country := iploc.Country(net.ParseIP(ip)); country != "ZZ" {
-		return country
-	}
-	return ""
+	return GeoByIP(ip).Country
 }
 
 // DecompressGzip reads and decompresses a gzip-compressed archive from the given data buffer
@@ -172,6 +170,39 @@ func DecompressZip(data []byte) ([]byte, error) {
 	}
 }
 
+// DecryptAES decrypts the given data, previously encrypted with EncryptAES, using the given key
+func DecryptAES(data, key []byte) ([]byte, error) {
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split the data into a nonce and the ciphertext
+	ns := gcm.NonceSize()
+	if len(data) < ns {
+		return nil, errors.New("encrypted data is too short")
+	}
+	return gcm.Open(nil, data[:ns], data[ns:], nil)
+}
+
+// EncryptAES encrypts the given data with AES-GCM using the given key, which must be 16, 24, or 32 bytes long. The
+// returned value is prefixed with a random nonce
+func EncryptAES(data, key []byte) ([]byte, error) {
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate a random nonce
+	nonce, err := RandomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	// Append the ciphertext to the nonce
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
 // FormatVersion renders the given uasurfer.Version as a string
 func FormatVersion(v *uasurfer.Version) string {
 	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
@@ -260,6 +291,33 @@ func If[T any](cond bool, ifTrue, ifFalse T) T {
 	return ifFalse
 }
 
+// IsPublicHost returns whether the given host name or IP address resolves to public IP addresses only (see IsPublicIP)
+func IsPublicHost(host string) bool {
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !IsPublicIP(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPublicIP returns whether the given IP address is a public one, i.e. not a loopback, private, link-local, multicast,
+// or unspecified address
+func IsPublicIP(ip net.IP) bool {
+	return ip != nil &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
 // IsStrongPassword checks whether the provided password is a 'strong' one
 func IsStrongPassword(s string) bool {
 	// Check length
@@ -443,6 +501,15 @@ func MD5ToHex(checksum *[16]byte) string {
 	return hex.EncodeToString((*checksum)[:])
 }
 
+// newAESGCM instantiates an AES cipher in Galois Counter Mode using the given key
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
 // ParseAbsoluteURL parses and returns the passed string as an absolute URL. If allowHTTP == false, HTTPS URLs are
 // enforced. If trimTrailingSlash == true, any trailing slash is removed except when the path consists of a single
 // slash
@@ -479,6 +546,31 @@ func ParseAbsoluteURL(s string, allowHTTP, trimTrailingSlash bool) (*url.URL, er
 	return u, nil
 }
 
+// PublicHTTPClient returns an HTTP client that refuses to connect to non-public IP addresses (see IsPublicIP), which
+// makes it safe to use with user-supplied URLs. The check is made on connecting, so it also applies to redirects and
+// to host names resolving to a different address later
+func PublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicIP(net.ParseIP(host)) {
+				return fmt.Errorf("connecting to non-public address %s is forbidden", host)
+			}
+			return nil
+		},
+	}
+
+	// Don't use a proxy, since it would connect to the target on our behalf, bypassing the check
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
 // RandomBytes makes a random byte slice of the desired size
 func RandomBytes(n int) ([]byte, error) {
 	b := make([]byte, n)
@@ -612,8 +704,14 @@ func UserIP(r *http.Request) string {
 
 // UserIPCountry tries to determine the IP address and country code of the user based on it, optionally masking the IP
 func UserIPCountry(r *http.Request, maskIP bool) (ip, country string) {
+	ip, geo := UserIPGeo(r, maskIP)
+	return ip, geo.Country
+}
+
+// UserIPGeo tries to determine the IP address and geolocation of the user based on it, optionally masking the IP
+func UserIPGeo(r *http.Request, maskIP bool) (ip string, geo *GeoInfo) {
 	ip = UserIP(r)
-	country = CountryByIP(ip)
+	geo = GeoByIP(ip)
 	if maskIP {
 		ip = MaskIP(ip)
 	}
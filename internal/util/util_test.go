@@ -2,15 +2,31 @@ package util
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
 	"errors"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
 	"github.com/go-openapi/strfmt"
+	"golang.org/x/crypto/bcrypt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mustDecode decodes the given hex string into a byte slice, panicking if it fails
@@ -251,6 +267,165 @@ func TestDecompressZip(t *testing.T) {
 	}
 }
 
+func TestEncryptAES(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	tests := []struct {
+		name    string
+		data    []byte
+		key     []byte
+		wantErr bool
+	}{
+		{"nil data       ", nil, key, false},
+		{"empty data     ", []byte{}, key, false},
+		{"some data      ", []byte("It's a secret"), key, false},
+		{"128-bit key    ", []byte("It's a secret"), key[:16], false},
+		{"nil key        ", []byte("It's a secret"), nil, true},
+		{"bad key length ", []byte("It's a secret"), key[:20], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := EncryptAES(tt.data, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EncryptAES() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			} else if err != nil {
+				return
+			}
+
+			// Decrypt the data back
+			got, err := DecryptAES(enc, tt.key)
+			if err != nil {
+				t.Errorf("DecryptAES() error = %v", err)
+			} else if !bytes.Equal(got, tt.data) {
+				t.Errorf("DecryptAES() got = %x, want %x", got, tt.data)
+			}
+
+			// Make sure a different key doesn't work
+			if _, err := DecryptAES(enc, bytes.Repeat([]byte{0x24}, len(tt.key))); err == nil {
+				t.Error("DecryptAES() with a wrong key succeeded")
+			}
+
+			// Make sure tampered data is rejected
+			enc[len(enc)-1] ^= 0xff
+			if _, err := DecryptAES(enc, tt.key); err == nil {
+				t.Error("DecryptAES() of tampered data succeeded")
+			}
+
+			// Make sure truncated data is rejected
+			if _, err := DecryptAES(enc[:4], tt.key); err == nil {
+				t.Error("DecryptAES() of truncated data succeeded")
+			}
+		})
+	}
+}
+
+// mmdbEncode encodes the given value as a MaxMind DB data field. Only strings, arrays, and maps shorter than 285 items,
+// and 32-bit unsigned integers are supported
+func mmdbEncode(v any) []byte {
+	ctrl := func(typ byte, size int) []byte {
+		var b []byte
+		if typ > 7 {
+			b = []byte{0, typ - 7}
+		} else {
+			b = []byte{typ << 5}
+		}
+		if size < 29 {
+			b[0] |= byte(size)
+		} else {
+			b[0] |= 29
+			b = append(b, byte(size-29))
+		}
+		return b
+	}
+	switch v := v.(type) {
+	case string:
+		return append(ctrl(2, len(v)), v...)
+	case uint32:
+		return append(ctrl(6, 4), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case []any:
+		b := ctrl(11, len(v))
+		for _, e := range v {
+			b = append(b, mmdbEncode(e)...)
+		}
+		return b
+	case map[string]any:
+		b := ctrl(7, len(v))
+		for k, e := range v {
+			b = append(append(b, mmdbEncode(k)...), mmdbEncode(e)...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+func TestGeoByIP(t *testing.T) {
+	// Build an IPv4 database with a single node, mapping addresses from 128.0.0.0 upwards to the only record
+	var db []byte
+	db = append(db, 0, 0, 1, 0, 0, 17)   // Search tree: left record is empty, right one points to data offset 0
+	db = append(db, make([]byte, 16)...) // Data section separator
+	db = append(db, mmdbEncode(map[string]any{
+		"country":                        map[string]any{"iso_code": "de"},
+		"subdivisions":                   []any{map[string]any{"names": map[string]any{"en": "Berlin State"}}},
+		"city":                           map[string]any{"names": map[string]any{"en": "Berlin"}},
+		"autonomous_system_number":       uint32(64500),
+		"autonomous_system_organization": "Example Org",
+	})...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, mmdbEncode(map[string]any{
+		"binary_format_major_version": uint32(2),
+		"database_type":               "Test-City-ASN",
+		"ip_version":                  uint32(4),
+		"node_count":                  uint32(1),
+		"record_size":                 uint32(24),
+	})...)
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "test.mmdb")
+	if err := os.WriteFile(dbFile, db, 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	badFile := filepath.Join(dir, "bad.mmdb")
+	if err := os.WriteFile(badFile, []byte("not a database"), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	// Verify invalid databases are rejected
+	if err := ConfigureGeoIP([]string{badFile}, time.Hour); err == nil {
+		t.Errorf("ConfigureGeoIP() with an invalid file succeeded")
+	}
+	if err := ConfigureGeoIP([]string{filepath.Join(dir, "missing.mmdb")}, time.Hour); err == nil {
+		t.Errorf("ConfigureGeoIP() with a missing file succeeded")
+	}
+
+	// Install the valid one
+	if err := ConfigureGeoIP([]string{dbFile}, time.Hour); err != nil {
+		t.Fatalf("ConfigureGeoIP() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		geoIPMu.Lock()
+		geoIPDBs = nil
+		geoIPMu.Unlock()
+	})
+
+	tests := []struct {
+		name string
+		ip   string
+		want GeoInfo
+	}{
+		{"found in database   ", "203.0.113.5", GeoInfo{Country: "DE", Region: "Berlin State", City: "Berlin", ASN: 64500, ASOrg: "Example Org"}},
+		{"built-in fallback   ", "1.1.1.1", GeoInfo{Country: "AU"}},
+		{"not found anywhere  ", "127.0.0.1", GeoInfo{}},
+		{"IPv6 not in database", "::1", GeoInfo{}},
+		{"invalid address     ", "blah.blah", GeoInfo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GeoByIP(tt.ip); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("GeoByIP() = %#v, want %#v", *got, tt.want)
+			}
+		})
+	}
+}
+
 func TestHMACSign(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -307,6 +482,24 @@ func TestHTMLDocumentTitle(t *testing.T) {
 	}
 }
 
+func TestHashPassword(t *testing.T) {
+	h, err := HashPassword("Passw0rd!")
+	if err != nil {
+		t.Fatalf("HashPassword() failed: %v", err)
+	}
+	if !strings.HasPrefix(h, "$argon2id$v=19$") {
+		t.Errorf("HashPassword() = %q, want an argon2id hash", h)
+	}
+	// The hash must fit into the password_hash column
+	if len(h) > 100 {
+		t.Errorf("HashPassword() hash length = %d, want <= 100", len(h))
+	}
+	// Hashes must be salted
+	if h2, _ := HashPassword("Passw0rd!"); h2 == h {
+		t.Errorf("HashPassword() produced the same hash twice: %q", h)
+	}
+}
+
 func TestIf_bool(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -367,6 +560,90 @@ func TestIf_string(t *testing.T) {
 	}
 }
 
+func TestIsBcryptPasswordHash(t *testing.T) {
+	bcryptMin, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	argon, _ := HashPassword("secret")
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"empty     ", "", false},
+		{"plain text", "secret", false},
+		{"argon2id  ", argon, false},
+		{"malformed ", "$2a$10$foo", false},
+		{"huge cost ", strings.Replace(string(bcryptMin), "$04$", "$31$", 1), false},
+		{"valid     ", string(bcryptMin), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsBcryptPasswordHash(tt.hash); got != tt.want {
+				t.Errorf("IsBcryptPasswordHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicHost(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{"empty       ", "", false},
+		{"loopback    ", "127.0.0.1", false},
+		{"localhost   ", "localhost", false},
+		{"private     ", "10.1.2.3", false},
+		{"link-local  ", "169.254.169.254", false},
+		{"unspecified ", "::", false},
+		{"unresolvable", "host.invalid", false},
+		{"public IPv4 ", "93.184.215.14", true},
+		{"public IPv6 ", "2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPublicHost(tt.host); got != tt.want {
+				t.Errorf("IsPublicHost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"invalid             ", "foo", false},
+		{"IPv4 unspecified    ", "0.0.0.0", false},
+		{"IPv4 loopback       ", "127.0.0.1", false},
+		{"IPv4 loopback other ", "127.10.20.30", false},
+		{"IPv4 private 10     ", "10.0.0.1", false},
+		{"IPv4 private 172    ", "172.16.5.4", false},
+		{"IPv4 private 192    ", "192.168.1.1", false},
+		{"IPv4 link-local     ", "169.254.169.254", false},
+		{"IPv4 multicast      ", "224.0.0.251", false},
+		{"IPv4 public         ", "8.8.8.8", true},
+		{"IPv4 public 172     ", "172.32.0.1", true},
+		{"IPv6 unspecified    ", "::", false},
+		{"IPv6 loopback       ", "::1", false},
+		{"IPv6 unique local   ", "fd00::1", false},
+		{"IPv6 link-local     ", "fe80::1", false},
+		{"IPv6 multicast      ", "ff02::1", false},
+		{"IPv6 mapped loopback", "::ffff:127.0.0.1", false},
+		{"IPv6 mapped private ", "::ffff:10.0.0.1", false},
+		{"IPv6 public         ", "2001:4860:4860::8888", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IsPublicIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsStrongPassword(t *testing.T) {
 	tests := []struct {
 		name string
@@ -390,6 +667,47 @@ func TestIsStrongPassword(t *testing.T) {
 	}
 }
 
+func TestIsPwnedPassword(t *testing.T) {
+	// Prepare a list with a hash (of "P@ssw0rd"), a hash with a count (of "Passw0rd!"), and a plain-text password
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	list := "21BD12DC183F740EE76F27B78EB39C8AD972A757\r\n\n" +
+		"f4a69973e7b0bf9d160f9f60e3c3acd2494beb0d:42\n" +
+		"Qwerty123!\n"
+	if err := os.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	// Load the list
+	if err := ConfigurePwnedPasswords(path); err != nil {
+		t.Fatalf("ConfigurePwnedPasswords() failed: %v", err)
+	}
+	defer func() { _ = ConfigurePwnedPasswords("") }()
+
+	tests := []struct {
+		name string
+		pwd  string
+		want bool
+	}{
+		{"hash      ", "P@ssw0rd", true},
+		{"hash+count", "Passw0rd!", true},
+		{"plain text", "Qwerty123!", true},
+		{"not listed", "No1+kNows", false},
+		{"empty     ", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPwnedPassword(tt.pwd); got != tt.want {
+				t.Errorf("IsPwnedPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A missing file fails to load
+	if err := ConfigurePwnedPasswords(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("ConfigurePwnedPasswords() didn't fail for a missing file")
+	}
+}
+
 func TestIsValidEmail(t *testing.T) {
 	tests := []struct {
 		s    string
@@ -706,6 +1024,283 @@ func TestIsValidURL(t *testing.T) {
 	}
 }
 
+func TestJWTParseKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() failed: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	pemKey := func(typ string, b []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}))
+	}
+	pkix := func(k any) []byte {
+		b, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatalf("MarshalPKIXPublicKey() failed: %v", err)
+		}
+		return b
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	x, y := make([]byte, 32), make([]byte, 32)
+	ecKey.X.FillBytes(x)
+	ecKey.Y.FillBytes(y)
+
+	tests := []struct {
+		name    string
+		s       string
+		wantIDs []string
+		wantErr bool
+	}{
+		{"empty              ", "", nil, true},
+		{"PEM RSA PKIX       ", pemKey("PUBLIC KEY", pkix(&rsaKey.PublicKey)), []string{""}, false},
+		{"PEM RSA PKCS1      ", pemKey("RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)), []string{""}, false},
+		{"PEM EC + RSA       ", pemKey("PUBLIC KEY", pkix(&ecKey.PublicKey)) + pemKey("PUBLIC KEY", pkix(&rsaKey.PublicKey)), []string{"", ""}, false},
+		{"PEM EC P-384       ", pemKey("PUBLIC KEY", pkix(&ec384Key.PublicKey)), nil, true},
+		{"PEM private key    ", pemKey("PRIVATE KEY", []byte{1}), nil, true},
+		{"PEM garbage        ", pemKey("PUBLIC KEY", []byte{1, 2, 3}), nil, true},
+		{"JWKS               ", `{"keys":[` +
+			`{"kty":"RSA","kid":"r1","use":"sig","n":"` + b64(rsaKey.N.Bytes()) + `","e":"AQAB"},` +
+			`{"kty":"EC","kid":"e1","crv":"P-256","x":"` + b64(x) + `","y":"` + b64(y) + `"},` +
+			`{"kty":"RSA","kid":"enc","use":"enc","n":"` + b64(rsaKey.N.Bytes()) + `","e":"AQAB"},` +
+			`{"kty":"oct","kid":"sym"}]}`, []string{"r1", "e1"}, false},
+		{"JWKS no keys       ", `{"keys":[]}`, nil, true},
+		{"JWKS off-curve     ", `{"keys":[{"kty":"EC","crv":"P-256","x":"` + b64(x) + `","y":"` + b64(x) + `"}]}`, nil, true},
+		{"JWKS bad curve     ", `{"keys":[{"kty":"EC","crv":"P-521","x":"AA","y":"AA"}]}`, nil, true},
+		{"JWKS invalid JSON  ", `{"keys":`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JWTParseKeys(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JWTParseKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var ids []string
+			for _, k := range got {
+				ids = append(ids, k.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("JWTParseKeys() key IDs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() failed: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	// sign produces a token with the given header and claims
+	sign := func(alg, kid, claims string, key crypto.Signer) string {
+		s := b64([]byte(`{"alg":"`+alg+`","kid":"`+kid+`"}`)) + "." + b64([]byte(claims))
+		h := sha256.Sum256([]byte(s))
+		var sig []byte
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, h[:]); err != nil {
+				t.Fatalf("SignPKCS1v15() failed: %v", err)
+			}
+		case *ecdsa.PrivateKey:
+			r, s, err := ecdsa.Sign(rand.Reader, k, h[:])
+			if err != nil {
+				t.Fatalf("ecdsa.Sign() failed: %v", err)
+			}
+			sig = make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		}
+		return s + "." + b64(sig)
+	}
+
+	now := time.Unix(1700000000, 0)
+	keys := []*JWTKey{{ID: "rsa", Key: &rsaKey.PublicKey}, {ID: "ec", Key: &ecKey.PublicKey}}
+	claims := func(extra string) string { return `{"iss":"https://sso.example.com","aud":"comentario"` + extra + `}` }
+	valid := claims(`,"sub":"42","exp":1700000600`)
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"RS256 valid        ", sign("RS256", "rsa", valid, rsaKey), false},
+		{"RS256 no kid       ", sign("RS256", "", valid, rsaKey), false},
+		{"RS256 wrong kid    ", sign("RS256", "ec", valid, rsaKey), true},
+		{"ES256 valid        ", sign("ES256", "ec", valid, ecKey), false},
+		{"ES256 fractional   ", sign("ES256", "", claims(`,"exp":1700000000.5`), ecKey), false},
+		{"ES256 as RS256     ", sign("RS256", "", valid, ecKey), true},
+		{"alg none           ", sign("none", "", valid, ecKey), true},
+		{"unknown key        ", sign("ES256", "", valid, otherKey), true},
+		{"no exp             ", sign("ES256", "", claims(`,"sub":"42"`), ecKey), true},
+		{"expired            ", sign("ES256", "", claims(`,"exp":1699999000`), ecKey), true},
+		{"expired in leeway  ", sign("ES256", "", claims(`,"exp":1699999970`), ecKey), false},
+		{"not yet valid      ", sign("ES256", "", claims(`,"exp":1700000600,"nbf":1700000300`), ecKey), true},
+		{"issued in future   ", sign("ES256", "", claims(`,"exp":1700000600,"iat":1700000300`), ecKey), true},
+		{"audience in list   ", sign("ES256", "", `{"iss":"https://sso.example.com","aud":["foo","comentario"],"exp":1700000600}`, ecKey), false},
+		{"wrong audience     ", sign("ES256", "", `{"iss":"https://sso.example.com","aud":"foo","exp":1700000600}`, ecKey), true},
+		{"no audience        ", sign("ES256", "", `{"iss":"https://sso.example.com","exp":1700000600}`, ecKey), true},
+		{"wrong issuer       ", sign("ES256", "", `{"iss":"https://evil.example.com","aud":"comentario","exp":1700000600}`, ecKey), true},
+		{"no issuer          ", sign("ES256", "", `{"aud":"comentario","exp":1700000600}`, ecKey), true},
+		{"tampered claims    ", strings.Replace(sign("ES256", "", valid, ecKey), ".", "."+b64([]byte(`{"exp":1}`))+"x", 1), true},
+		{"malformed          ", "foo.bar", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JWTVerify(tt.token, keys, "https://sso.example.com", "comentario", now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("JWTVerify() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr && len(got) == 0 {
+				t.Error("JWTVerify() returned no claims")
+			}
+		})
+	}
+}
+
+func TestLDAPConn(t *testing.T) {
+	// Start a fake LDAP server that accepts a single bind and responds to searches with a single entry
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			// Read a request and decode its ID and operation
+			req, err := ber.ReadPacket(conn)
+			if err != nil || len(req.Children) < 2 {
+				return
+			}
+			id, op := req.Children[0].Value.(int64), req.Children[1]
+			reply := func(resp *ber.Packet) {
+				msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+				msg.AppendChild(resp)
+				_, _ = conn.Write(msg.Bytes())
+			}
+			result := func(tag ber.Tag, code int64) {
+				resp := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+				resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+				resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+				resp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+				reply(resp)
+			}
+			attr := func(name string, values ...string) *ber.Packet {
+				p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+				vs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+				for _, v := range values {
+					vs.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+				}
+				p.AppendChild(vs)
+				return p
+			}
+
+			switch op.Tag {
+			case ldap.ApplicationBindRequest:
+				dn, pwd := op.Children[1].Value.(string), op.Children[2].Data.String()
+				result(ldap.ApplicationBindResponse, If[int64](dn == "uid=joe,dc=example" && pwd == "secret", 0, 49))
+
+			case ldap.ApplicationSearchRequest:
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "uid=joe,dc=example", ""))
+				attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				attrs.AppendChild(attr("mail", "joe@example.com"))
+				attrs.AppendChild(attr("objectGUID", "\xff\x00\x10"))
+				attrs.AppendChild(attr("memberOf", "cn=a", "cn=b"))
+				entry.AppendChild(attrs)
+				reply(entry)
+				result(ldap.ApplicationSearchResultDone, 0)
+
+			default:
+				return
+			}
+		}
+	}()
+
+	// Connect to the server
+	c, err := LDAPDial("ldap://"+ln.Addr().String(), false, false, 5*time.Second)
+	if err != nil {
+		t.Fatalf("LDAPDial() failed: %v", err)
+	}
+	defer c.Close()
+
+	// Verify binding
+	if err := c.Bind("uid=joe,dc=example", ""); !LDAPIsInvalidCredentials(err) {
+		t.Errorf("Bind() with empty password: got error %v, want invalid credentials", err)
+	}
+	if err := c.Bind("uid=joe,dc=example", "wrong"); !LDAPIsInvalidCredentials(err) {
+		t.Errorf("Bind() with wrong password: got error %v, want invalid credentials", err)
+	}
+	if err := c.Bind("uid=joe,dc=example", "secret"); err != nil {
+		t.Errorf("Bind() failed: %v", err)
+	}
+
+	// Verify searching
+	es, err := c.Search("dc=example", "(uid=joe)", []string{"mail", "objectGUID", "memberOf"}, 2)
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	} else if len(es) != 1 {
+		t.Fatalf("Search() got %d entries, want 1", len(es))
+	}
+	e := es[0]
+	if e.DN != "uid=joe,dc=example" {
+		t.Errorf("Search() got DN = %v", e.DN)
+	}
+	if v := e.Value("MAIL"); v != "joe@example.com" {
+		t.Errorf("Value(mail) got = %v", v)
+	}
+	if v := e.Value("objectGUID"); v != "ff0010" {
+		t.Errorf("Value(objectGUID) got = %v, want hex-encoded value", v)
+	}
+	if v := e.Values("memberOf"); !reflect.DeepEqual(v, []string{"cn=a", "cn=b"}) {
+		t.Errorf("Values(memberOf) got = %v", v)
+	}
+	if v := e.Value("missing"); v != "" {
+		t.Errorf("Value(missing) got = %v, want empty", v)
+	}
+}
+
+func TestLDAPEscapeFilterValue(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"empty  ", "", ""},
+		{"plain  ", "joe.doe@example.com", "joe.doe@example.com"},
+		{"special", "*)(uid=*", "\\2a\\29\\28uid=\\2a"},
+		{"escape ", "a\\b\x00", "a\\5cb\\00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LDAPEscapeFilterValue(tt.s); got != tt.want {
+				t.Errorf("LDAPEscapeFilterValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMarkdownToHTML(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -779,6 +1374,50 @@ func TestMaskIP(t *testing.T) {
 	}
 }
 
+func TestPasswordNeedsRehash(t *testing.T) {
+	argon, _ := HashPassword("secret")
+	bcryptDef, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.DefaultCost)
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{"empty                ", "", false},
+		{"unknown              ", "foo", false},
+		{"argon2id, current    ", argon, false},
+		{"argon2id, weaker     ", "$argon2id$v=19$m=4096,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", true},
+		{"argon2id, stronger   ", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", false},
+		{"argon2id, malformed  ", "$argon2id$v=19$m=65536$foo", true},
+		{"bcrypt, default cost ", string(bcryptDef), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PasswordNeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("PasswordNeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// The default client connects to the local server, whereas the public one refuses to
+	if res, err := http.Get(srv.URL); err != nil {
+		t.Fatalf("http.Get() failed: %v", err)
+	} else {
+		_ = res.Body.Close()
+	}
+	res, err := PublicHTTPClient(time.Second).Get(srv.URL)
+	if err == nil {
+		_ = res.Body.Close()
+		t.Fatalf("PublicHTTPClient().Get() succeeded, want error")
+	} else if !strings.Contains(err.Error(), "connecting to non-public address 127.0.0.1 is forbidden") {
+		t.Errorf("PublicHTTPClient().Get() error = %v", err)
+	}
+}
+
 func TestRandomBytesLength(t *testing.T) {
 	tests := []struct {
 		name string
@@ -892,6 +1531,66 @@ func TestStrToFloatDef(t *testing.T) {
 	}
 }
 
+func TestTOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238, appendix B (SHA-1 variant)
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	tests := []struct {
+		name string
+		ts   int64
+		want string
+	}{
+		{"59         ", 59, "94287082"},
+		{"1111111109 ", 1111111109, "07081804"},
+		{"1111111111 ", 1111111111, "14050471"},
+		{"1234567890 ", 1234567890, "89005924"},
+		{"2000000000 ", 2000000000, "69279037"},
+		{"20000000000", 20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.ts, 0)), 8); err != nil {
+				t.Errorf("TOTPCode() errored: %v", err)
+			} else if got != tt.want {
+				t.Errorf("TOTPCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTOTPVerify(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+	code := func(step int64) string {
+		c, _ := TOTPCode(secret, step, TOTPDigits)
+		return c
+	}
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		want     int64
+	}{
+		{"empty code       ", "", 0, 0},
+		{"wrong length     ", "1234", 0, 0},
+		{"current step     ", code(step), 0, step},
+		{"previous step    ", code(step - 1), 0, step - 1},
+		{"next step        ", code(step + 1), 0, step + 1},
+		{"too old          ", code(step - 2), 0, 0},
+		{"too new          ", code(step + 2), 0, 0},
+		{"with spaces      ", code(step)[:3] + " " + code(step)[3:], 0, step},
+		{"already used     ", code(step), step, 0},
+		{"after previous   ", code(step), step - 1, step},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TOTPVerify(secret, tt.code, now, tt.lastStep); got != tt.want {
+				t.Errorf("TOTPVerify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestToStringSlice(t *testing.T) {
 	in := []strfmt.UUID{"foo", "", "bar"}
 	want := []string{"foo", "", "bar"}
@@ -989,3 +1688,181 @@ func TestUserIP(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyPassword(t *testing.T) {
+	argon, _ := HashPassword("secret")
+	bcryptMin, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	tests := []struct {
+		name string
+		hash string
+		pwd  string
+		want bool
+	}{
+		{"empty hash         ", "", "", false},
+		{"unknown hash       ", "secret", "secret", false},
+		{"argon2id, match    ", argon, "secret", true},
+		{"argon2id, mismatch ", argon, "Secret", false},
+		{"argon2id, empty pwd", argon, "", false},
+		{"argon2id, malformed", "$argon2id$v=19$m=65536,t=3,p=2$!!!$!!!", "secret", false},
+		{"argon2id, bad ver  ", strings.Replace(argon, "v=19", "v=16", 1), "secret", false},
+		{"argon2id, huge mem ", strings.Replace(argon, "m=19456", "m=4194304", 1), "secret", false},
+		{"argon2id, many iter", strings.Replace(argon, "t=2", "t=1000", 1), "secret", false},
+		{"bcrypt, huge cost  ", strings.Replace(string(bcryptMin), "$04$", "$31$", 1), "secret", false},
+		{"bcrypt, match      ", string(bcryptMin), "secret", true},
+		{"bcrypt, mismatch   ", string(bcryptMin), "Secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPassword(tt.hash, tt.pwd); got != tt.want {
+				t.Errorf("VerifyPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// webAuthnAuthenticator is a software WebAuthn authenticator holding a single P-256 credential
+type webAuthnAuthenticator struct {
+	key     *ecdsa.PrivateKey
+	credID  []byte
+	coseKey []byte
+}
+
+// newWebAuthnAuthenticator returns a new webAuthnAuthenticator
+func newWebAuthnAuthenticator(t *testing.T) *webAuthnAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return &webAuthnAuthenticator{
+		key:     key,
+		credID:  []byte("credential-id"),
+		coseKey: mustHexDecode("a5010203262001215820" + hex.EncodeToString(x) + "225820" + hex.EncodeToString(y)),
+	}
+}
+
+// authData returns authenticator data for the given relying party ID, flags, and counter, with attested credential
+// data if attested is true
+func (a *webAuthnAuthenticator) authData(rpID string, flags byte, count uint32, attested bool) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	b := append(h[:], flags, byte(count>>24), byte(count>>16), byte(count>>8), byte(count))
+	if attested {
+		b[32] |= 0x40
+		b = append(b, make([]byte, 16)...) // AAGUID
+		b = append(b, 0, byte(len(a.credID)))
+		b = append(append(b, a.credID...), a.coseKey...)
+	}
+	return b
+}
+
+// clientData returns client data JSON of the given ceremony type, challenge, and origin
+func (a *webAuthnAuthenticator) clientData(typ string, challenge []byte, origin string) []byte {
+	return []byte(`{"type":"` + typ + `","challenge":"` + WebAuthnEncoding.EncodeToString(challenge) + `","origin":"` + origin + `"}`)
+}
+
+// sign returns the assertion signature over the given authenticator data and client data
+func (a *webAuthnAuthenticator) sign(t *testing.T, authData, clientData []byte) []byte {
+	t.Helper()
+	cdh := sha256.Sum256(clientData)
+	h := sha256.Sum256(append(bytes.Clone(authData), cdh[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, h[:])
+	if err != nil {
+		t.Fatalf("SignASN1() failed: %v", err)
+	}
+	return sig
+}
+
+func TestWebAuthnRelyingParty_VerifyAssertion(t *testing.T) {
+	rp, err := NewWebAuthnRelyingParty(&url.URL{Scheme: "https", Host: "example.com"})
+	if err != nil {
+		t.Fatalf("NewWebAuthnRelyingParty() failed: %v", err)
+	}
+	a := newWebAuthnAuthenticator(t)
+	user, challenge := []byte("user-handle"), []byte("0123456789abcdef0123456789abcdef")
+	cd := a.clientData("webauthn.get", challenge, "https://example.com")
+	ad := a.authData("example.com", 0x01, 7, false)
+	sig := a.sign(t, ad, cd)
+	cred := &WebAuthnCredential{ID: a.credID, PublicKey: a.coseKey, SignCount: 5}
+
+	tests := []struct {
+		name       string
+		challenge  []byte
+		cred       *WebAuthnCredential
+		clientData []byte
+		authData   []byte
+		sig        []byte
+		want       uint32
+		wantErr    error
+	}{
+		{"valid                ", challenge, cred, cd, ad, sig, 7, nil},
+		{"no counter           ", challenge, &WebAuthnCredential{ID: a.credID, PublicKey: a.coseKey}, cd, a.authData("example.com", 0x01, 0, false), a.sign(t, a.authData("example.com", 0x01, 0, false), cd), 0, nil},
+		{"counter not increased", challenge, &WebAuthnCredential{ID: a.credID, PublicKey: a.coseKey, SignCount: 7}, cd, ad, sig, 0, ErrWebAuthnSignCount},
+		{"wrong challenge      ", []byte("fedcba9876543210fedcba9876543210"), cred, cd, ad, sig, 0, errors.New("")},
+		{"wrong type           ", challenge, cred, a.clientData("webauthn.create", challenge, "https://example.com"), ad, a.sign(t, ad, a.clientData("webauthn.create", challenge, "https://example.com")), 0, errors.New("")},
+		{"wrong origin         ", challenge, cred, a.clientData("webauthn.get", challenge, "https://example.org"), ad, a.sign(t, ad, a.clientData("webauthn.get", challenge, "https://example.org")), 0, errors.New("")},
+		{"wrong RP ID          ", challenge, cred, cd, a.authData("example.org", 0x01, 7, false), a.sign(t, a.authData("example.org", 0x01, 7, false), cd), 0, errors.New("")},
+		{"user not present     ", challenge, cred, cd, a.authData("example.com", 0, 7, false), a.sign(t, a.authData("example.com", 0, 7, false), cd), 0, errors.New("")},
+		{"tampered auth data   ", challenge, cred, cd, a.authData("example.com", 0x01, 8, false), sig, 0, errors.New("")},
+		{"bad signature        ", challenge, cred, cd, ad, sig[1:], 0, errors.New("")},
+		{"invalid key          ", challenge, &WebAuthnCredential{ID: a.credID, PublicKey: mustHexDecode("ff")}, cd, ad, sig, 0, errors.New("")},
+		{"not JSON             ", challenge, cred, []byte("foo"), ad, sig, 0, errors.New("")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rp.VerifyAssertion(user, tt.challenge, tt.cred, tt.clientData, tt.authData, tt.sig)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("VerifyAssertion() error = %v, wantErr %v", err, tt.wantErr)
+			} else if tt.wantErr == ErrWebAuthnSignCount && !errors.Is(err, ErrWebAuthnSignCount) {
+				t.Errorf("VerifyAssertion() error = %v, want %v", err, ErrWebAuthnSignCount)
+			} else if got != tt.want {
+				t.Errorf("VerifyAssertion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebAuthnRelyingParty_VerifyRegistration(t *testing.T) {
+	rp, err := NewWebAuthnRelyingParty(&url.URL{Scheme: "https", Host: "example.com"})
+	if err != nil {
+		t.Fatalf("NewWebAuthnRelyingParty() failed: %v", err)
+	}
+	a := newWebAuthnAuthenticator(t)
+	user, challenge := []byte("user-handle"), []byte("0123456789abcdef0123456789abcdef")
+	cd := a.clientData("webauthn.create", challenge, "https://example.com")
+
+	// attestation returns a CBOR-encoded "none" attestation object with the given authenticator data
+	attestation := func(authData []byte) []byte {
+		return mustHexDecode("a363666d74646e6f6e656761747453746d74a068617574684461746159" +
+			hex.EncodeToString([]byte{byte(len(authData) >> 8), byte(len(authData))}) + hex.EncodeToString(authData))
+	}
+
+	tests := []struct {
+		name        string
+		clientData  []byte
+		attestation []byte
+		want        *WebAuthnCredential
+		wantErr     bool
+	}{
+		{"valid             ", cd, attestation(a.authData("example.com", 0x01, 3, true)), &WebAuthnCredential{ID: a.credID, PublicKey: a.coseKey, SignCount: 3}, false},
+		{"wrong type        ", a.clientData("webauthn.get", challenge, "https://example.com"), attestation(a.authData("example.com", 0x01, 0, true)), nil, true},
+		{"wrong challenge   ", a.clientData("webauthn.create", []byte("foo"), "https://example.com"), attestation(a.authData("example.com", 0x01, 0, true)), nil, true},
+		{"wrong origin      ", a.clientData("webauthn.create", challenge, "https://example.org"), attestation(a.authData("example.com", 0x01, 0, true)), nil, true},
+		{"wrong RP ID       ", cd, attestation(a.authData("example.org", 0x01, 0, true)), nil, true},
+		{"user not present  ", cd, attestation(a.authData("example.com", 0, 0, true)), nil, true},
+		{"no credential data", cd, attestation(a.authData("example.com", 0x01, 0, false)), nil, true},
+		{"not CBOR          ", cd, []byte{0xff}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rp.VerifyRegistration(user, challenge, tt.clientData, tt.attestation)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyRegistration() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VerifyRegistration() got = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"net/url"
+)
+
+// WebAuthnAlgorithms lists COSE algorithm identifiers of supported public key credentials, in the order of preference
+var WebAuthnAlgorithms = []webauthncose.COSEAlgorithmIdentifier{webauthncose.AlgES256, webauthncose.AlgEdDSA, webauthncose.AlgRS256}
+
+// WebAuthnEncoding is the encoding used for binary WebAuthn values exchanged with the client
+var WebAuthnEncoding = base64.RawURLEncoding
+
+// ErrWebAuthnSignCount is returned when the signature counter of an authenticator didn't increase, which may indicate
+// a cloned authenticator
+var ErrWebAuthnSignCount = errors.New("webauthn: signature counter didn't increase")
+
+// WebAuthnCredential is a registered public key credential
+type WebAuthnCredential struct {
+	ID        []byte // Credential ID
+	PublicKey []byte // COSE-encoded credential public key
+	SignCount uint32 // Signature counter
+}
+
+// WebAuthnRelyingParty verifies WebAuthn ceremonies on behalf of the relying party, i.e. the server
+type WebAuthnRelyingParty struct {
+	wa *webauthn.WebAuthn
+}
+
+// NewWebAuthnRelyingParty returns a new WebAuthnRelyingParty for the given base URL, whose host serves as the relying
+// party ID
+func NewWebAuthnRelyingParty(baseURL *url.URL) (*WebAuthnRelyingParty, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          baseURL.Hostname(),
+		RPDisplayName: ApplicationName,
+		RPOrigins:     []string{baseURL.Scheme + "://" + baseURL.Host},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnRelyingParty{wa: wa}, nil
+}
+
+// VerifyAssertion verifies a login ceremony made with the given credential of the user with the given handle, and
+// returns the new signature counter of the authenticator
+func (rp *WebAuthnRelyingParty) VerifyAssertion(userHandle, challenge []byte, cred *WebAuthnCredential, clientDataJSON, authData, sig []byte) (uint32, error) {
+	car := protocol.CredentialAssertionResponse{
+		PublicKeyCredential: webAuthnPublicKeyCredential(cred.ID),
+		AssertionResponse: protocol.AuthenticatorAssertionResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: clientDataJSON},
+			AuthenticatorData:     authData,
+			Signature:             sig,
+		},
+	}
+	par, err := car.Parse()
+	if err != nil {
+		return 0, err
+	}
+
+	// The backup eligibility of a credential isn't stored, so take it from the response
+	res, err := rp.wa.ValidateLogin(
+		&webAuthnUser{
+			id: userHandle,
+			creds: []webauthn.Credential{{
+				ID:            cred.ID,
+				PublicKey:     cred.PublicKey,
+				Flags:         webauthn.CredentialFlags{BackupEligible: par.Response.AuthenticatorData.Flags.HasBackupEligible()},
+				Authenticator: webauthn.Authenticator{SignCount: cred.SignCount},
+			}},
+		},
+		webAuthnSession(userHandle, challenge),
+		par)
+	if err != nil {
+		return 0, err
+	} else if res.Authenticator.CloneWarning {
+		return 0, ErrWebAuthnSignCount
+	}
+	return res.Authenticator.SignCount, nil
+}
+
+// VerifyRegistration verifies a registration ceremony for the user with the given handle, and returns the new
+// credential
+func (rp *WebAuthnRelyingParty) VerifyRegistration(userHandle, challenge, clientDataJSON, attestationObject []byte) (*WebAuthnCredential, error) {
+	resp := protocol.AuthenticatorAttestationResponse{
+		AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: clientDataJSON},
+		AttestationObject:     attestationObject,
+	}
+
+	// The client doesn't submit the credential ID separately, so take it from the attested credential data
+	par, err := resp.Parse()
+	if err != nil {
+		return nil, err
+	}
+	ccr := protocol.CredentialCreationResponse{
+		PublicKeyCredential: webAuthnPublicKeyCredential(par.AttestationObject.AuthData.AttData.CredentialID),
+		AttestationResponse: resp,
+	}
+	pcc, err := ccr.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the response
+	cred, err := rp.wa.CreateCredential(&webAuthnUser{id: userHandle}, webAuthnSession(userHandle, challenge), pcc)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnCredential{ID: cred.ID, PublicKey: cred.PublicKey, SignCount: cred.Authenticator.SignCount}, nil
+}
+
+// webAuthnPublicKeyCredential returns a public key credential with the given ID
+func webAuthnPublicKeyCredential(id []byte) protocol.PublicKeyCredential {
+	return protocol.PublicKeyCredential{
+		Credential: protocol.Credential{ID: WebAuthnEncoding.EncodeToString(id), Type: string(protocol.PublicKeyCredentialType)},
+		RawID:      id,
+	}
+}
+
+// webAuthnSession returns the session data of a ceremony with the given challenge for the user with the given handle
+func webAuthnSession(userHandle, challenge []byte) webauthn.SessionData {
+	params := make([]protocol.CredentialParameter, len(WebAuthnAlgorithms))
+	for i, alg := range WebAuthnAlgorithms {
+		params[i] = protocol.CredentialParameter{Type: protocol.PublicKeyCredentialType, Algorithm: alg}
+	}
+	return webauthn.SessionData{
+		Challenge:        WebAuthnEncoding.EncodeToString(challenge),
+		UserID:           userHandle,
+		UserVerification: protocol.VerificationPreferred,
+		CredParams:       params,
+	}
+}
+
+// webAuthnUser is a user taking part in a WebAuthn ceremony
+type webAuthnUser struct {
+	id    []byte                // User handle
+	creds []webauthn.Credential // User's credentials
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.id
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.creds
+}